@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"srv/database"
+	"srv/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// accessError reports that the current user may not access an item, along
+// with the status to respond with
+type accessError struct {
+	status int
+	title  string
+}
+
+func (e accessError) Error() string {
+	return e.title
+}
+
+// findDocument loads a document the user holds at least the required role on,
+// applying scopes such as preloadTags to the query. Documents the user has no
+// role on at all are reported as not found, so that their existence isn't
+// revealed.
+func findDocument(db *gorm.DB, userID, id uuid.UUID, required string, scopes ...func(*gorm.DB) *gorm.DB) (models.Document, error) {
+	var document models.Document
+	if err := db.Scopes(scopes...).Scopes(database.AccessibleDocuments(userID)).First(&document, "documents.id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.WithField("id", id).Warn("Document not found")
+			return models.Document{}, accessError{http.StatusNotFound, "Document not found"}
+		}
+		return models.Document{}, err
+	}
+
+	role, err := database.DocumentRole(db, userID, document)
+	if err != nil {
+		return models.Document{}, err
+	}
+	if !models.RoleAtLeast(role, required) {
+		logrus.WithFields(logrus.Fields{"id": id, "role": role}).Warn("Insufficient role on document")
+		return models.Document{}, accessError{http.StatusForbidden, "Requires " + required + " access to the document"}
+	}
+
+	return document, nil
+}
+
+// findFolder loads a folder the user holds at least the required role on,
+// applying scopes to the query. Folders the user has no role on at all are
+// reported as not found.
+func findFolder(db *gorm.DB, userID, id uuid.UUID, required string, scopes ...func(*gorm.DB) *gorm.DB) (models.Folder, error) {
+	var folder models.Folder
+	if err := db.Scopes(scopes...).Scopes(database.AccessibleFolders(userID)).First(&folder, "folders.id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.WithField("id", id).Warn("Folder not found")
+			return models.Folder{}, accessError{http.StatusNotFound, "Folder not found"}
+		}
+		return models.Folder{}, err
+	}
+
+	role, err := database.FolderRole(db, userID, folder)
+	if err != nil {
+		return models.Folder{}, err
+	}
+	if !models.RoleAtLeast(role, required) {
+		logrus.WithFields(logrus.Fields{"id": id, "role": role}).Warn("Insufficient role on folder")
+		return models.Folder{}, accessError{http.StatusForbidden, "Requires " + required + " access to the folder"}
+	}
+
+	return folder, nil
+}
+
+// accessHTTPError converts an error of findDocument or findFolder into an
+// api2go error, keeping the status of access errors
+func accessHTTPError(err error) error {
+	var access accessError
+	if errors.As(err, &access) {
+		return newHTTPError(err, access.title, access.status)
+	}
+	logrus.WithError(err).Error("Failed to check access")
+	return newHTTPError(err, err.Error(), http.StatusInternalServerError)
+}
+
+// writeAccessError writes the response for an error of findDocument or findFolder
+func writeAccessError(w http.ResponseWriter, err error) {
+	var access accessError
+	if errors.As(err, &access) {
+		writeError(w, access.status, access.title)
+		return
+	}
+	logrus.WithError(err).Error("Failed to check access")
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// findRequestDocument loads a document the authenticated user holds at least
+// the required role on, writing an error response if it can't
+func findRequestDocument(db *gorm.DB, w http.ResponseWriter, r *http.Request, id string, required string, scopes ...func(*gorm.DB) *gorm.DB) (models.Document, bool) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return models.Document{}, false
+	}
+
+	documentID, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid document ID")
+		writeError(w, http.StatusBadRequest, "Invalid document ID")
+		return models.Document{}, false
+	}
+
+	document, err := findDocument(db, userID, documentID, required, scopes...)
+	if err != nil {
+		writeAccessError(w, err)
+		return models.Document{}, false
+	}
+
+	return document, true
+}
+
+// findRequestFolder loads a folder the authenticated user holds at least the
+// required role on, writing an error response if it can't
+func findRequestFolder(db *gorm.DB, w http.ResponseWriter, r *http.Request, id string, required string, scopes ...func(*gorm.DB) *gorm.DB) (models.Folder, bool) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return models.Folder{}, false
+	}
+
+	folderID, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid folder ID")
+		writeError(w, http.StatusBadRequest, "Invalid folder ID")
+		return models.Folder{}, false
+	}
+
+	folder, err := findFolder(db, userID, folderID, required, scopes...)
+	if err != nil {
+		writeAccessError(w, err)
+		return models.Folder{}, false
+	}
+
+	return folder, true
+}
+
+// itemOwner returns the owner of a folder, or of a document when folderID is
+// nil, provided that the user holds the owner role on it
+func itemOwner(db *gorm.DB, userID uuid.UUID, folderID, documentID *uuid.UUID) (uuid.UUID, error) {
+	if folderID != nil {
+		folder, err := findFolder(db, userID, *folderID, models.RoleOwner)
+		return folder.UserID, err
+	}
+	document, err := findDocument(db, userID, *documentID, models.RoleOwner)
+	return document.UserID, err
+}
+
+// sameFolder reports whether two optional folder IDs refer to the same folder,
+// where nil stands for the root
+func sameFolder(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"srv/models"
+	"srv/storage"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// multipartOverhead is the room allowed for multipart headers and boundaries
+// on top of the maximum attachment size
+const multipartOverhead = 1 << 20
+
+// AttachmentHandler serves the upload and download endpoints of document attachments
+type AttachmentHandler struct {
+	DB      *gorm.DB
+	Blobs   storage.Storage
+	MaxSize int64
+}
+
+// NewAttachmentHandler creates a new AttachmentHandler accepting files of up to maxSize bytes
+func NewAttachmentHandler(db *gorm.DB, blobs storage.Storage, maxSize int64) *AttachmentHandler {
+	return &AttachmentHandler{
+		DB:      db,
+		Blobs:   blobs,
+		MaxSize: maxSize,
+	}
+}
+
+// Register adds the attachment routes to the router
+func (h AttachmentHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/documents/:id/attachments", h.List)
+	router.Handle(http.MethodPost, prefix+"/documents/:id/attachments", h.Upload)
+	router.Handle(http.MethodGet, prefix+"/documents/:id/attachments/:attachment_id", h.Get)
+	router.Handle(http.MethodGet, prefix+"/documents/:id/attachments/:attachment_id/content", h.Download)
+	router.Handle(http.MethodDelete, prefix+"/documents/:id/attachments/:attachment_id", h.Delete)
+}
+
+// List returns the attachments of a document, oldest first
+func (h AttachmentHandler) List(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	logrus.WithField("id", document.ID).Info("Finding document attachments")
+
+	var attachments []models.Attachment
+	if err := h.DB.Where("document_id = ?", document.ID).Order("created_at").Order("id").Find(&attachments).Error; err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to find document attachments")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, attachments, nil)
+}
+
+// Upload stores the file sent in the `file` part of a multipart/form-data
+// request as a new attachment of the document
+func (h AttachmentHandler) Upload(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid attachment upload")
+		writeError(w, http.StatusBadRequest, "Expected a multipart/form-data request")
+		return
+	}
+
+	// Skip ahead to the file part
+	var part *multipart.Part
+	for {
+		part, err = reader.NextPart()
+		if err == io.EOF {
+			writeError(w, http.StatusBadRequest, "Missing file part")
+			return
+		}
+		if err != nil {
+			h.writeUploadError(w, err)
+			return
+		}
+		if part.FormName() == "file" {
+			break
+		}
+	}
+	contentType := part.Header.Get("Content-Type")
+
+	filename := part.FileName()
+	if filename == "" || len(filename) > 255 {
+		writeError(w, http.StatusBadRequest, "File name must be between 1 and 255 characters")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":       document.ID,
+		"filename": filename,
+	}).Info("Uploading attachment")
+
+	// Spool the upload to disk, hashing it and enforcing the size limit on the way
+	file, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create temporary file")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(part, h.MaxSize+1))
+	if err != nil {
+		h.writeUploadError(w, err)
+		return
+	}
+	if size > h.MaxSize {
+		logrus.WithField("id", document.ID).Warn("Attachment too large")
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Attachment exceeds the maximum size of %d bytes", h.MaxSize))
+		return
+	}
+
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType, err = sniffContentType(file)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to read temporary file")
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		logrus.WithError(err).Error("Failed to rewind temporary file")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	userID, _ := requestUserID(r)
+	attachment := models.Attachment{
+		ID:          uuid.New(),
+		DocumentID:  document.ID,
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}
+	attachment.StorageKey = attachmentStorageKey(attachment)
+
+	// Store the blob before the row so that no attachment ever lacks its content
+	if err := h.Blobs.Put(r.Context(), attachment.StorageKey, file, size, contentType); err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to store attachment")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := h.DB.Create(&attachment).Error; err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to create attachment")
+		if err := h.Blobs.Delete(r.Context(), attachment.StorageKey); err != nil {
+			logrus.WithError(err).WithField("key", attachment.StorageKey).Error("Failed to delete orphaned blob")
+		}
+		writeConstraintError(w, err)
+		return
+	}
+
+	writeResponse(w, http.StatusCreated, attachment, nil)
+}
+
+// Get returns the metadata of an attachment
+func (h AttachmentHandler) Get(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	attachment, ok := h.findAttachment(w, r, params, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeResponse(w, http.StatusOK, attachment, nil)
+}
+
+// Download streams the content of an attachment. The SHA-256 hash serves as
+// the ETag, so clients can revalidate with If-None-Match.
+func (h AttachmentHandler) Download(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	attachment, ok := h.findAttachment(w, r, params, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	etag := `"` + attachment.SHA256 + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	streamAttachment(w, r, h.Blobs, attachment)
+}
+
+// Delete permanently deletes an attachment and its content
+func (h AttachmentHandler) Delete(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	attachment, ok := h.findAttachment(w, r, params, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	logrus.WithField("id", attachment.ID).Info("Deleting attachment")
+
+	if err := h.DB.Delete(&attachment).Error; err != nil {
+		logrus.WithError(err).WithField("id", attachment.ID).Error("Failed to delete attachment")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The attachment is gone either way, so failing to delete the blob only leaves it orphaned
+	if err := h.Blobs.Delete(r.Context(), attachment.StorageKey); err != nil {
+		logrus.WithError(err).WithField("key", attachment.StorageKey).Error("Failed to delete attachment content")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findAttachment loads an attachment of a document the authenticated user holds
+// at least the required role on, writing an error response if it can't
+func (h AttachmentHandler) findAttachment(w http.ResponseWriter, r *http.Request, params map[string]string, required string) (models.Attachment, bool) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], required)
+	if !ok {
+		return models.Attachment{}, false
+	}
+
+	attachmentID, err := uuid.Parse(params["attachment_id"])
+	if err != nil {
+		logrus.WithError(err).WithField("attachment_id", params["attachment_id"]).Error("Invalid attachment ID")
+		writeError(w, http.StatusBadRequest, "Invalid attachment ID")
+		return models.Attachment{}, false
+	}
+
+	var attachment models.Attachment
+	if err := h.DB.First(&attachment, "id = ? AND document_id = ?", attachmentID, document.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("attachment_id", attachmentID).Warn("Attachment not found")
+			writeError(w, http.StatusNotFound, "Attachment not found")
+			return models.Attachment{}, false
+		}
+		logrus.WithError(err).WithField("attachment_id", attachmentID).Error("Failed to find attachment")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return models.Attachment{}, false
+	}
+
+	return attachment, true
+}
+
+// streamAttachment writes the content of an attachment as a file download
+func streamAttachment(w http.ResponseWriter, r *http.Request, blobs storage.Storage, attachment models.Attachment) {
+	logrus.WithField("id", attachment.ID).Info("Downloading attachment")
+
+	blob, err := blobs.Get(r.Context(), attachment.StorageKey)
+	if err != nil {
+		logrus.WithError(err).WithField("id", attachment.ID).Error("Failed to open attachment content")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("ETag", `"`+attachment.SHA256+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, blob); err != nil {
+		logrus.WithError(err).WithField("id", attachment.ID).Error("Failed to stream attachment content")
+	}
+}
+
+// writeUploadError writes the error response for an upload that could not be read
+func (h AttachmentHandler) writeUploadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		logrus.Warn("Attachment upload too large")
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Attachment exceeds the maximum size of %d bytes", h.MaxSize))
+		return
+	}
+	logrus.WithError(err).Warn("Failed to read attachment upload")
+	writeError(w, http.StatusBadRequest, "Failed to read upload")
+}
+
+// sniffContentType detects the media type of a file from its first bytes
+func sniffContentType(file *os.File) (string, error) {
+	head := make([]byte, 512)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// attachmentStorageKey returns the key the blob of an attachment is stored under
+func attachmentStorageKey(attachment models.Attachment) string {
+	return "attachments/" + attachment.DocumentID.String() + "/" + attachment.ID.String()
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"srv/storage"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachmentHandler(t *testing.T) {
+	// Setup test database and storage
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+	blobs := newTestStorage(t)
+
+	// Create handlers and document resource
+	handler := NewAttachmentHandler(db, blobs, 64)
+	trash := NewTrashHandler(db, blobs)
+	documents := NewDocumentResource(db)
+
+	// Create test users
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "otheruser", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	resp, err := documents.Create(models.Document{Title: "Report"}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	doc := resp.Result().(models.Document)
+
+	// upload builds a multipart request with a single file part
+	upload := func(filename, contentType string, content []byte, userID uuid.UUID) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		part, err := writer.CreatePart(header)
+		require.NoError(t, err, "Failed to create file part")
+		_, err = part.Write(content)
+		require.NoError(t, err, "Failed to write file part")
+		require.NoError(t, writer.Close(), "Failed to close multipart writer")
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		handler.Upload(rec, req, map[string]string{"id": doc.ID.String()}, nil)
+		return rec
+	}
+
+	serve := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), params map[string]string, header http.Header, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		h(rec, req, params, nil)
+		return rec
+	}
+
+	type attributes map[string]interface{}
+	decodeOne := func(rec *httptest.ResponseRecorder) (string, attributes) {
+		var body struct {
+			Data struct {
+				ID         string     `json:"id"`
+				Attributes attributes `json:"attributes"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		return body.Data.ID, body.Data.Attributes
+	}
+
+	content := []byte("quarterly numbers\n")
+	sum := sha256.Sum256(content)
+	var attachmentID string
+
+	// Test Upload
+	t.Run("Upload", func(t *testing.T) {
+		rec := upload("report.txt", "text/plain", content, user.ID)
+		require.Equal(t, http.StatusCreated, rec.Code, "Expected status code 201")
+
+		var attrs attributes
+		attachmentID, attrs = decodeOne(rec)
+		assert.Equal(t, "report.txt", attrs["filename"], "Expected filename")
+		assert.Equal(t, "text/plain", attrs["content_type"], "Expected content type")
+		assert.Equal(t, float64(len(content)), attrs["size"], "Expected size")
+		assert.Equal(t, hex.EncodeToString(sum[:]), attrs["sha256"], "Expected content hash")
+		assert.NotContains(t, attrs, "storage_key", "Expected storage key to be hidden")
+	})
+
+	// Test that a missing content type is detected from the content
+	t.Run("SniffContentType", func(t *testing.T) {
+		rec := upload("page", "application/octet-stream", []byte("<html><body>hi</body></html>"), user.ID)
+		require.Equal(t, http.StatusCreated, rec.Code, "Expected status code 201")
+		_, attrs := decodeOne(rec)
+		assert.Equal(t, "text/html; charset=utf-8", attrs["content_type"], "Expected sniffed content type")
+	})
+
+	// Test that files over the size limit are rejected without being stored
+	t.Run("TooLarge", func(t *testing.T) {
+		var count int64
+		require.NoError(t, db.Model(&models.Attachment{}).Count(&count).Error, "Failed to count attachments")
+
+		rec := upload("big.bin", "", bytes.Repeat([]byte("x"), 65), user.ID)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "Expected status code 413")
+
+		var after int64
+		require.NoError(t, db.Model(&models.Attachment{}).Count(&after).Error, "Failed to count attachments")
+		assert.Equal(t, count, after, "Expected no attachment to be created")
+	})
+
+	// Test that uploads must be multipart
+	t.Run("NotMultipart", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("plain"))
+		req.Header.Set("Content-Type", "text/plain")
+		req = req.WithContext(auth.WithUserID(req.Context(), user.ID))
+		rec := httptest.NewRecorder()
+		handler.Upload(rec, req, map[string]string{"id": doc.ID.String()}, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+	})
+
+	// Test List
+	t.Run("List", func(t *testing.T) {
+		rec := serve(handler.List, map[string]string{"id": doc.ID.String()}, nil, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		var body struct {
+			Data []struct {
+				Attributes attributes `json:"attributes"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		require.Equal(t, 2, len(body.Data), "Expected two attachments")
+		assert.Equal(t, "report.txt", body.Data[0].Attributes["filename"], "Expected oldest attachment first")
+	})
+
+	// Test Download
+	t.Run("Download", func(t *testing.T) {
+		params := map[string]string{"id": doc.ID.String(), "attachment_id": attachmentID}
+		rec := serve(handler.Download, params, nil, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, content, rec.Body.Bytes(), "Expected attachment content")
+		assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"), "Expected content type header")
+		assert.Equal(t, `attachment; filename=report.txt`, rec.Header().Get("Content-Disposition"), "Expected content disposition header")
+
+		etag := rec.Header().Get("ETag")
+		assert.Equal(t, `"`+hex.EncodeToString(sum[:])+`"`, etag, "Expected content hash as ETag")
+
+		rec = serve(handler.Download, params, http.Header{"If-None-Match": {etag}}, user.ID)
+		assert.Equal(t, http.StatusNotModified, rec.Code, "Expected status code 304")
+		assert.Empty(t, rec.Body.Bytes(), "Expected no content")
+	})
+
+	// Test that other users cannot see attachments
+	t.Run("OtherUser", func(t *testing.T) {
+		rec := serve(handler.Get, map[string]string{"id": doc.ID.String(), "attachment_id": attachmentID}, nil, other.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+
+		rec = upload("x.txt", "text/plain", content, other.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+	})
+
+	// Test Get with an unknown attachment
+	t.Run("NotFound", func(t *testing.T) {
+		rec := serve(handler.Get, map[string]string{"id": doc.ID.String(), "attachment_id": uuid.New().String()}, nil, user.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+
+		rec = serve(handler.Get, map[string]string{"id": doc.ID.String(), "attachment_id": "invalid"}, nil, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+	})
+
+	// Test Delete
+	t.Run("Delete", func(t *testing.T) {
+		var attachment models.Attachment
+		require.NoError(t, db.First(&attachment, "id = ?", attachmentID).Error, "Failed to find attachment")
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), user.ID))
+		rec := httptest.NewRecorder()
+		handler.Delete(rec, req, map[string]string{"id": doc.ID.String(), "attachment_id": attachmentID}, nil)
+		require.Equal(t, http.StatusNoContent, rec.Code, "Expected status code 204")
+
+		_, err := blobs.Get(context.Background(), attachment.StorageKey)
+		assert.Equal(t, storage.ErrNotFound, err, "Expected blob to be deleted")
+	})
+
+	// Test that purging a document from the trash deletes its attachment blobs
+	t.Run("PurgeDocument", func(t *testing.T) {
+		var attachment models.Attachment
+		require.NoError(t, db.First(&attachment, "document_id = ?", doc.ID).Error, "Failed to find attachment")
+
+		_, err := documents.Delete(doc.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to delete document")
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), user.ID))
+		rec := httptest.NewRecorder()
+		trash.PurgeDocument(rec, req, map[string]string{"id": doc.ID.String()}, nil)
+		require.Equal(t, http.StatusNoContent, rec.Code, "Expected status code 204")
+
+		var count int64
+		require.NoError(t, db.Model(&models.Attachment{}).Count(&count).Error, "Failed to count attachments")
+		assert.Equal(t, int64(0), count, "Expected attachments to be deleted")
+
+		_, err = blobs.Get(context.Background(), attachment.StorageKey)
+		assert.Equal(t, storage.ErrNotFound, err, "Expected blob to be deleted")
+	})
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"srv/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// AuditEntryResource serves the audit trail of the authenticated user: the
+// changes to the users, folders and documents they own, whoever made them,
+// and the changes they made to those of others. Entries are recorded by the
+// resources making the changes, so the resource is read-only.
+type AuditEntryResource struct {
+	DB *gorm.DB
+}
+
+// auditEntrySortFields are the attributes audit entries can be sorted by
+var auditEntrySortFields = map[string]sortField{
+	"action":      {Column: "action"},
+	"target_type": {Column: "target_type"},
+	"created_at":  {Column: "created_at", Time: true},
+}
+
+// NewAuditEntryResource creates a new AuditEntryResource
+func NewAuditEntryResource(db *gorm.DB) *AuditEntryResource {
+	return &AuditEntryResource{
+		DB: db,
+	}
+}
+
+// FindAll returns the audit entries visible to the authenticated user
+func (r AuditEntryResource) FindAll(req api2go.Request) (api2go.Responder, error) {
+	logrus.Info("Finding all audit entries")
+
+	result, err := r.findEntries(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of audit entries along with the total count
+func (r AuditEntryResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of audit entries")
+
+	result, err := r.findEntries(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findEntries loads the audit entries matching the request's filters, sort and
+// page, newest first by default. Entries can be filtered by action,
+// target_type, target_id and actor_id, and by creation time with since and
+// until.
+func (r AuditEntryResource) findEntries(req api2go.Request) (page[models.AuditEntry], error) {
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return page[models.AuditEntry]{}, err
+	}
+
+	query := r.DB.Model(&models.AuditEntry{}).Where("owner_id = ? OR actor_id = ?", currentUser, currentUser)
+
+	// Filter by action if provided
+	if actions, ok := req.QueryParams["filter[action]"]; ok && len(actions) > 0 {
+		for _, action := range actions {
+			if !slices.Contains(models.AuditActions, action) {
+				return page[models.AuditEntry]{}, newHTTPError(nil, "Action must be create, update, delete, restore or purge", http.StatusBadRequest)
+			}
+		}
+		query = query.Where("action IN ?", actions)
+	}
+
+	// Filter by target type if provided
+	if targetTypes, ok := req.QueryParams["filter[target_type]"]; ok && len(targetTypes) > 0 {
+		for _, targetType := range targetTypes {
+			if !slices.Contains(models.AuditTargetTypes, targetType) {
+				return page[models.AuditEntry]{}, newHTTPError(nil, "Target type must be user, folder or document", http.StatusBadRequest)
+			}
+		}
+		query = query.Where("target_type IN ?", targetTypes)
+	}
+
+	// Filter by target or actor if provided
+	for _, filter := range []struct{ param, column, message string }{
+		{"filter[target_id]", "target_id", "Invalid target ID"},
+		{"filter[actor_id]", "actor_id", "Invalid actor ID"},
+	} {
+		if values, ok := req.QueryParams[filter.param]; ok && len(values) > 0 {
+			id, err := uuid.Parse(values[0])
+			if err != nil {
+				logrus.WithError(err).WithField(filter.column, values[0]).Error(filter.message)
+				return page[models.AuditEntry]{}, newHTTPError(err, filter.message, http.StatusBadRequest)
+			}
+			query = query.Where(filter.column+" = ?", id)
+		}
+	}
+
+	// Filter by creation time if provided
+	for _, filter := range []struct{ param, condition string }{
+		{"filter[since]", "created_at >= ?"},
+		{"filter[until]", "created_at < ?"},
+	} {
+		if values, ok := req.QueryParams[filter.param]; ok && len(values) > 0 {
+			at, err := time.Parse(time.RFC3339, values[0])
+			if err != nil {
+				logrus.WithError(err).WithField(filter.param, values[0]).Error("Invalid time filter")
+				return page[models.AuditEntry]{}, newHTTPError(err, "Times must be in RFC 3339 format", http.StatusBadRequest)
+			}
+			query = query.Where(filter.condition, at.UTC())
+		}
+	}
+
+	opts, err := parseListOptions(req, auditEntrySortFields, []sortTerm{{sortField: auditEntrySortFields["created_at"], Desc: true}})
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.AuditEntry]{}, err
+	}
+
+	result, err := findPage[models.AuditEntry](query, opts)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find audit entries")
+		return page[models.AuditEntry]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return result, nil
+}
+
+// FindOne returns a single audit entry
+func (r AuditEntryResource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Finding audit entry")
+
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid audit entry ID")
+		return &api2go.Response{}, newHTTPError(err, "Invalid audit entry ID", http.StatusBadRequest)
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	var entry models.AuditEntry
+	err = r.DB.Where("owner_id = ? OR actor_id = ?", currentUser, currentUser).First(&entry, "id = ?", uuid).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", id).Warn("Audit entry not found")
+			return &api2go.Response{}, newHTTPError(err, "Audit entry not found", http.StatusNotFound)
+		}
+		logrus.WithError(err).WithField("id", id).Error("Failed to find audit entry")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return &api2go.Response{Res: entry, Code: http.StatusOK}, nil
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditTrail(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resources
+	users := NewUserResource(db)
+	folders := NewFolderResource(db)
+	documents := NewDocumentResource(db)
+
+	// recorded returns the audit entries recorded since the last call, oldest
+	// first. The entries are immutable, so they are cleared with raw SQL.
+	recorded := func(t *testing.T) []models.AuditEntry {
+		var entries []models.AuditEntry
+		require.NoError(t, db.Order("created_at, id").Find(&entries).Error, "Failed to find audit entries")
+		require.NoError(t, db.Exec("DELETE FROM audit_entries").Error, "Failed to clear audit entries")
+		return entries
+	}
+
+	resp, err := users.Create(models.User{Username: "owner", Email: "owner@example.com", Password: "password123"}, newRequest(uuid.Nil, nil))
+	require.NoError(t, err, "Failed to create owner")
+	owner := resp.Result().(models.User)
+
+	t.Run("UserCreated", func(t *testing.T) {
+		entries := recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the registration")
+		entry := entries[0]
+		assert.Equal(t, models.AuditCreate, entry.Action, "Expected a creation")
+		assert.Equal(t, "user", entry.TargetType, "Expected the user to be the target")
+		assert.Equal(t, owner.ID, entry.TargetID, "Expected the new user")
+		assert.Equal(t, owner.ID, entry.ActorID, "Expected the user to be the actor")
+		assert.Equal(t, owner.ID, entry.OwnerID, "Expected users to own their entries")
+		assert.Equal(t, models.AuditChange{After: "owner"}, entry.Changes["username"], "Expected the username")
+		assert.Equal(t, models.AuditChange{After: "[redacted]"}, entry.Changes["password"], "Expected the password without its value")
+		assert.NotContains(t, entry.Changes, "updated_at", "Expected no timestamps")
+	})
+
+	editor := models.User{Username: "editor", Email: "editor@example.com"}
+	require.NoError(t, db.Create(&editor).Error, "Failed to create editor")
+	tag := models.Tag{Name: "urgent", UserID: owner.ID}
+	require.NoError(t, db.Create(&tag).Error, "Failed to create tag")
+
+	var projects, archive models.Folder
+	t.Run("Folder", func(t *testing.T) {
+		resp, err := folders.Create(models.Folder{Name: "Projects"}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create folder")
+		projects = resp.Result().(models.Folder)
+		resp, err = folders.Create(models.Folder{Name: "Archive"}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create folder")
+		archive = resp.Result().(models.Folder)
+
+		entries := recorded(t)
+		require.Len(t, entries, 2, "Expected an entry per folder")
+		assert.Equal(t, projects.ID, entries[0].TargetID, "Expected the created folder")
+		assert.Equal(t, models.AuditChange{After: "Projects"}, entries[0].Changes["name"], "Expected the folder's name")
+		assert.Equal(t, models.AuditChange{After: nil}, entries[0].Changes["parent_id"], "Expected the folder at the root")
+
+		// Only the attributes that changed are recorded
+		update := models.Folder{}
+		applyPatch(t, &update, "folders", projects.ID.String(), `{"name": "Current projects", "parent_id": "`+archive.ID.String()+`"}`)
+		require.NoError(t, update.SetToManyReferenceIDs("tags", []string{tag.ID.String()}), "Failed to set tags")
+		_, err = folders.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update folder")
+		entries = recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the update")
+		assert.Equal(t, models.AuditUpdate, entries[0].Action, "Expected an update")
+		assert.Equal(t, map[string]models.AuditChange{
+			"name":      {Before: "Projects", After: "Current projects"},
+			"parent_id": {Before: nil, After: archive.ID.String()},
+			"tags":      {Before: []interface{}{}, After: []interface{}{tag.ID.String()}},
+		}, entries[0].Changes, "Expected the changed attributes")
+
+		// Tags that aren't given are kept, so nothing else changed
+		update = models.Folder{}
+		applyPatch(t, &update, "folders", projects.ID.String(), `{"name": "Projects"}`)
+		_, err = folders.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to rename folder")
+		entries = recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the update")
+		assert.Equal(t, map[string]models.AuditChange{
+			"name": {Before: "Current projects", After: "Projects"},
+		}, entries[0].Changes, "Expected only the name to change")
+	})
+
+	t.Run("Document", func(t *testing.T) {
+		share := models.Share{UserID: editor.ID, FolderID: &archive.ID, Role: models.RoleEditor, OwnerID: owner.ID, CreatedByID: owner.ID}
+		require.NoError(t, db.Create(&share).Error, "Failed to create share")
+
+		// An editor's changes are recorded for the owner with the editor as the actor
+		resp, err := documents.Create(models.Document{Title: "Plan", Content: "Draft", FolderID: &projects.ID}, newRequest(editor.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+		document := resp.Result().(models.Document)
+		entries := recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the creation")
+		assert.Equal(t, "document", entries[0].TargetType, "Expected the document to be the target")
+		assert.Equal(t, editor.ID, entries[0].ActorID, "Expected the editor to be the actor")
+		assert.Equal(t, owner.ID, entries[0].OwnerID, "Expected the owner to own the entry")
+
+		update := models.Document{}
+		applyPatch(t, &update, "documents", document.ID.String(), `{"content": "Final"}`)
+		_, err = documents.Update(update, newRequest(editor.ID, nil))
+		require.NoError(t, err, "Failed to update document")
+		entries = recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the update")
+		assert.Equal(t, map[string]models.AuditChange{
+			"content":  {Before: "Draft", After: "Final"},
+			"revision": {Before: float64(1), After: float64(2)},
+		}, entries[0].Changes, "Expected the content and revision to change")
+
+		// A deletion records the state the document was in
+		_, err = documents.Delete(document.ID.String(), newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to delete document")
+		entries = recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the deletion")
+		assert.Equal(t, models.AuditDelete, entries[0].Action, "Expected a deletion")
+		assert.Equal(t, models.AuditChange{Before: "Final"}, entries[0].Changes["content"], "Expected the deleted content")
+	})
+
+	t.Run("RecursiveDelete", func(t *testing.T) {
+		_, err := folders.Delete(archive.ID.String(), newRequest(owner.ID, map[string][]string{"recursive": {"true"}}))
+		require.NoError(t, err, "Failed to delete folder")
+		entries := recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the subtree")
+		assert.Equal(t, archive.ID, entries[0].TargetID, "Expected the deleted folder")
+		assert.Equal(t, models.AuditDelete, entries[0].Action, "Expected a deletion")
+	})
+
+	t.Run("NoEntryOnFailure", func(t *testing.T) {
+		// The entries of the operations before a failed one are rolled back
+		body := `{"atomic:operations": [
+			{"op": "add", "data": {"type": "folders", "attributes": {"name": "Drafts"}}},
+			{"op": "update", "data": {"type": "documents", "id": "` + uuid.New().String() + `", "attributes": {"title": "Missing"}}}
+		]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/operations", strings.NewReader(body))
+		req = req.WithContext(auth.WithUserID(req.Context(), owner.ID))
+		rec := httptest.NewRecorder()
+		NewBulkHandler(db).Execute(rec, req, nil, nil)
+		require.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+		assert.Empty(t, recorded(t), "Expected the entries of the failed operations to be rolled back")
+	})
+
+	t.Run("User", func(t *testing.T) {
+		update := models.User{}
+		applyPatch(t, &update, "users", owner.ID.String(), `{"email": "new@example.com", "password": "newpassword123"}`)
+		_, err := users.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update user")
+		entries := recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the update")
+		assert.Equal(t, map[string]models.AuditChange{
+			"email":    {Before: "owner@example.com", After: "new@example.com"},
+			"password": {Before: "[redacted]", After: "[redacted]"},
+		}, entries[0].Changes, "Expected the email and password to change")
+
+		_, err = users.Delete(owner.ID.String(), newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to delete user")
+		entries = recorded(t)
+		require.Len(t, entries, 1, "Expected an entry for the deletion")
+		assert.Equal(t, models.AuditDelete, entries[0].Action, "Expected a deletion")
+	})
+
+	t.Run("Immutable", func(t *testing.T) {
+		entry, err := models.NewAuditEntry(models.AuditCreate, editor.ID, nil, editor)
+		require.NoError(t, err, "Failed to create audit entry")
+		require.NoError(t, db.Create(&entry).Error, "Failed to record audit entry")
+
+		assert.ErrorIs(t, db.Model(&entry).Update("action", models.AuditDelete).Error, models.ErrAuditEntryImmutable, "Expected updates to be rejected")
+		assert.ErrorIs(t, db.Delete(&entry).Error, models.ErrAuditEntryImmutable, "Expected deletions to be rejected")
+		assert.Error(t, db.Exec("UPDATE audit_entries SET action = ?", models.AuditDelete).Error, "Expected the database to reject updates")
+
+		var stored models.AuditEntry
+		require.NoError(t, db.First(&stored, "id = ?", entry.ID).Error, "Failed to find audit entry")
+		assert.Equal(t, models.AuditCreate, stored.Action, "Expected the entry to be unchanged")
+	})
+}
+
+func TestAuditEntryResource(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Serve the resource through api2go to cover its routes
+	api := api2go.NewAPI("v1")
+	api.AddResource(models.AuditEntry{}, NewAuditEntryResource(db))
+
+	// Create an owner, an editor of the owner's document and an unrelated user
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+	editor := models.User{Username: "editor", Email: "editor@example.com"}
+	require.NoError(t, db.Create(&editor).Error, "Failed to create editor")
+	other := models.User{Username: "other", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	document := models.Document{Title: "Plan", UserID: owner.ID}
+	require.NoError(t, db.Create(&document).Error, "Failed to create document")
+	folder := models.Folder{Name: "Projects", UserID: editor.ID}
+	require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+
+	// record stores an audit entry created at the given time
+	record := func(action string, actor uuid.UUID, before, after jsonapi.MarshalIdentifier, at time.Time) models.AuditEntry {
+		entry, err := models.NewAuditEntry(action, actor, before, after)
+		require.NoError(t, err, "Failed to create audit entry")
+		entry.CreatedAt = at
+		require.NoError(t, db.Create(&entry).Error, "Failed to record audit entry")
+		return entry
+	}
+	start := time.Now().UTC().Add(-time.Hour)
+	created := record(models.AuditCreate, owner.ID, nil, document, start)
+	edited := document
+	edited.Content = "Step 1"
+	updated := record(models.AuditUpdate, editor.ID, document, edited, start.Add(time.Minute))
+	editorFolder := record(models.AuditCreate, editor.ID, nil, folder, start.Add(2*time.Minute))
+	otherUser := record(models.AuditUpdate, other.ID, other, other, start.Add(3*time.Minute))
+
+	type resourceObject struct {
+		Type       string                 `json:"type"`
+		ID         string                 `json:"id"`
+		Attributes map[string]interface{} `json:"attributes"`
+	}
+
+	serve := func(method, path string, userID uuid.UUID) (int, []resourceObject) {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		api.Handler().ServeHTTP(rec, req)
+
+		var response struct {
+			Data json.RawMessage `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response), "Failed to decode response")
+		var objects []resourceObject
+		if len(response.Data) > 0 && response.Data[0] == '[' {
+			require.NoError(t, json.Unmarshal(response.Data, &objects), "Failed to decode data")
+		} else if len(response.Data) > 0 && response.Data[0] == '{' {
+			var object resourceObject
+			require.NoError(t, json.Unmarshal(response.Data, &object), "Failed to decode data")
+			objects = append(objects, object)
+		}
+		return rec.Code, objects
+	}
+	ids := func(objects []resourceObject) []string {
+		result := make([]string, 0, len(objects))
+		for _, object := range objects {
+			result = append(result, object.ID)
+		}
+		return result
+	}
+
+	t.Run("List", func(t *testing.T) {
+		code, objects := serve(http.MethodGet, "/v1/auditEntries", owner.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{updated.ID.String(), created.ID.String()}, ids(objects), "Expected the entries of the owner's items, newest first")
+		assert.Equal(t, "auditEntries", objects[0].Type, "Expected the entries' type")
+		assert.Equal(t, map[string]interface{}{
+			"content": map[string]interface{}{"before": "", "after": "Step 1"},
+		}, objects[0].Attributes["changes"], "Expected the changed attributes")
+
+		// Actors see their own changes to the items of others
+		code, objects = serve(http.MethodGet, "/v1/auditEntries", editor.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{editorFolder.ID.String(), updated.ID.String()}, ids(objects), "Expected the editor's entries")
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		code, objects := serve(http.MethodGet, "/v1/auditEntries?filter[action]=update", owner.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{updated.ID.String()}, ids(objects), "Expected the update")
+
+		code, objects = serve(http.MethodGet, "/v1/auditEntries?filter[actor_id]="+owner.ID.String(), owner.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{created.ID.String()}, ids(objects), "Expected the owner's own change")
+
+		code, objects = serve(http.MethodGet, "/v1/auditEntries?filter[target_type]=folder", editor.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{editorFolder.ID.String()}, ids(objects), "Expected the folder's entry")
+
+		code, objects = serve(http.MethodGet, "/v1/auditEntries?filter[target_id]="+document.ID.String()+"&filter[since]="+start.Add(30*time.Second).Format(time.RFC3339), editor.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{updated.ID.String()}, ids(objects), "Expected the document's entry since the given time")
+
+		code, objects = serve(http.MethodGet, "/v1/auditEntries?filter[until]="+start.Add(30*time.Second).Format(time.RFC3339), owner.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{created.ID.String()}, ids(objects), "Expected the entry before the given time")
+
+		for _, query := range []string{"filter[action]=archive", "filter[target_type]=tag", "filter[actor_id]=someone", "filter[since]=yesterday"} {
+			code, _ = serve(http.MethodGet, "/v1/auditEntries?"+query, owner.ID)
+			assert.Equal(t, http.StatusBadRequest, code, "Expected %s to be rejected", query)
+		}
+	})
+
+	t.Run("Paginate", func(t *testing.T) {
+		code, objects := serve(http.MethodGet, "/v1/auditEntries?page[number]=2&page[size]=1", owner.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{created.ID.String()}, ids(objects), "Expected the second page")
+	})
+
+	t.Run("FindOne", func(t *testing.T) {
+		code, objects := serve(http.MethodGet, "/v1/auditEntries/"+updated.ID.String(), owner.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		require.Len(t, objects, 1, "Expected the entry")
+		assert.Equal(t, editor.ID.String(), objects[0].Attributes["actor_id"], "Expected the entry's actor")
+
+		code, _ = serve(http.MethodGet, "/v1/auditEntries/"+otherUser.ID.String(), owner.ID)
+		assert.Equal(t, http.StatusNotFound, code, "Expected the other user's entry to be hidden")
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		code, _ := serve(http.MethodDelete, "/v1/auditEntries/"+created.ID.String(), owner.ID)
+		assert.Equal(t, http.StatusMethodNotAllowed, code, "Expected entries not to be deletable")
+		code, _ = serve(http.MethodPatch, "/v1/auditEntries/"+created.ID.String(), owner.ID)
+		assert.Equal(t, http.StatusMethodNotAllowed, code, "Expected entries not to be editable")
+	})
+}
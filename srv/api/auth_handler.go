@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"srv/auth"
+
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+)
+
+// AuthHandler serves the login and logout endpoints
+type AuthHandler struct {
+	Auth *auth.Service
+}
+
+// NewAuthHandler creates a new AuthHandler
+func NewAuthHandler(service *auth.Service) *AuthHandler {
+	return &AuthHandler{
+		Auth: service,
+	}
+}
+
+// Register adds the authentication routes to the router
+func (h AuthHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodPost, prefix+"/auth/login", h.Login)
+	router.Handle(http.MethodPost, prefix+"/auth/logout", h.Logout)
+}
+
+// Login exchanges a username and password for a bearer token
+func (h AuthHandler) Login(w http.ResponseWriter, r *http.Request, _ map[string]string, _ map[string]interface{}) {
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := readAttributes(r, &credentials); err != nil {
+		logrus.WithError(err).Warn("Invalid login request")
+		writeError(w, http.StatusBadRequest, "Invalid login request")
+		return
+	}
+
+	logrus.WithField("username", credentials.Username).Info("Logging in user")
+
+	session, err := h.Auth.Login(credentials.Username, credentials.Password)
+	if err != nil {
+		if err == auth.ErrInvalidCredentials {
+			logrus.WithField("username", credentials.Username).Warn("Invalid credentials")
+			writeError(w, http.StatusUnauthorized, "Invalid username or password")
+			return
+		}
+		logrus.WithError(err).Error("Failed to log in user")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusCreated, session, nil)
+}
+
+// Logout revokes the bearer token used for the request
+func (h AuthHandler) Logout(w http.ResponseWriter, r *http.Request, _ map[string]string, _ map[string]interface{}) {
+	token, ok := auth.BearerToken(r.Header.Get("Authorization"))
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	if err := h.Auth.Logout(token); err != nil {
+		logrus.WithError(err).Error("Failed to log out user")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manyminds/api2go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthHandler_LoginLogout(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create handler
+	service := auth.NewService(db, time.Hour)
+	handler := NewAuthHandler(service)
+
+	// Create a test user with a password
+	_, err := NewUserResource(db).Create(models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "password123",
+	}, api2go.Request{})
+	require.NoError(t, err, "Failed to create test user")
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body := `{"data":{"type":"sessions","attributes":{"username":"testuser","password":"` + password + `"}}}`
+		rec := httptest.NewRecorder()
+		handler.Login(rec, httptest.NewRequest(http.MethodPost, "/v1/auth/login", strings.NewReader(body)), nil, nil)
+		return rec
+	}
+
+	// Test Login with wrong password
+	t.Run("InvalidCredentials", func(t *testing.T) {
+		rec := login("wrongpassword")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Expected status code 401")
+	})
+
+	var token string
+
+	// Test Login
+	t.Run("Login", func(t *testing.T) {
+		rec := login("password123")
+		require.Equal(t, http.StatusCreated, rec.Code, "Expected status code 201")
+
+		var document struct {
+			Data struct {
+				Type       string `json:"type"`
+				Attributes struct {
+					Token string `json:"token"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document), "Failed to decode response")
+		assert.Equal(t, "sessions", document.Data.Type, "Expected sessions type")
+		require.NotEmpty(t, document.Data.Attributes.Token, "Expected a token")
+		token = document.Data.Attributes.Token
+
+		_, err := service.Authenticate(token)
+		assert.NoError(t, err, "Expected token to be valid")
+	})
+
+	// Test Logout
+	t.Run("Logout", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.Logout(rec, req, nil, nil)
+		require.Equal(t, http.StatusNoContent, rec.Code, "Expected status code 204")
+
+		_, err := service.Authenticate(token)
+		assert.Equal(t, auth.ErrInvalidToken, err, "Expected token to be revoked")
+	})
+}
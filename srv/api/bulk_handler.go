@@ -0,0 +1,319 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"srv/models"
+	"strconv"
+
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// maxBulkOperations is the most operations a single bulk request may contain
+const maxBulkOperations = 500
+
+// Operations of the atomic operations extension
+const (
+	opAdd    = "add"
+	opUpdate = "update"
+	opRemove = "remove"
+)
+
+// bulkResources are the resource types bulk operations can target, along
+// with their model and a constructor working on a transaction
+var bulkResources = map[string]struct {
+	model    interface{}
+	resource func(db *gorm.DB) api2go.CRUD
+}{
+	"users":     {models.User{}, func(db *gorm.DB) api2go.CRUD { return NewUserResource(db) }},
+	"folders":   {models.Folder{}, func(db *gorm.DB) api2go.CRUD { return NewFolderResource(db) }},
+	"documents": {models.Document{}, func(db *gorm.DB) api2go.CRUD { return NewDocumentResource(db) }},
+}
+
+// BulkHandler runs many create, update and delete operations on users,
+// folders and documents in a single transaction, following the JSON:API
+// atomic operations extension (https://jsonapi.org/ext/atomic/)
+type BulkHandler struct {
+	DB *gorm.DB
+}
+
+// NewBulkHandler creates a new BulkHandler
+func NewBulkHandler(db *gorm.DB) *BulkHandler {
+	return &BulkHandler{
+		DB: db,
+	}
+}
+
+// bulkRequest is a request document of the atomic operations extension
+type bulkRequest struct {
+	Operations []bulkOperation `json:"atomic:operations"`
+}
+
+// bulkOperation is a single operation of a bulk request. The target is given
+// by ref, or by the type and ID of data.
+type bulkOperation struct {
+	Op   string          `json:"op"`
+	Ref  *bulkRef        `json:"ref"`
+	Data json.RawMessage `json:"data"`
+}
+
+// bulkRef references the resource, or one of its relationships, an operation targets
+type bulkRef struct {
+	Type         string `json:"type"`
+	ID           string `json:"id"`
+	Relationship string `json:"relationship"`
+}
+
+// bulkResult is the outcome of a successful operation. Removals have no data.
+type bulkResult struct {
+	Data *jsonapi.Data `json:"data,omitempty"`
+}
+
+// Register adds the bulk operations route to the router
+func (h BulkHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodPost, prefix+"/operations", h.Execute)
+}
+
+// Execute runs the operations of a bulk request in order. Each operation goes
+// through the same validations as the corresponding single request, and the
+// query parameters of the bulk request, such as on_conflict or recursive,
+// apply to every operation. If any operation fails, none of them takes effect
+// and the error points at the failed operation.
+func (h BulkHandler) Execute(w http.ResponseWriter, r *http.Request, _ map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var body bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logrus.WithError(err).Warn("Invalid bulk request")
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(body.Operations) == 0 || len(body.Operations) > maxBulkOperations {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Expected between 1 and %d operations", maxBulkOperations))
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"operations": len(body.Operations),
+	}).Info("Running bulk operations")
+
+	results := make([]bulkResult, 0, len(body.Operations))
+	failed := -1
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		for i, op := range body.Operations {
+			result, err := h.execute(tx, r, op)
+			if err != nil {
+				failed = i
+				return err
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		status, errs := errorObjects(err)
+		if failed < 0 {
+			logrus.WithError(err).Error("Failed to commit bulk operations")
+		} else {
+			logrus.WithError(err).WithField("operation", failed).Warn("Bulk operation failed")
+			for i := range errs {
+				errs[i].Source = &api2go.ErrorSource{Pointer: "/atomic:operations/" + strconv.Itoa(failed)}
+			}
+		}
+		writeJSON(w, status, map[string]interface{}{"errors": errs})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"atomic:results": results})
+}
+
+// execute runs a single operation on resources working on tx
+func (h BulkHandler) execute(tx *gorm.DB, r *http.Request, op bulkOperation) (bulkResult, error) {
+	ref, err := op.target()
+	if err != nil {
+		return bulkResult{}, newHTTPError(err, err.Error(), http.StatusBadRequest)
+	}
+	target, ok := bulkResources[ref.Type]
+	if !ok {
+		return bulkResult{}, newHTTPError(nil, fmt.Sprintf("Resource type %q does not support bulk operations", ref.Type), http.StatusBadRequest)
+	}
+	resource := target.resource(tx)
+
+	// Every operation gets a request of its own, so headers such as If-Match
+	// of the bulk request don't apply to it
+	plain, err := http.NewRequestWithContext(r.Context(), http.MethodPost, r.URL.String(), nil)
+	if err != nil {
+		return bulkResult{}, err
+	}
+	req := api2go.Request{PlainRequest: plain, QueryParams: r.URL.Query()}
+
+	var response api2go.Responder
+	switch {
+	case ref.Relationship != "":
+		response, err = h.editRelationship(resource, req, op.Op, ref, op.Data)
+	case op.Op == opAdd:
+		var obj interface{}
+		obj, err = decodeResource(target.model, op.Data)
+		if err == nil {
+			response, err = resource.Create(obj, req)
+		}
+	case op.Op == opUpdate:
+		response, err = h.update(resource, req, ref, op.Data)
+	case op.Op == opRemove:
+		response, err = resource.Delete(ref.ID, req)
+	default:
+		err = newHTTPError(nil, "Unknown operation, must be add, update or remove", http.StatusBadRequest)
+	}
+	if err != nil {
+		return bulkResult{}, err
+	}
+
+	if response == nil || response.Result() == nil {
+		return bulkResult{}, nil
+	}
+	document, err := jsonapi.MarshalToStruct(response.Result(), nil)
+	if err != nil {
+		return bulkResult{}, err
+	}
+	return bulkResult{Data: document.Data.DataObject}, nil
+}
+
+// update applies the attributes and relationships of data to a stored
+// resource, the way api2go does for PATCH requests
+func (h BulkHandler) update(resource api2go.CRUD, req api2go.Request, ref bulkRef, data json.RawMessage) (api2go.Responder, error) {
+	existing, err := resource.FindOne(ref.ID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := decodeResource(existing.Result(), data)
+	if err != nil {
+		return nil, err
+	}
+	if obj.(jsonapi.MarshalIdentifier).GetID() != ref.ID {
+		return nil, newHTTPError(nil, "Resource ID does not match the operation's ref", http.StatusBadRequest)
+	}
+
+	return resource.Update(obj, req)
+}
+
+// editRelationship changes a to-many relationship of a stored resource, such
+// as the tags of a document: add and remove change the given members while
+// update replaces all of them
+func (h BulkHandler) editRelationship(resource api2go.CRUD, req api2go.Request, op string, ref bulkRef, data json.RawMessage) (api2go.Responder, error) {
+	var members []struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, newHTTPError(err, "Relationship data must be an array of resource identifiers", http.StatusBadRequest)
+	}
+
+	existing, err := resource.FindOne(ref.ID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	given := make(map[string]bool, len(members))
+	for _, member := range members {
+		given[member.ID] = true
+	}
+	if op != opUpdate {
+		if linked, ok := existing.Result().(jsonapi.MarshalLinkedRelations); ok {
+			for _, current := range linked.GetReferencedIDs() {
+				if current.Name == ref.Relationship && (op == opAdd || !given[current.ID]) {
+					ids = append(ids, current.ID)
+				}
+			}
+		}
+	}
+	switch op {
+	case opAdd, opUpdate:
+		for _, member := range members {
+			ids = append(ids, member.ID)
+		}
+	case opRemove:
+	default:
+		return nil, newHTTPError(nil, "Unknown operation, must be add, update or remove", http.StatusBadRequest)
+	}
+
+	// Work on a copy of the stored resource, like decodeResource does
+	value := reflect.New(reflect.TypeOf(existing.Result()))
+	value.Elem().Set(reflect.ValueOf(existing.Result()))
+	target, ok := value.Interface().(jsonapi.UnmarshalToManyRelations)
+	if !ok {
+		return nil, newHTTPError(nil, "Relationship "+ref.Relationship+" cannot be changed", http.StatusBadRequest)
+	}
+	if err := target.SetToManyReferenceIDs(ref.Relationship, ids); err != nil {
+		return nil, newHTTPError(err, err.Error(), http.StatusBadRequest)
+	}
+
+	return resource.Update(value.Elem().Interface(), req)
+}
+
+// target returns the reference of the resource an operation targets
+func (op bulkOperation) target() (bulkRef, error) {
+	if op.Ref != nil {
+		if op.Ref.Type == "" || (op.Ref.ID == "" && op.Op != opAdd) {
+			return bulkRef{}, errors.New("Operation ref requires a type and an id")
+		}
+		return *op.Ref, nil
+	}
+
+	var data struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal(op.Data, &data); err != nil || data.Type == "" {
+		return bulkRef{}, errors.New("Operation requires a ref or data with a type")
+	}
+	if data.ID == "" && op.Op != opAdd {
+		return bulkRef{}, errors.New("Operation requires the id of the resource")
+	}
+	return bulkRef{Type: data.Type, ID: data.ID}, nil
+}
+
+// decodeResource unmarshals the resource object data onto a copy of obj,
+// which is the stored resource for updates or a zero model for creates
+func decodeResource(obj interface{}, data json.RawMessage) (interface{}, error) {
+	value := reflect.New(reflect.TypeOf(obj))
+	value.Elem().Set(reflect.ValueOf(obj))
+
+	payload, err := json.Marshal(map[string]json.RawMessage{"data": data})
+	if err != nil {
+		return nil, err
+	}
+	if err := jsonapi.Unmarshal(payload, value.Interface()); err != nil {
+		return nil, newHTTPError(err, "Invalid resource data: "+err.Error(), http.StatusBadRequest)
+	}
+	return value.Elem().Interface(), nil
+}
+
+// errorObjects returns the status and JSON:API error objects for an error of
+// a resource. The resources create their errors with newHTTPError, so the
+// status is that of the first error object.
+func errorObjects(err error) (int, []api2go.Error) {
+	var httpErr api2go.HTTPError
+	if !errors.As(err, &httpErr) || len(httpErr.Errors) == 0 {
+		return http.StatusInternalServerError, []api2go.Error{{Status: strconv.Itoa(http.StatusInternalServerError), Title: err.Error()}}
+	}
+
+	status, _ := strconv.Atoi(httpErr.Errors[0].Status)
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	return status, append([]api2go.Error(nil), httpErr.Errors...)
+}
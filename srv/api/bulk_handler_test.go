@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create handler
+	handler := NewBulkHandler(db)
+
+	// Create test users, a folder, a tag and three documents in the root
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "otheruser", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	folder := models.Folder{Name: "Inbox", UserID: user.ID}
+	require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+	tag := models.Tag{Name: "Urgent", UserID: user.ID}
+	require.NoError(t, db.Create(&tag).Error, "Failed to create tag")
+	laterTag := models.Tag{Name: "Later", UserID: user.ID}
+	require.NoError(t, db.Create(&laterTag).Error, "Failed to create tag")
+
+	docs := make([]models.Document, 3)
+	for i, title := range []string{"First", "Second", "Third"} {
+		docs[i] = models.Document{Title: title, UserID: user.ID, Tags: []models.Tag{laterTag}}
+		require.NoError(t, db.Create(&docs[i]).Error, "Failed to create document")
+	}
+
+	type result struct {
+		Data *struct {
+			Type       string                 `json:"type"`
+			ID         string                 `json:"id"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"data"`
+	}
+	type errorObject struct {
+		Status string `json:"status"`
+		Title  string `json:"title"`
+		Source struct {
+			Pointer string `json:"pointer"`
+		} `json:"source"`
+	}
+
+	serve := func(query, body string, userID uuid.UUID) (*httptest.ResponseRecorder, []result, []errorObject) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/operations"+query, strings.NewReader(body))
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		handler.Execute(rec, req, nil, nil)
+
+		var response struct {
+			Results []result      `json:"atomic:results"`
+			Errors  []errorObject `json:"errors"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response), "Failed to decode response")
+		return rec, response.Results, response.Errors
+	}
+
+	folderOf := func(id uuid.UUID) *uuid.UUID {
+		var document models.Document
+		require.NoError(t, db.First(&document, "id = ?", id).Error, "Failed to find document")
+		return document.FolderID
+	}
+
+	tagsOf := func(id uuid.UUID) []string {
+		var names []string
+		require.NoError(t, db.Table(database.DocumentTagsTable).
+			Joins("JOIN tags ON tags.id = document_tags.tag_id").
+			Where("document_tags.document_id = ?", id).
+			Order("tags.name").
+			Pluck("tags.name", &names).Error, "Failed to find tags")
+		return names
+	}
+
+	t.Run("MoveAndTag", func(t *testing.T) {
+		body := `{"atomic:operations": [
+			{"op": "update", "data": {"type": "documents", "id": "` + docs[0].ID.String() + `", "attributes": {"folder_id": "` + folder.ID.String() + `"}}},
+			{"op": "update", "data": {"type": "documents", "id": "` + docs[1].ID.String() + `", "attributes": {"folder_id": "` + folder.ID.String() + `"}}},
+			{"op": "add", "ref": {"type": "documents", "id": "` + docs[0].ID.String() + `", "relationship": "tags"}, "data": [{"type": "tags", "id": "` + tag.ID.String() + `"}]},
+			{"op": "remove", "ref": {"type": "documents", "id": "` + docs[1].ID.String() + `", "relationship": "tags"}, "data": [{"type": "tags", "id": "` + laterTag.ID.String() + `"}]},
+			{"op": "add", "data": {"type": "folders", "attributes": {"name": "Archive"}}}
+		]}`
+		rec, results, _ := serve("", body, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		require.Len(t, results, 5, "Expected a result per operation")
+		assert.Equal(t, docs[0].ID.String(), results[0].Data.ID, "Expected the moved document")
+		assert.Equal(t, folder.ID.String(), results[1].Data.Attributes["folder_id"], "Expected the new folder")
+		assert.Equal(t, "folders", results[4].Data.Type, "Expected the created folder")
+		assert.Equal(t, "Archive", results[4].Data.Attributes["name"], "Expected the name of the created folder")
+
+		assert.Equal(t, folder.ID, *folderOf(docs[0].ID), "Expected the first document to be moved")
+		assert.Equal(t, folder.ID, *folderOf(docs[1].ID), "Expected the second document to be moved")
+		assert.Equal(t, []string{"Later", "Urgent"}, tagsOf(docs[0].ID), "Expected the tag to be added")
+		assert.Empty(t, tagsOf(docs[1].ID), "Expected the tag to be removed")
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		body := `{"atomic:operations": [
+			{"op": "remove", "ref": {"type": "documents", "id": "` + docs[2].ID.String() + `"}}
+		]}`
+		rec, results, _ := serve("", body, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		require.Len(t, results, 1, "Expected a result per operation")
+		assert.Nil(t, results[0].Data, "Expected no data for a removal")
+
+		var count int64
+		db.Model(&models.Document{}).Where("id = ?", docs[2].ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected the document to be moved to the trash")
+	})
+
+	t.Run("RollsBackOnFailure", func(t *testing.T) {
+		body := `{"atomic:operations": [
+			{"op": "update", "data": {"type": "documents", "id": "` + docs[0].ID.String() + `", "attributes": {"folder_id": null}}},
+			{"op": "update", "data": {"type": "documents", "id": "` + uuid.New().String() + `", "attributes": {"title": "Missing"}}}
+		]}`
+		rec, _, errs := serve("", body, user.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected the status of the failed operation")
+		require.Len(t, errs, 1, "Expected a single error")
+		assert.Equal(t, "Document not found", errs[0].Title, "Expected the error of the failed operation")
+		assert.Equal(t, "/atomic:operations/1", errs[0].Source.Pointer, "Expected the error to point at the failed operation")
+
+		assert.Equal(t, folder.ID, *folderOf(docs[0].ID), "Expected earlier operations to be rolled back")
+	})
+
+	t.Run("Validations", func(t *testing.T) {
+		// Folder names must be unique among siblings unless renamed
+		body := `{"atomic:operations": [
+			{"op": "add", "data": {"type": "folders", "attributes": {"name": "inbox"}}}
+		]}`
+		rec, _, errs := serve("", body, user.ID)
+		assert.Equal(t, http.StatusConflict, rec.Code, "Expected status code 409")
+		require.Len(t, errs, 1, "Expected a single error")
+		assert.Equal(t, "/atomic:operations/0", errs[0].Source.Pointer, "Expected the error to point at the operation")
+
+		rec, results, _ := serve("?on_conflict=rename", body, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected query parameters to apply to the operations")
+		assert.Equal(t, "inbox (2)", results[0].Data.Attributes["name"], "Expected the folder to be renamed")
+
+		// Other users' documents can't be changed
+		body = `{"atomic:operations": [
+			{"op": "update", "data": {"type": "documents", "id": "` + docs[0].ID.String() + `", "attributes": {"title": "Mine"}}}
+		]}`
+		rec, _, _ = serve("", body, other.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+
+		// Users can only change themselves
+		body = `{"atomic:operations": [
+			{"op": "update", "data": {"type": "users", "id": "` + user.ID.String() + `", "attributes": {"username": "taken"}}}
+		]}`
+		rec, _, _ = serve("", body, other.ID)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "Expected status code 403")
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		rec, _, _ := serve("", `{"atomic:operations": []}`, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected empty requests to be rejected")
+
+		rec, _, _ = serve("", `{"atomic:operations": [{"op": "add", "data": {"type": "tags", "attributes": {"name": "New"}}}]}`, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected unsupported types to be rejected")
+
+		rec, _, _ = serve("", `{"atomic:operations": [{"op": "replace", "ref": {"type": "folders", "id": "`+folder.ID.String()+`"}}]}`, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected unknown operations to be rejected")
+
+		rec, _, _ = serve("", `{"atomic:operations": [{"op": "update", "data": {"type": "folders", "attributes": {"name": "No ID"}}}]}`, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected updates without an ID to be rejected")
+	})
+}
+
+func TestErrorObjects(t *testing.T) {
+	status, objects := errorObjects(newHTTPError(nil, "Title spanning\ntwo lines", http.StatusConflict))
+	assert.Equal(t, http.StatusConflict, status, "Expected the status of the error object")
+	require.Len(t, objects, 1, "Expected one error object")
+	assert.Equal(t, "Title spanning\ntwo lines", objects[0].Title, "Expected the title to be kept")
+
+	status, objects = errorObjects(errors.New("connection refused"))
+	assert.Equal(t, http.StatusInternalServerError, status, "Expected other errors to be internal")
+	require.Len(t, objects, 1, "Expected one error object")
+	assert.Equal(t, "500", objects[0].Status, "Expected the status of internal errors")
+}
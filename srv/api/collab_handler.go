@@ -0,0 +1,210 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"srv/collab"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+	"gorm.io/gorm"
+)
+
+// maxCollabMessage is the size limit of a message sent by a collaborative
+// editing client, in bytes
+const maxCollabMessage = 1 << 20
+
+// CollabHandler connects clients to the collaborative editing sessions of
+// documents over WebSocket
+type CollabHandler struct {
+	DB        *gorm.DB
+	Hub       *collab.Hub
+	Heartbeat time.Duration
+}
+
+// NewCollabHandler creates a new CollabHandler
+func NewCollabHandler(db *gorm.DB, hub *collab.Hub) *CollabHandler {
+	return &CollabHandler{
+		DB:        db,
+		Hub:       hub,
+		Heartbeat: 30 * time.Second,
+	}
+}
+
+// Register adds the session route to the router
+func (h CollabHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/documents/:id/session", h.Session)
+}
+
+// Session upgrades the request to a WebSocket connection taking part in the
+// collaborative editing session of a document. Every message is a JSON
+// object as described by collab.Message. Viewers follow the edits and share
+// their cursor, while editors may change the content too.
+func (h CollabHandler) Session(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+	role, err := database.DocumentRole(h.DB, userID, document)
+	if err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to check access to document")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var user models.User
+	if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
+		logrus.WithError(err).WithField("user_id", userID).Error("Failed to find user")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		writeError(w, http.StatusUpgradeRequired, "WebSocket upgrade required")
+		return
+	}
+
+	participant := collab.Participant{
+		UserID:   userID,
+		Username: user.Username,
+		CanEdit:  models.RoleAtLeast(role, models.RoleEditor),
+	}
+	// Clients authenticate with a token rather than a cookie, so connections
+	// from other origins can't act on behalf of a user and are accepted
+	server := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			h.serve(conn, document.ID, participant)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// serve relays the messages between a connection and the session of a
+// document until either side closes
+func (h CollabHandler) serve(conn *websocket.Conn, documentID uuid.UUID, participant collab.Participant) {
+	conn.MaxPayloadBytes = maxCollabMessage
+	client, err := h.Hub.Join(documentID, participant)
+	if err != nil {
+		logrus.WithError(err).WithField("document_id", documentID).Error("Failed to join collaborative editing session")
+		websocket.JSON.Send(conn, collab.Message{Type: collab.MessageError, Error: "Failed to join the session"})
+		return
+	}
+	defer client.Leave()
+
+	// The client's messages are sent until it leaves or falls behind, with
+	// pings in between to keep idle connections open
+	go func() {
+		defer conn.Close()
+		heartbeat := time.NewTicker(h.Heartbeat)
+		defer heartbeat.Stop()
+		for {
+			message := collab.Message{Type: collab.MessagePing}
+			select {
+			case <-heartbeat.C:
+			case next, ok := <-client.Messages:
+				if !ok {
+					return
+				}
+				message = next
+			}
+			if err := websocket.JSON.Send(conn, message); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(conn, &data); err != nil {
+			return
+		}
+		if err := client.Handle(data); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"document_id": documentID,
+				"client_id":   client.ClientID,
+			}).Warn("Rejected collaborative editing message")
+		}
+	}
+}
+
+// collabStore loads and saves the content of documents edited in
+// collaborative editing sessions. A save is recorded like an update of the
+// content through the API, with a new revision, audit entry and event.
+type collabStore struct {
+	DB *gorm.DB
+}
+
+// NewCollabStore creates the store of collaborative editing sessions
+func NewCollabStore(db *gorm.DB) collab.Store {
+	return collabStore{DB: db}
+}
+
+// Load returns the current content and version of a document
+func (s collabStore) Load(documentID uuid.UUID) (collab.Snapshot, error) {
+	var document models.Document
+	if err := s.DB.First(&document, "id = ?", documentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return collab.Snapshot{}, collab.ErrNotFound
+		}
+		return collab.Snapshot{}, err
+	}
+	return collab.Snapshot{Content: document.Content, Version: document.Version}, nil
+}
+
+// Save replaces the content of a document still at the snapshot's version
+func (s collabStore) Save(documentID uuid.UUID, snapshot collab.Snapshot, actorID uuid.UUID) (int, error) {
+	var document models.Document
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		// Deleted documents have no version to claim
+		if err := database.ClaimVersion(tx, &models.Document{}, documentID, snapshot.Version); err != nil {
+			return err
+		}
+		var existingDocument models.Document
+		if err := tx.Scopes(preloadTags).First(&existingDocument, "id = ?", documentID).Error; err != nil {
+			return err
+		}
+		if err := ensureVersion(tx, existingDocument); err != nil {
+			return err
+		}
+
+		document = existingDocument
+		document.Content = snapshot.Content
+		document.Revision++
+		if err := tx.Select("content", "revision", "updated_at").Updates(&document).Error; err != nil {
+			return err
+		}
+		version := document.NewVersion(actorID)
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+
+		if err := recordAudit(tx, models.AuditUpdate, actorID, existingDocument, document); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventUpdated, document, actorID, nil)
+	})
+	if errors.Is(err, database.ErrVersionConflict) {
+		return 0, collab.ErrConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":       documentID,
+		"revision": document.Revision,
+	}).Info("Saved collaborative edits")
+	return document.Version, nil
+}
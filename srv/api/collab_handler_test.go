@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/collab"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestCollabHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Sessions are only saved when their last client leaves
+	hub := collab.NewHub(NewCollabStore(db), time.Hour)
+	api := api2go.NewAPI("v1")
+	api.AddResource(models.Document{}, NewDocumentResource(db))
+	NewCollabHandler(db, hub).Register(api.Router(), "/v1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := uuid.Parse(r.Header.Get("X-User-ID"))
+		api.Handler().ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+	}))
+	defer server.Close()
+
+	// Create an owner with a document in a folder shared with an editor and
+	// a viewer, and an unrelated user
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+	editor := models.User{Username: "editor", Email: "editor@example.com"}
+	require.NoError(t, db.Create(&editor).Error, "Failed to create editor")
+	viewer := models.User{Username: "viewer", Email: "viewer@example.com"}
+	require.NoError(t, db.Create(&viewer).Error, "Failed to create viewer")
+	other := models.User{Username: "other", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	folder := models.Folder{Name: "Shared", UserID: owner.ID}
+	require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+	for user, role := range map[uuid.UUID]string{editor.ID: models.RoleEditor, viewer.ID: models.RoleViewer} {
+		share := models.Share{UserID: user, FolderID: &folder.ID, Role: role, OwnerID: owner.ID, CreatedByID: owner.ID}
+		require.NoError(t, db.Create(&share).Error, "Failed to create share")
+	}
+	document := models.Document{Title: "Plan", Content: "Hello", FolderID: &folder.ID, UserID: owner.ID, Revision: 1, Version: 1}
+	require.NoError(t, db.Create(&document).Error, "Failed to create document")
+
+	path := "/v1/documents/" + document.ID.String() + "/session"
+	// connect opens a WebSocket connection to the session for a user
+	connect := func(t *testing.T, userID uuid.UUID, path string) (*websocket.Conn, error) {
+		config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+path, server.URL)
+		require.NoError(t, err, "Failed to create WebSocket config")
+		config.Header.Set("X-User-ID", userID.String())
+		conn, err := websocket.DialConfig(config)
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+		return conn, err
+	}
+	// receive reads the next message sent to a connection
+	receive := func(t *testing.T, conn *websocket.Conn) collab.Message {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)), "Failed to set deadline")
+		var message collab.Message
+		require.NoError(t, websocket.JSON.Receive(conn, &message), "Failed to receive message")
+		return message
+	}
+	send := func(t *testing.T, conn *websocket.Conn, message string) {
+		require.NoError(t, websocket.Message.Send(conn, message), "Failed to send message")
+	}
+
+	t.Run("Access", func(t *testing.T) {
+		_, err := connect(t, other.ID, path)
+		assert.Error(t, err, "Expected users without access to be rejected")
+		_, err = connect(t, owner.ID, "/v1/documents/"+uuid.NewString()+"/session")
+		assert.Error(t, err, "Expected unknown documents to be rejected")
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err, "Failed to create request")
+		req.Header.Set("X-User-ID", owner.ID.String())
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "Failed to send request")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode, "Expected status code 426")
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		ownerConn, err := connect(t, owner.ID, path)
+		require.NoError(t, err, "Failed to connect owner")
+		init := receive(t, ownerConn)
+		assert.Equal(t, collab.MessageInit, init.Type, "Expected the session's state")
+		assert.Equal(t, "Hello", *init.Content, "Expected the document's content")
+		assert.True(t, init.Participants[0].CanEdit, "Expected the owner to edit")
+
+		editorConn, err := connect(t, editor.ID, path)
+		require.NoError(t, err, "Failed to connect editor")
+		receive(t, editorConn)
+		joined := receive(t, ownerConn)
+		assert.Equal(t, collab.MessageJoin, joined.Type, "Expected the editor to join")
+		assert.Equal(t, "editor", joined.Participant.Username, "Expected the editor's name")
+
+		viewerConn, err := connect(t, viewer.ID, path)
+		require.NoError(t, err, "Failed to connect viewer")
+		init = receive(t, viewerConn)
+		require.Len(t, init.Participants, 3, "Expected every participant")
+		assert.False(t, init.Participants[2].CanEdit, "Expected the viewer not to edit")
+		receive(t, ownerConn)
+		receive(t, editorConn)
+
+		// Edits are acknowledged and sent to the others
+		send(t, editorConn, `{"type": "operation", "revision": 0, "operation": [5, " world"]}`)
+		assert.Equal(t, collab.MessageAck, receive(t, editorConn).Type, "Expected the edit to be acknowledged")
+		operation := receive(t, ownerConn)
+		assert.Equal(t, collab.MessageOperation, operation.Type, "Expected the edit")
+		assert.Equal(t, 1, *operation.Revision, "Expected the edit's revision")
+		assert.Equal(t, collab.MessageOperation, receive(t, viewerConn).Type, "Expected the viewer to follow the edit")
+
+		send(t, viewerConn, `{"type": "operation", "revision": 1, "operation": [11, "!"]}`)
+		rejection := receive(t, viewerConn)
+		assert.Equal(t, collab.MessageError, rejection.Type, "Expected the viewer's edit to be rejected")
+
+		// The content is saved when everybody has left
+		viewerConn.Close()
+		editorConn.Close()
+		assert.Equal(t, collab.MessageLeave, receive(t, ownerConn).Type, "Expected a participant to leave")
+		ownerConn.Close()
+		require.Eventually(t, func() bool {
+			var saved models.Document
+			return db.First(&saved, "id = ?", document.ID).Error == nil && saved.Content == "Hello world"
+		}, 5*time.Second, 10*time.Millisecond, "Expected the content to be saved")
+
+		var saved models.Document
+		require.NoError(t, db.First(&saved, "id = ?", document.ID).Error, "Failed to find document")
+		assert.Equal(t, 2, saved.Revision, "Expected a new revision")
+		assert.Equal(t, 2, saved.Version, "Expected a new version")
+
+		var versions []models.DocumentVersion
+		require.NoError(t, db.Where("document_id = ?", document.ID).Order("revision").Find(&versions).Error, "Failed to find versions")
+		require.Len(t, versions, 2, "Expected the previous and the saved revision")
+		assert.Equal(t, "Hello", versions[0].Content, "Expected the previous content")
+		assert.Equal(t, editor.ID, versions[1].UserID, "Expected the editor to be the saved revision's author")
+
+		var entry models.AuditEntry
+		require.NoError(t, db.Where("target_id = ?", document.ID).First(&entry).Error, "Failed to find audit entry")
+		assert.Equal(t, editor.ID, entry.ActorID, "Expected the editor as the actor")
+		assert.Equal(t, "Hello world", entry.Changes["content"].After, "Expected the content change")
+		var event models.Event
+		require.NoError(t, db.Where("resource_id = ?", document.ID).First(&event).Error, "Failed to find event")
+		assert.Equal(t, "document.updated", event.Type, "Expected the update event")
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		store := NewCollabStore(db)
+		snapshot, err := store.Load(document.ID)
+		require.NoError(t, err, "Failed to load document")
+		assert.Equal(t, collab.Snapshot{Content: "Hello world", Version: 2}, snapshot, "Expected the current content and version")
+
+		_, err = store.Save(document.ID, collab.Snapshot{Content: "Stale", Version: 1}, owner.ID)
+		assert.ErrorIs(t, err, collab.ErrConflict, "Expected an outdated version to conflict")
+
+		_, err = store.Load(uuid.New())
+		assert.ErrorIs(t, err, collab.ErrNotFound, "Expected an unknown document not to be found")
+	})
+}
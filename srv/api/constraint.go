@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"srv/database"
+	"strconv"
+
+	"github.com/manyminds/api2go"
+)
+
+// uniqueViolationTitles describe violations of the unique constraints of a
+// table to clients
+var uniqueViolationTitles = map[string]string{
+	"users":   "Username or email is already taken",
+	"folders": "A folder with this name already exists in the parent folder",
+	"tags":    "A tag with this name already exists",
+	"shares":  "Item is already shared with the user",
+}
+
+// constraintViolation returns the status and title of the response to a
+// write that violated a database constraint. Unique constraints conflict with
+// existing rows; the others mean the request referenced something that doesn't
+// exist or is invalid. Checks in the handlers catch most of these, but not
+// concurrent requests racing each other.
+func constraintViolation(err error) (int, string, bool) {
+	violation, ok := database.AsConstraintError(err)
+	if !ok {
+		return 0, "", false
+	}
+
+	switch violation.Kind {
+	case database.ConstraintUnique:
+		title, ok := uniqueViolationTitles[violation.Table]
+		if !ok {
+			title = "Conflicts with an existing resource"
+		}
+		return http.StatusConflict, title, true
+	case database.ConstraintForeignKey:
+		return http.StatusUnprocessableEntity, "Referenced resource does not exist", true
+	default:
+		return http.StatusUnprocessableEntity, "Missing or invalid attribute", true
+	}
+}
+
+// newHTTPError creates an api2go error whose status and title can be read
+// back from its error object, as done for the results of bulk operations.
+// api2go keeps them unexported otherwise.
+func newHTTPError(err error, msg string, status int) api2go.HTTPError {
+	httpErr := api2go.NewHTTPError(err, msg, status)
+	httpErr.Errors = []api2go.Error{{Status: strconv.Itoa(status), Title: msg}}
+	return httpErr
+}
+
+// constraintHTTPError converts an error of a database write into an api2go
+// error, keeping the status of constraint violations
+func constraintHTTPError(err error) error {
+	if status, title, ok := constraintViolation(err); ok {
+		return newHTTPError(err, title, status)
+	}
+	return newHTTPError(err, err.Error(), http.StatusInternalServerError)
+}
+
+// writeConstraintError writes the response for an error of a database write
+func writeConstraintError(w http.ResponseWriter, err error) {
+	if status, title, ok := constraintViolation(err); ok {
+		writeError(w, status, title)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
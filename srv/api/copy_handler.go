@@ -0,0 +1,393 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"srv/storage"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// CopyHandler serves the endpoints that duplicate documents and whole folder subtrees
+type CopyHandler struct {
+	DB    *gorm.DB
+	Blobs storage.Storage
+}
+
+// NewCopyHandler creates a new CopyHandler
+func NewCopyHandler(db *gorm.DB, blobs storage.Storage) *CopyHandler {
+	return &CopyHandler{
+		DB:    db,
+		Blobs: blobs,
+	}
+}
+
+// Register adds the copy routes to the router
+func (h CopyHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodPost, prefix+"/documents/:id/copy", h.CopyDocument)
+	router.Handle(http.MethodPost, prefix+"/folders/:id/copy", h.CopyFolder)
+}
+
+// CopyDocument copies a document along with its tags and attachments. The
+// optional `folder_id` and `title` attributes of the request body place and
+// name the copy, defaulting to the folder and title of the original, and the
+// `on_conflict` query parameter decides what happens if the title is taken.
+// The copy starts a version history of its own.
+func (h CopyHandler) CopyDocument(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	source, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleViewer, preloadTags)
+	if !ok {
+		return
+	}
+	userID, _ := requestUserID(r)
+
+	policy, err := parseConflictPolicy(r.URL.Query()["on_conflict"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	target := models.Document{Title: source.Title, FolderID: source.FolderID}
+	if err := readCopyAttributes(r, &target); err != nil {
+		logrus.WithError(err).Warn("Invalid copy request")
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ownerID, ok := h.targetOwner(w, userID, target.FolderID)
+	if !ok {
+		return
+	}
+
+	siblings, err := database.SiblingDocumentTitles(h.DB, ownerID, target.FolderID, uuid.Nil)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find sibling documents")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	title, err := resolveNameConflict(policy, target.Title, siblings, "A document")
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":        source.ID,
+		"folder_id": target.FolderID,
+		"user_id":   ownerID,
+	}).Info("Copying document")
+
+	c := &copier{ctx: r.Context(), blobs: h.Blobs, userID: userID, ownerID: ownerID}
+	var document models.Document
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		c.tx = tx
+		document, err = c.copyDocument(source, target.FolderID, title)
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditCreate, userID, nil, document); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventCreated, document, userID, map[string]interface{}{"copied_from": source.ID})
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("id", source.ID).Error("Failed to copy document")
+		c.discard()
+		writeConstraintError(w, err)
+		return
+	}
+
+	writeResponse(w, http.StatusCreated, document, c.meta())
+}
+
+// CopyFolder copies a folder along with all of its subfolders and documents,
+// their tags and attachments. The optional `parent_id` and `name` attributes
+// of the request body place and name the copy, defaulting to the parent and
+// name of the original, and the `on_conflict` query parameter decides what
+// happens if the name is taken. Items in the trash are not copied.
+func (h CopyHandler) CopyFolder(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	source, ok := findRequestFolder(h.DB, w, r, params["id"], models.RoleViewer, preloadTags)
+	if !ok {
+		return
+	}
+	userID, _ := requestUserID(r)
+
+	policy, err := parseFolderConflictPolicy(r.URL.Query()["on_conflict"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	target := models.Folder{Name: source.Name, ParentID: source.ParentID}
+	if err := readCopyAttributes(r, &target); err != nil {
+		logrus.WithError(err).Warn("Invalid copy request")
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ownerID, ok := h.targetOwner(w, userID, target.ParentID)
+	if !ok {
+		return
+	}
+
+	// Copying a folder into its own subtree would never end
+	if target.ParentID != nil {
+		var count int64
+		if err := h.DB.Model(&models.Folder{}).
+			Where("id = ? AND id IN (?)", *target.ParentID, database.FolderSubtreeIDs(h.DB, source.ID)).
+			Count(&count).Error; err != nil {
+			logrus.WithError(err).WithField("id", source.ID).Error("Failed to check folder subtree")
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if count > 0 {
+			logrus.WithFields(logrus.Fields{
+				"id":        source.ID,
+				"parent_id": target.ParentID,
+			}).Warn("Folder cannot be copied into itself")
+			writeError(w, http.StatusBadRequest, "Folder cannot be copied into itself or one of its subfolders")
+			return
+		}
+	}
+
+	siblings, err := database.SiblingFolderNames(h.DB, ownerID, target.ParentID, uuid.Nil)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find sibling folders")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	name, err := resolveNameConflict(policy, target.Name, siblings, "A folder")
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":        source.ID,
+		"parent_id": target.ParentID,
+		"user_id":   ownerID,
+	}).Info("Copying folder")
+
+	c := &copier{ctx: r.Context(), blobs: h.Blobs, userID: userID, ownerID: ownerID}
+	var folder models.Folder
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		c.tx = tx
+		if err := c.loadSubtree(source.ID); err != nil {
+			return err
+		}
+		folder, err = c.copyFolder(source, target.ParentID, name)
+		if err != nil {
+			return err
+		}
+		// Like a recursive delete, one audit entry and event stand for the
+		// copied subtree
+		if err := recordAudit(tx, models.AuditCreate, userID, nil, folder); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventCreated, folder, userID, map[string]interface{}{"copied_from": source.ID})
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("id", source.ID).Error("Failed to copy folder")
+		c.discard()
+		writeConstraintError(w, err)
+		return
+	}
+
+	writeResponse(w, http.StatusCreated, folder, c.meta())
+}
+
+// targetOwner returns the owner of copies made in a folder, writing an error
+// response if the user can't copy into it. Copying into a folder requires
+// editor access and the copies belong to the folder's owner, while copies in
+// the root belong to the user.
+func (h CopyHandler) targetOwner(w http.ResponseWriter, userID uuid.UUID, folderID *uuid.UUID) (uuid.UUID, bool) {
+	if folderID == nil {
+		return userID, true
+	}
+
+	folder, err := findFolder(h.DB, userID, *folderID, models.RoleEditor)
+	if err != nil {
+		writeAccessError(w, err)
+		return uuid.Nil, false
+	}
+	return folder.UserID, true
+}
+
+// readCopyAttributes decodes the attributes of a copy request over target,
+// which holds the defaults. The request body is optional.
+func readCopyAttributes(r *http.Request, target interface{}) error {
+	err := readAttributes(r, target)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// copier duplicates documents and folders for a new owner within a
+// transaction. Attachment blobs are copied along the way and their keys
+// remembered, so that they can be deleted should the transaction fail.
+type copier struct {
+	ctx   context.Context
+	tx    *gorm.DB
+	blobs storage.Storage
+	// userID is the user making the copy, who authors the first versions
+	userID uuid.UUID
+	// ownerID is the user the copies belong to
+	ownerID uuid.UUID
+
+	// subfolders and documents hold the items of the copied subtree by folder ID
+	subfolders map[uuid.UUID][]models.Folder
+	documents  map[uuid.UUID][]models.Document
+
+	folderCount   int
+	documentCount int
+	blobKeys      []string
+}
+
+// loadSubtree loads the subfolders and documents below a folder, along with their tags
+func (c *copier) loadSubtree(folderID uuid.UUID) error {
+	var folders []models.Folder
+	if err := c.tx.Scopes(preloadTags).
+		Where("id IN (?) AND id <> ?", database.FolderSubtreeIDs(c.tx, folderID), folderID).
+		Order("name").
+		Find(&folders).Error; err != nil {
+		return err
+	}
+	var documents []models.Document
+	if err := c.tx.Scopes(preloadTags).
+		Where("folder_id IN (?)", database.FolderSubtreeIDs(c.tx, folderID)).
+		Order("title").
+		Find(&documents).Error; err != nil {
+		return err
+	}
+
+	c.subfolders = make(map[uuid.UUID][]models.Folder)
+	for _, folder := range folders {
+		c.subfolders[*folder.ParentID] = append(c.subfolders[*folder.ParentID], folder)
+	}
+	c.documents = make(map[uuid.UUID][]models.Document)
+	for _, document := range documents {
+		c.documents[*document.FolderID] = append(c.documents[*document.FolderID], document)
+	}
+	return nil
+}
+
+// copyFolder copies a folder into parentID under the given name, followed by
+// its documents and subfolders as loaded by loadSubtree
+func (c *copier) copyFolder(source models.Folder, parentID *uuid.UUID, name string) (models.Folder, error) {
+	tags, err := database.MatchTags(c.tx, c.ownerID, source.Tags)
+	if err != nil {
+		return models.Folder{}, err
+	}
+
+	folder := models.Folder{
+		Name:     name,
+		UserID:   c.ownerID,
+		ParentID: parentID,
+		Tags:     tags,
+		Version:  1,
+	}
+	if err := c.tx.Create(&folder).Error; err != nil {
+		return models.Folder{}, err
+	}
+	c.folderCount++
+
+	for _, document := range c.documents[source.ID] {
+		if _, err := c.copyDocument(document, &folder.ID, document.Title); err != nil {
+			return models.Folder{}, err
+		}
+	}
+	for _, subfolder := range c.subfolders[source.ID] {
+		if _, err := c.copyFolder(subfolder, &folder.ID, subfolder.Name); err != nil {
+			return models.Folder{}, err
+		}
+	}
+	return folder, nil
+}
+
+// copyDocument copies a document into folderID under the given title, along
+// with its tags and attachments
+func (c *copier) copyDocument(source models.Document, folderID *uuid.UUID, title string) (models.Document, error) {
+	tags, err := database.MatchTags(c.tx, c.ownerID, source.Tags)
+	if err != nil {
+		return models.Document{}, err
+	}
+
+	document := models.Document{
+		Title:       title,
+		Content:     source.Content,
+		ContentType: source.ContentType,
+		Revision:    1,
+		Version:     1,
+		UserID:      c.ownerID,
+		FolderID:    folderID,
+		Tags:        tags,
+	}
+	if err := c.tx.Create(&document).Error; err != nil {
+		return models.Document{}, err
+	}
+	version := document.NewVersion(c.userID)
+	if err := c.tx.Create(&version).Error; err != nil {
+		return models.Document{}, err
+	}
+	c.documentCount++
+
+	var attachments []models.Attachment
+	if err := c.tx.Where("document_id = ?", source.ID).Order("created_at").Order("id").Find(&attachments).Error; err != nil {
+		return models.Document{}, err
+	}
+	for _, attachment := range attachments {
+		if err := c.copyAttachment(attachment, document.ID); err != nil {
+			return models.Document{}, err
+		}
+	}
+	return document, nil
+}
+
+// copyAttachment copies an attachment and its blob to another document
+func (c *copier) copyAttachment(source models.Attachment, documentID uuid.UUID) error {
+	attachment := models.Attachment{
+		ID:          uuid.New(),
+		DocumentID:  documentID,
+		UserID:      c.userID,
+		Filename:    source.Filename,
+		ContentType: source.ContentType,
+		Size:        source.Size,
+		SHA256:      source.SHA256,
+	}
+	attachment.StorageKey = attachmentStorageKey(attachment)
+
+	blob, err := c.blobs.Get(c.ctx, source.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	c.blobKeys = append(c.blobKeys, attachment.StorageKey)
+	if err := c.blobs.Put(c.ctx, attachment.StorageKey, blob, source.Size, source.ContentType); err != nil {
+		return err
+	}
+	return c.tx.Create(&attachment).Error
+}
+
+// discard deletes the blobs copied by a failed copy
+func (c *copier) discard() {
+	if err := storage.DeleteAll(c.ctx, c.blobs, c.blobKeys); err != nil {
+		logrus.WithError(err).Error("Failed to delete copied attachment blobs")
+	}
+}
+
+// meta summarizes what has been copied
+func (c *copier) meta() map[string]interface{} {
+	return map[string]interface{}{
+		"folders":     c.folderCount,
+		"documents":   c.documentCount,
+		"attachments": len(c.blobKeys),
+	}
+}
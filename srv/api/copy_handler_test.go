@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyHandler(t *testing.T) {
+	// Setup test database and storage
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+	blobs := newTestStorage(t)
+
+	// Create handler and document resource
+	handler := NewCopyHandler(db, blobs)
+	documents := NewDocumentResource(db)
+
+	// Create test users
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "otheruser", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	// Create the template Template/Plan and Template/Drafts/Notes, where Notes
+	// has an attachment and the template folder and Plan carry a tag
+	tag := models.Tag{Name: "Template", UserID: user.ID}
+	require.NoError(t, db.Create(&tag).Error, "Failed to create tag")
+	template := models.Folder{Name: "Template", UserID: user.ID, Tags: []models.Tag{tag}}
+	require.NoError(t, db.Create(&template).Error, "Failed to create folder")
+	drafts := models.Folder{Name: "Drafts", UserID: user.ID, ParentID: &template.ID}
+	require.NoError(t, db.Create(&drafts).Error, "Failed to create subfolder")
+
+	resp, err := documents.Create(models.Document{Title: "Plan", Content: "Step 1", ContentType: models.ContentTypeMarkdown, FolderID: &template.ID, Tags: []models.Tag{{ID: tag.ID}}}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	plan := resp.Result().(models.Document)
+	resp, err = documents.Create(models.Document{Title: "Notes", FolderID: &drafts.ID}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	notes := resp.Result().(models.Document)
+
+	attachment := models.Attachment{ID: uuid.New(), DocumentID: notes.ID, UserID: user.ID, Filename: "notes.txt", ContentType: "text/plain", Size: 5, SHA256: "hash"}
+	attachment.StorageKey = attachmentStorageKey(attachment)
+	require.NoError(t, blobs.Put(context.Background(), attachment.StorageKey, strings.NewReader("hello"), 5, "text/plain"), "Failed to store blob")
+	require.NoError(t, db.Create(&attachment).Error, "Failed to create attachment")
+
+	// Documents in the trash are not copied
+	deleted := models.Document{Title: "Deleted", UserID: user.ID, FolderID: &drafts.ID}
+	require.NoError(t, db.Create(&deleted).Error, "Failed to create document")
+	require.NoError(t, db.Delete(&deleted).Error, "Failed to delete document")
+
+	serve := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), id uuid.UUID, query, body string, userID uuid.UUID) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(`{"data": {"attributes": ` + body + `}}`)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/"+query, reader)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		h(rec, req, map[string]string{"id": id.String()}, nil)
+		return rec
+	}
+
+	decode := func(rec *httptest.ResponseRecorder) (uuid.UUID, map[string]interface{}) {
+		var body struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+			Meta map[string]interface{} `json:"meta"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		id, err := uuid.Parse(body.Data.ID)
+		require.NoError(t, err, "Expected the ID of the copy")
+		return id, body.Meta
+	}
+
+	countRows := func(model interface{}, query string, args ...interface{}) int64 {
+		var count int64
+		require.NoError(t, db.Model(model).Where(query, args...).Count(&count).Error, "Failed to count rows")
+		return count
+	}
+
+	t.Run("CopyDocument", func(t *testing.T) {
+		// The copy would take the title of the original in the same folder
+		rec := serve(handler.CopyDocument, plan.ID, "", "", user.ID)
+		assert.Equal(t, http.StatusConflict, rec.Code, "Expected status code 409")
+
+		rec = serve(handler.CopyDocument, plan.ID, "?on_conflict=rename", "", user.ID)
+		require.Equal(t, http.StatusCreated, rec.Code, "Expected status code 201")
+		id, meta := decode(rec)
+		assert.Equal(t, float64(1), meta["documents"], "Expected one copied document")
+
+		var copied models.Document
+		require.NoError(t, db.Preload("Tags").First(&copied, "id = ?", id).Error, "Failed to find copy")
+		assert.NotEqual(t, plan.ID, copied.ID, "Expected a fresh ID")
+		assert.Equal(t, "Plan (2)", copied.Title, "Expected the title to be renamed")
+		assert.Equal(t, "Step 1", copied.Content, "Expected the content to be copied")
+		assert.Equal(t, models.ContentTypeMarkdown, copied.ContentType, "Expected the content type to be copied")
+		assert.Equal(t, template.ID, *copied.FolderID, "Expected the copy next to the original")
+		assert.Equal(t, 1, copied.Revision, "Expected the copy to start at revision 1")
+		require.Len(t, copied.Tags, 1, "Expected the tag to be copied")
+		assert.Equal(t, tag.ID, copied.Tags[0].ID, "Expected the same tag for the same owner")
+		assert.Equal(t, int64(1), countRows(&models.DocumentVersion{}, "document_id = ?", id), "Expected a version history of its own")
+		assert.Equal(t, int64(1), countRows(&models.AuditEntry{}, "action = ? AND target_id = ? AND actor_id = ?", models.AuditCreate, id, user.ID),
+			"Expected the copy to be audited")
+	})
+
+	t.Run("CopyDocumentWithAttachments", func(t *testing.T) {
+		rec := serve(handler.CopyDocument, notes.ID, "", `{"folder_id": null, "title": "My Notes"}`, user.ID)
+		require.Equal(t, http.StatusCreated, rec.Code, "Expected status code 201")
+		id, meta := decode(rec)
+		assert.Equal(t, float64(1), meta["attachments"], "Expected one copied attachment")
+
+		var copied models.Document
+		require.NoError(t, db.First(&copied, "id = ?", id).Error, "Failed to find copy")
+		assert.Equal(t, "My Notes", copied.Title, "Expected the given title")
+		assert.Nil(t, copied.FolderID, "Expected the copy in the root")
+
+		var copiedAttachment models.Attachment
+		require.NoError(t, db.First(&copiedAttachment, "document_id = ?", id).Error, "Failed to find copied attachment")
+		assert.Equal(t, "notes.txt", copiedAttachment.Filename, "Expected the file name to be copied")
+		assert.NotEqual(t, attachment.StorageKey, copiedAttachment.StorageKey, "Expected a blob of its own")
+		blob, err := blobs.Get(context.Background(), copiedAttachment.StorageKey)
+		require.NoError(t, err, "Expected the blob to be copied")
+		defer blob.Close()
+		content, err := io.ReadAll(blob)
+		require.NoError(t, err, "Failed to read copied blob")
+		assert.Equal(t, "hello", string(content), "Expected the blob content to be copied")
+	})
+
+	t.Run("CopyFolder", func(t *testing.T) {
+		rec := serve(handler.CopyFolder, template.ID, "", `{"parent_id": null, "name": "Project"}`, user.ID)
+		require.Equal(t, http.StatusCreated, rec.Code, "Expected status code 201")
+		id, meta := decode(rec)
+		assert.Equal(t, float64(2), meta["folders"], "Expected two copied folders")
+		assert.Equal(t, float64(3), meta["documents"], "Expected three copied documents")
+		assert.Equal(t, float64(1), meta["attachments"], "Expected one copied attachment")
+
+		var project models.Folder
+		require.NoError(t, db.Preload("Tags").First(&project, "id = ?", id).Error, "Failed to find copy")
+		assert.Equal(t, "Project", project.Name, "Expected the given name")
+		assert.Nil(t, project.ParentID, "Expected the copy in the root")
+		require.Len(t, project.Tags, 1, "Expected the folder's tag to be copied")
+
+		var copiedDrafts models.Folder
+		require.NoError(t, db.First(&copiedDrafts, "parent_id = ?", project.ID).Error, "Expected the subfolder to be copied")
+		assert.Equal(t, "Drafts", copiedDrafts.Name, "Expected the subfolder to keep its name")
+		assert.NotEqual(t, drafts.ID, copiedDrafts.ID, "Expected a fresh ID")
+		assert.Equal(t, int64(2), countRows(&models.Document{}, "folder_id = ?", project.ID), "Expected the documents of the folder to be copied")
+		assert.Equal(t, int64(1), countRows(&models.Document{}, "folder_id = ?", copiedDrafts.ID), "Expected deleted documents to be skipped")
+
+		// One audit entry stands for the copied subtree
+		assert.Equal(t, int64(1), countRows(&models.AuditEntry{}, "action = ? AND target_id = ?", models.AuditCreate, project.ID), "Expected the copy to be audited")
+		assert.Equal(t, int64(0), countRows(&models.AuditEntry{}, "target_id = ?", copiedDrafts.ID), "Expected no entry for the copied subfolder")
+
+		// The original is left untouched
+		assert.Equal(t, int64(1), countRows(&models.Folder{}, "parent_id = ?", template.ID), "Expected the original subtree to be unchanged")
+	})
+
+	t.Run("CopyFolderIntoItself", func(t *testing.T) {
+		rec := serve(handler.CopyFolder, template.ID, "", `{"parent_id": "`+drafts.ID.String()+`"}`, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+	})
+
+	t.Run("CopySharedFolder", func(t *testing.T) {
+		rec := serve(handler.CopyFolder, template.ID, "", `{"parent_id": null}`, other.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected unshared folders not to be found")
+
+		share := models.Share{UserID: other.ID, OwnerID: user.ID, CreatedByID: user.ID, FolderID: &template.ID, Role: models.RoleViewer}
+		require.NoError(t, db.Create(&share).Error, "Failed to create share")
+
+		// Viewers can't copy into the shared folder
+		rec = serve(handler.CopyFolder, drafts.ID, "?on_conflict=rename", "", other.ID)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "Expected status code 403")
+
+		rec = serve(handler.CopyFolder, template.ID, "", `{"parent_id": null}`, other.ID)
+		require.Equal(t, http.StatusCreated, rec.Code, "Expected status code 201")
+		id, _ := decode(rec)
+
+		var copied models.Folder
+		require.NoError(t, db.Preload("Tags").First(&copied, "id = ?", id).Error, "Failed to find copy")
+		assert.Equal(t, other.ID, copied.UserID, "Expected the copy to belong to the copying user")
+		require.Len(t, copied.Tags, 1, "Expected the tag to be carried over")
+		assert.Equal(t, other.ID, copied.Tags[0].UserID, "Expected a tag of the new owner")
+		assert.Equal(t, "Template", copied.Tags[0].Name, "Expected the tag name to be kept")
+		assert.Equal(t, int64(1), countRows(&models.Tag{}, "user_id = ?", other.ID), "Expected a single tag to be created")
+		assert.Equal(t, int64(2), countRows(&models.Document{}, "folder_id = ? AND user_id = ?", id, other.ID),
+			"Expected the copied documents to belong to the copying user")
+	})
+
+	t.Run("RollsBackOnFailure", func(t *testing.T) {
+		require.NoError(t, blobs.Delete(context.Background(), attachment.StorageKey), "Failed to delete blob")
+		folders := countRows(&models.Folder{}, "1 = 1")
+		entries := countRows(&models.AuditEntry{}, "1 = 1")
+
+		rec := serve(handler.CopyFolder, drafts.ID, "?on_conflict=rename", "", user.ID)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code, "Expected status code 500")
+		assert.Equal(t, folders, countRows(&models.Folder{}, "1 = 1"), "Expected nothing to be copied")
+		assert.Equal(t, entries, countRows(&models.AuditEntry{}, "1 = 1"), "Expected nothing to be audited")
+	})
+
+	t.Run("InvalidPolicy", func(t *testing.T) {
+		rec := serve(handler.CopyDocument, plan.ID, "?on_conflict=replace", "", user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+		rec = serve(handler.CopyFolder, drafts.ID, "?on_conflict=allow", "", user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected folders not to allow duplicate names")
+	})
+}
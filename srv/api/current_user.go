@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+	"srv/auth"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+)
+
+// currentUserID returns the ID of the authenticated user making the request
+func currentUserID(req api2go.Request) (uuid.UUID, error) {
+	if req.PlainRequest != nil {
+		if userID, ok := auth.UserIDFromContext(req.PlainRequest.Context()); ok {
+			return userID, nil
+		}
+	}
+	return uuid.Nil, newHTTPError(nil, "Authentication required", http.StatusUnauthorized)
+}
+
+// requestUserID returns the ID of the authenticated user making a plain HTTP request
+func requestUserID(r *http.Request) (uuid.UUID, bool) {
+	return auth.UserIDFromContext(r.Context())
+}
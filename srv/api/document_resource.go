@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"srv/database"
 	"srv/models"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/manyminds/api2go"
@@ -15,6 +18,14 @@ type DocumentResource struct {
 	DB *gorm.DB
 }
 
+// documentSortFields are the attributes documents can be sorted by
+var documentSortFields = map[string]sortField{
+	"title":      {Column: "title"},
+	"revision":   {Column: "revision"},
+	"created_at": {Column: "created_at", Time: true},
+	"updated_at": {Column: "updated_at", Time: true},
+}
+
 // NewDocumentResource creates a new DocumentResource
 func NewDocumentResource(db *gorm.DB) *DocumentResource {
 	return &DocumentResource{
@@ -26,8 +37,51 @@ func NewDocumentResource(db *gorm.DB) *DocumentResource {
 func (r DocumentResource) FindAll(req api2go.Request) (api2go.Responder, error) {
 	logrus.Info("Finding all documents")
 
-	var documents []models.Document
-	query := r.DB
+	result, err := r.findDocuments(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of documents along with the total count
+func (r DocumentResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of documents")
+
+	result, err := r.findDocuments(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findDocuments loads the documents matching the request's filters, sort and page
+func (r DocumentResource) findDocuments(req api2go.Request) (page[models.Document], error) {
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return page[models.Document]{}, err
+	}
+
+	includes, err := parseIncludes(req, documentIncludes)
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid include parameter")
+		return page[models.Document]{}, err
+	}
+
+	// Documents of other users are listed when they have been shared with the current user
+	query := r.DB.Model(&models.Document{}).
+		Scopes(preloadTags, database.AccessibleDocuments(currentUser)).
+		Scopes(includeScopes(includes, documentIncludes, currentUser)...)
+	defaultSort := []sortTerm{{sortField: documentSortFields["created_at"]}}
+
+	// Restrict to the documents related to another resource for routes such as
+	// GET /v1/folders/{id}/documents
+	query, err = r.linkedDocuments(req, currentUser, query)
+	if err != nil {
+		return page[models.Document]{}, err
+	}
 
 	// Filter by user ID if provided
 	if userID, ok := req.QueryParams["user_id"]; ok && len(userID) > 0 {
@@ -36,10 +90,15 @@ func (r DocumentResource) FindAll(req api2go.Request) (api2go.Responder, error)
 		uuid, err := uuid.Parse(userID[0])
 		if err != nil {
 			logrus.WithError(err).WithField("user_id", userID[0]).Error("Invalid user ID")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+			return page[models.Document]{}, newHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+		}
+
+		if uuid != currentUser {
+			logrus.WithField("user_id", userID[0]).Warn("Cannot list another user's documents")
+			return page[models.Document]{}, newHTTPError(nil, "Cannot access another user's documents", http.StatusForbidden)
 		}
 
-		query = query.Where("user_id = ?", uuid)
+		query = query.Where("documents.user_id = ?", uuid)
 	}
 
 	// Filter by folder ID if provided
@@ -54,19 +113,118 @@ func (r DocumentResource) FindAll(req api2go.Request) (api2go.Responder, error)
 			uuid, err := uuid.Parse(folderID[0])
 			if err != nil {
 				logrus.WithError(err).WithField("folder_id", folderID[0]).Error("Invalid folder ID")
-				return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid folder ID", http.StatusBadRequest)
+				return page[models.Document]{}, newHTTPError(err, "Invalid folder ID", http.StatusBadRequest)
 			}
 
 			query = query.Where("folder_id = ?", uuid)
 		}
 	}
 
-	if err := query.Find(&documents).Error; err != nil {
+	// Restrict to a folder and all of its subfolders if provided
+	if folderID, ok := req.QueryParams["filter[folder_id]"]; ok && len(folderID) > 0 {
+		logrus.WithField("folder_id", folderID[0]).Info("Filtering documents by folder subtree")
+
+		uuid, err := uuid.Parse(folderID[0])
+		if err != nil {
+			logrus.WithError(err).WithField("folder_id", folderID[0]).Error("Invalid folder ID")
+			return page[models.Document]{}, newHTTPError(err, "Invalid folder ID", http.StatusBadRequest)
+		}
+
+		query = query.Where("folder_id IN (?)", database.FolderSubtreeIDs(r.DB, uuid))
+	}
+
+	// Filter by tag names if provided: every comma-separated group must match one of its |-separated names
+	if tags, ok := req.QueryParams["filter[tag]"]; ok && len(tags) > 0 {
+		logrus.WithField("tags", tags).Info("Filtering documents by tags")
+
+		groups, err := parseTagFilter(tags)
+		if err != nil {
+			logrus.WithError(err).Warn("Invalid tag filter")
+			return page[models.Document]{}, err
+		}
+		for _, names := range groups {
+			query = query.Where("documents.id IN (?)", database.TaggedIDs(r.DB, database.DocumentTagsTable, "document_id", names))
+		}
+	}
+
+	// Filter by content type if provided: any of the comma-separated types matches
+	if contentTypes, ok := req.QueryParams["filter[content_type]"]; ok && len(contentTypes) > 0 {
+		for _, contentType := range contentTypes {
+			if !models.ValidContentType(contentType) {
+				logrus.WithField("content_type", contentType).Warn("Invalid content type filter")
+				return page[models.Document]{}, newHTTPError(nil, "Invalid content type", http.StatusBadRequest)
+			}
+		}
+		query = query.Where("documents.content_type IN ?", contentTypes)
+	}
+
+	// Full-text search over title and content if provided, best matches first
+	searching := false
+	if q, ok := req.QueryParams["filter[q]"]; ok && len(q) > 0 {
+		// api2go splits query parameters on commas, so put the search text back together
+		text := strings.TrimSpace(strings.Join(q, ","))
+		if text == "" {
+			return page[models.Document]{}, newHTTPError(nil, "Search query must not be empty", http.StatusBadRequest)
+		}
+
+		logrus.WithField("q", text).Info("Searching documents")
+		query = query.Scopes(database.SearchDocuments(text))
+		searching = true
+		defaultSort = []sortTerm{{sortField: sortField{Column: "rank"}, Desc: true}}
+	}
+
+	opts, err := parseListOptions(req, documentSortFields, defaultSort)
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.Document]{}, err
+	}
+
+	// The search rank is computed per query, so it can't be used as a cursor
+	if searching && opts.Cursor {
+		logrus.Warn("Cursor pagination requested for search")
+		return page[models.Document]{}, newHTTPError(nil, "Search results support page[number] or page[offset] pagination only", http.StatusBadRequest)
+	}
+
+	result, err := findPage[models.Document](query, opts)
+	if err != nil {
 		logrus.WithError(err).Error("Failed to find documents")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return page[models.Document]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
-	return &api2go.Response{Res: documents, Code: http.StatusOK}, nil
+	for i := range result.Items {
+		includeDocument(&result.Items[i], includes, currentUser)
+		setExcerpt(&result.Items[i])
+	}
+	return result, nil
+}
+
+// linkedDocuments restricts a query to the documents related to the resource
+// api2go lists them for: the documents of a folder or of a user
+func (r DocumentResource) linkedDocuments(req api2go.Request, currentUser uuid.UUID, query *gorm.DB) (*gorm.DB, error) {
+	folderID, _, ok, err := linkedResource(req, "folders")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if _, err := findFolder(r.DB, currentUser, folderID, models.RoleViewer); err != nil {
+			return nil, accessHTTPError(err)
+		}
+		query = query.Where("documents.folder_id = ?", folderID)
+	}
+
+	userID, _, ok, err := linkedResource(req, "users")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if userID != currentUser {
+			logrus.WithField("user_id", userID).Warn("Cannot list another user's documents")
+			return nil, newHTTPError(nil, "Cannot access another user's documents", http.StatusForbidden)
+		}
+		query = query.Where("documents.user_id = ?", userID)
+	}
+
+	return query, nil
 }
 
 // FindOne returns a single document
@@ -76,19 +234,28 @@ func (r DocumentResource) FindOne(id string, req api2go.Request) (api2go.Respond
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Invalid document ID")
-		return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid document ID", http.StatusBadRequest)
+		return &api2go.Response{}, newHTTPError(err, "Invalid document ID", http.StatusBadRequest)
 	}
 
-	var document models.Document
-	if err := r.DB.First(&document, "id = ?", uuid).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logrus.WithField("id", id).Warn("Document not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "Document not found", http.StatusNotFound)
-		}
-		logrus.WithError(err).WithField("id", id).Error("Failed to find document")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	includes, err := parseIncludes(req, documentIncludes)
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid include parameter")
+		return &api2go.Response{}, err
+	}
+
+	scopes := append([]func(*gorm.DB) *gorm.DB{preloadTags}, includeScopes(includes, documentIncludes, currentUser)...)
+	document, err := findDocument(r.DB, currentUser, uuid, models.RoleViewer, scopes...)
+	if err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
 	}
+	includeDocument(&document, includes, currentUser)
 
+	setETag(req, document.ETag())
 	return &api2go.Response{Res: document, Code: http.StatusOK}, nil
 }
 
@@ -96,11 +263,28 @@ func (r DocumentResource) FindOne(id string, req api2go.Request) (api2go.Respond
 func (r DocumentResource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
 	document, ok := obj.(models.Document)
 	if !ok {
-		err := api2go.NewHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
 		logrus.WithError(err).Error("Invalid instance given to create document")
 		return &api2go.Response{}, err
 	}
 
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	policy, err := conflictPolicy(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Documents are always created for the authenticated user
+	if document.UserID != uuid.Nil && document.UserID != currentUser {
+		logrus.WithField("user_id", document.UserID).Warn("Cannot create document for another user")
+		return &api2go.Response{}, newHTTPError(nil, "Cannot create documents for another user", http.StatusForbidden)
+	}
+	document.UserID = currentUser
+
 	logrus.WithFields(logrus.Fields{
 		"title":     document.Title,
 		"user_id":   document.UserID,
@@ -112,40 +296,63 @@ func (r DocumentResource) Create(obj interface{}, req api2go.Request) (api2go.Re
 	if err := r.DB.First(&user, "id = ?", document.UserID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			logrus.WithField("user_id", document.UserID).Warn("User not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "User not found", http.StatusNotFound)
+			return &api2go.Response{}, newHTTPError(err, "User not found", http.StatusNotFound)
 		}
 		logrus.WithError(err).WithField("user_id", document.UserID).Error("Failed to find user")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
-	// Validate folder exists if provided
+	// Creating a document in a folder requires editor access to it. The
+	// document then belongs to the folder's owner, like the rest of the tree.
 	if document.FolderID != nil {
-		var folder models.Folder
-		if err := r.DB.First(&folder, "id = ?", document.FolderID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				logrus.WithField("folder_id", document.FolderID).Warn("Folder not found")
-				return &api2go.Response{}, api2go.NewHTTPError(err, "Folder not found", http.StatusNotFound)
-			}
-			logrus.WithError(err).WithField("folder_id", document.FolderID).Error("Failed to find folder")
-			return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		folder, err := findFolder(r.DB, currentUser, *document.FolderID, models.RoleEditor)
+		if err != nil {
+			return &api2go.Response{}, accessHTTPError(err)
 		}
+		document.UserID = folder.UserID
+	}
 
-		// Ensure folder belongs to the same user
-		if folder.UserID != document.UserID {
-			err := api2go.NewHTTPError(nil, "Folder does not belong to the user", http.StatusBadRequest)
-			logrus.WithFields(logrus.Fields{
-				"folder_id": document.FolderID,
-				"user_id":   document.UserID,
-			}).Warn("Folder does not belong to the user")
-			return &api2go.Response{}, err
-		}
+	if err := r.resolveTitle(policy, &document); err != nil {
+		return &api2go.Response{}, err
 	}
 
-	if err := r.DB.Create(&document).Error; err != nil {
+	// Tags must belong to the document's owner
+	document.Tags, err = resolveTags(r.DB, document.UserID, document.Tags)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Documents without a content type hold plain text
+	if document.ContentType == "" {
+		document.ContentType = models.ContentTypePlain
+	}
+	if !models.ValidContentType(document.ContentType) {
+		logrus.WithField("content_type", document.ContentType).Warn("Invalid content type")
+		return &api2go.Response{}, newHTTPError(nil, "Invalid content type", http.StatusBadRequest)
+	}
+
+	// Create the document along with its first version and tags
+	document.Revision = 1
+	document.Version = 1
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&document).Error; err != nil {
+			return err
+		}
+		version := document.NewVersion(currentUser)
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditCreate, currentUser, nil, document); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventCreated, document, currentUser, nil)
+	})
+	if err != nil {
 		logrus.WithError(err).Error("Failed to create document")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, constraintHTTPError(err)
 	}
 
+	setETag(req, document.ETag())
 	return &api2go.Response{Res: document, Code: http.StatusCreated}, nil
 }
 
@@ -156,86 +363,223 @@ func (r DocumentResource) Delete(id string, req api2go.Request) (api2go.Responde
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Invalid document ID")
-		return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid document ID", http.StatusBadRequest)
+		return &api2go.Response{}, newHTTPError(err, "Invalid document ID", http.StatusBadRequest)
 	}
 
-	// Check if document exists
-	var document models.Document
-	if err := r.DB.First(&document, "id = ?", uuid).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logrus.WithField("id", id).Warn("Document not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "Document not found", http.StatusNotFound)
-		}
-		logrus.WithError(err).WithField("id", id).Error("Failed to find document")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Only owners may delete a document. Its tags are loaded for the audit trail.
+	document, err := findDocument(r.DB, currentUser, uuid, models.RoleOwner, preloadTags)
+	if err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
 	}
 
 	// Delete document
-	if err := r.DB.Delete(&document).Error; err != nil {
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&document).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditDelete, currentUser, document, nil); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventDeleted, document, currentUser, nil)
+	})
+	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to delete document")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
 	return &api2go.Response{Code: http.StatusNoContent}, nil
 }
 
-// Update updates a document
+// Update updates a document. Changing the title or content starts a new
+// revision with its DocumentVersion snapshot; moves and changes of the tags or
+// content type only increment the version.
 func (r DocumentResource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
 	document, ok := obj.(models.Document)
 	if !ok {
-		err := api2go.NewHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
 		logrus.WithError(err).Error("Invalid instance given to update document")
 		return &api2go.Response{}, err
 	}
 
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"id":        document.ID,
 		"title":     document.Title,
 		"folder_id": document.FolderID,
 	}).Info("Updating document")
 
-	// Check if document exists
-	var existingDocument models.Document
-	if err := r.DB.First(&existingDocument, "id = ?", document.ID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logrus.WithField("id", document.ID).Warn("Document not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "Document not found", http.StatusNotFound)
+	policy, err := conflictPolicy(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Changing a document requires editor access. Its tags are loaded for the
+	// audit trail.
+	existingDocument, err := findDocument(r.DB, currentUser, document.ID, models.RoleEditor, preloadTags)
+	if err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
+	}
+
+	// Reject changes based on an outdated version of the document
+	if !ifMatch(req, existingDocument.ETag()) {
+		logrus.WithField("id", document.ID).Warn("Document has been modified")
+		return &api2go.Response{}, r.conflict(req, currentUser, document.ID)
+	}
+
+	// Apply only the attributes present in the payload to the stored document.
+	// Absent attributes keep their values, while an explicit null folder_id
+	// moves the document to the root.
+	changes := document
+	document = existingDocument
+	if changes.HasAttribute("title") {
+		document.Title = changes.Title
+	}
+	if changes.HasAttribute("content") {
+		document.Content = changes.Content
+	}
+	// An empty content type keeps the current one, as documents that weren't
+	// decoded from a payload have all attributes
+	if changes.HasAttribute("content_type") && changes.ContentType != "" {
+		if !models.ValidContentType(changes.ContentType) {
+			logrus.WithField("content_type", changes.ContentType).Warn("Invalid content type")
+			return &api2go.Response{}, newHTTPError(nil, "Invalid content type", http.StatusBadRequest)
 		}
-		logrus.WithError(err).WithField("id", document.ID).Error("Failed to find document")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		document.ContentType = changes.ContentType
+	}
+	if changes.HasAttribute("folder_id") {
+		document.FolderID = changes.FolderID
 	}
 
-	// Validate folder exists if provided
-	if document.FolderID != nil {
-		var folder models.Folder
-		if err := r.DB.First(&folder, "id = ?", document.FolderID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				logrus.WithField("folder_id", document.FolderID).Warn("Folder not found")
-				return &api2go.Response{}, api2go.NewHTTPError(err, "Folder not found", http.StatusNotFound)
+	// Moving the document requires editor access to the target folder, which
+	// must belong to the document's owner. Only owners may move it to the root.
+	if !sameFolder(document.FolderID, existingDocument.FolderID) {
+		if document.FolderID == nil {
+			if existingDocument.UserID != currentUser {
+				logrus.WithField("id", document.ID).Warn("Only the owner can move a document to the root")
+				return &api2go.Response{}, newHTTPError(nil, "Only the owner can move a document to the root", http.StatusForbidden)
+			}
+		} else {
+			folder, err := findFolder(r.DB, currentUser, *document.FolderID, models.RoleEditor)
+			if err != nil {
+				return &api2go.Response{}, accessHTTPError(err)
+			}
+
+			if folder.UserID != existingDocument.UserID {
+				err := newHTTPError(nil, "Folder does not belong to the user", http.StatusBadRequest)
+				logrus.WithFields(logrus.Fields{
+					"folder_id": document.FolderID,
+					"user_id":   existingDocument.UserID,
+				}).Warn("Folder does not belong to the user")
+				return &api2go.Response{}, err
 			}
-			logrus.WithError(err).WithField("folder_id", document.FolderID).Error("Failed to find folder")
-			return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
 		}
+	}
 
-		// Ensure folder belongs to the same user
-		if folder.UserID != existingDocument.UserID {
-			err := api2go.NewHTTPError(nil, "Folder does not belong to the user", http.StatusBadRequest)
-			logrus.WithFields(logrus.Fields{
-				"folder_id": document.FolderID,
-				"user_id":   existingDocument.UserID,
-			}).Warn("Folder does not belong to the user")
+	// Only a new title or folder can conflict with the siblings
+	if document.Title != existingDocument.Title || !sameFolder(document.FolderID, existingDocument.FolderID) {
+		if err := r.resolveTitle(policy, &document); err != nil {
 			return &api2go.Response{}, err
 		}
 	}
 
-	// Preserve the user ID
-	document.UserID = existingDocument.UserID
+	// Tags are replaced only if the payload set the relationship to other
+	// tags, which must belong to the document's owner
+	tagsChanged := false
+	if changes.HasRelationship("tags") {
+		tags, err := resolveTags(r.DB, existingDocument.UserID, changes.Tags)
+		if err != nil {
+			return &api2go.Response{}, err
+		}
+		if tags != nil && !sameTags(tags, existingDocument.Tags) {
+			document.Tags = tags
+			tagsChanged = true
+		}
+	}
 
-	// Update document
-	if err := r.DB.Save(&document).Error; err != nil {
+	// Changing the title or content starts a new revision
+	contentChanged := document.Title != existingDocument.Title || document.Content != existingDocument.Content
+	document.Revision = existingDocument.Revision
+	if contentChanged {
+		document.Revision++
+	}
+	document.Version = existingDocument.Version + 1
+
+	// Update document and record the new version
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.ClaimVersion(tx, &models.Document{}, document.ID, existingDocument.Version); err != nil {
+			return err
+		}
+		if contentChanged {
+			if err := ensureVersion(tx, existingDocument); err != nil {
+				return err
+			}
+		}
+		if err := tx.Select("title", "content", "content_type", "folder_id", "revision", "updated_at").Updates(&document).Error; err != nil {
+			return err
+		}
+		if tagsChanged {
+			if err := tx.Model(&document).Association("Tags").Replace(document.Tags); err != nil {
+				return err
+			}
+		}
+		if contentChanged {
+			version := document.NewVersion(currentUser)
+			if err := tx.Create(&version).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := recordAudit(tx, models.AuditUpdate, currentUser, existingDocument, document); err != nil {
+			return err
+		}
+		moved := !sameFolder(document.FolderID, existingDocument.FolderID)
+		changed := contentChanged || document.ContentType != existingDocument.ContentType || tagsChanged
+		return recordChange(tx, document, currentUser, moved, changed,
+			map[string]interface{}{"previous_folder_id": existingDocument.FolderID})
+	})
+	if errors.Is(err, database.ErrVersionConflict) {
+		logrus.WithField("id", document.ID).Warn("Document was modified concurrently")
+		return &api2go.Response{}, r.conflict(req, currentUser, document.ID)
+	}
+	if err != nil {
 		logrus.WithError(err).WithField("id", document.ID).Error("Failed to update document")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, constraintHTTPError(err)
 	}
 
+	setETag(req, document.ETag())
 	return &api2go.Response{Res: document, Code: http.StatusOK}, nil
 }
+
+// conflict returns the error for an update of a document that has been
+// modified since the client read it, carrying the document's current state
+func (r DocumentResource) conflict(req api2go.Request, userID, id uuid.UUID) error {
+	current, err := findDocument(r.DB, userID, id, models.RoleViewer, preloadTags)
+	if err != nil {
+		return accessHTTPError(err)
+	}
+	return preconditionFailed(req, current, current.ETag(), "Document has been modified")
+}
+
+// resolveTitle applies a name conflict policy to a document about to be stored
+func (r DocumentResource) resolveTitle(policy string, document *models.Document) error {
+	siblings, err := database.SiblingDocumentTitles(r.DB, document.UserID, document.FolderID, document.ID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find sibling documents")
+		return newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	document.Title, err = resolveNameConflict(policy, document.Title, siblings, "A document")
+	if err != nil {
+		return newHTTPError(err, err.Error(), http.StatusConflict)
+	}
+	return nil
+}
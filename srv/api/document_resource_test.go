@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"srv/database"
 	"srv/models"
 	"testing"
@@ -35,7 +36,7 @@ func TestDocumentResource_CRUD(t *testing.T) {
 			UserID:  user.ID,
 		}
 
-		resp, err := resource.Create(doc, api2go.Request{})
+		resp, err := resource.Create(doc, newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to create document")
 		require.Equal(t, http.StatusCreated, resp.StatusCode(), "Expected status code 201")
 
@@ -57,7 +58,7 @@ func TestDocumentResource_CRUD(t *testing.T) {
 
 	// Test FindOne
 	t.Run("FindOne", func(t *testing.T) {
-		resp, err := resource.FindOne(doc.ID.String(), api2go.Request{})
+		resp, err := resource.FindOne(doc.ID.String(), newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to find document")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -71,7 +72,7 @@ func TestDocumentResource_CRUD(t *testing.T) {
 
 	// Test FindAll
 	t.Run("FindAll", func(t *testing.T) {
-		resp, err := resource.FindAll(api2go.Request{})
+		resp, err := resource.FindAll(newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to find all documents")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -102,7 +103,7 @@ func TestDocumentResource_CRUD(t *testing.T) {
 			UserID:  user.ID, // This will be preserved by the Update method
 		}
 
-		resp, err := resource.Update(updatedDoc, api2go.Request{})
+		resp, err := resource.Update(updatedDoc, newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to update document")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -120,9 +121,84 @@ func TestDocumentResource_CRUD(t *testing.T) {
 		assert.Equal(t, "Updated Content", dbDoc.Content, "Expected document content to be updated in database")
 	})
 
+	// Test partial updates
+	t.Run("PartialUpdate", func(t *testing.T) {
+		folder := models.Folder{Name: "Drafts", UserID: user.ID}
+		require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+		require.NoError(t, db.Model(&models.Document{}).Where("id = ?", doc.ID).Update("folder_id", folder.ID).Error, "Failed to move document")
+
+		// Stored state as read before the update; the content changes in the meantime
+		var stored models.Document
+		require.NoError(t, db.First(&stored, "id = ?", doc.ID).Error, "Failed to find document")
+		require.NoError(t, db.Model(&models.Document{}).Where("id = ?", doc.ID).Update("content", "Concurrent Content").Error, "Failed to change content")
+
+		applyPatch(t, &stored, "documents", doc.ID.String(), `{"title": "Renamed", "created_at": "2000-01-01T00:00:00Z"}`)
+		resp, err := resource.Update(stored, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update document")
+		result := resp.Result().(models.Document)
+		assert.Equal(t, "Renamed", result.Title, "Expected title to be updated")
+		assert.Equal(t, "Concurrent Content", result.Content, "Expected absent content to be kept")
+		assert.Equal(t, &folder.ID, result.FolderID, "Expected absent folder_id to be kept")
+
+		var dbDoc models.Document
+		require.NoError(t, db.First(&dbDoc, "id = ?", doc.ID).Error, "Failed to find document in database")
+		assert.Equal(t, "Concurrent Content", dbDoc.Content, "Expected absent content to be kept in database")
+		assert.Equal(t, &folder.ID, dbDoc.FolderID, "Expected absent folder_id to be kept in database")
+		assert.Equal(t, doc.CreatedAt.Unix(), dbDoc.CreatedAt.Unix(), "Expected created_at to be read-only")
+
+		// An explicit null moves the document to the root
+		applyPatch(t, &dbDoc, "documents", doc.ID.String(), `{"folder_id": null}`)
+		resp, err = resource.Update(dbDoc, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to move document to the root")
+		assert.Nil(t, resp.Result().(models.Document).FolderID, "Expected document to be moved to the root")
+		require.NoError(t, db.First(&dbDoc, "id = ?", doc.ID).Error, "Failed to find document in database")
+		assert.Nil(t, dbDoc.FolderID, "Expected document to be moved to the root in database")
+		assert.Equal(t, "Renamed", dbDoc.Title, "Expected absent title to be kept")
+	})
+
+	// Test ownership enforcement
+	t.Run("OtherUser", func(t *testing.T) {
+		otherUser := models.User{
+			Username: "otheruser",
+			Email:    "other@example.com",
+		}
+		require.NoError(t, db.Create(&otherUser).Error, "Failed to create other user")
+
+		otherDoc := models.Document{
+			Title:  "Other Document",
+			UserID: otherUser.ID,
+		}
+		require.NoError(t, db.Create(&otherDoc).Error, "Failed to create other user's document")
+
+		// Other user's documents are not listed
+		resp, err := resource.FindAll(newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find all documents")
+		for _, d := range resp.Result().([]models.Document) {
+			assert.Equal(t, user.ID, d.UserID, "Expected only the user's own documents")
+		}
+
+		// Other user's document cannot be read, updated or deleted
+		_, err = resource.FindOne(otherDoc.ID.String(), newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		_, err = resource.Update(models.Document{ID: otherDoc.ID, Title: "Hijacked"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		_, err = resource.Delete(otherDoc.ID.String(), newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		// Documents cannot be created for another user
+		_, err = resource.Create(models.Document{Title: "Foreign", UserID: otherUser.ID}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		// Unauthenticated requests are rejected
+		_, err = resource.FindAll(api2go.Request{})
+		assertHTTPStatus(t, err, http.StatusUnauthorized)
+	})
+
 	// Test Delete
 	t.Run("Delete", func(t *testing.T) {
-		resp, err := resource.Delete(doc.ID.String(), api2go.Request{})
+		resp, err := resource.Delete(doc.ID.String(), newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to delete document")
 		require.Equal(t, http.StatusNoContent, resp.StatusCode(), "Expected status code 204")
 
@@ -131,4 +207,233 @@ func TestDocumentResource_CRUD(t *testing.T) {
 		db.Model(&models.Document{}).Where("id = ?", doc.ID).Count(&count)
 		assert.Equal(t, int64(0), count, "Expected document to be deleted")
 	})
-}
\ No newline at end of file
+}
+
+func TestDocumentResource_Concurrency(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewDocumentResource(db)
+
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	resp, err := resource.Create(models.Document{Title: "Draft", Content: "Text"}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	doc := resp.Result().(models.Document)
+	assert.Equal(t, 1, doc.Version, "New documents should start at version 1")
+
+	t.Run("FindOne", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		_, err := resource.FindOne(doc.ID.String(), newConditionalRequest(user.ID, "", rec))
+		require.NoError(t, err, "Failed to find document")
+		assert.Equal(t, `"1"`, rec.Header().Get("ETag"), "Expected the ETag of the current version")
+	})
+
+	t.Run("MatchingVersion", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		doc.Title = "Final"
+		resp, err := resource.Update(doc, newConditionalRequest(user.ID, `"1"`, rec))
+		require.NoError(t, err, "Failed to update document")
+
+		updated := resp.Result().(models.Document)
+		assert.Equal(t, 2, updated.Version, "Every update should increment the version")
+		assert.Equal(t, `"2"`, rec.Header().Get("ETag"), "Expected the ETag of the new version")
+
+		// Moving the document changes the version but not the revision
+		folder := models.Folder{Name: "Archive", UserID: user.ID}
+		require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+		updated.FolderID = &folder.ID
+		resp, err = resource.Update(updated, newConditionalRequest(user.ID, `"1", "2"`, rec))
+		require.NoError(t, err, "Any matching ETag should be accepted")
+		moved := resp.Result().(models.Document)
+		assert.Equal(t, 3, moved.Version, "Moving should increment the version")
+		assert.Equal(t, updated.Revision, moved.Revision, "Moving should not start a new revision")
+	})
+
+	t.Run("StaleVersion", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		doc.Title = "Overwritten"
+		_, err := resource.Update(doc, newConditionalRequest(user.ID, `"1"`, rec))
+		assertPreconditionFailed(t, err, 3)
+		assert.Equal(t, `"3"`, rec.Header().Get("ETag"), "Expected the ETag of the current version")
+
+		var stored models.Document
+		require.NoError(t, db.First(&stored, "id = ?", doc.ID).Error, "Failed to reload document")
+		assert.Equal(t, "Final", stored.Title, "Stale update should not be applied")
+		assert.Equal(t, 3, stored.Version, "Stale update should not change the version")
+	})
+
+	t.Run("Unconditional", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		_, err := resource.Update(doc, newConditionalRequest(user.ID, "*", rec))
+		require.NoError(t, err, "Wildcard should match any version")
+
+		_, err = resource.Update(doc, newConditionalRequest(user.ID, "", rec))
+		require.NoError(t, err, "Updates without If-Match should be applied")
+		assert.Equal(t, `"5"`, rec.Header().Get("ETag"), "Expected the ETag of the new version")
+	})
+}
+
+func TestDocumentResource_ContentType(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewDocumentResource(db)
+
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	resp, err := resource.Create(models.Document{Title: "Notes", Content: "Text"}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	doc := resp.Result().(models.Document)
+
+	t.Run("Create", func(t *testing.T) {
+		assert.Equal(t, models.ContentTypePlain, doc.ContentType, "Expected plain text by default")
+
+		resp, err := resource.Create(models.Document{Title: "Readme", Content: "# Readme", ContentType: models.ContentTypeMarkdown}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create Markdown document")
+		assert.Equal(t, models.ContentTypeMarkdown, resp.Result().(models.Document).ContentType, "Expected the given content type")
+
+		_, err = resource.Create(models.Document{Title: "Sheet", ContentType: "application/vnd.ms-excel"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		var stored models.Document
+		require.NoError(t, db.First(&stored, "id = ?", doc.ID).Error, "Failed to find document")
+		applyPatch(t, &stored, "documents", doc.ID.String(), `{"content_type": "text/html"}`)
+		resp, err := resource.Update(stored, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update content type")
+		updated := resp.Result().(models.Document)
+		assert.Equal(t, models.ContentTypeHTML, updated.ContentType, "Expected the new content type")
+		assert.Equal(t, "Text", updated.Content, "Expected absent content to be kept")
+		assert.Equal(t, doc.Version+1, updated.Version, "Expected a new version")
+		assert.Equal(t, doc.Revision, updated.Revision, "Expected the revision to be kept")
+
+		var event models.Event
+		require.NoError(t, db.Where("resource_id = ? AND type = ?", doc.ID, "document.updated").First(&event).Error, "Expected an update event")
+
+		// An empty content type keeps the current one
+		applyPatch(t, &updated, "documents", doc.ID.String(), `{"content_type": "", "content": "<p>Text</p>"}`)
+		_, err = resource.Update(updated, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update content")
+		require.NoError(t, db.First(&stored, "id = ?", doc.ID).Error, "Failed to find document")
+		assert.Equal(t, models.ContentTypeHTML, stored.ContentType, "Expected the content type to be kept")
+
+		applyPatch(t, &stored, "documents", doc.ID.String(), `{"content_type": "text/rtf"}`)
+		_, err = resource.Update(stored, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		resp, err := resource.FindAll(newRequest(user.ID, map[string][]string{"filter[content_type]": {models.ContentTypeMarkdown}}))
+		require.NoError(t, err, "Failed to filter documents")
+		docs := resp.Result().([]models.Document)
+		require.Len(t, docs, 1, "Expected the Markdown document")
+		assert.Equal(t, "Readme", docs[0].Title, "Expected the Markdown document")
+
+		resp, err = resource.FindAll(newRequest(user.ID, map[string][]string{"filter[content_type]": {models.ContentTypeMarkdown, models.ContentTypeHTML}}))
+		require.NoError(t, err, "Failed to filter documents")
+		assert.Len(t, resp.Result().([]models.Document), 2, "Expected documents of either type")
+
+		_, err = resource.FindAll(newRequest(user.ID, map[string][]string{"filter[content_type]": {"image/png"}}))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("Excerpt", func(t *testing.T) {
+		_, err := resource.Create(models.Document{Title: "Guide", Content: "# Guide\n\nRead **this** first.", ContentType: models.ContentTypeMarkdown}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+
+		resp, err := resource.FindAll(newRequest(user.ID, map[string][]string{"filter[q]": {"Guide"}}))
+		require.NoError(t, err, "Failed to find documents")
+		docs := resp.Result().([]models.Document)
+		require.Len(t, docs, 1, "Expected the guide")
+		assert.Equal(t, "Guide Read this first.", docs[0].Excerpt, "Expected the plain-text excerpt of the rendered content")
+	})
+}
+
+func TestDocumentResource_Search(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewDocumentResource(db)
+
+	// Create a test user with a folder tree Projects/2026
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	projects := models.Folder{Name: "Projects", UserID: user.ID}
+	require.NoError(t, db.Create(&projects).Error, "Failed to create folder")
+	year := models.Folder{Name: "2026", UserID: user.ID, ParentID: &projects.ID}
+	require.NoError(t, db.Create(&year).Error, "Failed to create subfolder")
+
+	inContent := models.Document{Title: "Meeting notes", Content: "Discussed the budget", UserID: user.ID}
+	inTitle := models.Document{Title: "Budget plan", Content: "Numbers for next year", UserID: user.ID, FolderID: &year.ID}
+	unrelated := models.Document{Title: "Shopping list", Content: "Milk, eggs", UserID: user.ID}
+	for _, doc := range []*models.Document{&inContent, &inTitle, &unrelated} {
+		require.NoError(t, db.Create(doc).Error, "Failed to create test document")
+	}
+
+	search := func(params map[string][]string) []models.Document {
+		resp, err := resource.FindAll(newRequest(user.ID, params))
+		require.NoError(t, err, "Failed to search documents")
+		docs, ok := resp.Result().([]models.Document)
+		require.True(t, ok, "Expected result to be a slice of Documents")
+		return docs
+	}
+
+	t.Run("Ranked", func(t *testing.T) {
+		docs := search(map[string][]string{"filter[q]": {"BUDGET"}})
+		require.Equal(t, 2, len(docs), "Expected two matching documents")
+		assert.Equal(t, inTitle.ID, docs[0].ID, "Expected title match to rank first")
+		assert.Equal(t, inContent.ID, docs[1].ID, "Expected content match to rank second")
+		assert.Greater(t, docs[0].Rank, docs[1].Rank, "Expected ranks to be ordered")
+	})
+
+	t.Run("AllTerms", func(t *testing.T) {
+		docs := search(map[string][]string{"filter[q]": {"budget discussed"}})
+		require.Equal(t, 1, len(docs), "Expected one matching document")
+		assert.Equal(t, inContent.ID, docs[0].ID, "Expected document matching all terms")
+	})
+
+	t.Run("FolderSubtree", func(t *testing.T) {
+		docs := search(map[string][]string{
+			"filter[q]":         {"budget"},
+			"filter[folder_id]": {projects.ID.String()},
+		})
+		require.Equal(t, 1, len(docs), "Expected one matching document in the subtree")
+		assert.Equal(t, inTitle.ID, docs[0].ID, "Expected document from the nested folder")
+	})
+
+	t.Run("Wildcards", func(t *testing.T) {
+		docs := search(map[string][]string{"filter[q]": {"%"}})
+		assert.Empty(t, docs, "Expected LIKE wildcards to be matched literally")
+	})
+
+	t.Run("Paginated", func(t *testing.T) {
+		req := newPageRequest(user, map[string][]string{"filter[q]": {"budget"}}, map[string]string{"number": "1", "size": "1"})
+		total, resp, err := resource.PaginatedFindAll(req)
+		require.NoError(t, err, "Failed to search documents")
+		assert.Equal(t, uint(2), total, "Expected total count of matches")
+		docs, ok := resp.Result().([]models.Document)
+		require.True(t, ok, "Expected result to be a slice of Documents")
+		require.Equal(t, 1, len(docs), "Expected one document on the page")
+		assert.Equal(t, inTitle.ID, docs[0].ID, "Expected best match on the first page")
+	})
+
+	t.Run("CursorPagination", func(t *testing.T) {
+		req := newPageRequest(user, map[string][]string{"filter[q]": {"budget"}}, map[string]string{"size": "1"})
+		_, err := resource.FindAll(req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+}
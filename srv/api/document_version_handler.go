@@ -0,0 +1,241 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"srv/database"
+	"srv/diff"
+	"srv/models"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// DocumentVersionHandler serves the version history endpoints of documents
+type DocumentVersionHandler struct {
+	DB *gorm.DB
+}
+
+// NewDocumentVersionHandler creates a new DocumentVersionHandler
+func NewDocumentVersionHandler(db *gorm.DB) *DocumentVersionHandler {
+	return &DocumentVersionHandler{
+		DB: db,
+	}
+}
+
+// documentDiff is the line-by-line difference between two revisions of a document
+type documentDiff struct {
+	DocumentID uuid.UUID   `json:"document_id"`
+	From       int         `json:"from"`
+	To         int         `json:"to"`
+	FromTitle  string      `json:"from_title"`
+	ToTitle    string      `json:"to_title"`
+	Lines      []diff.Line `json:"lines"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (d documentDiff) GetID() string {
+	return d.DocumentID.String() + ":" + strconv.Itoa(d.From) + ".." + strconv.Itoa(d.To)
+}
+
+// Register adds the version history routes to the router
+func (h DocumentVersionHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/documents/:id/versions", h.List)
+	router.Handle(http.MethodGet, prefix+"/documents/:id/versions/:revision", h.Get)
+	router.Handle(http.MethodPost, prefix+"/documents/:id/versions/:revision/restore", h.Restore)
+	router.Handle(http.MethodGet, prefix+"/documents/:id/diff", h.Diff)
+}
+
+// List returns all versions of a document, newest first
+func (h DocumentVersionHandler) List(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	logrus.WithField("id", document.ID).Info("Finding document versions")
+
+	var versions []models.DocumentVersion
+	if err := h.DB.Where("document_id = ?", document.ID).Order("revision DESC").Find(&versions).Error; err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to find document versions")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, versions, nil)
+}
+
+// Get returns a single version of a document
+func (h DocumentVersionHandler) Get(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	version, ok := h.findVersion(w, document, params["revision"])
+	if !ok {
+		return
+	}
+
+	writeResponse(w, http.StatusOK, version, nil)
+}
+
+// Diff compares two versions of a document line by line. The `from` query
+// parameter is required, `to` defaults to the current revision.
+func (h DocumentVersionHandler) Diff(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	to := query.Get("to")
+	if to == "" {
+		to = strconv.Itoa(document.Revision)
+	}
+
+	from, ok := h.findVersion(w, document, query.Get("from"))
+	if !ok {
+		return
+	}
+	target, ok := h.findVersion(w, document, to)
+	if !ok {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":   document.ID,
+		"from": from.Revision,
+		"to":   target.Revision,
+	}).Info("Comparing document versions")
+
+	lines, err := diff.Lines(from.Content, target.Content)
+	if errors.Is(err, diff.ErrTooLarge) {
+		logrus.WithField("id", document.ID).Warn("Document versions are too large to compare")
+		writeError(w, http.StatusUnprocessableEntity,
+			fmt.Sprintf("Versions are too large to compare, the limit is %d lines or %d bytes together", diff.MaxLines, diff.MaxBytes))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to compare document versions")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, documentDiff{
+		DocumentID: document.ID,
+		From:       from.Revision,
+		To:         target.Revision,
+		FromTitle:  from.Title,
+		ToTitle:    target.Title,
+		Lines:      lines,
+	}, nil)
+}
+
+// Restore makes a prior version the new head revision of a document
+func (h DocumentVersionHandler) Restore(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	version, ok := h.findVersion(w, document, params["revision"])
+	if !ok {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":       document.ID,
+		"revision": version.Revision,
+	}).Info("Restoring document version")
+
+	userID, _ := requestUserID(r)
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ensureVersion(tx, document); err != nil {
+			return err
+		}
+
+		if err := database.ClaimVersion(tx, &models.Document{}, document.ID, document.Version); err != nil {
+			return err
+		}
+
+		existingDocument := document
+		document.Title = version.Title
+		document.Content = version.Content
+		document.Revision++
+		document.Version++
+		if err := tx.Save(&document).Error; err != nil {
+			return err
+		}
+
+		restored := document.NewVersion(userID)
+		if err := tx.Create(&restored).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditUpdate, userID, existingDocument, document); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventUpdated, document, userID, map[string]interface{}{"restored_revision": version.Revision})
+	})
+	if errors.Is(err, database.ErrVersionConflict) {
+		logrus.WithField("id", document.ID).Warn("Document was modified concurrently")
+		writeError(w, http.StatusConflict, "Document was modified concurrently, try again")
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to restore document version")
+		writeConstraintError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", document.ETag())
+	writeResponse(w, http.StatusOK, document, nil)
+}
+
+// findVersion loads a revision of a document, writing an error response if it can't
+func (h DocumentVersionHandler) findVersion(w http.ResponseWriter, document models.Document, revision string) (models.DocumentVersion, bool) {
+	number, err := strconv.Atoi(revision)
+	if err != nil {
+		logrus.WithError(err).WithField("revision", revision).Error("Invalid revision")
+		writeError(w, http.StatusBadRequest, "Invalid revision")
+		return models.DocumentVersion{}, false
+	}
+
+	var version models.DocumentVersion
+	if err := h.DB.First(&version, "document_id = ? AND revision = ?", document.ID, number).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithFields(logrus.Fields{
+				"id":       document.ID,
+				"revision": number,
+			}).Warn("Document version not found")
+			writeError(w, http.StatusNotFound, "Document version not found")
+			return models.DocumentVersion{}, false
+		}
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to find document version")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return models.DocumentVersion{}, false
+	}
+
+	return version, true
+}
+
+// ensureVersion records the document's current revision if it has no version
+// yet, which is the case for documents created before history was kept
+func ensureVersion(tx *gorm.DB, document models.Document) error {
+	var count int64
+	if err := tx.Model(&models.DocumentVersion{}).
+		Where("document_id = ? AND revision = ?", document.ID, document.Revision).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	version := document.NewVersion(document.UserID)
+	return tx.Create(&version).Error
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/diff"
+	"srv/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentVersionHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create handler and document resource
+	handler := NewDocumentVersionHandler(db)
+	documents := NewDocumentResource(db)
+
+	// Create a test user
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	// Create a document and edit it twice
+	resp, err := documents.Create(models.Document{Title: "Notes", Content: "one\ntwo"}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	doc := resp.Result().(models.Document)
+	assert.Equal(t, 1, doc.Revision, "Expected first revision")
+
+	doc.Content = "one\n2"
+	resp, err = documents.Update(doc, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to update document")
+	doc = resp.Result().(models.Document)
+
+	doc.Title = "Renamed Notes"
+	doc.Content = "one\n2\nthree"
+	resp, err = documents.Update(doc, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to update document")
+	doc = resp.Result().(models.Document)
+	assert.Equal(t, 3, doc.Revision, "Expected third revision")
+
+	serve := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), method, target string, params map[string]string, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		h(rec, req, params, nil)
+		return rec
+	}
+
+	type attributes map[string]interface{}
+	decode := func(rec *httptest.ResponseRecorder, target interface{}) {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), target), "Failed to decode response")
+	}
+
+	// Test List
+	t.Run("List", func(t *testing.T) {
+		rec := serve(handler.List, http.MethodGet, "/", map[string]string{"id": doc.ID.String()}, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		var body struct {
+			Data []struct {
+				Attributes attributes `json:"attributes"`
+			} `json:"data"`
+		}
+		decode(rec, &body)
+		require.Equal(t, 3, len(body.Data), "Expected three versions")
+		assert.Equal(t, float64(3), body.Data[0].Attributes["revision"], "Expected newest version first")
+		assert.Equal(t, "Renamed Notes", body.Data[0].Attributes["title"], "Expected latest title")
+	})
+
+	// Test Get
+	t.Run("Get", func(t *testing.T) {
+		rec := serve(handler.Get, http.MethodGet, "/", map[string]string{"id": doc.ID.String(), "revision": "1"}, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		var body struct {
+			Data struct {
+				Attributes attributes `json:"attributes"`
+			} `json:"data"`
+		}
+		decode(rec, &body)
+		assert.Equal(t, "one\ntwo", body.Data.Attributes["content"], "Expected original content")
+
+		rec = serve(handler.Get, http.MethodGet, "/", map[string]string{"id": doc.ID.String(), "revision": "9"}, user.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+	})
+
+	// Test Diff
+	t.Run("Diff", func(t *testing.T) {
+		rec := serve(handler.Diff, http.MethodGet, "/?from=1", map[string]string{"id": doc.ID.String()}, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		var body struct {
+			Data struct {
+				Attributes struct {
+					From  int `json:"from"`
+					To    int `json:"to"`
+					Lines []struct {
+						Op   string `json:"op"`
+						Text string `json:"text"`
+					} `json:"lines"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		decode(rec, &body)
+		assert.Equal(t, 1, body.Data.Attributes.From, "Expected diff from revision 1")
+		assert.Equal(t, 3, body.Data.Attributes.To, "Expected diff to the current revision")
+
+		var ops []string
+		for _, line := range body.Data.Attributes.Lines {
+			ops = append(ops, line.Op+":"+line.Text)
+		}
+		assert.Equal(t, []string{"equal:one", "delete:two", "insert:2", "insert:three"}, ops, "Expected line-by-line diff")
+
+		// Versions too large to compare are rejected before diffing
+		large := models.DocumentVersion{DocumentID: doc.ID, Revision: 99, Title: "Notes", Content: strings.Repeat("line\n", diff.MaxLines), UserID: user.ID}
+		require.NoError(t, db.Create(&large).Error, "Failed to create version")
+		defer db.Delete(&large)
+		rec = serve(handler.Diff, http.MethodGet, "/?from=99&to=1", map[string]string{"id": doc.ID.String()}, user.ID)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, "Expected status code 422")
+	})
+
+	// Test Restore
+	t.Run("Restore", func(t *testing.T) {
+		rec := serve(handler.Restore, http.MethodPost, "/", map[string]string{"id": doc.ID.String(), "revision": "1"}, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		var dbDoc models.Document
+		require.NoError(t, db.First(&dbDoc, "id = ?", doc.ID).Error, "Failed to find document in database")
+		assert.Equal(t, 4, dbDoc.Revision, "Expected restore to create a new revision")
+		assert.Equal(t, "Notes", dbDoc.Title, "Expected title to be restored")
+		assert.Equal(t, "one\ntwo", dbDoc.Content, "Expected content to be restored")
+		assert.Equal(t, dbDoc.ETag(), rec.Header().Get("ETag"), "Expected the ETag of the new version")
+
+		var count int64
+		db.Model(&models.DocumentVersion{}).Where("document_id = ?", doc.ID).Count(&count)
+		assert.Equal(t, int64(4), count, "Expected four versions")
+
+		var entries []models.AuditEntry
+		require.NoError(t, db.Find(&entries, "target_id = ? AND action = ?", doc.ID, models.AuditUpdate).Error, "Failed to find audit entries")
+		require.Len(t, entries, 3, "Expected an audit entry for the restore")
+		restored := entries[0]
+		for _, entry := range entries {
+			if entry.Changes["revision"].After == float64(4) {
+				restored = entry
+			}
+		}
+		assert.Equal(t, models.AuditChange{Before: "one\n2\nthree", After: "one\ntwo"}, restored.Changes["content"], "Expected the restored content to be audited")
+	})
+
+	// Test ownership enforcement
+	t.Run("OtherUser", func(t *testing.T) {
+		rec := serve(handler.List, http.MethodGet, "/", map[string]string{"id": doc.ID.String()}, uuid.New())
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+	})
+}
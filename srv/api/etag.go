@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"srv/database"
+	"strings"
+
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+)
+
+// responseWriterKey is the api2go context key of the response writer
+const responseWriterKey = "responseWriter"
+
+// ResponseWriterMiddleware is an api2go middleware that makes the response
+// writer available to resources, which otherwise have no way to set response
+// headers such as ETag
+func ResponseWriterMiddleware(c api2go.APIContexter, w http.ResponseWriter, r *http.Request) {
+	c.Set(responseWriterKey, w)
+}
+
+// setETag sets the ETag header of the response to a resource request. It does
+// nothing unless ResponseWriterMiddleware is installed.
+func setETag(req api2go.Request, etag string) {
+	if req.Context == nil {
+		return
+	}
+	value, ok := req.Context.Get(responseWriterKey)
+	if !ok {
+		return
+	}
+	if w, ok := value.(http.ResponseWriter); ok {
+		w.Header().Set("ETag", etag)
+	}
+}
+
+// ifMatch reports whether the If-Match header of a request matches etag.
+// Requests without the header always match.
+func ifMatch(req api2go.Request, etag string) bool {
+	if req.PlainRequest == nil {
+		return true
+	}
+	values := req.PlainRequest.Header.Values("If-Match")
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// preconditionFailed returns the error for an update based on a stale version
+// of a resource. The error's meta carries the current state of the resource
+// so the client can reconcile its changes without another request.
+func preconditionFailed(req api2go.Request, current jsonapi.MarshalIdentifier, etag, title string) error {
+	document, err := jsonapi.MarshalToStruct(current, nil)
+	if err != nil {
+		return newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	setETag(req, etag)
+	httpErr := newHTTPError(database.ErrVersionConflict, title, http.StatusPreconditionFailed)
+	httpErr.Errors[0].Meta = map[string]interface{}{
+		"etag":    etag,
+		"current": document.Data.DataObject,
+	}
+	return httpErr
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"srv/models"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+)
+
+// recordEvent adds the event for an action on a user, folder or document to
+// the outbox. It must run in the transaction making the change, so that an
+// event is recorded exactly when the change is committed.
+func recordEvent(tx *gorm.DB, action string, resource jsonapi.MarshalIdentifier, actorID uuid.UUID, meta map[string]interface{}) error {
+	event, err := models.NewEvent(action, resource, actorID, meta)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&event).Error
+}
+
+// recordChange records the events of an update that may have moved a
+// resource: moved when its parent changed, along with the previous parent in
+// meta, and updated when anything else changed too
+func recordChange(tx *gorm.DB, resource jsonapi.MarshalIdentifier, actorID uuid.UUID, moved, updated bool, meta map[string]interface{}) error {
+	if moved {
+		if err := recordEvent(tx, models.EventMoved, resource, actorID, meta); err != nil {
+			return err
+		}
+	}
+	if !updated && moved {
+		return nil
+	}
+	return recordEvent(tx, models.EventUpdated, resource, actorID, nil)
+}
+
+// recordAudit adds the audit entry for an action on a user, folder or
+// document, with before nil for a creation and after nil for a deletion or
+// purge. Like recordEvent, it must run in the transaction making the change.
+func recordAudit(tx *gorm.DB, action string, actorID uuid.UUID, before, after jsonapi.MarshalIdentifier) error {
+	entry, err := models.NewAuditEntry(action, actorID, before, after)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&entry).Error
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resources and handlers
+	users := NewUserResource(db)
+	folders := NewFolderResource(db)
+	documents := NewDocumentResource(db)
+	trash := NewTrashHandler(db, newTestStorage(t))
+	bulk := NewBulkHandler(db)
+
+	// Create the owner of the items and an editor they are shared with
+	resp, err := users.Create(models.User{Username: "owner", Email: "owner@example.com", Password: "password123"}, newRequest(uuid.Nil, nil))
+	require.NoError(t, err, "Failed to create owner")
+	owner := resp.Result().(models.User)
+	editor := models.User{Username: "editor", Email: "editor@example.com"}
+	require.NoError(t, db.Create(&editor).Error, "Failed to create editor")
+
+	// recorded returns the events recorded since the last call, oldest first
+	recorded := func(t *testing.T) []models.Event {
+		var events []models.Event
+		require.NoError(t, db.Order("created_at, id").Find(&events).Error, "Failed to find events")
+		require.NoError(t, db.Where("1 = 1").Delete(&models.Event{}).Error, "Failed to clear events")
+		return events
+	}
+	types := func(events []models.Event) []string {
+		result := make([]string, 0, len(events))
+		for _, event := range events {
+			result = append(result, event.Type)
+		}
+		return result
+	}
+	payload := func(t *testing.T, event models.Event) map[string]interface{} {
+		var decoded map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(event.Payload), &decoded), "Failed to decode payload")
+		return decoded
+	}
+
+	t.Run("UserCreated", func(t *testing.T) {
+		events := recorded(t)
+		require.Len(t, events, 1, "Expected an event for the registration")
+		assert.Equal(t, "user.created", events[0].Type, "Expected the created event")
+		assert.Equal(t, owner.ID, events[0].UserID, "Expected the event for the user's webhooks")
+		assert.Equal(t, owner.ID, events[0].ActorID, "Expected the user to be the actor")
+		assert.Nil(t, events[0].DispatchedAt, "Expected the event to wait for dispatch")
+		assert.NotContains(t, events[0].Payload, "password", "Expected no password in the payload")
+	})
+
+	var projects, archive models.Folder
+	t.Run("Folder", func(t *testing.T) {
+		resp, err := folders.Create(models.Folder{Name: "Projects"}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create folder")
+		projects = resp.Result().(models.Folder)
+		resp, err = folders.Create(models.Folder{Name: "Archive"}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create folder")
+		archive = resp.Result().(models.Folder)
+
+		events := recorded(t)
+		require.Equal(t, []string{"folder.created", "folder.created"}, types(events), "Expected an event per folder")
+		assert.Equal(t, projects.ID, events[0].ResourceID, "Expected the created folder")
+		data := payload(t, events[0])["data"].(map[string]interface{})
+		assert.Equal(t, "folders", data["type"], "Expected the folder's type")
+		assert.Equal(t, projects.ID.String(), data["id"], "Expected the folder's ID")
+		assert.Equal(t, "Projects", data["attributes"].(map[string]interface{})["name"], "Expected the folder's attributes")
+
+		// Renaming updates the folder
+		update := models.Folder{}
+		applyPatch(t, &update, "folders", projects.ID.String(), `{"name": "Current projects"}`)
+		_, err = folders.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to rename folder")
+		assert.Equal(t, []string{"folder.updated"}, types(recorded(t)), "Expected an update")
+
+		// Moving alone is only a move, along with the previous parent
+		update = models.Folder{}
+		applyPatch(t, &update, "folders", projects.ID.String(), `{"parent_id": "`+archive.ID.String()+`"}`)
+		_, err = folders.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to move folder")
+		events = recorded(t)
+		require.Equal(t, []string{"folder.moved"}, types(events), "Expected a move")
+		assert.Contains(t, payload(t, events[0])["meta"], "previous_parent_id", "Expected the previous parent")
+		assert.Nil(t, payload(t, events[0])["meta"].(map[string]interface{})["previous_parent_id"], "Expected the folder to come from the root")
+
+		// Moving and renaming is both
+		update = models.Folder{}
+		applyPatch(t, &update, "folders", projects.ID.String(), `{"name": "Projects", "parent_id": null}`)
+		_, err = folders.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to move folder")
+		events = recorded(t)
+		require.Equal(t, []string{"folder.moved", "folder.updated"}, types(events), "Expected a move and an update")
+		assert.Equal(t, archive.ID.String(), payload(t, events[0])["meta"].(map[string]interface{})["previous_parent_id"], "Expected the previous parent")
+
+		// Folders loaded the way api2go does carry their tags, which only
+		// count as changed when the payload sets other tags
+		resp, err = folders.FindOne(projects.ID.String(), newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to find folder")
+		stored := resp.Result().(models.Folder)
+		applyPatch(t, &stored, "folders", projects.ID.String(), `{"parent_id": "`+archive.ID.String()+`"}`)
+		_, err = folders.Update(stored, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to move folder")
+		assert.Equal(t, []string{"folder.moved"}, types(recorded(t)), "Expected only a move")
+
+		resp, err = folders.FindOne(projects.ID.String(), newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to find folder")
+		stored = resp.Result().(models.Folder)
+		applyPatch(t, &stored, "folders", projects.ID.String(), `{"parent_id": null}`)
+		require.NoError(t, stored.SetToManyReferenceIDs("tags", []string{}), "Failed to set tags")
+		_, err = folders.Update(stored, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to move folder")
+		assert.Equal(t, []string{"folder.moved"}, types(recorded(t)), "Expected the same tags to leave it a move")
+	})
+
+	t.Run("Document", func(t *testing.T) {
+		share := models.Share{UserID: editor.ID, FolderID: &projects.ID, Role: models.RoleEditor, OwnerID: owner.ID, CreatedByID: owner.ID}
+		require.NoError(t, db.Create(&share).Error, "Failed to create share")
+
+		// An editor's changes go to the owner's webhooks
+		resp, err := documents.Create(models.Document{Title: "Plan", FolderID: &projects.ID}, newRequest(editor.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+		document := resp.Result().(models.Document)
+		events := recorded(t)
+		require.Equal(t, []string{"document.created"}, types(events), "Expected the created event")
+		assert.Equal(t, owner.ID, events[0].UserID, "Expected the event for the owner's webhooks")
+		assert.Equal(t, editor.ID, events[0].ActorID, "Expected the editor to be the actor")
+
+		update := models.Document{}
+		applyPatch(t, &update, "documents", document.ID.String(), `{"content": "Step 1", "folder_id": "`+archive.ID.String()+`"}`)
+		_, err = documents.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update document")
+		events = recorded(t)
+		require.Equal(t, []string{"document.moved", "document.updated"}, types(events), "Expected a move and an update")
+		assert.Equal(t, projects.ID.String(), payload(t, events[0])["meta"].(map[string]interface{})["previous_folder_id"], "Expected the previous folder")
+		assert.Equal(t, "Step 1", payload(t, events[1])["data"].(map[string]interface{})["attributes"].(map[string]interface{})["content"], "Expected the new content")
+
+		_, err = documents.Delete(document.ID.String(), newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to delete document")
+		assert.Equal(t, []string{"document.deleted"}, types(recorded(t)), "Expected the deleted event")
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), owner.ID))
+		rec := httptest.NewRecorder()
+		trash.RestoreDocument(rec, req, map[string]string{"id": document.ID.String()}, nil)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		events = recorded(t)
+		require.Equal(t, []string{"document.restored"}, types(events), "Expected the restored event")
+		assert.Equal(t, false, payload(t, events[0])["meta"].(map[string]interface{})["reparented"], "Expected the document back in its folder")
+	})
+
+	t.Run("RecursiveDelete", func(t *testing.T) {
+		_, err := folders.Delete(archive.ID.String(), newRequest(owner.ID, map[string][]string{"recursive": {"true"}}))
+		require.NoError(t, err, "Failed to delete folder")
+		events := recorded(t)
+		require.Equal(t, []string{"folder.deleted"}, types(events), "Expected a single event for the subtree")
+		assert.Equal(t, archive.ID, events[0].ResourceID, "Expected the deleted folder")
+		assert.Equal(t, true, payload(t, events[0])["meta"].(map[string]interface{})["recursive"], "Expected the deletion to be recursive")
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), owner.ID))
+		rec := httptest.NewRecorder()
+		trash.RestoreFolder(rec, req, map[string]string{"id": archive.ID.String()}, nil)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{"folder.restored"}, types(recorded(t)), "Expected the restored event")
+	})
+
+	t.Run("NoEventOnFailure", func(t *testing.T) {
+		_, err := folders.Create(models.Folder{Name: "Projects"}, newRequest(owner.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+		assert.Empty(t, recorded(t), "Expected no event for a rejected change")
+
+		// Events of the operations before a failed one are rolled back too
+		body := `{"atomic:operations": [
+			{"op": "add", "data": {"type": "folders", "attributes": {"name": "Drafts"}}},
+			{"op": "update", "data": {"type": "documents", "id": "` + uuid.New().String() + `", "attributes": {"title": "Missing"}}}
+		]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/operations", strings.NewReader(body))
+		req = req.WithContext(auth.WithUserID(req.Context(), owner.ID))
+		rec := httptest.NewRecorder()
+		bulk.Execute(rec, req, nil, nil)
+		require.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+		assert.Empty(t, recorded(t), "Expected the events of the failed operations to be rolled back")
+	})
+
+	t.Run("User", func(t *testing.T) {
+		update := models.User{}
+		applyPatch(t, &update, "users", owner.ID.String(), `{"email": "new@example.com"}`)
+		_, err := users.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update user")
+		assert.Equal(t, []string{"user.updated"}, types(recorded(t)), "Expected the updated event")
+
+		_, err = users.Delete(owner.ID.String(), newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to delete user")
+		assert.Equal(t, []string{"user.deleted"}, types(recorded(t)), "Expected the deleted event")
+	})
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"srv/database"
 	"srv/models"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/manyminds/api2go"
@@ -15,6 +19,13 @@ type FolderResource struct {
 	DB *gorm.DB
 }
 
+// folderSortFields are the attributes folders can be sorted by
+var folderSortFields = map[string]sortField{
+	"name":       {Column: "name"},
+	"created_at": {Column: "created_at", Time: true},
+	"updated_at": {Column: "updated_at", Time: true},
+}
+
 // NewFolderResource creates a new FolderResource
 func NewFolderResource(db *gorm.DB) *FolderResource {
 	return &FolderResource{
@@ -26,8 +37,50 @@ func NewFolderResource(db *gorm.DB) *FolderResource {
 func (r FolderResource) FindAll(req api2go.Request) (api2go.Responder, error) {
 	logrus.Info("Finding all folders")
 
-	var folders []models.Folder
-	query := r.DB
+	result, err := r.findFolders(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of folders along with the total count
+func (r FolderResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of folders")
+
+	result, err := r.findFolders(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findFolders loads the folders matching the request's filters, sort and page
+func (r FolderResource) findFolders(req api2go.Request) (page[models.Folder], error) {
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return page[models.Folder]{}, err
+	}
+
+	includes, err := parseIncludes(req, folderIncludes)
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid include parameter")
+		return page[models.Folder]{}, err
+	}
+
+	// Folders of other users are listed when they have been shared with the current user
+	query := r.DB.Model(&models.Folder{}).
+		Scopes(preloadTags, database.AccessibleFolders(currentUser)).
+		Scopes(includeScopes(includes, folderIncludes, currentUser)...)
+
+	// Restrict to the folders related to another resource for routes such as
+	// GET /v1/folders/{id}/folders
+	query, err = r.linkedFolders(req, currentUser, query)
+	if err != nil {
+		return page[models.Folder]{}, err
+	}
 
 	// Filter by user ID if provided
 	if userID, ok := req.QueryParams["user_id"]; ok && len(userID) > 0 {
@@ -36,10 +89,15 @@ func (r FolderResource) FindAll(req api2go.Request) (api2go.Responder, error) {
 		uuid, err := uuid.Parse(userID[0])
 		if err != nil {
 			logrus.WithError(err).WithField("user_id", userID[0]).Error("Invalid user ID")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+			return page[models.Folder]{}, newHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+		}
+
+		if uuid != currentUser {
+			logrus.WithField("user_id", userID[0]).Warn("Cannot list another user's folders")
+			return page[models.Folder]{}, newHTTPError(nil, "Cannot access another user's folders", http.StatusForbidden)
 		}
 
-		query = query.Where("user_id = ?", uuid)
+		query = query.Where("folders.user_id = ?", uuid)
 	}
 
 	// Filter by parent ID if provided
@@ -54,19 +112,90 @@ func (r FolderResource) FindAll(req api2go.Request) (api2go.Responder, error) {
 			uuid, err := uuid.Parse(parentID[0])
 			if err != nil {
 				logrus.WithError(err).WithField("parent_id", parentID[0]).Error("Invalid parent ID")
-				return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid parent ID", http.StatusBadRequest)
+				return page[models.Folder]{}, newHTTPError(err, "Invalid parent ID", http.StatusBadRequest)
 			}
 
 			query = query.Where("parent_id = ?", uuid)
 		}
 	}
 
-	if err := query.Find(&folders).Error; err != nil {
+	// Filter by tag names if provided: every comma-separated group must match one of its |-separated names
+	if tags, ok := req.QueryParams["filter[tag]"]; ok && len(tags) > 0 {
+		logrus.WithField("tags", tags).Info("Filtering folders by tags")
+
+		groups, err := parseTagFilter(tags)
+		if err != nil {
+			logrus.WithError(err).Warn("Invalid tag filter")
+			return page[models.Folder]{}, err
+		}
+		for _, names := range groups {
+			query = query.Where("folders.id IN (?)", database.TaggedIDs(r.DB, database.FolderTagsTable, "folder_id", names))
+		}
+	}
+
+	opts, err := parseListOptions(req, folderSortFields, []sortTerm{{sortField: folderSortFields["created_at"]}})
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.Folder]{}, err
+	}
+
+	result, err := findPage[models.Folder](query, opts)
+	if err != nil {
 		logrus.WithError(err).Error("Failed to find folders")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return page[models.Folder]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	for i := range result.Items {
+		includeFolder(&result.Items[i], includes, currentUser)
+	}
+	return result, nil
+}
+
+// linkedFolders restricts a query to the folders related to the resource api2go
+// lists them for: the subfolders or parent of a folder, the folder of a
+// document or the folders of a user
+func (r FolderResource) linkedFolders(req api2go.Request, currentUser uuid.UUID, query *gorm.DB) (*gorm.DB, error) {
+	folderID, relationship, ok, err := linkedResource(req, "folders")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		folder, err := findFolder(r.DB, currentUser, folderID, models.RoleViewer)
+		if err != nil {
+			return nil, accessHTTPError(err)
+		}
+		if relationship == "parent" {
+			// Root folders have no parent, so nothing matches
+			return query.Where("folders.id = ?", folder.ParentID), nil
+		}
+		query = query.Where("folders.parent_id = ?", folder.ID)
+	}
+
+	documentID, _, ok, err := linkedResource(req, "documents")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		document, err := findDocument(r.DB, currentUser, documentID, models.RoleViewer)
+		if err != nil {
+			return nil, accessHTTPError(err)
+		}
+		query = query.Where("folders.id = ?", document.FolderID)
+	}
+
+	userID, _, ok, err := linkedResource(req, "users")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if userID != currentUser {
+			logrus.WithField("user_id", userID).Warn("Cannot list another user's folders")
+			return nil, newHTTPError(nil, "Cannot access another user's folders", http.StatusForbidden)
+		}
+		query = query.Where("folders.user_id = ?", userID)
 	}
 
-	return &api2go.Response{Res: folders, Code: http.StatusOK}, nil
+	return query, nil
 }
 
 // FindOne returns a single folder
@@ -76,19 +205,31 @@ func (r FolderResource) FindOne(id string, req api2go.Request) (api2go.Responder
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Invalid folder ID")
-		return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid folder ID", http.StatusBadRequest)
+		return &api2go.Response{}, newHTTPError(err, "Invalid folder ID", http.StatusBadRequest)
 	}
 
-	var folder models.Folder
-	if err := r.DB.First(&folder, "id = ?", uuid).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logrus.WithField("id", id).Warn("Folder not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "Folder not found", http.StatusNotFound)
-		}
-		logrus.WithError(err).WithField("id", id).Error("Failed to find folder")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	includes, err := parseIncludes(req, folderIncludes)
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid include parameter")
+		return &api2go.Response{}, err
+	}
+
+	// The IDs of subfolders and documents are loaded for the relationships,
+	// and replaced by the complete items when they are included
+	scopes := append([]func(*gorm.DB) *gorm.DB{preloadTags, preloadChildIDs(currentUser, "parent_id", "folder_id")},
+		includeScopes(includes, folderIncludes, currentUser)...)
+	folder, err := findFolder(r.DB, currentUser, uuid, models.RoleViewer, scopes...)
+	if err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
 	}
+	includeFolder(&folder, includes, currentUser)
 
+	setETag(req, folder.ETag())
 	return &api2go.Response{Res: folder, Code: http.StatusOK}, nil
 }
 
@@ -96,11 +237,28 @@ func (r FolderResource) FindOne(id string, req api2go.Request) (api2go.Responder
 func (r FolderResource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
 	folder, ok := obj.(models.Folder)
 	if !ok {
-		err := api2go.NewHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
 		logrus.WithError(err).Error("Invalid instance given to create folder")
 		return &api2go.Response{}, err
 	}
 
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	policy, err := folderConflictPolicy(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Folders are always created for the authenticated user
+	if folder.UserID != uuid.Nil && folder.UserID != currentUser {
+		logrus.WithField("user_id", folder.UserID).Warn("Cannot create folder for another user")
+		return &api2go.Response{}, newHTTPError(nil, "Cannot create folders for another user", http.StatusForbidden)
+	}
+	folder.UserID = currentUser
+
 	logrus.WithFields(logrus.Fields{
 		"name":      folder.Name,
 		"user_id":   folder.UserID,
@@ -112,30 +270,48 @@ func (r FolderResource) Create(obj interface{}, req api2go.Request) (api2go.Resp
 	if err := r.DB.First(&user, "id = ?", folder.UserID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			logrus.WithField("user_id", folder.UserID).Warn("User not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "User not found", http.StatusNotFound)
+			return &api2go.Response{}, newHTTPError(err, "User not found", http.StatusNotFound)
 		}
 		logrus.WithError(err).WithField("user_id", folder.UserID).Error("Failed to find user")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
-	// Validate parent folder exists if provided
+	// Creating a subfolder requires editor access to the parent folder. The
+	// subfolder then belongs to the parent's owner, like the rest of the tree.
 	if folder.ParentID != nil {
-		var parentFolder models.Folder
-		if err := r.DB.First(&parentFolder, "id = ?", folder.ParentID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				logrus.WithField("parent_id", folder.ParentID).Warn("Parent folder not found")
-				return &api2go.Response{}, api2go.NewHTTPError(err, "Parent folder not found", http.StatusNotFound)
-			}
-			logrus.WithError(err).WithField("parent_id", folder.ParentID).Error("Failed to find parent folder")
-			return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		parentFolder, err := r.findParent(currentUser, *folder.ParentID)
+		if err != nil {
+			return &api2go.Response{}, err
 		}
+		folder.UserID = parentFolder.UserID
+	}
+
+	if err := r.resolveName(policy, &folder); err != nil {
+		return &api2go.Response{}, err
 	}
 
-	if err := r.DB.Create(&folder).Error; err != nil {
+	// Tags must belong to the folder's owner
+	folder.Tags, err = resolveTags(r.DB, folder.UserID, folder.Tags)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	folder.Version = 1
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&folder).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditCreate, currentUser, nil, folder); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventCreated, folder, currentUser, nil)
+	})
+	if err != nil {
 		logrus.WithError(err).Error("Failed to create folder")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, constraintHTTPError(err)
 	}
 
+	setETag(req, folder.ETag())
 	return &api2go.Response{Res: folder, Code: http.StatusCreated}, nil
 }
 
@@ -146,29 +322,47 @@ func (r FolderResource) Delete(id string, req api2go.Request) (api2go.Responder,
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Invalid folder ID")
-		return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid folder ID", http.StatusBadRequest)
+		return &api2go.Response{}, newHTTPError(err, "Invalid folder ID", http.StatusBadRequest)
 	}
 
-	// Check if folder exists
-	var folder models.Folder
-	if err := r.DB.First(&folder, "id = ?", uuid).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logrus.WithField("id", id).Warn("Folder not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "Folder not found", http.StatusNotFound)
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Only owners may delete a folder. Its tags are loaded for the audit trail.
+	folder, err := findFolder(r.DB, currentUser, uuid, models.RoleOwner, preloadTags)
+	if err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
+	}
+
+	// Delete the whole subtree if requested
+	recursive := false
+	if values, ok := req.QueryParams["recursive"]; ok && len(values) > 0 {
+		recursive, err = strconv.ParseBool(values[0])
+		if err != nil {
+			logrus.WithError(err).WithField("recursive", values[0]).Error("Invalid recursive parameter")
+			return &api2go.Response{}, newHTTPError(err, "Invalid recursive parameter", http.StatusBadRequest)
 		}
-		logrus.WithError(err).WithField("id", id).Error("Failed to find folder")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	if recursive {
+		if err := r.deleteSubtree(folder, currentUser); err != nil {
+			logrus.WithError(err).WithField("id", id).Error("Failed to delete folder subtree")
+			return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+		}
+		return &api2go.Response{Code: http.StatusNoContent}, nil
 	}
 
 	// Check if folder has subfolders
 	var subfolderCount int64
 	if err := r.DB.Model(&models.Folder{}).Where("parent_id = ?", uuid).Count(&subfolderCount).Error; err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to count subfolders")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
 	if subfolderCount > 0 {
-		err := api2go.NewHTTPError(nil, "Cannot delete folder with subfolders", http.StatusBadRequest)
+		err := newHTTPError(nil, "Cannot delete folder with subfolders", http.StatusBadRequest)
 		logrus.WithField("id", id).Warn("Cannot delete folder with subfolders")
 		return &api2go.Response{}, err
 	}
@@ -177,19 +371,28 @@ func (r FolderResource) Delete(id string, req api2go.Request) (api2go.Responder,
 	var documentCount int64
 	if err := r.DB.Model(&models.Document{}).Where("folder_id = ?", uuid).Count(&documentCount).Error; err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to count documents")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
 	if documentCount > 0 {
-		err := api2go.NewHTTPError(nil, "Cannot delete folder with documents", http.StatusBadRequest)
+		err := newHTTPError(nil, "Cannot delete folder with documents", http.StatusBadRequest)
 		logrus.WithField("id", id).Warn("Cannot delete folder with documents")
 		return &api2go.Response{}, err
 	}
 
 	// Delete folder
-	if err := r.DB.Delete(&folder).Error; err != nil {
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&folder).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditDelete, currentUser, folder, nil); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventDeleted, folder, currentUser, nil)
+	})
+	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to delete folder")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
 	return &api2go.Response{Code: http.StatusNoContent}, nil
@@ -199,56 +402,220 @@ func (r FolderResource) Delete(id string, req api2go.Request) (api2go.Responder,
 func (r FolderResource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
 	folder, ok := obj.(models.Folder)
 	if !ok {
-		err := api2go.NewHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
 		logrus.WithError(err).Error("Invalid instance given to update folder")
 		return &api2go.Response{}, err
 	}
 
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"id":        folder.ID,
 		"name":      folder.Name,
 		"parent_id": folder.ParentID,
 	}).Info("Updating folder")
 
-	// Check if folder exists
-	var existingFolder models.Folder
-	if err := r.DB.First(&existingFolder, "id = ?", folder.ID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			logrus.WithField("id", folder.ID).Warn("Folder not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "Folder not found", http.StatusNotFound)
-		}
-		logrus.WithError(err).WithField("id", folder.ID).Error("Failed to find folder")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+	policy, err := folderConflictPolicy(req)
+	if err != nil {
+		return &api2go.Response{}, err
 	}
 
-	// Validate parent folder exists if provided
-	if folder.ParentID != nil {
+	// Changing a folder requires editor access. Its tags are loaded for the
+	// audit trail.
+	existingFolder, err := findFolder(r.DB, currentUser, folder.ID, models.RoleEditor, preloadTags)
+	if err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
+	}
+
+	// Reject changes based on an outdated version of the folder
+	if !ifMatch(req, existingFolder.ETag()) {
+		logrus.WithField("id", folder.ID).Warn("Folder has been modified")
+		return &api2go.Response{}, r.conflict(req, currentUser, folder.ID)
+	}
+
+	// Apply only the attributes present in the payload to the stored folder.
+	// An explicit null parent_id moves the folder to the root.
+	changes := folder
+	folder = existingFolder
+	if changes.HasAttribute("name") {
+		folder.Name = changes.Name
+	}
+	if changes.HasAttribute("parent_id") {
+		folder.ParentID = changes.ParentID
+	}
+
+	// Only owners may move a folder to the root
+	if folder.ParentID == nil && existingFolder.ParentID != nil && existingFolder.UserID != currentUser {
+		logrus.WithField("id", folder.ID).Warn("Only the owner can move a folder to the root")
+		return &api2go.Response{}, newHTTPError(nil, "Only the owner can move a folder to the root", http.StatusForbidden)
+	}
+
+	// Validate the new parent folder if the folder is moved
+	if folder.ParentID != nil && !sameFolder(folder.ParentID, existingFolder.ParentID) {
 		// Prevent circular reference
 		if *folder.ParentID == folder.ID {
-			err := api2go.NewHTTPError(nil, "Folder cannot be its own parent", http.StatusBadRequest)
+			err := newHTTPError(nil, "Folder cannot be its own parent", http.StatusBadRequest)
 			logrus.WithField("id", folder.ID).Warn("Folder cannot be its own parent")
 			return &api2go.Response{}, err
 		}
 
-		var parentFolder models.Folder
-		if err := r.DB.First(&parentFolder, "id = ?", folder.ParentID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				logrus.WithField("parent_id", folder.ParentID).Warn("Parent folder not found")
-				return &api2go.Response{}, api2go.NewHTTPError(err, "Parent folder not found", http.StatusNotFound)
-			}
-			logrus.WithError(err).WithField("parent_id", folder.ParentID).Error("Failed to find parent folder")
-			return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		parentFolder, err := r.findParent(currentUser, *folder.ParentID)
+		if err != nil {
+			return &api2go.Response{}, err
+		}
+
+		if parentFolder.UserID != existingFolder.UserID {
+			err := newHTTPError(nil, "Parent folder does not belong to the user", http.StatusBadRequest)
+			logrus.WithFields(logrus.Fields{
+				"parent_id": folder.ParentID,
+				"user_id":   existingFolder.UserID,
+			}).Warn("Parent folder does not belong to the user")
+			return &api2go.Response{}, err
+		}
+
+		// Prevent cycles by checking the new parent's full ancestor chain
+		var cycleCount int64
+		if err := r.DB.Model(&models.Folder{}).
+			Where("id = ? AND id IN (?)", folder.ID, database.FolderAncestorIDs(r.DB, parentFolder.ID)).
+			Count(&cycleCount).Error; err != nil {
+			logrus.WithError(err).WithField("id", folder.ID).Error("Failed to check folder ancestors")
+			return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+		}
+
+		if cycleCount > 0 {
+			err := newHTTPError(nil, "Folder cannot be moved into one of its subfolders", http.StatusBadRequest)
+			logrus.WithFields(logrus.Fields{
+				"id":        folder.ID,
+				"parent_id": folder.ParentID,
+			}).Warn("Folder cannot be moved into one of its subfolders")
+			return &api2go.Response{}, err
+		}
+	}
+
+	// Only a new name or parent can conflict with the siblings
+	if folder.Name != existingFolder.Name || !sameFolder(folder.ParentID, existingFolder.ParentID) {
+		if err := r.resolveName(policy, &folder); err != nil {
+			return &api2go.Response{}, err
+		}
+	}
+
+	// Tags are replaced only if the payload set the relationship to other
+	// tags, which must belong to the folder's owner
+	tagsChanged := false
+	if changes.HasRelationship("tags") {
+		tags, err := resolveTags(r.DB, existingFolder.UserID, changes.Tags)
+		if err != nil {
+			return &api2go.Response{}, err
+		}
+		if tags != nil && !sameTags(tags, existingFolder.Tags) {
+			folder.Tags = tags
+			tagsChanged = true
 		}
 	}
 
-	// Preserve the user ID
-	folder.UserID = existingFolder.UserID
+	// Update folder and replace its tags if they changed
+	folder.Version = existingFolder.Version + 1
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.ClaimVersion(tx, &models.Folder{}, folder.ID, existingFolder.Version); err != nil {
+			return err
+		}
+		if err := tx.Select("name", "parent_id", "updated_at").Updates(&folder).Error; err != nil {
+			return err
+		}
+		if tagsChanged {
+			if err := tx.Model(&folder).Association("Tags").Replace(folder.Tags); err != nil {
+				return err
+			}
+		}
 
-	// Update folder
-	if err := r.DB.Save(&folder).Error; err != nil {
+		if err := recordAudit(tx, models.AuditUpdate, currentUser, existingFolder, folder); err != nil {
+			return err
+		}
+		moved := !sameFolder(folder.ParentID, existingFolder.ParentID)
+		renamed := folder.Name != existingFolder.Name
+		return recordChange(tx, folder, currentUser, moved, renamed || tagsChanged,
+			map[string]interface{}{"previous_parent_id": existingFolder.ParentID})
+	})
+	if errors.Is(err, database.ErrVersionConflict) {
+		logrus.WithField("id", folder.ID).Warn("Folder was modified concurrently")
+		return &api2go.Response{}, r.conflict(req, currentUser, folder.ID)
+	}
+	if err != nil {
 		logrus.WithError(err).WithField("id", folder.ID).Error("Failed to update folder")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, constraintHTTPError(err)
 	}
 
+	setETag(req, folder.ETag())
 	return &api2go.Response{Res: folder, Code: http.StatusOK}, nil
 }
+
+// conflict returns the error for an update of a folder that has been modified
+// since the client read it, carrying the folder's current state
+func (r FolderResource) conflict(req api2go.Request, userID, id uuid.UUID) error {
+	current, err := findFolder(r.DB, userID, id, models.RoleViewer, preloadTags)
+	if err != nil {
+		return accessHTTPError(err)
+	}
+	return preconditionFailed(req, current, current.ETag(), "Folder has been modified")
+}
+
+// findParent loads a folder that another folder is created in or moved to,
+// which requires editor access
+func (r FolderResource) findParent(userID, parentID uuid.UUID) (models.Folder, error) {
+	parentFolder, err := findFolder(r.DB, userID, parentID, models.RoleEditor)
+	var access accessError
+	if errors.As(err, &access) && access.status == http.StatusNotFound {
+		logrus.WithField("parent_id", parentID).Warn("Parent folder not found")
+		return models.Folder{}, newHTTPError(err, "Parent folder not found", http.StatusNotFound)
+	}
+	if err != nil {
+		return models.Folder{}, accessHTTPError(err)
+	}
+	return parentFolder, nil
+}
+
+// deleteSubtree soft-deletes a folder along with all of its subfolders and
+// their documents in one transaction. Every item shares the same deletion
+// time, so restoring the folder from the trash restores the subtree too. A
+// single event stands for the whole subtree.
+func (r FolderResource) deleteSubtree(folder models.Folder, actorID uuid.UUID) error {
+	logrus.WithField("id", folder.ID).Info("Deleting folder subtree")
+
+	deletedAt := time.Now().UTC()
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uuid.UUID
+		if err := tx.Raw("SELECT id FROM (?) AS subtree", database.FolderSubtreeIDs(tx, folder.ID)).Scan(&ids).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Document{}).Where("folder_id IN ?", ids).Update("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Folder{}).Where("id IN ?", ids).Update("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditDelete, actorID, folder, nil); err != nil {
+			return err
+		}
+		folder.DeletedAt = gorm.DeletedAt{Time: deletedAt, Valid: true}
+		return recordEvent(tx, models.EventDeleted, folder, actorID, map[string]interface{}{"recursive": true})
+	})
+}
+
+// resolveName applies a name conflict policy to a folder about to be stored
+func (r FolderResource) resolveName(policy string, folder *models.Folder) error {
+	siblings, err := database.SiblingFolderNames(r.DB, folder.UserID, folder.ParentID, folder.ID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find sibling folders")
+		return newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	folder.Name, err = resolveNameConflict(policy, folder.Name, siblings, "A folder")
+	if err != nil {
+		return newHTTPError(err, err.Error(), http.StatusConflict)
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"srv/auth"
 	"srv/database"
 	"srv/models"
 	"testing"
@@ -34,7 +36,7 @@ func TestFolderResource_CRUD(t *testing.T) {
 			UserID: user.ID,
 		}
 
-		resp, err := resource.Create(folder, api2go.Request{})
+		resp, err := resource.Create(folder, newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to create folder")
 		require.Equal(t, http.StatusCreated, resp.StatusCode(), "Expected status code 201")
 
@@ -47,14 +49,14 @@ func TestFolderResource_CRUD(t *testing.T) {
 
 	// Create a folder for subsequent tests
 	folder := models.Folder{
-		Name:   "Test Folder",
+		Name:   "Fixture Folder",
 		UserID: user.ID,
 	}
 	require.NoError(t, db.Create(&folder).Error, "Failed to create test folder")
 
 	// Test FindOne
 	t.Run("FindOne", func(t *testing.T) {
-		resp, err := resource.FindOne(folder.ID.String(), api2go.Request{})
+		resp, err := resource.FindOne(folder.ID.String(), newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to find folder")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -67,7 +69,7 @@ func TestFolderResource_CRUD(t *testing.T) {
 
 	// Test FindAll
 	t.Run("FindAll", func(t *testing.T) {
-		resp, err := resource.FindAll(api2go.Request{})
+		resp, err := resource.FindAll(newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to find all folders")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -99,11 +101,9 @@ func TestFolderResource_CRUD(t *testing.T) {
 		require.NoError(t, db.Create(&childFolder).Error, "Failed to create child folder")
 
 		// Test FindAll with parent_id filter
-		req := api2go.Request{
-			QueryParams: map[string][]string{
-				"parent_id": {folder.ID.String()},
-			},
-		}
+		req := newRequest(user.ID, map[string][]string{
+			"parent_id": {folder.ID.String()},
+		})
 		resp, err := resource.FindAll(req)
 		require.NoError(t, err, "Failed to find folders with parent_id filter")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
@@ -122,7 +122,7 @@ func TestFolderResource_CRUD(t *testing.T) {
 			UserID: user.ID, // This will be preserved by the Update method
 		}
 
-		resp, err := resource.Update(updatedFolder, api2go.Request{})
+		resp, err := resource.Update(updatedFolder, newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to update folder")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -138,9 +138,82 @@ func TestFolderResource_CRUD(t *testing.T) {
 		assert.Equal(t, "Updated Folder", dbFolder.Name, "Expected folder name to be updated in database")
 	})
 
+	// Test partial updates
+	t.Run("PartialUpdate", func(t *testing.T) {
+		var stored models.Folder
+		require.NoError(t, db.First(&stored, "id = ?", childFolder.ID).Error, "Failed to find folder")
+
+		applyPatch(t, &stored, "folders", childFolder.ID.String(), `{"name": "Renamed Child"}`)
+		resp, err := resource.Update(stored, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update folder")
+		assert.Equal(t, &folder.ID, resp.Result().(models.Folder).ParentID, "Expected absent parent_id to be kept")
+
+		var dbFolder models.Folder
+		require.NoError(t, db.First(&dbFolder, "id = ?", childFolder.ID).Error, "Failed to find folder in database")
+		assert.Equal(t, "Renamed Child", dbFolder.Name, "Expected folder name to be updated in database")
+		assert.Equal(t, &folder.ID, dbFolder.ParentID, "Expected absent parent_id to be kept in database")
+
+		// An explicit null moves the folder to the root
+		applyPatch(t, &dbFolder, "folders", childFolder.ID.String(), `{"parent_id": null}`)
+		_, err = resource.Update(dbFolder, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to move folder to the root")
+		require.NoError(t, db.First(&dbFolder, "id = ?", childFolder.ID).Error, "Failed to find folder in database")
+		assert.Nil(t, dbFolder.ParentID, "Expected folder to be moved to the root")
+		assert.Equal(t, "Renamed Child", dbFolder.Name, "Expected absent name to be kept")
+	})
+
+	// Test ownership enforcement
+	t.Run("OtherUser", func(t *testing.T) {
+		otherUser := models.User{
+			Username: "otheruser",
+			Email:    "other@example.com",
+		}
+		require.NoError(t, db.Create(&otherUser).Error, "Failed to create other user")
+
+		otherFolder := models.Folder{
+			Name:   "Other Folder",
+			UserID: otherUser.ID,
+		}
+		require.NoError(t, db.Create(&otherFolder).Error, "Failed to create other user's folder")
+
+		// Other user's folders are not listed
+		resp, err := resource.FindAll(newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find all folders")
+		for _, f := range resp.Result().([]models.Folder) {
+			assert.Equal(t, user.ID, f.UserID, "Expected only the user's own folders")
+		}
+
+		// Other user's folders cannot be listed explicitly
+		_, err = resource.FindAll(newRequest(user.ID, map[string][]string{
+			"user_id": {otherUser.ID.String()},
+		}))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		// Other user's folder cannot be read, updated or deleted
+		_, err = resource.FindOne(otherFolder.ID.String(), newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		_, err = resource.Update(models.Folder{ID: otherFolder.ID, Name: "Hijacked"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		_, err = resource.Delete(otherFolder.ID.String(), newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		// Folders cannot be created for or inside another user's tree
+		_, err = resource.Create(models.Folder{Name: "Foreign", UserID: otherUser.ID}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		_, err = resource.Create(models.Folder{Name: "Foreign", ParentID: &otherFolder.ID}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		// Unauthenticated requests are rejected
+		_, err = resource.FindAll(api2go.Request{})
+		assertHTTPStatus(t, err, http.StatusUnauthorized)
+	})
+
 	// Test Delete
 	t.Run("Delete", func(t *testing.T) {
-		resp, err := resource.Delete(childFolder.ID.String(), api2go.Request{})
+		resp, err := resource.Delete(childFolder.ID.String(), newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to delete folder")
 		require.Equal(t, http.StatusNoContent, resp.StatusCode(), "Expected status code 204")
 
@@ -150,3 +223,161 @@ func TestFolderResource_CRUD(t *testing.T) {
 		assert.Equal(t, int64(0), count, "Expected folder to be deleted")
 	})
 }
+
+func TestFolderResource_Concurrency(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewFolderResource(db)
+
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	resp, err := resource.Create(models.Folder{Name: "Projects"}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create folder")
+	folder := resp.Result().(models.Folder)
+
+	t.Run("FindOne", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		_, err := resource.FindOne(folder.ID.String(), newConditionalRequest(user.ID, "", rec))
+		require.NoError(t, err, "Failed to find folder")
+		assert.Equal(t, `"1"`, rec.Header().Get("ETag"), "Expected the ETag of the current version")
+	})
+
+	t.Run("MatchingVersion", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		folder.Name = "Active Projects"
+		resp, err := resource.Update(folder, newConditionalRequest(user.ID, `"1"`, rec))
+		require.NoError(t, err, "Failed to update folder")
+		assert.Equal(t, 2, resp.Result().(models.Folder).Version, "Every update should increment the version")
+		assert.Equal(t, `"2"`, rec.Header().Get("ETag"), "Expected the ETag of the new version")
+	})
+
+	t.Run("StaleVersion", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		folder.Name = "Old Projects"
+		_, err := resource.Update(folder, newConditionalRequest(user.ID, `"1"`, rec))
+		assertPreconditionFailed(t, err, 2)
+
+		var stored models.Folder
+		require.NoError(t, db.First(&stored, "id = ?", folder.ID).Error, "Failed to reload folder")
+		assert.Equal(t, "Active Projects", stored.Name, "Stale update should not be applied")
+	})
+
+	t.Run("WeakETag", func(t *testing.T) {
+		// If-Match uses the strong comparison, so weak ETags never match
+		_, err := resource.Update(folder, newConditionalRequest(user.ID, `W/"2"`, httptest.NewRecorder()))
+		assertPreconditionFailed(t, err, 2)
+	})
+}
+
+func TestFolderResource_Subtree(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewFolderResource(db)
+
+	// Create a test user with a folder tree Root/Child/Grandchild
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	root := models.Folder{Name: "Root", UserID: user.ID}
+	require.NoError(t, db.Create(&root).Error, "Failed to create root folder")
+	child := models.Folder{Name: "Child", UserID: user.ID, ParentID: &root.ID}
+	require.NoError(t, db.Create(&child).Error, "Failed to create child folder")
+	grandchild := models.Folder{Name: "Grandchild", UserID: user.ID, ParentID: &child.ID}
+	require.NoError(t, db.Create(&grandchild).Error, "Failed to create grandchild folder")
+
+	rootDoc := models.Document{Title: "Root Document", UserID: user.ID, FolderID: &root.ID}
+	deepDoc := models.Document{Title: "Deep Document", UserID: user.ID, FolderID: &grandchild.ID}
+	for _, doc := range []*models.Document{&rootDoc, &deepDoc} {
+		require.NoError(t, db.Create(doc).Error, "Failed to create test document")
+	}
+
+	// Test moving a folder under its own descendant
+	t.Run("MoveIntoDescendant", func(t *testing.T) {
+		_, err := resource.Update(models.Folder{ID: root.ID, Name: "Root", ParentID: &grandchild.ID}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		_, err = resource.Update(models.Folder{ID: root.ID, Name: "Root", ParentID: &child.ID}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		var dbFolder models.Folder
+		require.NoError(t, db.First(&dbFolder, "id = ?", root.ID).Error, "Failed to find folder in database")
+		assert.Nil(t, dbFolder.ParentID, "Expected folder to stay at the root")
+	})
+
+	// Test moving a folder within its subtree
+	t.Run("MoveWithinSubtree", func(t *testing.T) {
+		resp, err := resource.Update(models.Folder{ID: grandchild.ID, Name: "Grandchild", ParentID: &root.ID}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to move folder")
+		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
+
+		resp, err = resource.Update(models.Folder{ID: grandchild.ID, Name: "Grandchild", ParentID: &child.ID}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to move folder back")
+		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
+	})
+
+	// Test that sibling folders can't share a name
+	t.Run("SiblingNames", func(t *testing.T) {
+		_, err := resource.Create(models.Folder{Name: "Root"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+
+		_, err = resource.Create(models.Folder{Name: "Child", ParentID: &root.ID}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+
+		_, err = resource.Update(models.Folder{ID: grandchild.ID, Name: "Child", ParentID: &root.ID}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+
+		var dbFolder models.Folder
+		require.NoError(t, db.First(&dbFolder, "id = ?", grandchild.ID).Error, "Failed to find folder")
+		assert.Equal(t, "Grandchild", dbFolder.Name, "Expected folder to be unchanged")
+	})
+
+	// Test deleting a non-empty folder without recursive
+	t.Run("DeleteNotEmpty", func(t *testing.T) {
+		_, err := resource.Delete(root.ID.String(), newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		_, err = resource.Delete(root.ID.String(), newRequest(user.ID, map[string][]string{"recursive": {"maybe"}}))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	// Test deleting the whole subtree
+	t.Run("DeleteRecursive", func(t *testing.T) {
+		resp, err := resource.Delete(root.ID.String(), newRequest(user.ID, map[string][]string{"recursive": {"true"}}))
+		require.NoError(t, err, "Failed to delete folder recursively")
+		require.Equal(t, http.StatusNoContent, resp.StatusCode(), "Expected status code 204")
+
+		var count int64
+		db.Model(&models.Folder{}).Where("user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected all folders to be deleted")
+		db.Model(&models.Document{}).Where("user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected all documents to be deleted")
+		db.Unscoped().Model(&models.Folder{}).Where("user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(3), count, "Expected folders to be soft-deleted")
+	})
+
+	// Test restoring the subtree from the trash
+	t.Run("RestoreRecursive", func(t *testing.T) {
+		trash := NewTrashHandler(db, newTestStorage(t))
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), user.ID))
+		rec := httptest.NewRecorder()
+		trash.RestoreFolder(rec, req, map[string]string{"id": root.ID.String()}, nil)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		var count int64
+		db.Model(&models.Folder{}).Where("user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(3), count, "Expected all folders to be restored")
+		db.Model(&models.Document{}).Where("user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(2), count, "Expected all documents to be restored")
+	})
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"srv/database"
+	"srv/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// includePreload returns the scope loading one relationship of the queried
+// items, restricted to what the current user can access
+type includePreload func(userID uuid.UUID) func(*gorm.DB) *gorm.DB
+
+// folderIncludes are the relationships folders can include
+var folderIncludes = map[string]includePreload{
+	"user":      preloadOwner,
+	"parent":    preloadRelatedFolder("Parent"),
+	"folders":   preloadChildFolders,
+	"documents": preloadChildDocuments,
+	"tags":      includeTags,
+}
+
+// documentIncludes are the relationships documents can include
+var documentIncludes = map[string]includePreload{
+	"user":   preloadOwner,
+	"folder": preloadRelatedFolder("Folder"),
+	"tags":   includeTags,
+}
+
+// userIncludes are the relationships users can include
+var userIncludes = map[string]includePreload{
+	"folders":   preloadChildFolders,
+	"documents": preloadChildDocuments,
+}
+
+// parseIncludes parses the include parameter, a comma-separated list of the
+// relationships whose resources make up the included member of a compound
+// document. Only direct relationships are supported, so paths such as
+// folders.documents are rejected like unknown names.
+func parseIncludes(req api2go.Request, allowed map[string]includePreload) ([]string, error) {
+	var names []string
+	for _, name := range req.QueryParams["include"] {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := allowed[name]; !ok {
+			valid := make([]string, 0, len(allowed))
+			for name := range allowed {
+				valid = append(valid, name)
+			}
+			sort.Strings(valid)
+			return nil, newHTTPError(nil, fmt.Sprintf("Cannot include %q, must be one of %s", name, strings.Join(valid, ", ")), http.StatusBadRequest)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// includeScopes returns the scopes loading the included relationships
+func includeScopes(names []string, allowed map[string]includePreload, userID uuid.UUID) []func(*gorm.DB) *gorm.DB {
+	scopes := make([]func(*gorm.DB) *gorm.DB, 0, len(names))
+	for _, name := range names {
+		scopes = append(scopes, allowed[name](userID))
+	}
+	return scopes
+}
+
+// preloadOwner loads the owner of the queried folders or documents
+func preloadOwner(uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("User")
+	}
+}
+
+// preloadRelatedFolder loads the parent of the queried folders or the folder
+// of the queried documents, along with its tags. The folder stays empty when
+// the user can't access it, such as the parent of a folder shared on its own.
+func preloadRelatedFolder(association string) includePreload {
+	return func(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Preload(association, database.AccessibleFolders(userID)).
+				Preload(association+".Tags", func(db *gorm.DB) *gorm.DB {
+					return db.Order("tags.name")
+				})
+		}
+	}
+}
+
+// preloadChildFolders loads the subfolders of the queried folders or the
+// folders of the queried users, along with their tags
+func preloadChildFolders(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Folders", func(db *gorm.DB) *gorm.DB {
+			return db.Scopes(database.AccessibleFolders(userID)).Order("folders.created_at, folders.id")
+		}).Preload("Folders.Tags", func(db *gorm.DB) *gorm.DB {
+			return db.Order("tags.name")
+		})
+	}
+}
+
+// preloadChildDocuments loads the documents of the queried folders or users,
+// along with their tags
+func preloadChildDocuments(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Documents", func(db *gorm.DB) *gorm.DB {
+			return db.Scopes(database.AccessibleDocuments(userID)).Order("documents.created_at, documents.id")
+		}).Preload("Documents.Tags", func(db *gorm.DB) *gorm.DB {
+			return db.Order("tags.name")
+		})
+	}
+}
+
+// includeTags loads nothing, as tags are always loaded along with folders and
+// documents
+func includeTags(uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return preloadTags
+}
+
+// preloadChildIDs loads the IDs of the subfolders and documents of the queried
+// folders or users, so that their folders and documents relationships are
+// complete without loading every related item. folderKey and documentKey are
+// the columns pointing at the queried items, such as parent_id and folder_id.
+func preloadChildIDs(userID uuid.UUID, folderKey, documentKey string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Folders", func(db *gorm.DB) *gorm.DB {
+			return db.Scopes(database.AccessibleFolders(userID)).Select("folders.id", "folders."+folderKey).Order("folders.created_at, folders.id")
+		}).Preload("Documents", func(db *gorm.DB) *gorm.DB {
+			return db.Scopes(database.AccessibleDocuments(userID)).Select("documents.id", "documents."+documentKey).Order("documents.created_at, documents.id")
+		})
+	}
+}
+
+// includeFolder selects the included relationships of a loaded folder and
+// hides the email address of its owner from other users
+func includeFolder(folder *models.Folder, names []string, userID uuid.UUID) {
+	folder.Include(names...)
+	if folder.User.ID != userID {
+		folder.User = folder.User.Profile()
+	}
+}
+
+// includeDocument selects the included relationships of a loaded document and
+// hides the email address of its owner from other users
+func includeDocument(document *models.Document, names []string, userID uuid.UUID) {
+	document.Include(names...)
+	if document.User.ID != userID {
+		document.User = document.User.Profile()
+	}
+}
+
+// linkedResource returns the ID of the resource of the given type whose
+// related resources are listed, along with the name of the relationship. For
+// GET /v1/folders/{id}/documents, api2go calls FindAll of the documents with
+// the query parameters foldersID and foldersName=documents.
+func linkedResource(req api2go.Request, resourceType string) (uuid.UUID, string, bool, error) {
+	ids, ok := req.QueryParams[resourceType+"ID"]
+	if !ok || len(ids) == 0 {
+		return uuid.Nil, "", false, nil
+	}
+
+	id, err := uuid.Parse(ids[0])
+	if err != nil {
+		logrus.WithError(err).WithField(resourceType+"ID", ids[0]).Error("Invalid ID")
+		return uuid.Nil, "", false, newHTTPError(err, "Invalid ID", http.StatusBadRequest)
+	}
+
+	name := ""
+	if names := req.QueryParams[resourceType+"Name"]; len(names) > 0 {
+		name = names[0]
+	}
+	return id, name, true, nil
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncludes(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Serve the resources through api2go, which adds the relationship routes
+	api := api2go.NewAPI("v1")
+	api.UseMiddleware(ResponseWriterMiddleware)
+	api.AddResource(models.User{}, NewUserResource(db))
+	api.AddResource(models.Folder{}, NewFolderResource(db))
+	api.AddResource(models.Document{}, NewDocumentResource(db))
+	api.AddResource(models.Tag{}, NewTagResource(db))
+
+	// Create test users
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "otheruser", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	// Create Projects/Drafts with the document Plan in Projects, along with a
+	// document in the trash and a document in the root
+	tag := models.Tag{Name: "Work", UserID: user.ID}
+	require.NoError(t, db.Create(&tag).Error, "Failed to create tag")
+	projects := models.Folder{Name: "Projects", UserID: user.ID, Tags: []models.Tag{tag}}
+	require.NoError(t, db.Create(&projects).Error, "Failed to create folder")
+	drafts := models.Folder{Name: "Drafts", UserID: user.ID, ParentID: &projects.ID}
+	require.NoError(t, db.Create(&drafts).Error, "Failed to create subfolder")
+	plan := models.Document{Title: "Plan", UserID: user.ID, FolderID: &projects.ID}
+	require.NoError(t, db.Create(&plan).Error, "Failed to create document")
+	deleted := models.Document{Title: "Deleted", UserID: user.ID, FolderID: &projects.ID}
+	require.NoError(t, db.Create(&deleted).Error, "Failed to create document")
+	require.NoError(t, db.Delete(&deleted).Error, "Failed to delete document")
+	loose := models.Document{Title: "Loose", UserID: user.ID}
+	require.NoError(t, db.Create(&loose).Error, "Failed to create document")
+
+	// Create a folder of the other user shared with the test user, and one
+	// that isn't shared
+	shared := models.Folder{Name: "Shared", UserID: other.ID}
+	require.NoError(t, db.Create(&shared).Error, "Failed to create shared folder")
+	report := models.Document{Title: "Report", UserID: other.ID, FolderID: &shared.ID}
+	require.NoError(t, db.Create(&report).Error, "Failed to create shared document")
+	share := models.Share{UserID: user.ID, OwnerID: other.ID, CreatedByID: other.ID, FolderID: &shared.ID, Role: models.RoleViewer}
+	require.NoError(t, db.Create(&share).Error, "Failed to create share")
+	private := models.Folder{Name: "Private", UserID: other.ID}
+	require.NoError(t, db.Create(&private).Error, "Failed to create private folder")
+
+	type resourceObject struct {
+		Type          string                 `json:"type"`
+		ID            string                 `json:"id"`
+		Attributes    map[string]interface{} `json:"attributes"`
+		Relationships map[string]struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"relationships"`
+	}
+	type response struct {
+		Data     json.RawMessage  `json:"data"`
+		Included []resourceObject `json:"included"`
+	}
+
+	serve := func(path string, userID uuid.UUID) (*httptest.ResponseRecorder, response) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		api.Handler().ServeHTTP(rec, req)
+
+		var body response
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		return rec, body
+	}
+
+	// identifiers returns the sorted type/id pairs of resource identifiers or objects
+	identifiers := func(raw json.RawMessage) []string {
+		var objects []resourceObject
+		if len(raw) > 0 && raw[0] == '{' {
+			objects = make([]resourceObject, 1)
+			require.NoError(t, json.Unmarshal(raw, &objects[0]), "Failed to decode resource")
+		} else {
+			require.NoError(t, json.Unmarshal(raw, &objects), "Failed to decode resources")
+		}
+		result := []string{}
+		for _, object := range objects {
+			result = append(result, object.Type+"/"+object.ID)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	included := func(body response) map[string]resourceObject {
+		result := make(map[string]resourceObject, len(body.Included))
+		for _, object := range body.Included {
+			result[object.Type+"/"+object.ID] = object
+		}
+		return result
+	}
+
+	ref := func(resourceType string, id uuid.UUID) string {
+		return resourceType + "/" + id.String()
+	}
+
+	t.Run("Relationships", func(t *testing.T) {
+		rec, body := serve("/v1/folders/"+projects.ID.String()+"/relationships/documents", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{ref("documents", plan.ID)}, identifiers(body.Data), "Expected the documents of the folder, without deleted ones")
+
+		rec, body = serve("/v1/folders/"+projects.ID.String()+"/relationships/folders", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{ref("folders", drafts.ID)}, identifiers(body.Data), "Expected the subfolders of the folder")
+
+		rec, body = serve("/v1/folders/"+drafts.ID.String()+"/relationships/documents", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.JSONEq(t, `[]`, string(body.Data), "Expected an empty relationship for a folder without documents")
+
+		rec, body = serve("/v1/users/"+user.ID.String()+"/relationships/documents", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		expected := []string{ref("documents", plan.ID), ref("documents", loose.ID)}
+		sort.Strings(expected)
+		assert.Equal(t, expected, identifiers(body.Data), "Expected the documents of the user")
+
+		rec, _ = serve("/v1/folders/"+private.ID.String()+"/relationships/documents", user.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected unshared folders not to be found")
+	})
+
+	t.Run("IncludeFolder", func(t *testing.T) {
+		rec, body := serve("/v1/folders/"+projects.ID.String()+"?include=folders,documents,user,parent,tags", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		resources := included(body)
+		assert.Len(t, resources, 4, "Expected the subfolder, document, owner and tag to be included")
+		assert.Equal(t, "Drafts", resources[ref("folders", drafts.ID)].Attributes["name"], "Expected the subfolder to be included")
+		assert.Equal(t, "Plan", resources[ref("documents", plan.ID)].Attributes["title"], "Expected the document to be included")
+		assert.Equal(t, "test@example.com", resources[ref("users", user.ID)].Attributes["email"], "Expected the owner to be included")
+		assert.Equal(t, "Work", resources[ref("tags", tag.ID)].Attributes["name"], "Expected the tag to be included")
+
+		rec, body = serve("/v1/folders/"+drafts.ID.String()+"?include=parent", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		parent, ok := included(body)[ref("folders", projects.ID)]
+		require.True(t, ok, "Expected the parent to be included")
+		assert.Equal(t, []string{ref("tags", tag.ID)}, identifiers(parent.Relationships["tags"].Data), "Expected the tags of the included parent")
+
+		// Without include, no related resources are returned
+		rec, body = serve("/v1/folders/"+projects.ID.String(), user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Empty(t, body.Included, "Expected no included resources")
+	})
+
+	t.Run("IncludeList", func(t *testing.T) {
+		rec, body := serve("/v1/documents?include=folder,user", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		resources := included(body)
+		assert.Contains(t, resources, ref("folders", projects.ID), "Expected the folder of a document")
+		assert.Contains(t, resources, ref("folders", shared.ID), "Expected the folder of a shared document")
+		assert.Equal(t, "test@example.com", resources[ref("users", user.ID)].Attributes["email"], "Expected the current user with their email")
+		owner, ok := resources[ref("users", other.ID)]
+		require.True(t, ok, "Expected the owner of the shared document")
+		assert.Equal(t, "otheruser", owner.Attributes["username"], "Expected the owner's username")
+		assert.Empty(t, owner.Attributes["email"], "Expected the email of other users to be hidden")
+
+		// Lists only load the children of folders when they are included
+		rec, body = serve("/v1/folders?parent_id=null", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		var folders []resourceObject
+		require.NoError(t, json.Unmarshal(body.Data, &folders), "Failed to decode folders")
+		require.NotEmpty(t, folders, "Expected root folders")
+		for _, folder := range folders {
+			assert.Nil(t, folder.Relationships["documents"].Data, "Expected no data for a relationship that wasn't loaded")
+		}
+
+		rec, body = serve("/v1/folders?parent_id=null&include=documents", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		resources = included(body)
+		assert.Contains(t, resources, ref("documents", plan.ID), "Expected the documents of own folders")
+		assert.Contains(t, resources, ref("documents", report.ID), "Expected the documents of shared folders")
+		assert.NotContains(t, resources, ref("documents", deleted.ID), "Expected deleted documents to be left out")
+	})
+
+	t.Run("IncludeUser", func(t *testing.T) {
+		rec, body := serve("/v1/users/"+user.ID.String()+"?include=folders", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		var keys []string
+		for key := range included(body) {
+			keys = append(keys, key)
+		}
+		expected := []string{ref("folders", projects.ID), ref("folders", drafts.ID)}
+		assert.ElementsMatch(t, expected, keys, "Expected the folders of the user")
+	})
+
+	t.Run("LinkedResources", func(t *testing.T) {
+		rec, body := serve("/v1/folders/"+projects.ID.String()+"/documents", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{ref("documents", plan.ID)}, identifiers(body.Data), "Expected the documents of the folder")
+
+		rec, body = serve("/v1/folders/"+drafts.ID.String()+"/parent", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{ref("folders", projects.ID)}, identifiers(body.Data), "Expected the parent of the folder")
+
+		rec, body = serve("/v1/folders/"+projects.ID.String()+"/parent", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Empty(t, identifiers(body.Data), "Expected root folders to have no parent")
+
+		rec, body = serve("/v1/documents/"+report.ID.String()+"/folder", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{ref("folders", shared.ID)}, identifiers(body.Data), "Expected the folder of the document")
+
+		rec, body = serve("/v1/documents/"+report.ID.String()+"/user", user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{ref("users", other.ID)}, identifiers(body.Data), "Expected the owner of the document")
+		assert.NotContains(t, rec.Body.String(), other.Email, "Expected the email of other users to be hidden")
+
+		rec, _ = serve("/v1/folders/"+private.ID.String()+"/documents", user.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected unshared folders not to be found")
+
+		rec, _ = serve("/v1/users/"+other.ID.String()+"/folders", user.ID)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "Expected other users' folders not to be listed")
+	})
+
+	t.Run("InvalidInclude", func(t *testing.T) {
+		folders := NewFolderResource(db)
+		_, err := folders.FindOne(projects.ID.String(), newRequest(user.ID, map[string][]string{"include": {"folders.documents"}}))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		documents := NewDocumentResource(db)
+		_, err = documents.FindAll(newRequest(user.ID, map[string][]string{"include": {"parent"}}))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		users := NewUserResource(db)
+		_, err = users.FindOne(user.ID.String(), newRequest(user.ID, map[string][]string{"include": {"user"}}))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+}
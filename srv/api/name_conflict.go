@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+)
+
+// Policies for a name already taken by a sibling, chosen per request with the
+// on_conflict query parameter. Names are compared ignoring case, as the unique
+// indexes on folder names do. Document titles have no index, so for them the
+// check is best-effort against concurrent requests.
+const (
+	// conflictReject rejects the request with 409 Conflict
+	conflictReject = "reject"
+	// conflictRename appends the first free counter, as in "Notes (2)"
+	conflictRename = "rename"
+	// conflictAllow stores the name as is
+	conflictAllow = "allow"
+)
+
+// maxNameLength is the longest folder name or document title that can be stored
+const maxNameLength = 255
+
+// nameCounter matches the counter conflictRename appends to a name
+var nameCounter = regexp.MustCompile(`^(.*) \((\d+)\)$`)
+
+// errInvalidConflictPolicy is returned for an unknown on_conflict parameter
+var errInvalidConflictPolicy = errors.New("Invalid on_conflict parameter, must be reject, rename or allow")
+
+// errFolderConflictAllow is returned for conflictAllow on folders, whose
+// sibling names are unique in the database
+var errFolderConflictAllow = errors.New("on_conflict=allow is not supported for folders, sibling folder names are unique")
+
+// nameTakenError reports a name rejected by conflictReject
+type nameTakenError struct {
+	kind string
+	name string
+}
+
+func (e nameTakenError) Error() string {
+	return fmt.Sprintf("%s named %q already exists here", e.kind, e.name)
+}
+
+// conflictPolicy returns the name conflict policy of a request, which
+// defaults to conflictReject
+func conflictPolicy(req api2go.Request) (string, error) {
+	policy, err := parseConflictPolicy(req.QueryParams["on_conflict"])
+	if err != nil {
+		return "", newHTTPError(err, err.Error(), http.StatusBadRequest)
+	}
+	return policy, nil
+}
+
+// folderConflictPolicy returns the name conflict policy of a request for a
+// folder, which can't be conflictAllow
+func folderConflictPolicy(req api2go.Request) (string, error) {
+	policy, err := parseFolderConflictPolicy(req.QueryParams["on_conflict"])
+	if err != nil {
+		return "", newHTTPError(err, err.Error(), http.StatusBadRequest)
+	}
+	return policy, nil
+}
+
+// parseFolderConflictPolicy validates the values of an on_conflict query
+// parameter for a folder
+func parseFolderConflictPolicy(values []string) (string, error) {
+	policy, err := parseConflictPolicy(values)
+	if err == nil && policy == conflictAllow {
+		logrus.Warn("Name conflict policy allow requested for a folder")
+		return "", errFolderConflictAllow
+	}
+	return policy, err
+}
+
+// parseConflictPolicy validates the values of an on_conflict query parameter
+func parseConflictPolicy(values []string) (string, error) {
+	if len(values) == 0 {
+		return conflictReject, nil
+	}
+
+	switch values[0] {
+	case conflictReject, conflictRename, conflictAllow:
+		return values[0], nil
+	}
+	logrus.WithField("on_conflict", values[0]).Warn("Invalid on_conflict parameter")
+	return "", errInvalidConflictPolicy
+}
+
+// resolveNameConflict applies a conflict policy to the name of an item given
+// the names of its siblings, returning the name to store. kind describes the
+// item in the nameTakenError returned for rejected names.
+func resolveNameConflict(policy, name string, siblings []string, kind string) (string, error) {
+	if policy == conflictAllow {
+		return name, nil
+	}
+
+	taken := make(map[string]bool, len(siblings))
+	for _, sibling := range siblings {
+		taken[strings.ToLower(sibling)] = true
+	}
+	if !taken[strings.ToLower(name)] {
+		return name, nil
+	}
+
+	if policy == conflictReject {
+		logrus.WithField("name", name).Warn("Name already taken by a sibling")
+		return "", nameTakenError{kind: kind, name: name}
+	}
+
+	return uniqueName(name, taken), nil
+}
+
+// uniqueName returns the name with the lowest counter of 2 or more that isn't
+// taken, replacing a counter the name already has so that copying "Notes (2)"
+// gives "Notes (3)" rather than "Notes (2) (2)". taken holds lowercase names.
+func uniqueName(name string, taken map[string]bool) string {
+	base := name
+	if match := nameCounter.FindStringSubmatch(name); match != nil {
+		base = match[1]
+	}
+
+	for counter := 2; ; counter++ {
+		suffix := " (" + strconv.Itoa(counter) + ")"
+
+		// Shorten the base rather than exceed the column size
+		trimmed := base
+		for utf8.RuneCountInString(trimmed)+len(suffix) > maxNameLength {
+			_, size := utf8.DecodeLastRuneInString(trimmed)
+			trimmed = trimmed[:len(trimmed)-size]
+		}
+
+		candidate := trimmed + suffix
+		if !taken[strings.ToLower(candidate)] {
+			return candidate
+		}
+	}
+}
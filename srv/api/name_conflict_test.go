@@ -0,0 +1,176 @@
+package api
+
+import (
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// onConflict creates an authenticated request with a name conflict policy
+func onConflict(userID uuid.UUID, policy string) api2go.Request {
+	return newRequest(userID, map[string][]string{"on_conflict": {policy}})
+}
+
+func TestUniqueName(t *testing.T) {
+	taken := map[string]bool{"notes": true, "notes (2)": true, "report (3)": true}
+
+	assert.Equal(t, "Notes (3)", uniqueName("Notes", taken), "Expected the first free counter")
+	assert.Equal(t, "NOTES (3)", uniqueName("NOTES", taken), "Expected the case of the name to be kept")
+	assert.Equal(t, "Notes (3)", uniqueName("Notes (2)", taken), "Expected an existing counter to be replaced")
+	assert.Equal(t, "Report (2)", uniqueName("Report (3)", taken), "Expected counters to start at 2")
+
+	long := strings.Repeat("ä", maxNameLength)
+	renamed := uniqueName(long, map[string]bool{long: true})
+	assert.True(t, strings.HasSuffix(renamed, " (2)"), "Expected a counter on long names")
+	assert.Equal(t, maxNameLength, len([]rune(renamed)), "Expected long names to be shortened")
+}
+
+func TestFolderResource_NameConflicts(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewFolderResource(db)
+
+	// Create a test user with the folders Archive and Projects/Archive
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	archive := models.Folder{Name: "Archive", UserID: user.ID}
+	require.NoError(t, db.Create(&archive).Error, "Failed to create folder")
+	projects := models.Folder{Name: "Projects", UserID: user.ID}
+	require.NoError(t, db.Create(&projects).Error, "Failed to create folder")
+	nested := models.Folder{Name: "Archive", UserID: user.ID, ParentID: &projects.ID}
+	require.NoError(t, db.Create(&nested).Error, "Failed to create subfolder")
+
+	t.Run("Reject", func(t *testing.T) {
+		_, err := resource.Create(models.Folder{Name: "ARCHIVE"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+
+		_, err = resource.Create(models.Folder{Name: "archive"}, onConflict(user.ID, conflictReject))
+		assertHTTPStatus(t, err, http.StatusConflict)
+
+		// Moving a folder next to one with the same name conflicts as well
+		_, err = resource.Update(models.Folder{ID: nested.ID, Name: "Archive"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		resp, err := resource.Create(models.Folder{Name: "archive"}, onConflict(user.ID, conflictRename))
+		require.NoError(t, err, "Failed to create folder")
+		assert.Equal(t, "archive (2)", resp.Result().(models.Folder).Name, "Expected a counter to be appended")
+
+		resp, err = resource.Update(models.Folder{ID: nested.ID, Name: "Archive"}, onConflict(user.ID, conflictRename))
+		require.NoError(t, err, "Failed to move folder")
+		moved := resp.Result().(models.Folder)
+		assert.Equal(t, "Archive (3)", moved.Name, "Expected the next free counter")
+		assert.Nil(t, moved.ParentID, "Expected folder to be moved to the root")
+	})
+
+	t.Run("Allow", func(t *testing.T) {
+		// Sibling folder names are unique, so duplicates can't be allowed
+		_, err := resource.Create(models.Folder{Name: "ARCHIVE"}, onConflict(user.ID, conflictAllow))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+		_, err = resource.Update(models.Folder{ID: archive.ID, Name: "Archive"}, onConflict(user.ID, conflictAllow))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("UnchangedName", func(t *testing.T) {
+		// Renaming a folder to its own name doesn't conflict with itself
+		resp, err := resource.Update(models.Folder{ID: archive.ID, Name: "Archive"}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update folder")
+		assert.Equal(t, "Archive", resp.Result().(models.Folder).Name, "Expected the name to be kept")
+	})
+
+	t.Run("DeletedSiblings", func(t *testing.T) {
+		deleted := models.Folder{Name: "Old", UserID: user.ID}
+		require.NoError(t, db.Create(&deleted).Error, "Failed to create folder")
+		require.NoError(t, db.Delete(&deleted).Error, "Failed to delete folder")
+
+		resp, err := resource.Create(models.Folder{Name: "Old"}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Expected folders in the trash not to conflict")
+		assert.Equal(t, "Old", resp.Result().(models.Folder).Name, "Expected the name to be kept")
+	})
+
+	t.Run("InvalidPolicy", func(t *testing.T) {
+		_, err := resource.Create(models.Folder{Name: "New"}, onConflict(user.ID, "overwrite"))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+}
+
+func TestDocumentResource_NameConflicts(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewDocumentResource(db)
+
+	// Create a test user with a document Notes in the root and in a folder
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	folder := models.Folder{Name: "Folder", UserID: user.ID}
+	require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+	resp, err := resource.Create(models.Document{Title: "Notes"}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	rootNotes := resp.Result().(models.Document)
+	resp, err = resource.Create(models.Document{Title: "Notes", FolderID: &folder.ID}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Expected documents in other folders not to conflict")
+	folderNotes := resp.Result().(models.Document)
+
+	t.Run("Reject", func(t *testing.T) {
+		_, err := resource.Create(models.Document{Title: "notes"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+
+		var stored models.Document
+		require.NoError(t, db.First(&stored, "id = ?", folderNotes.ID).Error, "Failed to find document")
+		applyPatch(t, &stored, "documents", folderNotes.ID.String(), `{"folder_id": null}`)
+		_, err = resource.Update(stored, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		resp, err := resource.Create(models.Document{Title: "Notes"}, onConflict(user.ID, conflictRename))
+		require.NoError(t, err, "Failed to create document")
+		assert.Equal(t, "Notes (2)", resp.Result().(models.Document).Title, "Expected a counter to be appended")
+
+		var stored models.Document
+		require.NoError(t, db.First(&stored, "id = ?", folderNotes.ID).Error, "Failed to find document")
+		applyPatch(t, &stored, "documents", folderNotes.ID.String(), `{"folder_id": null}`)
+		resp, err = resource.Update(stored, onConflict(user.ID, conflictRename))
+		require.NoError(t, err, "Failed to move document")
+		moved := resp.Result().(models.Document)
+		assert.Equal(t, "Notes (3)", moved.Title, "Expected the next free counter")
+		assert.Nil(t, moved.FolderID, "Expected document to be moved to the root")
+	})
+
+	t.Run("Allow", func(t *testing.T) {
+		resp, err := resource.Create(models.Document{Title: "Notes"}, onConflict(user.ID, conflictAllow))
+		require.NoError(t, err, "Failed to create document")
+		assert.Equal(t, "Notes", resp.Result().(models.Document).Title, "Expected the title to be kept")
+	})
+
+	t.Run("ContentOnly", func(t *testing.T) {
+		// Other changes to a document with a duplicate title don't conflict
+		var stored models.Document
+		require.NoError(t, db.First(&stored, "id = ?", rootNotes.ID).Error, "Failed to find document")
+		applyPatch(t, &stored, "documents", rootNotes.ID.String(), `{"content": "Changed"}`)
+		_, err := resource.Update(stored, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update document content")
+	})
+}
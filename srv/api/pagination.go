@@ -0,0 +1,372 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// maxPageSize is the largest page that can be requested from a collection
+	maxPageSize = 100
+	// defaultPageSize is used for cursor pagination when no page[size] is given
+	defaultPageSize = 25
+)
+
+// schemaCache caches the parsed GORM schemas used to read cursor values
+var schemaCache = &sync.Map{}
+
+// sortField describes a column a collection can be sorted by
+type sortField struct {
+	Column string
+	Time   bool
+}
+
+// sortTerm is a single entry of an ORDER BY clause
+type sortTerm struct {
+	sortField
+	Desc bool
+}
+
+// idSortTerm is appended to every sort so that the order is total
+var idSortTerm = sortTerm{sortField: sortField{Column: "id"}}
+
+// listOptions holds the sorting and pagination requested for a collection
+type listOptions struct {
+	Sort []sortTerm
+
+	// Offset pagination (page[number]/page[size] or page[offset]/page[limit])
+	Offset int
+	Limit  int
+
+	// Cursor pagination (page[after] or page[before] with page[size])
+	Cursor bool
+	Size   int
+	After  []interface{}
+	Before []interface{}
+}
+
+// page is a loaded page of a collection
+type page[T any] struct {
+	Items []T
+	Total int64
+	Next  string
+	Prev  string
+}
+
+// listResponse is a collection response carrying cursor pagination links
+type listResponse struct {
+	api2go.Response
+	Next string
+	Prev string
+}
+
+// Links returns the next and previous cursor links of the collection
+func (r listResponse) Links(req *http.Request, baseURL string) jsonapi.Links {
+	links := make(jsonapi.Links)
+	if r.Next != "" {
+		links["next"] = cursorLink(req, baseURL, "page[after]", r.Next)
+	}
+	if r.Prev != "" {
+		links["prev"] = cursorLink(req, baseURL, "page[before]", r.Prev)
+	}
+	return links
+}
+
+// cursorLink builds a link to the request URL with the given cursor parameter
+func cursorLink(req *http.Request, baseURL, param, cursor string) jsonapi.Link {
+	params := url.Values{}
+	if req != nil {
+		params = req.URL.Query()
+	}
+	params.Del("page[after]")
+	params.Del("page[before]")
+	params.Set(param, cursor)
+	query, _ := url.QueryUnescape(params.Encode())
+	return jsonapi.Link{Href: fmt.Sprintf("%s?%s", baseURL, query)}
+}
+
+// parseListOptions reads the sort and page query parameters of a request.
+// Only the given fields may be sorted by; defaultSort applies when no sort is requested.
+func parseListOptions(req api2go.Request, fields map[string]sortField, defaultSort []sortTerm) (listOptions, error) {
+	var opts listOptions
+
+	// Parse sort=field,-field
+	for _, name := range req.QueryParams["sort"] {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		desc := strings.HasPrefix(name, "-")
+		field, ok := fields[strings.TrimPrefix(name, "-")]
+		if !ok {
+			return opts, newHTTPError(nil, fmt.Sprintf("Cannot sort by %q", strings.TrimPrefix(name, "-")), http.StatusBadRequest)
+		}
+		opts.Sort = append(opts.Sort, sortTerm{sortField: field, Desc: desc})
+	}
+	if len(opts.Sort) == 0 {
+		opts.Sort = append(opts.Sort, defaultSort...)
+	}
+	opts.Sort = append(opts.Sort, idSortTerm)
+
+	pagination := req.Pagination
+	number, size := pagination["number"], pagination["size"]
+	offset, limit := pagination["offset"], pagination["limit"]
+	after, before := pagination["after"], pagination["before"]
+
+	switch {
+	case number != "" && size != "":
+		n, err := parsePageParam("page[number]", number, 1)
+		if err != nil {
+			return opts, err
+		}
+		s, err := parsePageSize("page[size]", size)
+		if err != nil {
+			return opts, err
+		}
+		opts.Offset, opts.Limit = (n-1)*s, s
+	case offset != "" && limit != "":
+		o, err := parsePageParam("page[offset]", offset, 0)
+		if err != nil {
+			return opts, err
+		}
+		l, err := parsePageSize("page[limit]", limit)
+		if err != nil {
+			return opts, err
+		}
+		opts.Offset, opts.Limit = o, l
+	case after != "" || before != "" || size != "":
+		if after != "" && before != "" {
+			return opts, newHTTPError(nil, "page[after] and page[before] cannot be combined", http.StatusBadRequest)
+		}
+		opts.Cursor = true
+		opts.Size = defaultPageSize
+		if size != "" {
+			s, err := parsePageSize("page[size]", size)
+			if err != nil {
+				return opts, err
+			}
+			opts.Size = s
+		}
+		var err error
+		if after != "" {
+			opts.After, err = decodeCursor(after, opts.Sort)
+		} else if before != "" {
+			opts.Before, err = decodeCursor(before, opts.Sort)
+		}
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+// parsePageParam parses an integer page parameter that must be at least min
+func parsePageParam(name, value string, min int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min {
+		return 0, newHTTPError(err, fmt.Sprintf("%s must be an integer of at least %d", name, min), http.StatusBadRequest)
+	}
+	return n, nil
+}
+
+// parsePageSize parses a page size parameter, which is limited to maxPageSize
+func parsePageSize(name, value string) (int, error) {
+	n, err := parsePageParam(name, value, 1)
+	if err != nil {
+		return 0, err
+	}
+	if n > maxPageSize {
+		return 0, newHTTPError(nil, fmt.Sprintf("%s must not exceed %d", name, maxPageSize), http.StatusBadRequest)
+	}
+	return n, nil
+}
+
+// findPage counts the rows matching query, then loads the page described by opts
+func findPage[T any](query *gorm.DB, opts listOptions) (page[T], error) {
+	var result page[T]
+	query = query.Session(&gorm.Session{})
+
+	if err := query.Session(&gorm.Session{NewDB: true}).Table("(?) AS results", query).Count(&result.Total).Error; err != nil {
+		return result, err
+	}
+
+	if !opts.Cursor {
+		query = orderBy(query, opts.Sort, false)
+		if opts.Limit > 0 {
+			query = query.Offset(opts.Offset).Limit(opts.Limit)
+		}
+		err := query.Find(&result.Items).Error
+		return result, err
+	}
+
+	// Cursor pagination reads one extra row to find out whether there is another page
+	backwards := opts.Before != nil
+	if opts.After != nil {
+		condition, args := keysetCondition(opts.Sort, opts.After, false)
+		query = query.Where(condition, args...)
+	} else if backwards {
+		condition, args := keysetCondition(opts.Sort, opts.Before, true)
+		query = query.Where(condition, args...)
+	}
+	query = orderBy(query, opts.Sort, backwards).Limit(opts.Size + 1)
+	if err := query.Find(&result.Items).Error; err != nil {
+		return result, err
+	}
+
+	more := len(result.Items) > opts.Size
+	if more {
+		result.Items = result.Items[:opts.Size]
+	}
+	if backwards {
+		for i, j := 0, len(result.Items)-1; i < j; i, j = i+1, j-1 {
+			result.Items[i], result.Items[j] = result.Items[j], result.Items[i]
+		}
+	}
+	if len(result.Items) == 0 {
+		return result, nil
+	}
+
+	hasNext := more || backwards
+	hasPrev := opts.After != nil || (backwards && more)
+	if hasNext {
+		cursor, err := encodeCursor(query, result.Items[len(result.Items)-1], opts.Sort)
+		if err != nil {
+			return result, err
+		}
+		result.Next = cursor
+	}
+	if hasPrev {
+		cursor, err := encodeCursor(query, result.Items[0], opts.Sort)
+		if err != nil {
+			return result, err
+		}
+		result.Prev = cursor
+	}
+
+	return result, nil
+}
+
+// orderBy applies the sort terms to query, reversing every direction if requested
+func orderBy(query *gorm.DB, terms []sortTerm, reverse bool) *gorm.DB {
+	for _, term := range terms {
+		direction := "ASC"
+		if term.Desc != reverse {
+			direction = "DESC"
+		}
+		query = query.Order(term.Column + " " + direction)
+	}
+	return query
+}
+
+// keysetCondition builds a condition selecting the rows sorted after the
+// cursor values, or before them if backwards is set
+func keysetCondition(terms []sortTerm, values []interface{}, backwards bool) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	for i, term := range terms {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, terms[j].Column+" = ?")
+			args = append(args, values[j])
+		}
+		operator := ">"
+		if term.Desc != backwards {
+			operator = "<"
+		}
+		parts = append(parts, term.Column+" "+operator+" ?")
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+// encodeCursor encodes the sort values of item as an opaque cursor
+func encodeCursor(query *gorm.DB, item interface{}, terms []sortTerm) (string, error) {
+	itemSchema, err := schema.Parse(item, schemaCache, query.NamingStrategy)
+	if err != nil {
+		return "", err
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(item))
+	values := make([]interface{}, len(terms))
+	for i, term := range terms {
+		field := itemSchema.LookUpField(term.Column)
+		if field == nil {
+			return "", fmt.Errorf("unknown sort column %s", term.Column)
+		}
+		fieldValue, _ := field.ValueOf(context.Background(), value)
+		if t, ok := fieldValue.(time.Time); ok {
+			fieldValue = t.Format(time.RFC3339Nano)
+		}
+		values[i] = fieldValue
+	}
+
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+// decodeCursor decodes a cursor created by encodeCursor for the same sort terms
+func decodeCursor(cursor string, terms []sortTerm) ([]interface{}, error) {
+	invalid := newHTTPError(nil, "Invalid page cursor", http.StatusBadRequest)
+
+	payload, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	var raw []interface{}
+	if err := json.Unmarshal(payload, &raw); err != nil || len(raw) != len(terms) {
+		return nil, invalid
+	}
+
+	values := make([]interface{}, len(terms))
+	for i, term := range terms {
+		switch v := raw[i].(type) {
+		case string:
+			if term.Time {
+				t, err := time.Parse(time.RFC3339Nano, v)
+				if err != nil {
+					return nil, invalid
+				}
+				values[i] = t
+			} else {
+				values[i] = v
+			}
+		case float64:
+			values[i] = v
+		default:
+			return nil, invalid
+		}
+	}
+	return values, nil
+}
+
+// newListResponse creates the response for a loaded page
+func newListResponse[T any](result page[T]) *listResponse {
+	return &listResponse{
+		Response: api2go.Response{
+			Res:  result.Items,
+			Code: http.StatusOK,
+			Meta: map[string]interface{}{"total": result.Total},
+		},
+		Next: result.Next,
+		Prev: result.Prev,
+	}
+}
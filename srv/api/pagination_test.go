@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"testing"
+
+	"github.com/manyminds/api2go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPageRequest creates an authenticated request with pagination parameters
+func newPageRequest(user models.User, queryParams map[string][]string, pagination map[string]string) api2go.Request {
+	req := newRequest(user.ID, queryParams)
+	req.Pagination = pagination
+	return req
+}
+
+// folderNames returns the names of the folders in a response
+func folderNames(t *testing.T, resp api2go.Responder) []string {
+	t.Helper()
+	folders, ok := resp.Result().([]models.Folder)
+	require.True(t, ok, "Expected result to be a slice of Folders")
+	names := make([]string, len(folders))
+	for i, folder := range folders {
+		names[i] = folder.Name
+	}
+	return names
+}
+
+func TestFolderResource_Pagination(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewFolderResource(db)
+
+	// Create a test user with five folders and one deleted folder
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	for i := 1; i <= 5; i++ {
+		folder := models.Folder{Name: fmt.Sprintf("Folder %d", i), UserID: user.ID}
+		require.NoError(t, db.Create(&folder).Error, "Failed to create test folder")
+	}
+	deleted := models.Folder{Name: "Folder 6", UserID: user.ID}
+	require.NoError(t, db.Create(&deleted).Error, "Failed to create test folder")
+	require.NoError(t, db.Delete(&deleted).Error, "Failed to delete test folder")
+
+	// Test sorting
+	t.Run("Sort", func(t *testing.T) {
+		resp, err := resource.FindAll(newRequest(user.ID, map[string][]string{"sort": {"-name"}}))
+		require.NoError(t, err, "Failed to find all folders")
+		assert.Equal(t, []string{"Folder 5", "Folder 4", "Folder 3", "Folder 2", "Folder 1"}, folderNames(t, resp), "Expected folders sorted by name descending")
+		assert.Equal(t, int64(5), resp.Metadata()["total"], "Expected total to exclude deleted folders")
+	})
+
+	// Test sorting by an unknown field
+	t.Run("SortUnknownField", func(t *testing.T) {
+		_, err := resource.FindAll(newRequest(user.ID, map[string][]string{"sort": {"user_id"}}))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	// Test page[number] and page[size]
+	t.Run("PageNumber", func(t *testing.T) {
+		req := newPageRequest(user, map[string][]string{"sort": {"name"}}, map[string]string{"number": "2", "size": "2"})
+		total, resp, err := resource.PaginatedFindAll(req)
+		require.NoError(t, err, "Failed to find folder page")
+		assert.Equal(t, uint(5), total, "Expected total count of folders")
+		assert.Equal(t, []string{"Folder 3", "Folder 4"}, folderNames(t, resp), "Expected second page of folders")
+		assert.Equal(t, int64(5), resp.Metadata()["total"], "Expected total in meta")
+	})
+
+	// Test page[offset] and page[limit]
+	t.Run("PageOffset", func(t *testing.T) {
+		req := newPageRequest(user, map[string][]string{"sort": {"name"}}, map[string]string{"offset": "4", "limit": "2"})
+		total, resp, err := resource.PaginatedFindAll(req)
+		require.NoError(t, err, "Failed to find folder page")
+		assert.Equal(t, uint(5), total, "Expected total count of folders")
+		assert.Equal(t, []string{"Folder 5"}, folderNames(t, resp), "Expected last page of folders")
+	})
+
+	// Test page size limit
+	t.Run("PageSizeTooLarge", func(t *testing.T) {
+		req := newPageRequest(user, nil, map[string]string{"number": "1", "size": "101"})
+		_, _, err := resource.PaginatedFindAll(req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	// Test cursor pagination forwards and backwards
+	t.Run("Cursor", func(t *testing.T) {
+		sort := map[string][]string{"sort": {"-name"}}
+
+		resp, err := resource.FindAll(newPageRequest(user, sort, map[string]string{"size": "2"}))
+		require.NoError(t, err, "Failed to find first page")
+		assert.Equal(t, []string{"Folder 5", "Folder 4"}, folderNames(t, resp), "Expected first page of folders")
+		first, ok := resp.(*listResponse)
+		require.True(t, ok, "Expected a list response")
+		require.NotEmpty(t, first.Next, "Expected a next cursor")
+		assert.Empty(t, first.Prev, "Expected no previous cursor on the first page")
+
+		resp, err = resource.FindAll(newPageRequest(user, sort, map[string]string{"size": "2", "after": first.Next}))
+		require.NoError(t, err, "Failed to find second page")
+		assert.Equal(t, []string{"Folder 3", "Folder 2"}, folderNames(t, resp), "Expected second page of folders")
+		second := resp.(*listResponse)
+		require.NotEmpty(t, second.Next, "Expected a next cursor")
+		require.NotEmpty(t, second.Prev, "Expected a previous cursor")
+
+		resp, err = resource.FindAll(newPageRequest(user, sort, map[string]string{"size": "2", "after": second.Next}))
+		require.NoError(t, err, "Failed to find last page")
+		assert.Equal(t, []string{"Folder 1"}, folderNames(t, resp), "Expected last page of folders")
+		assert.Empty(t, resp.(*listResponse).Next, "Expected no next cursor on the last page")
+
+		resp, err = resource.FindAll(newPageRequest(user, sort, map[string]string{"size": "2", "before": second.Prev}))
+		require.NoError(t, err, "Failed to find previous page")
+		assert.Equal(t, []string{"Folder 5", "Folder 4"}, folderNames(t, resp), "Expected first page of folders")
+		assert.Empty(t, resp.(*listResponse).Prev, "Expected no previous cursor on the first page")
+	})
+
+	// Test an invalid cursor
+	t.Run("InvalidCursor", func(t *testing.T) {
+		_, err := resource.FindAll(newPageRequest(user, nil, map[string]string{"after": "not-a-cursor"}))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+}
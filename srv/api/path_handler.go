@@ -0,0 +1,214 @@
+package api
+
+import (
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PathHandler serves the breadcrumb paths of folders and documents and
+// resolves slash-separated paths to items
+type PathHandler struct {
+	DB *gorm.DB
+}
+
+// NewPathHandler creates a new PathHandler
+func NewPathHandler(db *gorm.DB) *PathHandler {
+	return &PathHandler{
+		DB: db,
+	}
+}
+
+// Register adds the path routes to the router
+func (h PathHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/folders/:id/path", h.FolderPath)
+	router.Handle(http.MethodGet, prefix+"/documents/:id/path", h.DocumentPath)
+	router.Handle(http.MethodGet, prefix+"/users/:id/resolve", h.Resolve)
+}
+
+// FolderPath returns the folders from the root down to and including the
+// given folder. For users the folder is shared with, the path starts at the
+// highest ancestor they can see.
+func (h PathHandler) FolderPath(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	folder, ok := findRequestFolder(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+	userID, _ := requestUserID(r)
+
+	logrus.WithField("id", folder.ID).Info("Finding folder path")
+
+	h.writePath(w, userID, &folder.ID)
+}
+
+// DocumentPath returns the folders from the root down to the folder containing
+// the given document. For users the document is shared with, the path starts
+// at the highest ancestor they can see, and is empty if they see none.
+func (h PathHandler) DocumentPath(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+	userID, _ := requestUserID(r)
+
+	logrus.WithField("id", document.ID).Info("Finding document path")
+
+	h.writePath(w, userID, document.FolderID)
+}
+
+// Resolve finds the folder or document of a user at a slash-separated path
+// such as /Projects/2026/notes. Every segment but the last names a folder; the
+// last names a folder or, if there is none, a document title. Should siblings
+// share a name, the oldest one is used.
+func (h PathHandler) Resolve(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		logrus.WithError(err).WithField("id", params["id"]).Error("Invalid user ID")
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if id != userID {
+		logrus.WithField("id", id).Warn("Cannot resolve another user's path")
+		writeError(w, http.StatusForbidden, "Cannot access another user")
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		logrus.WithField("path", path).Warn("Empty path")
+		writeError(w, http.StatusBadRequest, "path must name a folder or document")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"user_id": userID,
+		"path":    path,
+	}).Info("Resolving path")
+
+	// Walk down the folders named by every segment but the last
+	var parentID *uuid.UUID
+	last := len(segments) - 1
+	for _, segment := range segments[:last] {
+		folder, err := h.findFolder(userID, parentID, segment)
+		if err != nil {
+			writeResolveError(w, path, err)
+			return
+		}
+		parentID = &folder.ID
+	}
+
+	folder, err := h.findFolder(userID, parentID, segments[last])
+	if err == nil {
+		writeResponse(w, http.StatusOK, folder, nil)
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		writeResolveError(w, path, err)
+		return
+	}
+
+	document, err := h.findDocument(userID, parentID, segments[last])
+	if err != nil {
+		writeResolveError(w, path, err)
+		return
+	}
+	writeResponse(w, http.StatusOK, document, nil)
+}
+
+// findFolder loads the oldest folder of the user with the given name inside
+// the parent folder, or at the root if parentID is nil
+func (h PathHandler) findFolder(userID uuid.UUID, parentID *uuid.UUID, name string) (models.Folder, error) {
+	query := h.DB.Where("user_id = ? AND name = ?", userID, name)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var folder models.Folder
+	err := query.Order("created_at").Order("id").First(&folder).Error
+	return folder, err
+}
+
+// findDocument loads the oldest document of the user with the given title
+// inside the folder, or at the root if folderID is nil
+func (h PathHandler) findDocument(userID uuid.UUID, folderID *uuid.UUID, title string) (models.Document, error) {
+	query := h.DB.Where("user_id = ? AND title = ?", userID, title)
+	if folderID == nil {
+		query = query.Where("folder_id IS NULL")
+	} else {
+		query = query.Where("folder_id = ?", *folderID)
+	}
+
+	var document models.Document
+	err := query.Order("created_at").Order("id").First(&document).Error
+	return document, err
+}
+
+// writeResolveError writes the error response for a path that could not be resolved
+func writeResolveError(w http.ResponseWriter, path string, err error) {
+	if err == gorm.ErrRecordNotFound {
+		logrus.WithField("path", path).Warn("Path not found")
+		writeError(w, http.StatusNotFound, "Path not found")
+		return
+	}
+	logrus.WithError(err).WithField("path", path).Error("Failed to resolve path")
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// writePath writes the folder and those of its ancestors the user may access
+// ordered from the root down, or an empty list for items at the root. As
+// shares extend to subfolders, the path leaves out the ancestors above the
+// highest one the user can see.
+func (h PathHandler) writePath(w http.ResponseWriter, userID uuid.UUID, folderID *uuid.UUID) {
+	folders := []models.Folder{}
+	if folderID != nil {
+		ancestors, err := database.FolderAncestors(h.DB, *folderID)
+		if err != nil {
+			logrus.WithError(err).WithField("id", *folderID).Error("Failed to find folder ancestors")
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		var accessibleIDs []uuid.UUID
+		if err := h.DB.Model(&models.Folder{}).Scopes(database.AccessibleFolders(userID)).
+			Where("folders.id IN (?)", database.FolderAncestorIDs(h.DB, *folderID)).
+			Pluck("folders.id", &accessibleIDs).Error; err != nil {
+			logrus.WithError(err).WithField("id", *folderID).Error("Failed to find accessible folder ancestors")
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		accessible := make(map[uuid.UUID]bool, len(accessibleIDs))
+		for _, id := range accessibleIDs {
+			accessible[id] = true
+		}
+
+		for i, folder := range ancestors {
+			if accessible[folder.ID] {
+				folders = ancestors[i:]
+				break
+			}
+		}
+	}
+
+	writeResponse(w, http.StatusOK, folders, nil)
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create handler
+	handler := NewPathHandler(db)
+
+	// Create a test user with a folder tree Projects/2026 and documents in it
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	projects := models.Folder{Name: "Projects", UserID: user.ID}
+	require.NoError(t, db.Create(&projects).Error, "Failed to create folder")
+	year := models.Folder{Name: "2026", UserID: user.ID, ParentID: &projects.ID}
+	require.NoError(t, db.Create(&year).Error, "Failed to create subfolder")
+
+	notes := models.Document{Title: "notes", UserID: user.ID, FolderID: &year.ID}
+	readme := models.Document{Title: "readme", UserID: user.ID}
+	for _, doc := range []*models.Document{&notes, &readme} {
+		require.NoError(t, db.Create(doc).Error, "Failed to create document")
+	}
+
+	type resource struct {
+		ID         string                 `json:"id"`
+		Type       string                 `json:"type"`
+		Attributes map[string]interface{} `json:"attributes"`
+	}
+	serve := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), target string, id uuid.UUID, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		h(rec, req, map[string]string{"id": id.String()}, nil)
+		return rec
+	}
+	pathIDs := func(rec *httptest.ResponseRecorder) []string {
+		var body struct {
+			Data []resource `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		ids := []string{}
+		for _, folder := range body.Data {
+			ids = append(ids, folder.ID)
+		}
+		return ids
+	}
+	resolve := func(path string) (*httptest.ResponseRecorder, resource) {
+		rec := serve(handler.Resolve, "/?path="+url.QueryEscape(path), user.ID, user.ID)
+		var body struct {
+			Data resource `json:"data"`
+		}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		}
+		return rec, body.Data
+	}
+
+	// Test FolderPath
+	t.Run("FolderPath", func(t *testing.T) {
+		rec := serve(handler.FolderPath, "/", year.ID, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{projects.ID.String(), year.ID.String()}, pathIDs(rec), "Expected folders from the root down")
+
+		rec = serve(handler.FolderPath, "/", projects.ID, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{projects.ID.String()}, pathIDs(rec), "Expected root folder only")
+	})
+
+	// Test DocumentPath
+	t.Run("DocumentPath", func(t *testing.T) {
+		rec := serve(handler.DocumentPath, "/", notes.ID, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{projects.ID.String(), year.ID.String()}, pathIDs(rec), "Expected folders of the document")
+
+		rec = serve(handler.DocumentPath, "/", readme.ID, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Empty(t, pathIDs(rec), "Expected empty path for a root document")
+	})
+
+	// Test Resolve
+	t.Run("Resolve", func(t *testing.T) {
+		rec, item := resolve("/Projects/2026/notes")
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, "documents", item.Type, "Expected a document")
+		assert.Equal(t, notes.ID.String(), item.ID, "Expected the notes document")
+
+		rec, item = resolve("Projects/2026/")
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, "folders", item.Type, "Expected a folder")
+		assert.Equal(t, year.ID.String(), item.ID, "Expected the 2026 folder")
+
+		rec, item = resolve("/readme")
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, readme.ID.String(), item.ID, "Expected the root document")
+
+		rec, _ = resolve("/Projects/notes")
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+
+		rec, _ = resolve("/Projects/2026/notes/more")
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected documents not to contain items")
+
+		rec, _ = resolve("/")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+	})
+
+	// Test the paths of a folder and of documents shared with another user
+	t.Run("Sharee", func(t *testing.T) {
+		sharee := models.User{Username: "sharee", Email: "sharee@example.com"}
+		require.NoError(t, db.Create(&sharee).Error, "Failed to create sharee")
+		draft := models.Document{Title: "draft", UserID: user.ID, FolderID: &projects.ID}
+		require.NoError(t, db.Create(&draft).Error, "Failed to create document")
+		folderShare := models.Share{UserID: sharee.ID, FolderID: &year.ID, Role: models.RoleViewer, OwnerID: user.ID, CreatedByID: user.ID}
+		documentShare := models.Share{UserID: sharee.ID, DocumentID: &draft.ID, Role: models.RoleViewer, OwnerID: user.ID, CreatedByID: user.ID}
+		for _, share := range []*models.Share{&folderShare, &documentShare} {
+			require.NoError(t, db.Create(share).Error, "Failed to create share")
+		}
+
+		rec := serve(handler.FolderPath, "/", year.ID, sharee.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{year.ID.String()}, pathIDs(rec), "Expected the path to start at the shared folder")
+
+		rec = serve(handler.DocumentPath, "/", notes.ID, sharee.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{year.ID.String()}, pathIDs(rec), "Expected the path to start at the shared folder")
+
+		rec = serve(handler.DocumentPath, "/", draft.ID, sharee.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Empty(t, pathIDs(rec), "Expected an empty path for a document shared on its own")
+
+		rec = serve(handler.FolderPath, "/", projects.ID, sharee.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected the unshared parent to stay hidden")
+	})
+
+	// Test ownership enforcement
+	t.Run("OtherUser", func(t *testing.T) {
+		otherUser := uuid.New()
+		rec := serve(handler.FolderPath, "/", year.ID, otherUser)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+
+		rec = serve(handler.DocumentPath, "/", notes.ID, otherUser)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+
+		rec = serve(handler.Resolve, "/?path=/Projects", user.ID, otherUser)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "Expected status code 403")
+	})
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"net/http"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"srv/storage"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// linkPasswordHeader carries the password of a password-protected share link
+const linkPasswordHeader = "X-Link-Password"
+
+// PublicLinkHandler serves the read-only content behind public share links.
+// Its routes don't require authentication; the link token grants access.
+type PublicLinkHandler struct {
+	DB    *gorm.DB
+	Blobs storage.Storage
+}
+
+// NewPublicLinkHandler creates a new PublicLinkHandler
+func NewPublicLinkHandler(db *gorm.DB, blobs storage.Storage) *PublicLinkHandler {
+	return &PublicLinkHandler{
+		DB:    db,
+		Blobs: blobs,
+	}
+}
+
+// publicDocument is a document as seen through a public link, without any
+// details about its owner or location
+type publicDocument struct {
+	ID          uuid.UUID `json:"-"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	ContentType string    `json:"content_type"`
+	Revision    int       `json:"revision"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (d publicDocument) GetID() string {
+	return d.ID.String()
+}
+
+// Register adds the public link routes to the router
+func (h PublicLinkHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/public/links/:token", h.Get)
+	router.Handle(http.MethodGet, prefix+"/public/links/:token/documents/:document_id", h.GetDocument)
+	router.Handle(http.MethodGet, prefix+"/public/links/:token/documents/:document_id/attachments", h.ListAttachments)
+	router.Handle(http.MethodGet, prefix+"/public/links/:token/documents/:document_id/attachments/:attachment_id/content", h.DownloadAttachment)
+}
+
+// Get returns the item behind a link: the document itself, which counts as a
+// download, or the tree of the linked folder
+func (h PublicLinkHandler) Get(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	link, ok := h.resolveLink(w, r, params["token"])
+	if !ok {
+		return
+	}
+
+	if link.DocumentID != nil {
+		h.serveDocument(w, link, link.DocumentID.String())
+		return
+	}
+
+	var folder models.Folder
+	if err := h.DB.First(&folder, "id = ?", link.FolderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", link.FolderID).Warn("Linked folder not found")
+			writeError(w, http.StatusNotFound, "Folder not found")
+			return
+		}
+		logrus.WithError(err).WithField("id", link.FolderID).Error("Failed to find linked folder")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	logrus.WithField("id", folder.ID).Info("Building public folder tree")
+
+	tree := &folderTree{ID: folder.ID, Name: folder.Name}
+	if err := (TreeHandler{DB: h.DB}).buildTree(tree, folder.UserID, folder.UserID, &folder.ID, 0); err != nil {
+		logrus.WithError(err).WithField("id", folder.ID).Error("Failed to build folder tree")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, *tree, nil)
+}
+
+// GetDocument returns a document within the linked folder, which counts as a download
+func (h PublicLinkHandler) GetDocument(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	link, ok := h.resolveLink(w, r, params["token"])
+	if !ok {
+		return
+	}
+
+	h.serveDocument(w, link, params["document_id"])
+}
+
+// ListAttachments returns the attachments of a linked document, oldest first
+func (h PublicLinkHandler) ListAttachments(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	link, ok := h.resolveLink(w, r, params["token"])
+	if !ok {
+		return
+	}
+	document, ok := h.findDocument(w, link, params["document_id"])
+	if !ok {
+		return
+	}
+
+	var attachments []models.Attachment
+	if err := h.DB.Where("document_id = ?", document.ID).Order("created_at").Order("id").Find(&attachments).Error; err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to find document attachments")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, attachments, nil)
+}
+
+// DownloadAttachment streams the content of an attachment of a linked
+// document. Revalidating with If-None-Match doesn't count as a download.
+func (h PublicLinkHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	link, ok := h.resolveLink(w, r, params["token"])
+	if !ok {
+		return
+	}
+	document, ok := h.findDocument(w, link, params["document_id"])
+	if !ok {
+		return
+	}
+
+	attachmentID, err := uuid.Parse(params["attachment_id"])
+	if err != nil {
+		logrus.WithError(err).WithField("attachment_id", params["attachment_id"]).Error("Invalid attachment ID")
+		writeError(w, http.StatusBadRequest, "Invalid attachment ID")
+		return
+	}
+
+	var attachment models.Attachment
+	if err := h.DB.First(&attachment, "id = ? AND document_id = ?", attachmentID, document.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("attachment_id", attachmentID).Warn("Attachment not found")
+			writeError(w, http.StatusNotFound, "Attachment not found")
+			return
+		}
+		logrus.WithError(err).WithField("attachment_id", attachmentID).Error("Failed to find attachment")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	etag := `"` + attachment.SHA256 + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if !h.countDownload(w, link) {
+		return
+	}
+	streamAttachment(w, r, h.Blobs, attachment)
+}
+
+// serveDocument writes a linked document after counting the download
+func (h PublicLinkHandler) serveDocument(w http.ResponseWriter, link models.ShareLink, id string) {
+	document, ok := h.findDocument(w, link, id)
+	if !ok {
+		return
+	}
+	if !h.countDownload(w, link) {
+		return
+	}
+
+	writeResponse(w, http.StatusOK, publicDocument{
+		ID:          document.ID,
+		Title:       document.Title,
+		Content:     document.Content,
+		ContentType: document.ContentType,
+		Revision:    document.Revision,
+		UpdatedAt:   document.UpdatedAt,
+	}, nil)
+}
+
+// resolveLink loads the share link for a token, writing an error response if
+// the link is unknown, no longer usable, or the request lacks its password
+func (h PublicLinkHandler) resolveLink(w http.ResponseWriter, r *http.Request, token string) (models.ShareLink, bool) {
+	var link models.ShareLink
+	if err := h.DB.First(&link, "token_hash = ?", auth.HashLinkToken(token)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.Warn("Share link not found")
+			writeError(w, http.StatusNotFound, "Link not found")
+			return models.ShareLink{}, false
+		}
+		logrus.WithError(err).Error("Failed to find share link")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return models.ShareLink{}, false
+	}
+
+	switch {
+	case link.RevokedAt != nil:
+		logrus.WithField("id", link.ID).Warn("Share link revoked")
+		writeError(w, http.StatusGone, "Link has been revoked")
+		return models.ShareLink{}, false
+	case link.Expired(time.Now()):
+		logrus.WithField("id", link.ID).Warn("Share link expired")
+		writeError(w, http.StatusGone, "Link has expired")
+		return models.ShareLink{}, false
+	case link.Exhausted():
+		logrus.WithField("id", link.ID).Warn("Share link download limit reached")
+		writeError(w, http.StatusGone, "Link download limit reached")
+		return models.ShareLink{}, false
+	}
+
+	if link.PasswordHash != "" {
+		password := r.Header.Get(linkPasswordHeader)
+		if password == "" {
+			writeError(w, http.StatusUnauthorized, "Link password required")
+			return models.ShareLink{}, false
+		}
+		if !auth.CheckPassword(link.PasswordHash, password) {
+			logrus.WithField("id", link.ID).Warn("Invalid share link password")
+			writeError(w, http.StatusUnauthorized, "Invalid link password")
+			return models.ShareLink{}, false
+		}
+	}
+
+	return link, true
+}
+
+// findDocument loads a document reachable through a link: the linked document
+// itself, or any document within the linked folder's subtree
+func (h PublicLinkHandler) findDocument(w http.ResponseWriter, link models.ShareLink, id string) (models.Document, bool) {
+	documentID, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid document ID")
+		writeError(w, http.StatusBadRequest, "Invalid document ID")
+		return models.Document{}, false
+	}
+
+	query := h.DB.Where("id = ?", documentID)
+	if link.DocumentID != nil {
+		query = query.Where("id = ?", *link.DocumentID)
+	} else {
+		query = query.Where("folder_id IN (?)", database.FolderSubtreeIDs(h.DB, *link.FolderID))
+	}
+
+	var document models.Document
+	if err := query.First(&document).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", documentID).Warn("Linked document not found")
+			writeError(w, http.StatusNotFound, "Document not found")
+			return models.Document{}, false
+		}
+		logrus.WithError(err).WithField("id", documentID).Error("Failed to find linked document")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return models.Document{}, false
+	}
+
+	return document, true
+}
+
+// countDownload records a download through a link, writing an error response
+// if the link was revoked or used up in the meantime. The limit is checked in
+// the same statement, so concurrent downloads can't exceed it.
+func (h PublicLinkHandler) countDownload(w http.ResponseWriter, link models.ShareLink) bool {
+	result := h.DB.Model(&models.ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL", link.ID).
+		Where("(max_downloads IS NULL OR download_count < max_downloads)").
+		UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+	if result.Error != nil {
+		logrus.WithError(result.Error).WithField("id", link.ID).Error("Failed to count share link download")
+		writeError(w, http.StatusInternalServerError, result.Error.Error())
+		return false
+	}
+	if result.RowsAffected == 0 {
+		logrus.WithField("id", link.ID).Warn("Share link download limit reached")
+		writeError(w, http.StatusGone, "Link download limit reached")
+		return false
+	}
+	return true
+}
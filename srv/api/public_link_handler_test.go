@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicLinkHandler(t *testing.T) {
+	// Setup test database and storage
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+	blobs := newTestStorage(t)
+
+	// Create handler
+	handler := NewPublicLinkHandler(db, blobs)
+
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+
+	// Create a folder with a subfolder, documents inside and outside of it, and an attachment
+	folder := models.Folder{Name: "Public", UserID: owner.ID}
+	require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+	sub := models.Folder{Name: "Sub", UserID: owner.ID, ParentID: &folder.ID}
+	require.NoError(t, db.Create(&sub).Error, "Failed to create subfolder")
+	nested := models.Document{Title: "Nested", Content: "Nested content", UserID: owner.ID, FolderID: &sub.ID}
+	require.NoError(t, db.Create(&nested).Error, "Failed to create document")
+	private := models.Document{Title: "Private", Content: "Private content", UserID: owner.ID}
+	require.NoError(t, db.Create(&private).Error, "Failed to create document")
+
+	attachment := models.Attachment{
+		DocumentID:  nested.ID,
+		UserID:      owner.ID,
+		Filename:    "notes.txt",
+		ContentType: "text/plain",
+		Size:        5,
+		SHA256:      "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		StorageKey:  "attachments/" + nested.ID.String() + "/notes",
+	}
+	require.NoError(t, blobs.Put(context.Background(), attachment.StorageKey, strings.NewReader("hello"), 5, "text/plain"), "Failed to store blob")
+	require.NoError(t, db.Create(&attachment).Error, "Failed to create attachment")
+
+	// newLink creates a link and returns its token
+	newLink := func(link models.ShareLink) (models.ShareLink, string) {
+		token, hash, err := auth.NewLinkToken()
+		require.NoError(t, err, "Failed to generate token")
+		link.TokenHash = hash
+		link.UserID = owner.ID
+		link.OwnerID = owner.ID
+		require.NoError(t, db.Create(&link).Error, "Failed to create share link")
+		return link, token
+	}
+
+	serve := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), params map[string]string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req, params, nil)
+		return rec
+	}
+
+	decodeTitle := func(rec *httptest.ResponseRecorder) string {
+		var body struct {
+			Data struct {
+				Attributes struct {
+					Title string `json:"title"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		return body.Data.Attributes.Title
+	}
+
+	downloads := func(link models.ShareLink) int {
+		var reloaded models.ShareLink
+		require.NoError(t, db.First(&reloaded, "id = ?", link.ID).Error, "Failed to reload share link")
+		return reloaded.DownloadCount
+	}
+
+	t.Run("Document", func(t *testing.T) {
+		link, token := newLink(models.ShareLink{DocumentID: &private.ID})
+
+		rec := serve(handler.Get, map[string]string{"token": token}, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, "Private", decodeTitle(rec), "Should return the linked document")
+		assert.NotContains(t, rec.Body.String(), owner.ID.String(), "Should not expose the owner")
+		assert.Equal(t, 1, downloads(link), "Viewing the document should count as a download")
+
+		rec = serve(handler.GetDocument, map[string]string{"token": token, "document_id": nested.ID.String()}, nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Other documents should not be reachable")
+	})
+
+	t.Run("Folder", func(t *testing.T) {
+		link, token := newLink(models.ShareLink{FolderID: &folder.ID})
+
+		rec := serve(handler.Get, map[string]string{"token": token}, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Contains(t, rec.Body.String(), `"name":"Sub"`, "Tree should contain the subfolder")
+		assert.Contains(t, rec.Body.String(), nested.ID.String(), "Tree should contain the nested document")
+		assert.Equal(t, 0, downloads(link), "Browsing the tree should not count as a download")
+
+		rec = serve(handler.GetDocument, map[string]string{"token": token, "document_id": nested.ID.String()}, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, "Nested", decodeTitle(rec), "Should return the nested document")
+		assert.Equal(t, 1, downloads(link), "Viewing a document should count as a download")
+
+		rec = serve(handler.GetDocument, map[string]string{"token": token, "document_id": private.ID.String()}, nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Documents outside the folder should not be reachable")
+
+		rec = serve(handler.GetDocument, map[string]string{"token": token, "document_id": "invalid"}, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+	})
+
+	t.Run("Attachments", func(t *testing.T) {
+		link, token := newLink(models.ShareLink{FolderID: &folder.ID})
+		params := map[string]string{"token": token, "document_id": nested.ID.String(), "attachment_id": attachment.ID.String()}
+
+		rec := serve(handler.ListAttachments, params, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Contains(t, rec.Body.String(), "notes.txt", "Should list the attachment")
+		assert.Equal(t, 0, downloads(link), "Listing attachments should not count as a download")
+
+		rec = serve(handler.DownloadAttachment, params, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, "hello", rec.Body.String(), "Should stream the attachment content")
+		assert.Equal(t, 1, downloads(link), "Downloading should count as a download")
+
+		rec = serve(handler.DownloadAttachment, params, http.Header{"If-None-Match": {`"` + attachment.SHA256 + `"`}})
+		assert.Equal(t, http.StatusNotModified, rec.Code, "Expected status code 304")
+		assert.Equal(t, 1, downloads(link), "Revalidating should not count as a download")
+	})
+
+	t.Run("DownloadLimit", func(t *testing.T) {
+		maxDownloads := 2
+		link, token := newLink(models.ShareLink{DocumentID: &private.ID, MaxDownloads: &maxDownloads})
+		params := map[string]string{"token": token}
+
+		for i := 0; i < maxDownloads; i++ {
+			rec := serve(handler.Get, params, nil)
+			assert.Equal(t, http.StatusOK, rec.Code, "Downloads within the limit should succeed")
+		}
+		rec := serve(handler.Get, params, nil)
+		assert.Equal(t, http.StatusGone, rec.Code, "Expected status code 410 once the limit is reached")
+		assert.Equal(t, maxDownloads, downloads(link), "Download count should not exceed the limit")
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		link, token := newLink(models.ShareLink{DocumentID: &private.ID})
+		require.NoError(t, db.Model(&link).Update("expires_at", time.Now().Add(-time.Minute)).Error, "Failed to expire link")
+
+		rec := serve(handler.Get, map[string]string{"token": token}, nil)
+		assert.Equal(t, http.StatusGone, rec.Code, "Expected status code 410")
+		assert.Contains(t, rec.Body.String(), "expired", "Error should mention the expiry")
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		link, token := newLink(models.ShareLink{DocumentID: &private.ID})
+		require.NoError(t, db.Model(&link).Update("revoked_at", time.Now()).Error, "Failed to revoke link")
+
+		rec := serve(handler.Get, map[string]string{"token": token}, nil)
+		assert.Equal(t, http.StatusGone, rec.Code, "Expected status code 410")
+		assert.Contains(t, rec.Body.String(), "revoked", "Error should mention the revocation")
+	})
+
+	t.Run("Password", func(t *testing.T) {
+		hash, err := auth.HashPassword("secret-password")
+		require.NoError(t, err, "Failed to hash password")
+		_, token := newLink(models.ShareLink{DocumentID: &private.ID, PasswordHash: hash})
+		params := map[string]string{"token": token}
+
+		rec := serve(handler.Get, params, nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Expected status code 401 without a password")
+
+		rec = serve(handler.Get, params, http.Header{linkPasswordHeader: {"wrong-password"}})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Expected status code 401 with a wrong password")
+
+		rec = serve(handler.Get, params, http.Header{linkPasswordHeader: {"secret-password"}})
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200 with the password")
+	})
+
+	t.Run("UnknownToken", func(t *testing.T) {
+		rec := serve(handler.Get, map[string]string{"token": "unknown"}, nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+	})
+
+	t.Run("DeletedDocument", func(t *testing.T) {
+		gone := models.Document{Title: "Gone", UserID: owner.ID}
+		require.NoError(t, db.Create(&gone).Error, "Failed to create document")
+		_, token := newLink(models.ShareLink{DocumentID: &gone.ID})
+		require.NoError(t, db.Delete(&gone).Error, "Failed to delete document")
+
+		rec := serve(handler.Get, map[string]string{"token": token}, nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Deleted documents should not be reachable")
+	})
+}
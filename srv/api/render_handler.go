@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"srv/models"
+	"srv/render"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// RenderHandler serves the rendered content of documents
+type RenderHandler struct {
+	DB *gorm.DB
+}
+
+// NewRenderHandler creates a new RenderHandler
+func NewRenderHandler(db *gorm.DB) *RenderHandler {
+	return &RenderHandler{
+		DB: db,
+	}
+}
+
+// documentRendering is the content of a document's revision as sanitized
+// HTML, with the excerpt and outline shown in listings
+type documentRendering struct {
+	DocumentID  uuid.UUID        `json:"document_id"`
+	Revision    int              `json:"revision"`
+	ContentType string           `json:"content_type"`
+	HTML        string           `json:"html"`
+	Excerpt     string           `json:"excerpt"`
+	Outline     []render.Heading `json:"outline"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (d documentRendering) GetID() string {
+	return d.DocumentID.String() + ":" + strconv.Itoa(d.Revision)
+}
+
+// Register adds the render route to the router
+func (h RenderHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/documents/:id/render", h.Render)
+}
+
+// Render returns the current content of a document converted to sanitized
+// HTML according to its content type, answering 304 Not Modified to requests
+// for the version the client already has
+func (h RenderHandler) Render(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	document, ok := findRequestDocument(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	// Every change of the document, including its content type, starts a new
+	// version, so clients can keep renderings until the version changes
+	etag := document.ETag()
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":           document.ID,
+		"content_type": document.ContentType,
+	}).Info("Rendering document")
+
+	result, err := render.Render(document.Content, document.ContentType)
+	if err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to render document")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, documentRendering{
+		DocumentID:  document.ID,
+		Revision:    document.Revision,
+		ContentType: document.ContentType,
+		HTML:        result.HTML,
+		Excerpt:     result.Excerpt,
+		Outline:     result.Outline,
+	}, nil)
+}
+
+// setExcerpt sets the excerpt of a listed document from its rendered content.
+// Documents that fail to render are listed without one.
+func setExcerpt(document *models.Document) {
+	result, err := render.Render(document.Content, document.ContentType)
+	if err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Warn("Failed to render document excerpt")
+		return
+	}
+	document.Excerpt = result.Excerpt
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create handler and document resource
+	handler := NewRenderHandler(db)
+	documents := NewDocumentResource(db)
+
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "other", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	content := "# Plan\n\n- [x] Draft <script>alert(1)</script>\n- [ ] Review\n"
+	resp, err := documents.Create(models.Document{Title: "Plan", Content: content, ContentType: models.ContentTypeMarkdown}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	doc := resp.Result().(models.Document)
+
+	serve := func(userID uuid.UUID, id string, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.Render(rec, req, map[string]string{"id": id}, nil)
+		return rec
+	}
+
+	type renderAttributes struct {
+		Revision    int    `json:"revision"`
+		ContentType string `json:"content_type"`
+		HTML        string `json:"html"`
+		Excerpt     string `json:"excerpt"`
+		Outline     []struct {
+			Level int    `json:"level"`
+			Text  string `json:"text"`
+			ID    string `json:"id"`
+		} `json:"outline"`
+	}
+	decode := func(rec *httptest.ResponseRecorder) renderAttributes {
+		var body struct {
+			Data struct {
+				Attributes renderAttributes `json:"attributes"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		return body.Data.Attributes
+	}
+
+	t.Run("Render", func(t *testing.T) {
+		rec := serve(user.ID, doc.ID.String(), "")
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, `"1"`, rec.Header().Get("ETag"), "Expected the ETag of the document's version")
+
+		rendering := decode(rec)
+		assert.Equal(t, 1, rendering.Revision, "Expected the current revision")
+		assert.Equal(t, models.ContentTypeMarkdown, rendering.ContentType, "Expected the document's content type")
+		assert.Contains(t, rendering.HTML, `<h1 id="plan">Plan</h1>`, "Expected the heading")
+		assert.Contains(t, rendering.HTML, `type="checkbox"`, "Expected the task list")
+		assert.NotContains(t, rendering.HTML, "<script", "Expected the script to be removed")
+		assert.Equal(t, "Plan Draft Review", rendering.Excerpt, "Expected the text")
+		require.Len(t, rendering.Outline, 1, "Expected the heading in the outline")
+		assert.Equal(t, "plan", rendering.Outline[0].ID, "Expected the heading's id")
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+		rec := serve(user.ID, doc.ID.String(), `"1"`)
+		assert.Equal(t, http.StatusNotModified, rec.Code, "Expected status code 304")
+		assert.Empty(t, rec.Body.String(), "Expected no body")
+
+		// Changing the content type starts a new version
+		applyPatch(t, &doc, "documents", doc.ID.String(), `{"content_type": "text/plain"}`)
+		_, err := documents.Update(doc, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update document")
+		rec = serve(user.ID, doc.ID.String(), `"1"`)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Contains(t, decode(rec).HTML, `<p># Plan</p>`, "Expected the content as plain text")
+	})
+
+	t.Run("Access", func(t *testing.T) {
+		rec := serve(other.ID, doc.ID.String(), "")
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+		rec = serve(user.ID, "invalid", "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+	})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+)
+
+// contentType is the media type of every JSON:API document written by this package
+const contentType = "application/vnd.api+json"
+
+// writeResponse marshals data as a JSON:API document and writes it with the given status
+func writeResponse(w http.ResponseWriter, status int, data interface{}, meta map[string]interface{}) {
+	document, err := jsonapi.MarshalToStruct(data, nil)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to marshal response")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(meta) > 0 {
+		document.Meta = meta
+	}
+	writeJSON(w, status, document)
+}
+
+// writeError writes a JSON:API error document with a single error
+func writeError(w http.ResponseWriter, status int, title string) {
+	writeJSON(w, status, map[string]interface{}{
+		"errors": []map[string]string{
+			{"status": strconv.Itoa(status), "title": title},
+		},
+	})
+}
+
+// writeJSON writes body as JSON with the JSON:API content type
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(payload)
+}
+
+// readAttributes decodes the attributes of a JSON:API request document into target
+func readAttributes(r *http.Request, target interface{}) error {
+	var document struct {
+		Data struct {
+			Attributes json.RawMessage `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&document); err != nil {
+		return err
+	}
+	if len(document.Data.Attributes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(document.Data.Attributes, target)
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"srv/auth"
+	"srv/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ShareLinkResource implements api2go.CRUD interface for ShareLink
+type ShareLinkResource struct {
+	DB *gorm.DB
+}
+
+// shareLinkSortFields are the attributes share links can be sorted by
+var shareLinkSortFields = map[string]sortField{
+	"download_count": {Column: "download_count"},
+	"created_at":     {Column: "created_at", Time: true},
+	"updated_at":     {Column: "updated_at", Time: true},
+}
+
+// NewShareLinkResource creates a new ShareLinkResource
+func NewShareLinkResource(db *gorm.DB) *ShareLinkResource {
+	return &ShareLinkResource{
+		DB: db,
+	}
+}
+
+// FindAll returns the public links the authenticated user created or that
+// point at the user's items
+func (r ShareLinkResource) FindAll(req api2go.Request) (api2go.Responder, error) {
+	logrus.Info("Finding all share links")
+
+	result, err := r.findLinks(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of share links along with the total count
+func (r ShareLinkResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of share links")
+
+	result, err := r.findLinks(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findLinks loads the share links matching the request's filters, sort and
+// page. Filtering by folder or document lists all links of that item, which
+// requires the owner role on it.
+func (r ShareLinkResource) findLinks(req api2go.Request) (page[models.ShareLink], error) {
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return page[models.ShareLink]{}, err
+	}
+
+	query := r.DB.Model(&models.ShareLink{})
+	filtered := false
+
+	// Filter by linked folder or document if provided
+	for _, item := range []struct{ param, title string }{
+		{"folder_id", "Invalid folder ID"},
+		{"document_id", "Invalid document ID"},
+	} {
+		values, ok := req.QueryParams[item.param]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		logrus.WithField(item.param, values[0]).Info("Filtering share links by item")
+
+		id, err := uuid.Parse(values[0])
+		if err != nil {
+			logrus.WithError(err).WithField(item.param, values[0]).Error(item.title)
+			return page[models.ShareLink]{}, newHTTPError(err, item.title, http.StatusBadRequest)
+		}
+
+		var folderID, documentID *uuid.UUID
+		if item.param == "folder_id" {
+			folderID = &id
+		} else {
+			documentID = &id
+		}
+		if _, err := itemOwner(r.DB, currentUser, folderID, documentID); err != nil {
+			return page[models.ShareLink]{}, accessHTTPError(err)
+		}
+
+		query = query.Where(item.param+" = ?", id)
+		filtered = true
+	}
+
+	if !filtered {
+		query = query.Where("(owner_id = ? OR user_id = ?)", currentUser, currentUser)
+	}
+
+	opts, err := parseListOptions(req, shareLinkSortFields, []sortTerm{{sortField: shareLinkSortFields["created_at"]}})
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.ShareLink]{}, err
+	}
+
+	result, err := findPage[models.ShareLink](query, opts)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find share links")
+		return page[models.ShareLink]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return result, nil
+}
+
+// FindOne returns a single share link
+func (r ShareLinkResource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Finding share link")
+
+	link, err := r.findLink(id, req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return &api2go.Response{Res: link, Code: http.StatusOK}, nil
+}
+
+// Create creates a public link to a folder or document. The response carries
+// the link's token, which can't be retrieved again.
+func (r ShareLinkResource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	link, ok := obj.(models.ShareLink)
+	if !ok {
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		logrus.WithError(err).Error("Invalid instance given to create share link")
+		return &api2go.Response{}, err
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"folder_id":   link.FolderID,
+		"document_id": link.DocumentID,
+		"expires_at":  link.ExpiresAt,
+	}).Info("Creating share link")
+
+	if (link.FolderID == nil) == (link.DocumentID == nil) {
+		return &api2go.Response{}, newHTTPError(nil, "Exactly one of folder_id and document_id must be given", http.StatusBadRequest)
+	}
+	if err := r.validateLimits(link); err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Publishing an item requires the owner role on it
+	link.OwnerID, err = itemOwner(r.DB, currentUser, link.FolderID, link.DocumentID)
+	if err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
+	}
+
+	link.PasswordHash = ""
+	if link.Password != "" {
+		if link.PasswordHash, err = hashLinkPassword(link.Password); err != nil {
+			return &api2go.Response{}, err
+		}
+	}
+
+	token, hash, err := auth.NewLinkToken()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate link token")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	link.ID = uuid.Nil
+	link.TokenHash = hash
+	link.UserID = currentUser
+	link.DownloadCount = 0
+	link.RevokedAt = nil
+	if err := r.DB.Create(&link).Error; err != nil {
+		logrus.WithError(err).Error("Failed to create share link")
+		return &api2go.Response{}, constraintHTTPError(err)
+	}
+
+	link.Token = token
+	link.Password = ""
+	link.PasswordProtected = link.PasswordHash != ""
+	return &api2go.Response{Res: link, Code: http.StatusCreated}, nil
+}
+
+// Delete revokes a share link. The link is kept so that its download count
+// remains visible, but it can no longer be used.
+func (r ShareLinkResource) Delete(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Revoking share link")
+
+	link, err := r.findLink(id, req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	if link.RevokedAt == nil {
+		if err := r.DB.Model(&link).Update("revoked_at", time.Now().UTC()).Error; err != nil {
+			logrus.WithError(err).WithField("id", id).Error("Failed to revoke share link")
+			return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	return &api2go.Response{Code: http.StatusNoContent}, nil
+}
+
+// Update changes the expiry, download limit or password of a share link
+func (r ShareLinkResource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	link, ok := obj.(models.ShareLink)
+	if !ok {
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		logrus.WithError(err).Error("Invalid instance given to update share link")
+		return &api2go.Response{}, err
+	}
+
+	logrus.WithField("id", link.ID).Info("Updating share link")
+
+	existingLink, err := r.findLink(link.ID.String(), req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+	if existingLink.RevokedAt != nil {
+		return &api2go.Response{}, newHTTPError(nil, "Revoked links cannot be changed", http.StatusBadRequest)
+	}
+
+	existingLink.ExpiresAt = link.ExpiresAt
+	existingLink.MaxDownloads = link.MaxDownloads
+	if err := r.validateLimits(existingLink); err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// A new password replaces the old one; the password can't be removed
+	if link.Password != "" {
+		if existingLink.PasswordHash, err = hashLinkPassword(link.Password); err != nil {
+			return &api2go.Response{}, err
+		}
+		existingLink.PasswordProtected = true
+	}
+
+	if err := r.DB.Model(&existingLink).Select("expires_at", "max_downloads", "password_hash").Updates(&existingLink).Error; err != nil {
+		logrus.WithError(err).WithField("id", link.ID).Error("Failed to update share link")
+		return &api2go.Response{}, constraintHTTPError(err)
+	}
+
+	return &api2go.Response{Res: existingLink, Code: http.StatusOK}, nil
+}
+
+// validateLimits checks that a link's expiry lies in the future and that its
+// download limit allows at least one download
+func (r ShareLinkResource) validateLimits(link models.ShareLink) error {
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return newHTTPError(nil, "Expiry must be in the future", http.StatusBadRequest)
+	}
+	if link.MaxDownloads != nil && *link.MaxDownloads < 1 {
+		return newHTTPError(nil, "Download limit must be at least 1", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// findLink loads a share link of an item the authenticated user holds the
+// owner role on
+func (r ShareLinkResource) findLink(id string, req api2go.Request) (models.ShareLink, error) {
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid share link ID")
+		return models.ShareLink{}, newHTTPError(err, "Invalid share link ID", http.StatusBadRequest)
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return models.ShareLink{}, err
+	}
+
+	var link models.ShareLink
+	if err := r.DB.First(&link, "id = ?", uuid).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", id).Warn("Share link not found")
+			return models.ShareLink{}, newHTTPError(err, "Share link not found", http.StatusNotFound)
+		}
+		logrus.WithError(err).WithField("id", id).Error("Failed to find share link")
+		return models.ShareLink{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	if link.OwnerID == currentUser {
+		return link, nil
+	}
+	if _, err := itemOwner(r.DB, currentUser, link.FolderID, link.DocumentID); err != nil {
+		var access accessError
+		if errors.As(err, &access) {
+			logrus.WithField("id", id).Warn("Share link not found")
+			return models.ShareLink{}, newHTTPError(err, "Share link not found", http.StatusNotFound)
+		}
+		return models.ShareLink{}, accessHTTPError(err)
+	}
+
+	return link, nil
+}
+
+// hashLinkPassword hashes the password protecting a share link
+func hashLinkPassword(password string) (string, error) {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		if errors.Is(err, auth.ErrPasswordTooShort) {
+			return "", newHTTPError(err, "Link password must be at least 8 characters", http.StatusBadRequest)
+		}
+		logrus.WithError(err).Error("Failed to hash link password")
+		return "", newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+	return hash, nil
+}
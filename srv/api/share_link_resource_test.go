@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareLinkResource_CRUD(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewShareLinkResource(db)
+
+	// Create the owner of the linked items, a co-owner and a bystander
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+	coOwner := models.User{Username: "coowner", Email: "coowner@example.com"}
+	require.NoError(t, db.Create(&coOwner).Error, "Failed to create co-owner")
+	bystander := models.User{Username: "bystander", Email: "bystander@example.com"}
+	require.NoError(t, db.Create(&bystander).Error, "Failed to create bystander")
+
+	folder := models.Folder{Name: "Projects", UserID: owner.ID}
+	require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+	document := models.Document{Title: "Plan", UserID: owner.ID}
+	require.NoError(t, db.Create(&document).Error, "Failed to create document")
+
+	share := models.Share{UserID: coOwner.ID, FolderID: &folder.ID, Role: models.RoleOwner, OwnerID: owner.ID, CreatedByID: owner.ID}
+	require.NoError(t, db.Create(&share).Error, "Failed to create share")
+
+	var linkID string
+	expiresAt := time.Now().Add(24 * time.Hour).UTC()
+	maxDownloads := 3
+
+	t.Run("Create", func(t *testing.T) {
+		resp, err := resource.Create(models.ShareLink{
+			DocumentID:   &document.ID,
+			ExpiresAt:    &expiresAt,
+			MaxDownloads: &maxDownloads,
+			Password:     "secret-password",
+		}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create share link")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode(), "Expected status code 201")
+
+		link := resp.Result().(models.ShareLink)
+		assert.NotEmpty(t, link.Token, "Token should be returned on creation")
+		assert.Equal(t, auth.HashLinkToken(link.Token), link.TokenHash, "Only the token hash should be stored")
+		assert.Empty(t, link.Password, "Password should not be returned")
+		assert.True(t, link.PasswordProtected, "Link should be password protected")
+		assert.True(t, auth.CheckPassword(link.PasswordHash, "secret-password"), "Password should be hashed")
+		assert.Equal(t, owner.ID, link.OwnerID, "Link should record the item's owner")
+		assert.Equal(t, owner.ID, link.UserID, "Link should record who created it")
+		linkID = link.ID.String()
+	})
+
+	t.Run("CreateInvalid", func(t *testing.T) {
+		req := newRequest(owner.ID, nil)
+
+		_, err := resource.Create(models.ShareLink{}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		_, err = resource.Create(models.ShareLink{FolderID: &folder.ID, DocumentID: &document.ID}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		past := time.Now().Add(-time.Hour)
+		_, err = resource.Create(models.ShareLink{DocumentID: &document.ID, ExpiresAt: &past}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		zero := 0
+		_, err = resource.Create(models.ShareLink{DocumentID: &document.ID, MaxDownloads: &zero}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		_, err = resource.Create(models.ShareLink{DocumentID: &document.ID, Password: "short"}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("CreateWithoutOwnerRole", func(t *testing.T) {
+		_, err := resource.Create(models.ShareLink{DocumentID: &document.ID}, newRequest(bystander.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		// Co-owners of a folder can publish it on behalf of its owner
+		resp, err := resource.Create(models.ShareLink{FolderID: &folder.ID}, newRequest(coOwner.ID, nil))
+		require.NoError(t, err, "Co-owner should be able to create a link")
+		link := resp.Result().(models.ShareLink)
+		assert.Equal(t, owner.ID, link.OwnerID, "Link should belong to the folder's owner")
+		assert.False(t, link.PasswordProtected, "Link should not be password protected")
+	})
+
+	t.Run("FindAll", func(t *testing.T) {
+		resp, err := resource.FindAll(newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to find share links")
+		assert.Len(t, resp.Result(), 2, "Owner should see the links to their items")
+
+		resp, err = resource.FindAll(newRequest(coOwner.ID, map[string][]string{"folder_id": {folder.ID.String()}}))
+		require.NoError(t, err, "Failed to find folder links")
+		assert.Len(t, resp.Result(), 1, "Should list the links of the folder")
+
+		resp, err = resource.FindAll(newRequest(bystander.ID, nil))
+		require.NoError(t, err, "Failed to find share links")
+		assert.Empty(t, resp.Result(), "Bystander should see no links")
+
+		_, err = resource.FindAll(newRequest(bystander.ID, map[string][]string{"document_id": {document.ID.String()}}))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+	})
+
+	t.Run("FindOne", func(t *testing.T) {
+		resp, err := resource.FindOne(linkID, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to find share link")
+		link := resp.Result().(models.ShareLink)
+		assert.Empty(t, link.Token, "Token should not be returned again")
+		assert.True(t, link.PasswordProtected, "Link should report its password protection")
+
+		_, err = resource.FindOne(linkID, newRequest(bystander.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		_, err = resource.FindOne("invalid", newRequest(owner.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		resp, err := resource.FindOne(linkID, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to find share link")
+		link := resp.Result().(models.ShareLink)
+		previousHash := link.PasswordHash
+
+		// Lift the limits and replace the password
+		link.ExpiresAt = nil
+		link.MaxDownloads = nil
+		link.Password = "another-password"
+		link.DownloadCount = 100
+		resp, err = resource.Update(link, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update share link")
+		assert.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
+
+		var updated models.ShareLink
+		require.NoError(t, db.First(&updated, "id = ?", link.ID).Error, "Failed to reload share link")
+		assert.Nil(t, updated.ExpiresAt, "Expiry should be removed")
+		assert.Nil(t, updated.MaxDownloads, "Download limit should be removed")
+		assert.Equal(t, 0, updated.DownloadCount, "Download count should not be changeable")
+		assert.NotEqual(t, previousHash, updated.PasswordHash, "Password should be replaced")
+		assert.True(t, auth.CheckPassword(updated.PasswordHash, "another-password"), "New password should be set")
+
+		// Keeping the password when none is given
+		link.Password = ""
+		_, err = resource.Update(link, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update share link")
+		require.NoError(t, db.First(&updated, "id = ?", link.ID).Error, "Failed to reload share link")
+		assert.True(t, updated.PasswordProtected, "Password should be kept")
+
+		_, err = resource.Update(link, newRequest(bystander.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		resp, err := resource.Delete(linkID, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to revoke share link")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode(), "Expected status code 204")
+
+		var link models.ShareLink
+		require.NoError(t, db.First(&link, "id = ?", linkID).Error, "Revoked link should be kept")
+		assert.NotNil(t, link.RevokedAt, "Link should be revoked")
+
+		// Revoking again is a no-op, but a revoked link can't be changed
+		_, err = resource.Delete(linkID, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Revoking twice should succeed")
+		_, err = resource.Update(link, newRequest(owner.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+}
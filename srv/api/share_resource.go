@@ -0,0 +1,327 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"srv/models"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ShareResource implements api2go.CRUD interface for Share
+type ShareResource struct {
+	DB *gorm.DB
+}
+
+// shareSortFields are the attributes shares can be sorted by
+var shareSortFields = map[string]sortField{
+	"role":       {Column: "role"},
+	"created_at": {Column: "created_at", Time: true},
+	"updated_at": {Column: "updated_at", Time: true},
+}
+
+// NewShareResource creates a new ShareResource
+func NewShareResource(db *gorm.DB) *ShareResource {
+	return &ShareResource{
+		DB: db,
+	}
+}
+
+// FindAll returns the shares the authenticated user granted or received
+func (r ShareResource) FindAll(req api2go.Request) (api2go.Responder, error) {
+	logrus.Info("Finding all shares")
+
+	result, err := r.findShares(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of shares along with the total count
+func (r ShareResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of shares")
+
+	result, err := r.findShares(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findShares loads the shares matching the request's filters, sort and page.
+// Without a filter these are the shares of the user's own items and the shares
+// the user received. Filtering by folder or document lists all shares of that
+// item, which requires the owner role on it.
+func (r ShareResource) findShares(req api2go.Request) (page[models.Share], error) {
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return page[models.Share]{}, err
+	}
+
+	query := r.DB.Model(&models.Share{})
+	filtered := false
+
+	// Filter by shared folder if provided
+	if folderID, ok := req.QueryParams["folder_id"]; ok && len(folderID) > 0 {
+		logrus.WithField("folder_id", folderID[0]).Info("Filtering shares by folder ID")
+
+		uuid, err := uuid.Parse(folderID[0])
+		if err != nil {
+			logrus.WithError(err).WithField("folder_id", folderID[0]).Error("Invalid folder ID")
+			return page[models.Share]{}, newHTTPError(err, "Invalid folder ID", http.StatusBadRequest)
+		}
+
+		if _, err := findFolder(r.DB, currentUser, uuid, models.RoleOwner); err != nil {
+			return page[models.Share]{}, accessHTTPError(err)
+		}
+
+		query = query.Where("folder_id = ?", uuid)
+		filtered = true
+	}
+
+	// Filter by shared document if provided
+	if documentID, ok := req.QueryParams["document_id"]; ok && len(documentID) > 0 {
+		logrus.WithField("document_id", documentID[0]).Info("Filtering shares by document ID")
+
+		uuid, err := uuid.Parse(documentID[0])
+		if err != nil {
+			logrus.WithError(err).WithField("document_id", documentID[0]).Error("Invalid document ID")
+			return page[models.Share]{}, newHTTPError(err, "Invalid document ID", http.StatusBadRequest)
+		}
+
+		if _, err := findDocument(r.DB, currentUser, uuid, models.RoleOwner); err != nil {
+			return page[models.Share]{}, accessHTTPError(err)
+		}
+
+		query = query.Where("document_id = ?", uuid)
+		filtered = true
+	}
+
+	if !filtered {
+		query = query.Where("(owner_id = ? OR user_id = ?)", currentUser, currentUser)
+	}
+
+	opts, err := parseListOptions(req, shareSortFields, []sortTerm{{sortField: shareSortFields["created_at"]}})
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.Share]{}, err
+	}
+
+	result, err := findPage[models.Share](query, opts)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find shares")
+		return page[models.Share]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return result, nil
+}
+
+// FindOne returns a single share
+func (r ShareResource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Finding share")
+
+	share, err := r.findShare(id, req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return &api2go.Response{Res: share, Code: http.StatusOK}, nil
+}
+
+// Create shares a folder or document with another user
+func (r ShareResource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	share, ok := obj.(models.Share)
+	if !ok {
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		logrus.WithError(err).Error("Invalid instance given to create share")
+		return &api2go.Response{}, err
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"user_id":     share.UserID,
+		"folder_id":   share.FolderID,
+		"document_id": share.DocumentID,
+		"role":        share.Role,
+	}).Info("Creating share")
+
+	if (share.FolderID == nil) == (share.DocumentID == nil) {
+		return &api2go.Response{}, newHTTPError(nil, "Exactly one of folder_id and document_id must be given", http.StatusBadRequest)
+	}
+	if !models.ValidRole(share.Role) {
+		return &api2go.Response{}, newHTTPError(nil, "Role must be viewer, editor or owner", http.StatusBadRequest)
+	}
+
+	// Validate the user exists, looking them up by email if no ID is given
+	var user models.User
+	if share.UserID != uuid.Nil {
+		err = r.DB.First(&user, "id = ?", share.UserID).Error
+	} else if share.Email != "" {
+		err = r.DB.First(&user, "email = ?", share.Email).Error
+	} else {
+		return &api2go.Response{}, newHTTPError(nil, "Either user_id or email must be given", http.StatusBadRequest)
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithFields(logrus.Fields{"user_id": share.UserID, "email": share.Email}).Warn("User not found")
+			return &api2go.Response{}, newHTTPError(err, "User not found", http.StatusNotFound)
+		}
+		logrus.WithError(err).Error("Failed to find user")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+	share.UserID = user.ID
+	share.Email = ""
+
+	// Sharing requires the owner role on the item
+	share.OwnerID, err = itemOwner(r.DB, currentUser, share.FolderID, share.DocumentID)
+	if err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
+	}
+	if share.UserID == share.OwnerID {
+		return &api2go.Response{}, newHTTPError(nil, "Cannot share an item with its owner", http.StatusBadRequest)
+	}
+
+	// A user holds at most one share per item, whose role can be changed
+	existing := r.DB.Model(&models.Share{}).Where("user_id = ?", share.UserID)
+	if share.FolderID != nil {
+		existing = existing.Where("folder_id = ?", share.FolderID)
+	} else {
+		existing = existing.Where("document_id = ?", share.DocumentID)
+	}
+	var count int64
+	if err := existing.Count(&count).Error; err != nil {
+		logrus.WithError(err).Error("Failed to check existing shares")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+	if count > 0 {
+		logrus.WithField("user_id", share.UserID).Warn("Item is already shared with the user")
+		return &api2go.Response{}, newHTTPError(nil, "Item is already shared with the user", http.StatusConflict)
+	}
+
+	share.ID = uuid.Nil
+	share.CreatedByID = currentUser
+	if err := r.DB.Create(&share).Error; err != nil {
+		logrus.WithError(err).Error("Failed to create share")
+		return &api2go.Response{}, constraintHTTPError(err)
+	}
+
+	return &api2go.Response{Res: share, Code: http.StatusCreated}, nil
+}
+
+// Delete revokes a share. Users holding the owner role on the item can revoke
+// any of its shares, and users can give up shares they received.
+func (r ShareResource) Delete(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Deleting share")
+
+	share, err := r.findShare(id, req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+	if share.UserID != currentUser {
+		if _, err := itemOwner(r.DB, currentUser, share.FolderID, share.DocumentID); err != nil {
+			return &api2go.Response{}, accessHTTPError(err)
+		}
+	}
+
+	if err := r.DB.Delete(&share).Error; err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to delete share")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return &api2go.Response{Code: http.StatusNoContent}, nil
+}
+
+// Update changes the role of a share
+func (r ShareResource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	share, ok := obj.(models.Share)
+	if !ok {
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		logrus.WithError(err).Error("Invalid instance given to update share")
+		return &api2go.Response{}, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":   share.ID,
+		"role": share.Role,
+	}).Info("Updating share")
+
+	existingShare, err := r.findShare(share.ID.String(), req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+	if _, err := itemOwner(r.DB, currentUser, existingShare.FolderID, existingShare.DocumentID); err != nil {
+		return &api2go.Response{}, accessHTTPError(err)
+	}
+
+	// Only the role can change
+	if !models.ValidRole(share.Role) {
+		return &api2go.Response{}, newHTTPError(nil, "Role must be viewer, editor or owner", http.StatusBadRequest)
+	}
+	existingShare.Role = share.Role
+
+	if err := r.DB.Model(&existingShare).Update("role", existingShare.Role).Error; err != nil {
+		logrus.WithError(err).WithField("id", share.ID).Error("Failed to update share")
+		return &api2go.Response{}, constraintHTTPError(err)
+	}
+
+	return &api2go.Response{Res: existingShare, Code: http.StatusOK}, nil
+}
+
+// findShare loads a share the authenticated user granted, received or can
+// manage as an owner of the shared item
+func (r ShareResource) findShare(id string, req api2go.Request) (models.Share, error) {
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid share ID")
+		return models.Share{}, newHTTPError(err, "Invalid share ID", http.StatusBadRequest)
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return models.Share{}, err
+	}
+
+	var share models.Share
+	if err := r.DB.First(&share, "id = ?", uuid).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", id).Warn("Share not found")
+			return models.Share{}, newHTTPError(err, "Share not found", http.StatusNotFound)
+		}
+		logrus.WithError(err).WithField("id", id).Error("Failed to find share")
+		return models.Share{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	if share.OwnerID == currentUser || share.UserID == currentUser {
+		return share, nil
+	}
+	if _, err := itemOwner(r.DB, currentUser, share.FolderID, share.DocumentID); err != nil {
+		var access accessError
+		if errors.As(err, &access) {
+			logrus.WithField("id", id).Warn("Share not found")
+			return models.Share{}, newHTTPError(err, "Share not found", http.StatusNotFound)
+		}
+		return models.Share{}, accessHTTPError(err)
+	}
+
+	return share, nil
+}
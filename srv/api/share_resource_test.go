@@ -0,0 +1,350 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestShareResource_CRUD(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewShareResource(db)
+
+	// Create the owner of the shared items, a collaborator and a bystander
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+	collaborator := models.User{Username: "collaborator", Email: "collaborator@example.com"}
+	require.NoError(t, db.Create(&collaborator).Error, "Failed to create collaborator")
+	bystander := models.User{Username: "bystander", Email: "bystander@example.com"}
+	require.NoError(t, db.Create(&bystander).Error, "Failed to create bystander")
+
+	folder := models.Folder{Name: "Projects", UserID: owner.ID}
+	require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+	document := models.Document{Title: "Plan", UserID: owner.ID}
+	require.NoError(t, db.Create(&document).Error, "Failed to create document")
+
+	var shareID string
+
+	t.Run("Create", func(t *testing.T) {
+		resp, err := resource.Create(models.Share{Email: collaborator.Email, FolderID: &folder.ID, Role: models.RoleViewer}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create share")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode(), "Expected status code 201")
+
+		share := resp.Result().(models.Share)
+		assert.Equal(t, collaborator.ID, share.UserID, "Share should be resolved to the user with the email")
+		assert.Equal(t, owner.ID, share.OwnerID, "Share should record the item's owner")
+		assert.Equal(t, owner.ID, share.CreatedByID, "Share should record who created it")
+		assert.Empty(t, share.Email, "Email should not be returned")
+		shareID = share.ID.String()
+	})
+
+	t.Run("CreateInvalid", func(t *testing.T) {
+		req := newRequest(owner.ID, nil)
+
+		_, err := resource.Create(models.Share{UserID: collaborator.ID, Role: models.RoleViewer}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		_, err = resource.Create(models.Share{UserID: collaborator.ID, FolderID: &folder.ID, DocumentID: &document.ID, Role: models.RoleViewer}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		_, err = resource.Create(models.Share{UserID: collaborator.ID, DocumentID: &document.ID, Role: "admin"}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		_, err = resource.Create(models.Share{DocumentID: &document.ID, Role: models.RoleViewer}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		_, err = resource.Create(models.Share{Email: "nobody@example.com", DocumentID: &document.ID, Role: models.RoleViewer}, req)
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		// Items can't be shared with their owner
+		_, err = resource.Create(models.Share{UserID: owner.ID, DocumentID: &document.ID, Role: models.RoleViewer}, req)
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		// A user holds at most one share per item
+		_, err = resource.Create(models.Share{UserID: collaborator.ID, FolderID: &folder.ID, Role: models.RoleEditor}, req)
+		assertHTTPStatus(t, err, http.StatusConflict)
+	})
+
+	t.Run("CreateWithoutOwnerRole", func(t *testing.T) {
+		// Viewers can't share the item further
+		_, err := resource.Create(models.Share{UserID: bystander.ID, FolderID: &folder.ID, Role: models.RoleViewer}, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		// Items the user has no access to are not found
+		_, err = resource.Create(models.Share{UserID: bystander.ID, DocumentID: &document.ID, Role: models.RoleViewer}, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+	})
+
+	t.Run("FindAll", func(t *testing.T) {
+		// Both the owner and the collaborator see the share
+		for _, userID := range []uuid.UUID{owner.ID, collaborator.ID} {
+			resp, err := resource.FindAll(newRequest(userID, nil))
+			require.NoError(t, err, "Failed to find shares")
+			shares := resp.Result().([]models.Share)
+			require.Len(t, shares, 1, "Should find the share")
+			assert.Equal(t, shareID, shares[0].GetID(), "Should find the share")
+		}
+
+		resp, err := resource.FindAll(newRequest(bystander.ID, nil))
+		require.NoError(t, err, "Failed to find shares")
+		assert.Empty(t, resp.Result().([]models.Share), "Bystander should see no shares")
+
+		// Listing the shares of an item requires the owner role
+		resp, err = resource.FindAll(newRequest(owner.ID, map[string][]string{"folder_id": {folder.ID.String()}}))
+		require.NoError(t, err, "Failed to find shares of folder")
+		assert.Len(t, resp.Result().([]models.Share), 1, "Should find the share of the folder")
+
+		_, err = resource.FindAll(newRequest(collaborator.ID, map[string][]string{"folder_id": {folder.ID.String()}}))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+	})
+
+	t.Run("FindOne", func(t *testing.T) {
+		resp, err := resource.FindOne(shareID, newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Failed to find share")
+		assert.Equal(t, models.RoleViewer, resp.Result().(models.Share).Role, "Should find the share")
+
+		_, err = resource.FindOne(shareID, newRequest(bystander.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		_, err = resource.FindOne("invalid", newRequest(owner.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		id, _ := uuid.Parse(shareID)
+
+		// Grantees can't raise their own role
+		_, err := resource.Update(models.Share{ID: id, Role: models.RoleOwner}, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		_, err = resource.Update(models.Share{ID: id, Role: "admin"}, newRequest(owner.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		// Only the role changes
+		resp, err := resource.Update(models.Share{ID: id, UserID: bystander.ID, Role: models.RoleEditor}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update share")
+		share := resp.Result().(models.Share)
+		assert.Equal(t, models.RoleEditor, share.Role, "Role should be updated")
+		assert.Equal(t, collaborator.ID, share.UserID, "User should not change")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		_, err := resource.Delete(shareID, newRequest(bystander.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		// Grantees can give up a share they received
+		resp, err := resource.Delete(shareID, newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Failed to delete share")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode(), "Expected status code 204")
+
+		var count int64
+		require.NoError(t, db.Model(&models.Share{}).Count(&count).Error, "Failed to count shares")
+		assert.Zero(t, count, "Share should be deleted")
+	})
+
+	t.Run("OwnerRole", func(t *testing.T) {
+		// A co-owner can share the document further and revoke the shares
+		_, err := resource.Create(models.Share{UserID: collaborator.ID, DocumentID: &document.ID, Role: models.RoleOwner}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create owner share")
+
+		resp, err := resource.Create(models.Share{UserID: bystander.ID, DocumentID: &document.ID, Role: models.RoleViewer}, newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Co-owner should be able to share the document")
+		share := resp.Result().(models.Share)
+		assert.Equal(t, owner.ID, share.OwnerID, "Share should record the document's owner")
+		assert.Equal(t, collaborator.ID, share.CreatedByID, "Share should record who created it")
+
+		_, err = resource.Delete(share.GetID(), newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Co-owner should be able to revoke the share")
+	})
+}
+
+func TestShareResource_Access(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resources
+	shares := NewShareResource(db)
+	folders := NewFolderResource(db)
+	documents := NewDocumentResource(db)
+
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+	collaborator := models.User{Username: "collaborator", Email: "collaborator@example.com"}
+	require.NoError(t, db.Create(&collaborator).Error, "Failed to create collaborator")
+	bystander := models.User{Username: "bystander", Email: "bystander@example.com"}
+	require.NoError(t, db.Create(&bystander).Error, "Failed to create bystander")
+
+	// Create Team/Specs with a document in Specs, plus an unshared document
+	team := models.Folder{Name: "Team", UserID: owner.ID}
+	require.NoError(t, db.Create(&team).Error, "Failed to create folder")
+	specs := models.Folder{Name: "Specs", UserID: owner.ID, ParentID: &team.ID}
+	require.NoError(t, db.Create(&specs).Error, "Failed to create subfolder")
+	spec := models.Document{Title: "Spec", UserID: owner.ID, FolderID: &specs.ID}
+	require.NoError(t, db.Create(&spec).Error, "Failed to create document")
+	private := models.Document{Title: "Private", UserID: owner.ID}
+	require.NoError(t, db.Create(&private).Error, "Failed to create document")
+
+	resp, err := shares.Create(models.Share{UserID: collaborator.ID, FolderID: &team.ID, Role: models.RoleViewer}, newRequest(owner.ID, nil))
+	require.NoError(t, err, "Failed to share folder")
+	share := resp.Result().(models.Share)
+
+	setRole := func(role string) {
+		t.Helper()
+		_, err := shares.Update(models.Share{ID: share.ID, Role: role}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to change role")
+	}
+
+	t.Run("Inherited", func(t *testing.T) {
+		// The share covers the whole subtree
+		_, err := folders.FindOne(specs.ID.String(), newRequest(collaborator.ID, nil))
+		assert.NoError(t, err, "Subfolder should be visible")
+		_, err = documents.FindOne(spec.ID.String(), newRequest(collaborator.ID, nil))
+		assert.NoError(t, err, "Document in subfolder should be visible")
+
+		_, err = documents.FindOne(private.ID.String(), newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+		_, err = documents.FindOne(spec.ID.String(), newRequest(bystander.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+	})
+
+	t.Run("FindAll", func(t *testing.T) {
+		resp, err := documents.FindAll(newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Failed to find documents")
+		docs := resp.Result().([]models.Document)
+		require.Len(t, docs, 1, "Should find the shared document only")
+		assert.Equal(t, spec.ID, docs[0].ID, "Should find the shared document")
+
+		resp, err = folders.FindAll(newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Failed to find folders")
+		assert.Len(t, resp.Result().([]models.Folder), 2, "Should find the shared folder and its subfolder")
+
+		// Filtering by the user's own ID leaves out shared items
+		resp, err = documents.FindAll(newRequest(collaborator.ID, map[string][]string{"user_id": {collaborator.ID.String()}}))
+		require.NoError(t, err, "Failed to find documents")
+		assert.Empty(t, resp.Result().([]models.Document), "Should find no own documents")
+
+		resp, err = documents.FindAll(newRequest(bystander.ID, nil))
+		require.NoError(t, err, "Failed to find documents")
+		assert.Empty(t, resp.Result().([]models.Document), "Bystander should find no documents")
+	})
+
+	t.Run("Viewer", func(t *testing.T) {
+		spec.Title = "Edited"
+		_, err := documents.Update(spec, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		_, err = documents.Create(models.Document{Title: "New", FolderID: &specs.ID}, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		_, err = folders.Create(models.Folder{Name: "New", ParentID: &specs.ID}, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+	})
+
+	t.Run("Editor", func(t *testing.T) {
+		setRole(models.RoleEditor)
+
+		spec.Title = "Edited"
+		resp, err := documents.Update(spec, newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Editor should be able to update the document")
+		assert.Equal(t, "Edited", resp.Result().(models.Document).Title, "Title should be updated")
+		assert.Equal(t, owner.ID, resp.Result().(models.Document).UserID, "Owner should not change")
+
+		// Items created in a shared folder belong to the folder's owner
+		resp, err = documents.Create(models.Document{Title: "Notes", FolderID: &specs.ID}, newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Editor should be able to create a document")
+		notes := resp.Result().(models.Document)
+		assert.Equal(t, owner.ID, notes.UserID, "Document should belong to the folder's owner")
+
+		resp, err = folders.Create(models.Folder{Name: "Drafts", ParentID: &team.ID}, newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Editor should be able to create a subfolder")
+		assert.Equal(t, owner.ID, resp.Result().(models.Folder).UserID, "Subfolder should belong to the parent's owner")
+
+		// Editors can move items within the tree but not out of it
+		notes.FolderID = &team.ID
+		_, err = documents.Update(notes, newRequest(collaborator.ID, nil))
+		assert.NoError(t, err, "Editor should be able to move the document within the tree")
+		notes.FolderID = nil
+		_, err = documents.Update(notes, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+		specs.ParentID = nil
+		_, err = folders.Update(specs, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		own := models.Folder{Name: "Mine", UserID: collaborator.ID}
+		require.NoError(t, db.Create(&own).Error, "Failed to create folder")
+		notes.FolderID = &own.ID
+		_, err = documents.Update(notes, newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+
+		// Deleting requires the owner role
+		_, err = documents.Delete(notes.GetID(), newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+		_, err = folders.Delete(specs.GetID(), newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		setRole(models.RoleOwner)
+
+		resp, err := documents.Create(models.Document{Title: "Scratch", FolderID: &team.ID}, newRequest(collaborator.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+		_, err = documents.Delete(resp.Result().(models.Document).GetID(), newRequest(collaborator.ID, nil))
+		assert.NoError(t, err, "Co-owner should be able to delete the document")
+	})
+
+	t.Run("Handlers", func(t *testing.T) {
+		setRole(models.RoleViewer)
+
+		serveHandler := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), method string, params map[string]string, userID uuid.UUID) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/", nil)
+			req = req.WithContext(auth.WithUserID(req.Context(), userID))
+			rec := httptest.NewRecorder()
+			h(rec, req, params, nil)
+			return rec
+		}
+
+		// Viewers can read the history but not restore it
+		versions := NewDocumentVersionHandler(db)
+		rec := serveHandler(versions.List, http.MethodGet, map[string]string{"id": spec.ID.String()}, collaborator.ID)
+		assert.Equal(t, http.StatusOK, rec.Code, "Viewer should be able to list versions")
+		rec = serveHandler(versions.Restore, http.MethodPost, map[string]string{"id": spec.ID.String(), "revision": "1"}, collaborator.ID)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "Viewer should not be able to restore a version")
+		rec = serveHandler(versions.List, http.MethodGet, map[string]string{"id": spec.ID.String()}, bystander.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Bystander should not find the document")
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		_, err := shares.Delete(share.GetID(), newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to revoke share")
+
+		_, err = documents.FindOne(spec.ID.String(), newRequest(collaborator.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		_, err := shares.Create(models.Share{UserID: collaborator.ID, DocumentID: &private.ID, Role: models.RoleViewer}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to share document")
+
+		require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+			_, err := database.PurgeDocuments(tx, []uuid.UUID{private.ID})
+			return err
+		}), "Failed to purge document")
+
+		var count int64
+		require.NoError(t, db.Model(&models.Share{}).Where("document_id = ?", private.ID).Count(&count).Error, "Failed to count shares")
+		assert.Zero(t, count, "Shares of purged documents should be deleted")
+	})
+}
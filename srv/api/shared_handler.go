@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"srv/models"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SharedHandler serves the "shared with me" listings of the folders and
+// documents other users shared with the authenticated user
+type SharedHandler struct {
+	DB *gorm.DB
+}
+
+// NewSharedHandler creates a new SharedHandler
+func NewSharedHandler(db *gorm.DB) *SharedHandler {
+	return &SharedHandler{
+		DB: db,
+	}
+}
+
+// Register adds the shared-with-me routes to the router
+func (h SharedHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/shared/folders", h.ListFolders)
+	router.Handle(http.MethodGet, prefix+"/shared/documents", h.ListDocuments)
+}
+
+// ListFolders returns the folders shared with the authenticated user, sorted by
+// name. The `roles` meta maps each folder ID to the role the user was granted.
+// Subfolders of a shared folder are not listed separately.
+func (h SharedHandler) ListFolders(w http.ResponseWriter, r *http.Request, _ map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	logrus.WithField("user_id", userID).Info("Finding shared folders")
+
+	ids, roles, err := h.sharedRoles(userID, "folder_id")
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find shares")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	folders := []models.Folder{}
+	if err := h.DB.Scopes(preloadTags).Where("id IN ?", ids).Order("name").Order("id").Find(&folders).Error; err != nil {
+		logrus.WithError(err).Error("Failed to find shared folders")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Leave out the roles of folders that are in the trash
+	meta := make(map[string]string, len(folders))
+	for _, folder := range folders {
+		meta[folder.ID.String()] = roles[folder.ID.String()]
+	}
+
+	writeResponse(w, http.StatusOK, folders, map[string]interface{}{"roles": meta})
+}
+
+// ListDocuments returns the documents shared with the authenticated user on
+// their own, sorted by title. The `roles` meta maps each document ID to the
+// role the user was granted.
+func (h SharedHandler) ListDocuments(w http.ResponseWriter, r *http.Request, _ map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	logrus.WithField("user_id", userID).Info("Finding shared documents")
+
+	ids, roles, err := h.sharedRoles(userID, "document_id")
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find shares")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	documents := []models.Document{}
+	if err := h.DB.Scopes(preloadTags).Where("id IN ?", ids).Order("title").Order("id").Find(&documents).Error; err != nil {
+		logrus.WithError(err).Error("Failed to find shared documents")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	meta := make(map[string]string, len(documents))
+	for _, document := range documents {
+		meta[document.ID.String()] = roles[document.ID.String()]
+	}
+
+	writeResponse(w, http.StatusOK, documents, map[string]interface{}{"roles": meta})
+}
+
+// sharedRoles loads the IDs of the items shared with a user, where column is
+// the share's folder_id or document_id, along with the role granted on each
+func (h SharedHandler) sharedRoles(userID uuid.UUID, column string) ([]uuid.UUID, map[string]string, error) {
+	var shares []models.Share
+	if err := h.DB.Where("user_id = ? AND "+column+" IS NOT NULL", userID).Find(&shares).Error; err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(shares))
+	roles := make(map[string]string, len(shares))
+	for _, share := range shares {
+		id := share.DocumentID
+		if share.FolderID != nil {
+			id = share.FolderID
+		}
+		ids = append(ids, *id)
+		roles[id.String()] = share.Role
+	}
+	return ids, roles, nil
+}
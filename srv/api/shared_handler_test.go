@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create handler
+	handler := NewSharedHandler(db)
+
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+	collaborator := models.User{Username: "collaborator", Email: "collaborator@example.com"}
+	require.NoError(t, db.Create(&collaborator).Error, "Failed to create collaborator")
+
+	// Share a folder with a subfolder, a document and a deleted document
+	team := models.Folder{Name: "Team", UserID: owner.ID}
+	require.NoError(t, db.Create(&team).Error, "Failed to create folder")
+	sub := models.Folder{Name: "Sub", UserID: owner.ID, ParentID: &team.ID}
+	require.NoError(t, db.Create(&sub).Error, "Failed to create subfolder")
+	plan := models.Document{Title: "Plan", UserID: owner.ID}
+	require.NoError(t, db.Create(&plan).Error, "Failed to create document")
+	gone := models.Document{Title: "Gone", UserID: owner.ID}
+	require.NoError(t, db.Create(&gone).Error, "Failed to create document")
+
+	for _, share := range []models.Share{
+		{UserID: collaborator.ID, FolderID: &team.ID, Role: models.RoleEditor, OwnerID: owner.ID, CreatedByID: owner.ID},
+		{UserID: collaborator.ID, DocumentID: &plan.ID, Role: models.RoleViewer, OwnerID: owner.ID, CreatedByID: owner.ID},
+		{UserID: collaborator.ID, DocumentID: &gone.ID, Role: models.RoleViewer, OwnerID: owner.ID, CreatedByID: owner.ID},
+	} {
+		require.NoError(t, db.Create(&share).Error, "Failed to create share")
+	}
+	require.NoError(t, db.Delete(&gone).Error, "Failed to delete document")
+
+	serve := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if userID != uuid.Nil {
+			req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req, nil, nil)
+		return rec
+	}
+
+	type body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+		Meta struct {
+			Roles map[string]string `json:"roles"`
+		} `json:"meta"`
+	}
+	decode := func(rec *httptest.ResponseRecorder) body {
+		var b body
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &b), "Failed to decode response")
+		return b
+	}
+
+	t.Run("ListFolders", func(t *testing.T) {
+		rec := serve(handler.ListFolders, collaborator.ID)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		b := decode(rec)
+		require.Len(t, b.Data, 1, "Should list the shared folder but not its subfolder")
+		assert.Equal(t, team.ID.String(), b.Data[0].ID, "Should list the shared folder")
+		assert.Equal(t, map[string]string{team.ID.String(): models.RoleEditor}, b.Meta.Roles, "Should report the granted role")
+	})
+
+	t.Run("ListDocuments", func(t *testing.T) {
+		rec := serve(handler.ListDocuments, collaborator.ID)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		b := decode(rec)
+		require.Len(t, b.Data, 1, "Should list the shared document but not the deleted one")
+		assert.Equal(t, plan.ID.String(), b.Data[0].ID, "Should list the shared document")
+		assert.Equal(t, map[string]string{plan.ID.String(): models.RoleViewer}, b.Meta.Roles, "Should report the granted role")
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		b := decode(serve(handler.ListDocuments, owner.ID))
+		assert.Empty(t, b.Data, "Owner should have nothing shared with them")
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		rec := serve(handler.ListFolders, uuid.Nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Expected status code 401")
+	})
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"srv/stream"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// streamReplayBatch is the number of events loaded at a time when a client
+// catches up after reconnecting
+const streamReplayBatch = 100
+
+// StreamHandler streams the changes to the folders and documents a user can
+// access as server-sent events.
+//
+// Events are replayed by creation time, which is taken before their
+// transaction commits, so replays look back by Lookback from the last event
+// received for events committed late, as the local broker does.
+type StreamHandler struct {
+	DB        *gorm.DB
+	Broker    stream.Broker
+	Heartbeat time.Duration
+	Lookback  time.Duration
+}
+
+// NewStreamHandler creates a new StreamHandler
+func NewStreamHandler(db *gorm.DB, broker stream.Broker) *StreamHandler {
+	return &StreamHandler{
+		DB:        db,
+		Broker:    broker,
+		Heartbeat: 15 * time.Second,
+		Lookback:  5 * time.Second,
+	}
+}
+
+// Register adds the stream route to the router
+func (h StreamHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/stream", h.Stream)
+}
+
+// Stream sends the folder and document events of the user's items, and of
+// the items shared with them, as they are committed. Each event carries its
+// ID, type and webhook payload. A client reconnecting with the ID of the last
+// event it received in the Last-Event-ID header, or the last_event_id
+// parameter, first receives the events it missed from the outbox, which may
+// repeat some of the events recorded shortly before the last one. The stream
+// ends when the client falls behind, and the client then catches up the same
+// way.
+func (h StreamHandler) Stream(w http.ResponseWriter, r *http.Request, _ map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logrus.Error("Response writer does not support streaming")
+		writeError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	// Find the event to resume after if given
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastEvent *models.Event
+	if lastEventID != "" {
+		id, err := uuid.Parse(lastEventID)
+		if err != nil {
+			logrus.WithError(err).WithField("last_event_id", lastEventID).Error("Invalid last event ID")
+			writeError(w, http.StatusBadRequest, "Invalid last event ID")
+			return
+		}
+		var event models.Event
+		if err := h.DB.First(&event, "id = ?", id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				logrus.WithField("last_event_id", id).Warn("Last event not found")
+				writeError(w, http.StatusNotFound, "Last event not found")
+				return
+			}
+			logrus.WithError(err).WithField("last_event_id", id).Error("Failed to find last event")
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		lastEvent = &event
+	}
+
+	// Subscribe before catching up, so that no event falls in between
+	subscription := h.Broker.Subscribe()
+	defer subscription.Close()
+
+	logrus.WithFields(logrus.Fields{
+		"user_id":       userID,
+		"last_event_id": lastEventID,
+	}).Info("Streaming events")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, ": connected\n\n"); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	// Events caught up on may be published to the subscription too
+	sent := map[uuid.UUID]bool{}
+	if lastEvent != nil {
+		var err error
+		if sent, err = h.replay(w, userID, *lastEvent); err != nil {
+			logrus.WithError(err).WithField("user_id", userID).Error("Failed to replay events")
+			return
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-subscription.Events:
+			if !ok {
+				logrus.WithField("user_id", userID).Warn("Event stream fell behind")
+				return
+			}
+			if sent[event.ID] {
+				continue
+			}
+			visible, err := h.visible(userID, event)
+			if err != nil {
+				logrus.WithError(err).WithField("event_id", event.ID).Error("Failed to check access to event")
+				return
+			}
+			if !visible {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// replay writes the events visible to the user that were recorded after the
+// given one, or up to Lookback before it, and returns their IDs
+func (h StreamHandler) replay(w io.Writer, userID uuid.UUID, after models.Event) (map[uuid.UUID]bool, error) {
+	sent := map[uuid.UUID]bool{after.ID: true}
+	query := h.DB.Where("created_at > ?", after.CreatedAt.Add(-h.Lookback))
+	for {
+		var events []models.Event
+		err := query.Scopes(database.VisibleEvents(userID)).
+			Order("created_at, id").Limit(streamReplayBatch).Find(&events).Error
+		if err != nil {
+			return sent, err
+		}
+
+		for _, event := range events {
+			if sent[event.ID] {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return sent, err
+			}
+			sent[event.ID] = true
+		}
+		if len(events) < streamReplayBatch {
+			return sent, nil
+		}
+		last := events[len(events)-1]
+		query = h.DB.Where("created_at > ? OR (created_at = ? AND id > ?)", last.CreatedAt, last.CreatedAt, last.ID)
+	}
+}
+
+// visible reports whether an event is streamed to a user, as selected by
+// database.VisibleEvents. The events of the user's own items need no query.
+func (h StreamHandler) visible(userID uuid.UUID, event models.Event) (bool, error) {
+	if event.UserID == userID && (event.ResourceType == "folder" || event.ResourceType == "document") {
+		return true, nil
+	}
+
+	var count int64
+	err := h.DB.Model(&models.Event{}).Scopes(database.VisibleEvents(userID)).
+		Where("events.id = ?", event.ID).Count(&count).Error
+	return count > 0, err
+}
+
+// writeEvent writes an event in the server-sent events format. Payloads are
+// compact JSON, so they fit on the single data line.
+func writeEvent(w io.Writer, event models.Event) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+	return err
+}
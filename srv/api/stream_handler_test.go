@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"srv/stream"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// The broker is polled by the test rather than in the background
+	broker := stream.NewLocalBroker(db, time.Hour)
+	api := api2go.NewAPI("v1")
+	NewStreamHandler(db, broker).Register(api.Router(), "/v1")
+	var streams sync.WaitGroup
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streams.Add(1)
+		defer streams.Done()
+		userID, _ := uuid.Parse(r.Header.Get("X-User-ID"))
+		api.Handler().ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+	}))
+	defer server.Close()
+
+	folders := NewFolderResource(db)
+	documents := NewDocumentResource(db)
+	users := NewUserResource(db)
+
+	// Create an owner with a private and a shared folder, the collaborator the
+	// folder is shared with, and an unrelated user
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+	collaborator := models.User{Username: "collaborator", Email: "collaborator@example.com"}
+	require.NoError(t, db.Create(&collaborator).Error, "Failed to create collaborator")
+	other := models.User{Username: "other", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	private := models.Folder{Name: "Private", UserID: owner.ID}
+	require.NoError(t, db.Create(&private).Error, "Failed to create folder")
+	shared := models.Folder{Name: "Shared", UserID: owner.ID}
+	require.NoError(t, db.Create(&shared).Error, "Failed to create folder")
+	share := models.Share{UserID: collaborator.ID, FolderID: &shared.ID, Role: models.RoleViewer, OwnerID: owner.ID, CreatedByID: owner.ID}
+	require.NoError(t, db.Create(&share).Error, "Failed to create share")
+
+	type frame struct {
+		id, event, data string
+	}
+
+	// open starts streaming the events of a user, returning the response and
+	// a function reading the next event. Comments such as heartbeats are
+	// skipped. The streams of a subtest are closed at its end and waited for,
+	// so that they don't read from the database while the next one writes,
+	// which SQLite's shared cache reports as a locked table.
+	waiting := map[*testing.T]bool{}
+	open := func(t *testing.T, userID uuid.UUID, lastEventID string) (*http.Response, func() frame) {
+		if !waiting[t] {
+			waiting[t] = true
+			t.Cleanup(streams.Wait)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/stream", nil)
+		require.NoError(t, err, "Failed to create request")
+		req.Header.Set("X-User-ID", userID.String())
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "Failed to open stream")
+		t.Cleanup(func() { resp.Body.Close() })
+
+		reader := bufio.NewReader(resp.Body)
+		readFrame := func() frame {
+			var f frame
+			for {
+				line, err := reader.ReadString('\n')
+				require.NoError(t, err, "Failed to read event")
+				line = strings.TrimSuffix(line, "\n")
+				switch {
+				case line == "" && f.id != "":
+					return f
+				case strings.HasPrefix(line, "id: "):
+					f.id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "event: "):
+					f.event = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					f.data = strings.TrimPrefix(line, "data: ")
+				}
+			}
+		}
+
+		// The connected comment is sent once the stream is subscribed
+		if resp.StatusCode == http.StatusOK {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err, "Failed to read stream")
+			require.Equal(t, ": connected\n", line, "Expected the stream to be connected")
+		}
+		return resp, readFrame
+	}
+	poll := func(t *testing.T) {
+		_, err := broker.Poll()
+		require.NoError(t, err, "Failed to poll events")
+	}
+
+	var first, second models.Document
+	t.Run("Live", func(t *testing.T) {
+		resp, ownerEvents := open(t, owner.ID, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Expected status code 200")
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"), "Expected an event stream")
+		_, collaboratorEvents := open(t, collaborator.ID, "")
+
+		created, err := documents.Create(models.Document{Title: "Plan", FolderID: &private.ID}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+		first = created.Result().(models.Document)
+		created, err = documents.Create(models.Document{Title: "Notes", FolderID: &shared.ID}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+		second = created.Result().(models.Document)
+		poll(t)
+
+		f := ownerEvents()
+		assert.Equal(t, "document.created", f.event, "Expected the created event")
+		assert.Contains(t, f.data, first.ID.String(), "Expected the event's payload")
+		assert.Contains(t, ownerEvents().data, second.ID.String(), "Expected the owner to receive both events")
+
+		// The collaborator only sees the shared folder's document
+		f = collaboratorEvents()
+		assert.Equal(t, "document.created", f.event, "Expected the created event")
+		assert.Contains(t, f.data, second.ID.String(), "Expected only the shared document's event")
+	})
+
+	t.Run("Scope", func(t *testing.T) {
+		_, ownerEvents := open(t, owner.ID, "")
+		_, otherEvents := open(t, other.ID, "")
+
+		// Changes to users and to the items of others aren't streamed
+		update := models.User{}
+		applyPatch(t, &update, "users", owner.ID.String(), `{"email": "new@example.com"}`)
+		_, err := users.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update user")
+		_, err = folders.Create(models.Folder{Name: "Drafts"}, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to create folder")
+		_, err = folders.Create(models.Folder{Name: "Mine"}, newRequest(other.ID, nil))
+		require.NoError(t, err, "Failed to create folder")
+		poll(t)
+
+		assert.Contains(t, ownerEvents().data, "Drafts", "Expected the owner's folder after skipping the user event")
+		assert.Contains(t, otherEvents().data, "Mine", "Expected only the other user's own folder")
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		var events []models.Event
+		require.NoError(t, db.Where("resource_id = ?", first.ID).Find(&events).Error, "Failed to find events")
+		require.Len(t, events, 1, "Expected the first document's event")
+
+		// The events after the last one received are replayed
+		_, ownerEvents := open(t, owner.ID, events[0].ID.String())
+		assert.Contains(t, ownerEvents().data, second.ID.String(), "Expected the second document's event")
+		assert.Contains(t, ownerEvents().data, "Drafts", "Expected the folder's event")
+
+		// Live events follow the replayed ones
+		update := models.Document{}
+		applyPatch(t, &update, "documents", second.ID.String(), `{"content": "Agenda"}`)
+		_, err := documents.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update document")
+		poll(t)
+		assert.Equal(t, "document.updated", ownerEvents().event, "Expected the live event")
+
+		// Collaborators catch up on the shared items only
+		_, collaboratorEvents := open(t, collaborator.ID, events[0].ID.String())
+		f := collaboratorEvents()
+		assert.Equal(t, "document.created", f.event, "Expected the shared document's creation")
+		assert.Contains(t, f.data, second.ID.String(), "Expected the shared document")
+		assert.Equal(t, "document.updated", collaboratorEvents().event, "Expected the shared document's update")
+	})
+
+	t.Run("ResumeLateCommit", func(t *testing.T) {
+		// Move the earlier events out of the lookback
+		require.NoError(t, db.Model(&models.Event{}).Where("1 = 1").Update("created_at", time.Now().Add(-time.Hour)).Error,
+			"Failed to age events")
+
+		// An event created before the last one received, but committed after
+		// it, is replayed, while the last one isn't sent again
+		record := func(createdAt time.Time) models.Event {
+			event, err := models.NewEvent(models.EventUpdated, shared, owner.ID, nil)
+			require.NoError(t, err, "Failed to create event")
+			event.CreatedAt = createdAt
+			require.NoError(t, db.Create(&event).Error, "Failed to record event")
+			return event
+		}
+		now := time.Now()
+		last := record(now)
+		late := record(now.Add(-time.Second))
+		poll(t)
+
+		_, collaboratorEvents := open(t, collaborator.ID, last.ID.String())
+		assert.Equal(t, late.ID.String(), collaboratorEvents().id, "Expected the late event")
+
+		update := models.Document{}
+		applyPatch(t, &update, "documents", second.ID.String(), `{"content": "Minutes"}`)
+		_, err := documents.Update(update, newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to update document")
+		poll(t)
+		assert.Equal(t, "document.updated", collaboratorEvents().event, "Expected the live event next")
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		// Collaborators learn about the deletion of shared items
+		_, collaboratorEvents := open(t, collaborator.ID, "")
+		_, err := documents.Delete(second.ID.String(), newRequest(owner.ID, nil))
+		require.NoError(t, err, "Failed to delete document")
+		poll(t)
+
+		f := collaboratorEvents()
+		assert.Equal(t, "document.deleted", f.event, "Expected the deleted event")
+		assert.Contains(t, f.data, second.ID.String(), "Expected the shared document")
+	})
+
+	t.Run("InvalidLastEventID", func(t *testing.T) {
+		resp, _ := open(t, owner.ID, "latest")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected status code 400")
+
+		resp, _ = open(t, owner.ID, uuid.New().String())
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Expected status code 404")
+	})
+}
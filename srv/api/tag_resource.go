@@ -0,0 +1,384 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxTagNameLength is the longest tag name that can be stored
+	maxTagNameLength = 64
+	// tagAlternative separates alternatives in a filter[tag] group
+	tagAlternative = "|"
+)
+
+// TagResource implements api2go.CRUD interface for Tag
+type TagResource struct {
+	DB *gorm.DB
+}
+
+// tagSortFields are the attributes tags can be sorted by
+var tagSortFields = map[string]sortField{
+	"name":           {Column: "name"},
+	"document_count": {Column: "document_count"},
+	"folder_count":   {Column: "folder_count"},
+	"created_at":     {Column: "created_at", Time: true},
+	"updated_at":     {Column: "updated_at", Time: true},
+}
+
+// NewTagResource creates a new TagResource
+func NewTagResource(db *gorm.DB) *TagResource {
+	return &TagResource{
+		DB: db,
+	}
+}
+
+// FindAll returns the tags of the authenticated user with their usage counts
+func (r TagResource) FindAll(req api2go.Request) (api2go.Responder, error) {
+	logrus.Info("Finding all tags")
+
+	result, err := r.findTags(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of tags along with the total count
+func (r TagResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of tags")
+
+	result, err := r.findTags(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findTags loads the tags matching the request's filters, sort and page
+func (r TagResource) findTags(req api2go.Request) (page[models.Tag], error) {
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return page[models.Tag]{}, err
+	}
+
+	// Filter by user ID if provided
+	if userID, ok := req.QueryParams["user_id"]; ok && len(userID) > 0 {
+		logrus.WithField("user_id", userID[0]).Info("Filtering tags by user ID")
+
+		uuid, err := uuid.Parse(userID[0])
+		if err != nil {
+			logrus.WithError(err).WithField("user_id", userID[0]).Error("Invalid user ID")
+			return page[models.Tag]{}, newHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+		}
+
+		if uuid != currentUser {
+			logrus.WithField("user_id", userID[0]).Warn("Cannot list another user's tags")
+			return page[models.Tag]{}, newHTTPError(nil, "Cannot access another user's tags", http.StatusForbidden)
+		}
+	}
+
+	// Restrict to the tags of a document or folder when listed through its tags
+	// relationship. The item may have been shared by another user, whose tags it carries.
+	tagOwner := currentUser
+	var linked []*gorm.DB
+	for _, owner := range []struct {
+		param, joinTable, column string
+		find                     func(id uuid.UUID) (uuid.UUID, error)
+	}{
+		{"documentsID", database.DocumentTagsTable, "document_id", func(id uuid.UUID) (uuid.UUID, error) {
+			document, err := findDocument(r.DB, currentUser, id, models.RoleViewer)
+			return document.UserID, err
+		}},
+		{"foldersID", database.FolderTagsTable, "folder_id", func(id uuid.UUID) (uuid.UUID, error) {
+			folder, err := findFolder(r.DB, currentUser, id, models.RoleViewer)
+			return folder.UserID, err
+		}},
+	} {
+		ownerID, ok := req.QueryParams[owner.param]
+		if !ok || len(ownerID) == 0 {
+			continue
+		}
+		uuid, err := uuid.Parse(ownerID[0])
+		if err != nil {
+			logrus.WithError(err).WithField(owner.column, ownerID[0]).Error("Invalid ID")
+			return page[models.Tag]{}, newHTTPError(err, "Invalid ID", http.StatusBadRequest)
+		}
+		if tagOwner, err = owner.find(uuid); err != nil {
+			return page[models.Tag]{}, accessHTTPError(err)
+		}
+		linked = append(linked, r.DB.Table(owner.joinTable).Select("tag_id").Where(owner.column+" = ?", uuid))
+	}
+
+	tags := database.TagsWithUsage(r.DB, tagOwner)
+	for _, ids := range linked {
+		tags = tags.Where("tags.id IN (?)", ids)
+	}
+
+	opts, err := parseListOptions(req, tagSortFields, []sortTerm{{sortField: tagSortFields["name"]}})
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.Tag]{}, err
+	}
+
+	// Sort and paginate over the counted tags so that the counts can be used like columns
+	query := r.DB.Table("(?) AS tags", tags)
+	result, err := findPage[models.Tag](query, opts)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find tags")
+		return page[models.Tag]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return result, nil
+}
+
+// FindOne returns a single tag with its usage counts
+func (r TagResource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Finding tag")
+
+	tag, err := r.findTag(id, req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return &api2go.Response{Res: tag, Code: http.StatusOK}, nil
+}
+
+// Create creates a new tag
+func (r TagResource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	tag, ok := obj.(models.Tag)
+	if !ok {
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		logrus.WithError(err).Error("Invalid instance given to create tag")
+		return &api2go.Response{}, err
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Tags are always created for the authenticated user
+	if tag.UserID != uuid.Nil && tag.UserID != currentUser {
+		logrus.WithField("user_id", tag.UserID).Warn("Cannot create tag for another user")
+		return &api2go.Response{}, newHTTPError(nil, "Cannot create tags for another user", http.StatusForbidden)
+	}
+	tag.UserID = currentUser
+
+	logrus.WithFields(logrus.Fields{
+		"name":    tag.Name,
+		"user_id": tag.UserID,
+	}).Info("Creating tag")
+
+	if err := r.validateName(&tag); err != nil {
+		return &api2go.Response{}, err
+	}
+
+	if err := r.DB.Create(&tag).Error; err != nil {
+		logrus.WithError(err).Error("Failed to create tag")
+		return &api2go.Response{}, constraintHTTPError(err)
+	}
+
+	return &api2go.Response{Res: tag, Code: http.StatusCreated}, nil
+}
+
+// Delete deletes a tag and removes it from every document and folder
+func (r TagResource) Delete(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Deleting tag")
+
+	tag, err := r.findTag(id, req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.DeleteTagLinks(tx, database.DocumentTagsTable, "tag_id", []uuid.UUID{tag.ID}); err != nil {
+			return err
+		}
+		if err := database.DeleteTagLinks(tx, database.FolderTagsTable, "tag_id", []uuid.UUID{tag.ID}); err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to delete tag")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return &api2go.Response{Code: http.StatusNoContent}, nil
+}
+
+// Update renames a tag
+func (r TagResource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	tag, ok := obj.(models.Tag)
+	if !ok {
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		logrus.WithError(err).Error("Invalid instance given to update tag")
+		return &api2go.Response{}, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":   tag.ID,
+		"name": tag.Name,
+	}).Info("Updating tag")
+
+	existingTag, err := r.findTag(tag.ID.String(), req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Only the name can change
+	existingTag.Name = tag.Name
+	if err := r.validateName(&existingTag); err != nil {
+		return &api2go.Response{}, err
+	}
+
+	if err := r.DB.Model(&existingTag).Update("name", existingTag.Name).Error; err != nil {
+		logrus.WithError(err).WithField("id", tag.ID).Error("Failed to update tag")
+		return &api2go.Response{}, constraintHTTPError(err)
+	}
+
+	return &api2go.Response{Res: existingTag, Code: http.StatusOK}, nil
+}
+
+// findTag loads a tag of the authenticated user along with its usage counts
+func (r TagResource) findTag(id string, req api2go.Request) (models.Tag, error) {
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid tag ID")
+		return models.Tag{}, newHTTPError(err, "Invalid tag ID", http.StatusBadRequest)
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	var tag models.Tag
+	if err := database.TagsWithUsage(r.DB, currentUser).First(&tag, "tags.id = ?", uuid).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", id).Warn("Tag not found")
+			return models.Tag{}, newHTTPError(err, "Tag not found", http.StatusNotFound)
+		}
+		logrus.WithError(err).WithField("id", id).Error("Failed to find tag")
+		return models.Tag{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return tag, nil
+}
+
+// validateName trims the name of a tag and checks that it is valid and not
+// already used by another tag of the same user, ignoring case
+func (r TagResource) validateName(tag *models.Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" || len(tag.Name) > maxTagNameLength {
+		return newHTTPError(nil, fmt.Sprintf("Tag name must be between 1 and %d characters", maxTagNameLength), http.StatusBadRequest)
+	}
+
+	// Commas and bars separate tags in filter[tag]
+	if strings.ContainsAny(tag.Name, ","+tagAlternative) {
+		return newHTTPError(nil, "Tag name must not contain commas or vertical bars", http.StatusBadRequest)
+	}
+
+	var count int64
+	if err := r.DB.Model(&models.Tag{}).
+		Where("user_id = ? AND id <> ? AND LOWER(name) = LOWER(?)", tag.UserID, tag.ID, tag.Name).
+		Count(&count).Error; err != nil {
+		logrus.WithError(err).Error("Failed to check tag name")
+		return newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+	if count > 0 {
+		logrus.WithField("name", tag.Name).Warn("Tag name already in use")
+		return newHTTPError(nil, "A tag with this name already exists", http.StatusConflict)
+	}
+
+	return nil
+}
+
+// resolveTags loads the tags referenced by a tags relationship, which must all
+// belong to userID. A nil slice means the relationship was not given and is
+// returned as is.
+func resolveTags(db *gorm.DB, userID uuid.UUID, refs []models.Tag) ([]models.Tag, error) {
+	if refs == nil {
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(refs))
+	seen := make(map[uuid.UUID]bool, len(refs))
+	for _, ref := range refs {
+		if !seen[ref.ID] {
+			seen[ref.ID] = true
+			ids = append(ids, ref.ID)
+		}
+	}
+
+	tags := []models.Tag{}
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	if err := db.Where("id IN ? AND user_id = ?", ids, userID).Order("name").Find(&tags).Error; err != nil {
+		logrus.WithError(err).Error("Failed to find tags")
+		return nil, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+	if len(tags) != len(ids) {
+		logrus.WithField("tags", ids).Warn("Tag not found")
+		return nil, newHTTPError(nil, "Tag not found", http.StatusNotFound)
+	}
+
+	return tags, nil
+}
+
+// sameTags reports whether two lists of tags hold the same tags, in any order
+func sameTags(a, b []models.Tag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := make(map[uuid.UUID]bool, len(a))
+	for _, tag := range a {
+		ids[tag.ID] = true
+	}
+	for _, tag := range b {
+		if !ids[tag.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+// preloadTags loads the tags of the queried documents or folders, sorted by name
+func preloadTags(db *gorm.DB) *gorm.DB {
+	return db.Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("tags.name")
+	})
+}
+
+// parseTagFilter parses the filter[tag] parameter. Comma-separated groups must
+// all match, while the names within a group are alternatives separated by
+// vertical bars: filter[tag]=work|home,urgent selects items tagged urgent and
+// either work or home.
+func parseTagFilter(values []string) ([][]string, error) {
+	var groups [][]string
+	for _, value := range values {
+		var names []string
+		for _, name := range strings.Split(value, tagAlternative) {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, newHTTPError(nil, "Tag filter must not contain empty tags", http.StatusBadRequest)
+		}
+		groups = append(groups, names)
+	}
+	return groups, nil
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestTagResource_CRUD(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource
+	resource := NewTagResource(db)
+
+	// Create test users
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "otheruser", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	var tag models.Tag
+
+	// Test Create
+	t.Run("Create", func(t *testing.T) {
+		resp, err := resource.Create(models.Tag{Name: "  Work "}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create tag")
+		require.Equal(t, http.StatusCreated, resp.StatusCode(), "Expected status code 201")
+
+		tag = resp.Result().(models.Tag)
+		assert.NotEqual(t, uuid.Nil, tag.ID, "Expected tag ID to be set")
+		assert.Equal(t, "Work", tag.Name, "Expected tag name to be trimmed")
+		assert.Equal(t, user.ID, tag.UserID, "Expected tag to belong to the user")
+	})
+
+	// Test that names are unique per user regardless of case
+	t.Run("DuplicateName", func(t *testing.T) {
+		_, err := resource.Create(models.Tag{Name: "work"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+
+		_, err = resource.Create(models.Tag{Name: "Work"}, newRequest(other.ID, nil))
+		assert.NoError(t, err, "Expected another user to be able to use the same name")
+	})
+
+	// Test invalid names
+	t.Run("InvalidName", func(t *testing.T) {
+		for _, name := range []string{"", "   ", "a,b", "a|b", string(make([]byte, maxTagNameLength+1))} {
+			_, err := resource.Create(models.Tag{Name: name}, newRequest(user.ID, nil))
+			assertHTTPStatus(t, err, http.StatusBadRequest)
+		}
+	})
+
+	// Test FindOne
+	t.Run("FindOne", func(t *testing.T) {
+		resp, err := resource.FindOne(tag.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find tag")
+		assert.Equal(t, "Work", resp.Result().(models.Tag).Name, "Expected tag name to match")
+
+		_, err = resource.FindOne(tag.ID.String(), newRequest(other.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+	})
+
+	// Test Update
+	t.Run("Update", func(t *testing.T) {
+		_, err := resource.Create(models.Tag{Name: "Home"}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create tag")
+
+		resp, err := resource.Update(models.Tag{ID: tag.ID, Name: "Office"}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update tag")
+		assert.Equal(t, "Office", resp.Result().(models.Tag).Name, "Expected tag to be renamed")
+
+		_, err = resource.Update(models.Tag{ID: tag.ID, Name: "HOME"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusConflict)
+
+		_, err = resource.Update(models.Tag{ID: tag.ID, Name: "Mine"}, newRequest(other.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+	})
+
+	// Test Delete
+	t.Run("Delete", func(t *testing.T) {
+		documents := NewDocumentResource(db)
+		_, err := documents.Create(models.Document{Title: "Tagged", Tags: []models.Tag{{ID: tag.ID}}}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+
+		resp, err := resource.Delete(tag.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to delete tag")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode(), "Expected status code 204")
+
+		var links int64
+		require.NoError(t, db.Table(database.DocumentTagsTable).Where("tag_id = ?", tag.ID).Count(&links).Error, "Failed to count tag links")
+		assert.Equal(t, int64(0), links, "Expected tag to be removed from documents")
+	})
+}
+
+func TestTagResource_Tagging(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resources
+	tags := NewTagResource(db)
+	documents := NewDocumentResource(db)
+	folders := NewFolderResource(db)
+
+	// Create test users
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "otheruser", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	createTag := func(userID uuid.UUID, name string) models.Tag {
+		resp, err := tags.Create(models.Tag{Name: name}, newRequest(userID, nil))
+		require.NoError(t, err, "Failed to create tag")
+		return resp.Result().(models.Tag)
+	}
+	work, home, urgent := createTag(user.ID, "work"), createTag(user.ID, "home"), createTag(user.ID, "urgent")
+	foreign := createTag(other.ID, "secret")
+
+	createDocument := func(title string, tags ...models.Tag) models.Document {
+		resp, err := documents.Create(models.Document{Title: title, Tags: tags}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+		return resp.Result().(models.Document)
+	}
+	report := createDocument("Report", work, urgent)
+	createDocument("Recipe", home)
+	createDocument("Chores", home, urgent)
+	createDocument("Untagged")
+
+	documentTitles := func(query map[string][]string) []string {
+		resp, err := documents.FindAll(newRequest(user.ID, query))
+		require.NoError(t, err, "Failed to find documents")
+		var titles []string
+		for _, doc := range resp.Result().([]models.Document) {
+			titles = append(titles, doc.Title)
+		}
+		return titles
+	}
+
+	// Test that tags are exposed as a relationship
+	t.Run("References", func(t *testing.T) {
+		resp, err := documents.FindOne(report.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find document")
+
+		var tagIDs []string
+		for _, ref := range resp.Result().(models.Document).GetReferencedIDs() {
+			if ref.Name == "tags" {
+				tagIDs = append(tagIDs, ref.ID)
+			}
+		}
+		assert.ElementsMatch(t, []string{work.ID.String(), urgent.ID.String()}, tagIDs, "Expected tags relationship")
+	})
+
+	// Test filtering by a single tag, case-insensitively
+	t.Run("FilterSingle", func(t *testing.T) {
+		titles := documentTitles(map[string][]string{"filter[tag]": {"URGENT"}})
+		assert.ElementsMatch(t, []string{"Report", "Chores"}, titles, "Expected documents tagged urgent")
+	})
+
+	// Test that comma-separated tags must all match
+	t.Run("FilterAll", func(t *testing.T) {
+		titles := documentTitles(map[string][]string{"filter[tag]": {"home", "urgent"}, "sort": {"title"}})
+		assert.Equal(t, []string{"Chores"}, titles, "Expected documents tagged home and urgent")
+	})
+
+	// Test that |-separated tags are alternatives
+	t.Run("FilterAny", func(t *testing.T) {
+		titles := documentTitles(map[string][]string{"filter[tag]": {"work|home"}, "sort": {"title"}})
+		assert.Equal(t, []string{"Chores", "Recipe", "Report"}, titles, "Expected documents tagged work or home")
+
+		titles = documentTitles(map[string][]string{"filter[tag]": {"work|home", "urgent"}, "sort": {"title"}})
+		assert.Equal(t, []string{"Chores", "Report"}, titles, "Expected documents tagged urgent and either work or home")
+	})
+
+	// Test that unknown and foreign tags match nothing
+	t.Run("FilterUnknown", func(t *testing.T) {
+		assert.Empty(t, documentTitles(map[string][]string{"filter[tag]": {"missing"}}), "Expected no documents")
+		assert.Empty(t, documentTitles(map[string][]string{"filter[tag]": {"secret"}}), "Expected no documents")
+
+		_, err := documents.FindAll(newRequest(user.ID, map[string][]string{"filter[tag]": {"|"}}))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	// Test that tagging with another user's tag fails
+	t.Run("ForeignTag", func(t *testing.T) {
+		_, err := documents.Create(models.Document{Title: "Sneaky", Tags: []models.Tag{{ID: foreign.ID}}}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		_, err = folders.Create(models.Folder{Name: "Sneaky", Tags: []models.Tag{{ID: foreign.ID}}}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+	})
+
+	// Test replacing the tags of a document through the relationship
+	t.Run("ReplaceTags", func(t *testing.T) {
+		resp, err := documents.FindOne(report.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find document")
+		doc := resp.Result().(models.Document)
+
+		require.NoError(t, doc.SetToManyReferenceIDs("tags", []string{home.ID.String()}), "Failed to set tags")
+		resp, err = documents.Update(doc, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update document")
+		require.Len(t, resp.Result().(models.Document).Tags, 1, "Expected one tag")
+
+		assert.Equal(t, []string{"Chores", "Recipe", "Report"}, documentTitles(map[string][]string{"filter[tag]": {"home"}, "sort": {"title"}}), "Expected document to be tagged home")
+		assert.Equal(t, []string{"Chores"}, documentTitles(map[string][]string{"filter[tag]": {"urgent"}}), "Expected document to lose its urgent tag")
+
+		// Updating without the relationship keeps the tags
+		doc.Tags = nil
+		doc.Title = "Annual Report"
+		_, err = documents.Update(doc, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update document")
+		assert.Contains(t, documentTitles(map[string][]string{"filter[tag]": {"home"}}), "Annual Report", "Expected tags to be kept")
+	})
+
+	// Test that a JSON:API payload sets the tags relationship
+	t.Run("Unmarshal", func(t *testing.T) {
+		payload := `{"data":{"type":"folders","attributes":{"name":"Projects"},"relationships":{"tags":{"data":[{"type":"tags","id":"` + work.ID.String() + `"}]}}}}`
+		var folder models.Folder
+		require.NoError(t, jsonapi.Unmarshal([]byte(payload), &folder), "Failed to unmarshal folder")
+		require.Len(t, folder.Tags, 1, "Expected one tag")
+
+		resp, err := folders.Create(folder, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create folder")
+		created := resp.Result().(models.Folder)
+		require.Len(t, created.Tags, 1, "Expected folder to be tagged")
+
+		resp, err = folders.FindAll(newRequest(user.ID, map[string][]string{"filter[tag]": {"work"}}))
+		require.NoError(t, err, "Failed to find folders")
+		require.Len(t, resp.Result().([]models.Folder), 1, "Expected one tagged folder")
+		assert.Equal(t, "Projects", resp.Result().([]models.Folder)[0].Name, "Expected tagged folder")
+
+		payload = `{"data":{"type":"folders","attributes":{"name":"Projects"},"relationships":{"documents":{"data":[]}}}}`
+		assert.Error(t, jsonapi.Unmarshal([]byte(payload), &folder), "Expected documents relationship to be read-only")
+	})
+
+	// Test the per-user tag listing with usage counts
+	t.Run("Usage", func(t *testing.T) {
+		resp, err := tags.FindAll(newRequest(user.ID, map[string][]string{"sort": {"-document_count"}}))
+		require.NoError(t, err, "Failed to find tags")
+
+		result := resp.Result().([]models.Tag)
+		require.Len(t, result, 3, "Expected only the user's tags")
+		assert.Equal(t, "home", result[0].Name, "Expected most used tag first")
+		assert.Equal(t, int64(3), result[0].DocumentCount, "Expected home document count")
+		counts := map[string][2]int64{}
+		for _, tag := range result {
+			counts[tag.Name] = [2]int64{tag.DocumentCount, tag.FolderCount}
+		}
+		assert.Equal(t, [2]int64{0, 1}, counts["work"], "Expected work counts")
+		assert.Equal(t, [2]int64{1, 0}, counts["urgent"], "Expected urgent counts")
+
+		// Deleted documents are not counted
+		_, err = documents.Delete(report.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to delete document")
+		resp, err = tags.FindOne(home.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find tag")
+		assert.Equal(t, int64(2), resp.Result().(models.Tag).DocumentCount, "Expected deleted document not to be counted")
+	})
+
+	// Test listing the tags of a single document
+	t.Run("DocumentTags", func(t *testing.T) {
+		chores := documentTitles(map[string][]string{"filter[tag]": {"home", "urgent"}})
+		require.Equal(t, []string{"Chores"}, chores, "Expected chores document")
+
+		var doc models.Document
+		require.NoError(t, db.First(&doc, "title = ?", "Chores").Error, "Failed to find document")
+		resp, err := tags.FindAll(newRequest(user.ID, map[string][]string{"documentsID": {doc.ID.String()}}))
+		require.NoError(t, err, "Failed to find tags")
+
+		var names []string
+		for _, tag := range resp.Result().([]models.Tag) {
+			names = append(names, tag.Name)
+		}
+		assert.Equal(t, []string{"home", "urgent"}, names, "Expected the document's tags")
+	})
+
+	// Test that purging a document removes its tag links
+	t.Run("Purge", func(t *testing.T) {
+		require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+			_, err := database.PurgeDocuments(tx, []uuid.UUID{report.ID})
+			return err
+		}), "Failed to purge document")
+
+		var links int64
+		require.NoError(t, db.Table(database.DocumentTagsTable).Where("document_id = ?", report.ID).Count(&links).Error, "Failed to count tag links")
+		assert.Equal(t, int64(0), links, "Expected tag links to be deleted")
+	})
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/storage"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRequest creates an api2go request authenticated as the given user
+func newRequest(userID uuid.UUID, queryParams map[string][]string) api2go.Request {
+	plainRequest := httptest.NewRequest("GET", "/", nil)
+	plainRequest = plainRequest.WithContext(auth.WithUserID(plainRequest.Context(), userID))
+	return api2go.Request{
+		PlainRequest: plainRequest,
+		QueryParams:  queryParams,
+	}
+}
+
+// assertHTTPStatus asserts that err is an api2go.HTTPError with the given status
+func assertHTTPStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	require.Error(t, err, "Expected an error")
+	httpErr, ok := err.(api2go.HTTPError)
+	require.True(t, ok, "Expected error to be an HTTPError")
+	require.NotEmpty(t, httpErr.Errors, "Expected the error to carry an error object")
+	assert.Equal(t, strconv.Itoa(status), httpErr.Errors[0].Status, "Expected status code %d", status)
+}
+
+// newTestStorage creates a blob storage in a temporary directory removed after the test
+func newTestStorage(t *testing.T) storage.Storage {
+	t.Helper()
+	blobs, err := storage.NewLocal(t.TempDir())
+	require.NoError(t, err, "Failed to create test storage")
+	return blobs
+}
+
+// newConditionalRequest creates an api2go request authenticated as the given
+// user that carries an If-Match header, unless ifMatch is empty, and records
+// the response headers set by the resource in rec
+func newConditionalRequest(userID uuid.UUID, ifMatch string, rec *httptest.ResponseRecorder) api2go.Request {
+	req := newRequest(userID, nil)
+	if ifMatch != "" {
+		req.PlainRequest.Header.Set("If-Match", ifMatch)
+	}
+	req.Context = &api2go.APIContext{}
+	ResponseWriterMiddleware(req.Context, rec, req.PlainRequest)
+	return req
+}
+
+// assertPreconditionFailed asserts that err is a 412 error carrying the
+// current state of the resource with the given version
+func assertPreconditionFailed(t *testing.T, err error, version int) {
+	t.Helper()
+	assertHTTPStatus(t, err, http.StatusPreconditionFailed)
+	httpErr := err.(api2go.HTTPError)
+	require.Len(t, httpErr.Errors, 1, "Expected a single error")
+	meta, ok := httpErr.Errors[0].Meta.(map[string]interface{})
+	require.True(t, ok, "Expected the error to carry meta")
+	assert.Equal(t, fmt.Sprintf(`"%d"`, version), meta["etag"], "Expected the ETag of the current version")
+	current, ok := meta["current"].(*jsonapi.Data)
+	require.True(t, ok, "Expected the current state in the error meta")
+	assert.Contains(t, string(current.Attributes), fmt.Sprintf(`"version":%d`, version), "Expected the current version")
+}
+
+// applyPatch decodes a JSON:API PATCH payload with the given attributes onto
+// obj, the way api2go applies it to the stored resource before Update
+func applyPatch(t *testing.T, obj jsonapi.UnmarshalIdentifier, resourceType, id, attributes string) {
+	t.Helper()
+	payload := fmt.Sprintf(`{"data":{"type":%q,"id":%q,"attributes":%s}}`, resourceType, id, attributes)
+	require.NoError(t, jsonapi.Unmarshal([]byte(payload), obj), "Failed to decode payload")
+}
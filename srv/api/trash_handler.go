@@ -0,0 +1,294 @@
+package api
+
+import (
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"srv/storage"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// TrashHandler serves the endpoints for listing, restoring and purging deleted folders and documents
+type TrashHandler struct {
+	DB    *gorm.DB
+	Blobs storage.Storage
+}
+
+// NewTrashHandler creates a new TrashHandler
+func NewTrashHandler(db *gorm.DB, blobs storage.Storage) *TrashHandler {
+	return &TrashHandler{
+		DB:    db,
+		Blobs: blobs,
+	}
+}
+
+// Register adds the trash routes to the router
+func (h TrashHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/trash/folders", h.ListFolders)
+	router.Handle(http.MethodPost, prefix+"/trash/folders/:id/restore", h.RestoreFolder)
+	router.Handle(http.MethodDelete, prefix+"/trash/folders/:id", h.PurgeFolder)
+	router.Handle(http.MethodGet, prefix+"/trash/documents", h.ListDocuments)
+	router.Handle(http.MethodPost, prefix+"/trash/documents/:id/restore", h.RestoreDocument)
+	router.Handle(http.MethodDelete, prefix+"/trash/documents/:id", h.PurgeDocument)
+}
+
+// ListFolders returns the deleted folders of the authenticated user, most recently deleted first
+func (h TrashHandler) ListFolders(w http.ResponseWriter, r *http.Request, _ map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	logrus.WithField("user_id", userID).Info("Finding deleted folders")
+
+	var folders []models.Folder
+	if err := h.DB.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").
+		Find(&folders).Error; err != nil {
+		logrus.WithError(err).Error("Failed to find deleted folders")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, folders, nil)
+}
+
+// ListDocuments returns the deleted documents of the authenticated user, most recently deleted first
+func (h TrashHandler) ListDocuments(w http.ResponseWriter, r *http.Request, _ map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	logrus.WithField("user_id", userID).Info("Finding deleted documents")
+
+	var documents []models.Document
+	if err := h.DB.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").
+		Find(&documents).Error; err != nil {
+		logrus.WithError(err).Error("Failed to find deleted documents")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, documents, nil)
+}
+
+// RestoreFolder takes a folder out of the trash along with the subfolders and
+// documents deleted together with it. If its parent folder was deleted or
+// purged in the meantime, the folder is restored to the root.
+func (h TrashHandler) RestoreFolder(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	var folder models.Folder
+	if !h.findDeleted(w, r, params["id"], &folder, "folder") {
+		return
+	}
+
+	logrus.WithField("id", folder.ID).Info("Restoring folder")
+
+	deletedFolder := folder
+	reparented := false
+	if folder.ParentID != nil && !h.folderExists(*folder.ParentID) {
+		folder.ParentID = nil
+		reparented = true
+	}
+	deletedAt := folder.DeletedAt.Time
+	folder.DeletedAt = gorm.DeletedAt{}
+	folder.Version++
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		subtree := database.DeletedFolderSubtreeIDs(tx, folder.ID, deletedAt)
+		if err := tx.Unscoped().Model(&models.Document{}).
+			Where("folder_id IN (?) AND deleted_at = ?", subtree, deletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Folder{}).
+			Where("id IN (?) AND id <> ?", subtree, folder.ID).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Save(&folder).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditRestore, folder.UserID, deletedFolder, folder); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventRestored, folder, folder.UserID, map[string]interface{}{"reparented": reparented})
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("id", folder.ID).Error("Failed to restore folder")
+		writeConstraintError(w, err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, folder, map[string]interface{}{"reparented": reparented})
+}
+
+// RestoreDocument takes a document out of the trash. If its folder was
+// deleted or purged in the meantime, the document is restored to the root.
+func (h TrashHandler) RestoreDocument(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	var document models.Document
+	if !h.findDeleted(w, r, params["id"], &document, "document") {
+		return
+	}
+
+	logrus.WithField("id", document.ID).Info("Restoring document")
+
+	deletedDocument := document
+	reparented := false
+	if document.FolderID != nil && !h.folderExists(*document.FolderID) {
+		document.FolderID = nil
+		reparented = true
+	}
+	document.DeletedAt = gorm.DeletedAt{}
+	document.Version++
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Save(&document).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditRestore, document.UserID, deletedDocument, document); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventRestored, document, document.UserID, map[string]interface{}{"reparented": reparented})
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to restore document")
+		writeConstraintError(w, err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, document, map[string]interface{}{"reparented": reparented})
+}
+
+// PurgeFolder permanently deletes a folder from the trash along with the
+// subfolders and documents deleted together with it
+func (h TrashHandler) PurgeFolder(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	var folder models.Folder
+	if !h.findDeleted(w, r, params["id"], &folder, "folder") {
+		return
+	}
+
+	logrus.WithField("id", folder.ID).Info("Purging folder")
+
+	// The subfolders and documents deleted together with the folder, the ones
+	// RestoreFolder would bring back, are purged with it. Like a recursive
+	// delete, one audit entry stands for the purged subtree.
+	deletedAt := folder.DeletedAt.Time
+	var blobKeys []string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		subtree := database.DeletedFolderSubtreeIDs(tx, folder.ID, deletedAt)
+		var folderIDs, documentIDs []uuid.UUID
+		if err := tx.Unscoped().Model(&models.Folder{}).Where("id IN (?)", subtree).Pluck("id", &folderIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Document{}).
+			Where("folder_id IN (?) AND deleted_at = ?", subtree, deletedAt).
+			Pluck("id", &documentIDs).Error; err != nil {
+			return err
+		}
+
+		if err := recordAudit(tx, models.AuditPurge, folder.UserID, folder, nil); err != nil {
+			return err
+		}
+		var err error
+		if blobKeys, err = database.PurgeDocuments(tx, documentIDs); err != nil {
+			return err
+		}
+		return database.PurgeFolders(tx, folderIDs)
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("id", folder.ID).Error("Failed to purge folder")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The documents are gone either way, so failing to delete a blob only leaves it orphaned
+	if err := storage.DeleteAll(r.Context(), h.Blobs, blobKeys); err != nil {
+		logrus.WithError(err).WithField("id", folder.ID).Error("Failed to delete attachment blobs")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeDocument permanently deletes a document with its version history and attachments from the trash
+func (h TrashHandler) PurgeDocument(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	var document models.Document
+	if !h.findDeleted(w, r, params["id"], &document, "document") {
+		return
+	}
+
+	logrus.WithField("id", document.ID).Info("Purging document")
+
+	var blobKeys []string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := recordAudit(tx, models.AuditPurge, document.UserID, document, nil); err != nil {
+			return err
+		}
+		var err error
+		blobKeys, err = database.PurgeDocuments(tx, []uuid.UUID{document.ID})
+		return err
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to purge document")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The document is gone either way, so failing to delete a blob only leaves it orphaned
+	if err := storage.DeleteAll(r.Context(), h.Blobs, blobKeys); err != nil {
+		logrus.WithError(err).WithField("id", document.ID).Error("Failed to delete attachment blobs")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findDeleted loads a deleted folder or document of the authenticated user into
+// target, writing an error response if it can't. kind names the model in messages.
+func (h TrashHandler) findDeleted(w http.ResponseWriter, r *http.Request, id string, target interface{}, kind string) bool {
+	title := strings.ToUpper(kind[:1]) + kind[1:]
+
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return false
+	}
+
+	itemID, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid " + kind + " ID")
+		writeError(w, http.StatusBadRequest, "Invalid "+kind+" ID")
+		return false
+	}
+
+	if err := h.DB.Unscoped().
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", itemID, userID).
+		First(target).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", id).Warn(title + " not found in trash")
+			writeError(w, http.StatusNotFound, title+" not found in trash")
+			return false
+		}
+		logrus.WithError(err).WithField("id", id).Error("Failed to find deleted " + kind)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	return true
+}
+
+// folderExists reports whether a folder exists and is not in the trash
+func (h TrashHandler) folderExists(id uuid.UUID) bool {
+	var count int64
+	h.DB.Model(&models.Folder{}).Where("id = ?", id).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestTrashHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create handler and document resource
+	handler := NewTrashHandler(db, newTestStorage(t))
+	documents := NewDocumentResource(db)
+
+	// Create a test user
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	// Create Archive/Old with a document in each folder, then delete everything
+	archive := models.Folder{Name: "Archive", UserID: user.ID}
+	require.NoError(t, db.Create(&archive).Error, "Failed to create folder")
+	old := models.Folder{Name: "Old", UserID: user.ID, ParentID: &archive.ID}
+	require.NoError(t, db.Create(&old).Error, "Failed to create subfolder")
+
+	resp, err := documents.Create(models.Document{Title: "Archived", FolderID: &archive.ID}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	archived := resp.Result().(models.Document)
+	resp, err = documents.Create(models.Document{Title: "Older", FolderID: &old.ID}, newRequest(user.ID, nil))
+	require.NoError(t, err, "Failed to create document")
+	older := resp.Result().(models.Document)
+	live := models.Document{Title: "Live", UserID: user.ID}
+	require.NoError(t, db.Create(&live).Error, "Failed to create document")
+
+	require.NoError(t, db.Delete(&archived).Error, "Failed to delete document")
+	require.NoError(t, db.Delete(&older).Error, "Failed to delete document")
+	require.NoError(t, db.Delete(&old).Error, "Failed to delete subfolder")
+	require.NoError(t, db.Delete(&archive).Error, "Failed to delete folder")
+
+	serve := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), method string, params map[string]string, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		h(rec, req, params, nil)
+		return rec
+	}
+
+	type resource struct {
+		ID         string                 `json:"id"`
+		Attributes map[string]interface{} `json:"attributes"`
+	}
+	decodeList := func(rec *httptest.ResponseRecorder) []resource {
+		var body struct {
+			Data []resource `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		return body.Data
+	}
+	decodeOne := func(rec *httptest.ResponseRecorder) (resource, map[string]interface{}) {
+		var body struct {
+			Data resource               `json:"data"`
+			Meta map[string]interface{} `json:"meta"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+		return body.Data, body.Meta
+	}
+
+	// Test ListFolders
+	t.Run("ListFolders", func(t *testing.T) {
+		rec := serve(handler.ListFolders, http.MethodGet, nil, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		folders := decodeList(rec)
+		require.Equal(t, 2, len(folders), "Expected two deleted folders")
+		assert.NotNil(t, folders[0].Attributes["deleted_at"], "Expected deletion time to be set")
+	})
+
+	// Test ListDocuments
+	t.Run("ListDocuments", func(t *testing.T) {
+		rec := serve(handler.ListDocuments, http.MethodGet, nil, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		docs := decodeList(rec)
+		require.Equal(t, 2, len(docs), "Expected two deleted documents")
+		for _, doc := range docs {
+			assert.NotEqual(t, live.ID.String(), doc.ID, "Expected live document to be excluded")
+		}
+
+		rec = serve(handler.ListDocuments, http.MethodGet, nil, uuid.New())
+		assert.Empty(t, decodeList(rec), "Expected other users to see an empty trash")
+	})
+
+	auditEntry := func(t *testing.T, action string, targetID uuid.UUID) models.AuditEntry {
+		var entry models.AuditEntry
+		require.NoError(t, db.First(&entry, "action = ? AND target_id = ?", action, targetID).Error, "Expected a %s audit entry", action)
+		assert.Equal(t, user.ID, entry.ActorID, "Expected the user to be the actor")
+		return entry
+	}
+
+	// Test restoring a document whose folder is still deleted
+	t.Run("RestoreDocumentReparented", func(t *testing.T) {
+		rec := serve(handler.RestoreDocument, http.MethodPost, map[string]string{"id": older.ID.String()}, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		doc, meta := decodeOne(rec)
+		assert.Nil(t, doc.Attributes["folder_id"], "Expected document to be restored to the root")
+		assert.Equal(t, true, meta["reparented"], "Expected document to be reparented")
+
+		var dbDoc models.Document
+		require.NoError(t, db.First(&dbDoc, "id = ?", older.ID).Error, "Expected document to be restored")
+		assert.Nil(t, dbDoc.FolderID, "Expected folder to be cleared")
+
+		entry := auditEntry(t, models.AuditRestore, older.ID)
+		assert.Nil(t, entry.Changes["folder_id"].After, "Expected the reparenting to be audited")
+	})
+
+	// Test restoring a folder, then a document into it
+	t.Run("RestoreFolder", func(t *testing.T) {
+		rec := serve(handler.RestoreFolder, http.MethodPost, map[string]string{"id": archive.ID.String()}, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		_, meta := decodeOne(rec)
+		assert.Equal(t, false, meta["reparented"], "Expected root folder to stay in place")
+
+		rec = serve(handler.RestoreDocument, http.MethodPost, map[string]string{"id": archived.ID.String()}, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		_, meta = decodeOne(rec)
+		assert.Equal(t, false, meta["reparented"], "Expected document to return to its restored folder")
+
+		var dbDoc models.Document
+		require.NoError(t, db.First(&dbDoc, "id = ?", archived.ID).Error, "Expected document to be restored")
+		require.NotNil(t, dbDoc.FolderID, "Expected folder to be kept")
+		assert.Equal(t, archive.ID, *dbDoc.FolderID, "Expected original folder")
+
+		auditEntry(t, models.AuditRestore, archive.ID)
+		auditEntry(t, models.AuditRestore, archived.ID)
+	})
+
+	// Test restoring a folder whose name was taken by a new sibling meanwhile
+	t.Run("RestoreFolderNameTaken", func(t *testing.T) {
+		taken := models.Folder{Name: "Old", UserID: user.ID, ParentID: &archive.ID}
+		require.NoError(t, db.Create(&taken).Error, "Failed to create folder")
+		defer db.Unscoped().Delete(&taken)
+
+		rec := serve(handler.RestoreFolder, http.MethodPost, map[string]string{"id": old.ID.String()}, user.ID)
+		assert.Equal(t, http.StatusConflict, rec.Code, "Expected status code 409")
+
+		var count int64
+		db.Model(&models.Folder{}).Where("id = ?", old.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected folder to stay in the trash")
+	})
+
+	// Test restoring an item that is not in the trash
+	t.Run("RestoreNotDeleted", func(t *testing.T) {
+		rec := serve(handler.RestoreDocument, http.MethodPost, map[string]string{"id": live.ID.String()}, user.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+
+		rec = serve(handler.RestoreFolder, http.MethodPost, map[string]string{"id": "invalid"}, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+	})
+
+	// Test purging a document with its versions
+	t.Run("PurgeDocument", func(t *testing.T) {
+		require.NoError(t, db.Delete(&models.Document{}, "id = ?", archived.ID).Error, "Failed to delete document")
+
+		rec := serve(handler.PurgeDocument, http.MethodDelete, map[string]string{"id": archived.ID.String()}, uuid.New())
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected other users to get status code 404")
+
+		rec = serve(handler.PurgeDocument, http.MethodDelete, map[string]string{"id": archived.ID.String()}, user.ID)
+		require.Equal(t, http.StatusNoContent, rec.Code, "Expected status code 204")
+
+		var count int64
+		db.Unscoped().Model(&models.Document{}).Where("id = ?", archived.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected document to be permanently deleted")
+		db.Model(&models.DocumentVersion{}).Where("document_id = ?", archived.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected document versions to be deleted")
+
+		entry := auditEntry(t, models.AuditPurge, archived.ID)
+		assert.Equal(t, "Archived", entry.Changes["title"].Before, "Expected the purged document's attributes")
+	})
+
+	// Test purging a folder with a deleted document inside
+	t.Run("PurgeFolder", func(t *testing.T) {
+		require.NoError(t, db.Model(&models.Document{}).Where("id = ?", older.ID).Update("folder_id", old.ID).Error, "Failed to move document")
+		require.NoError(t, db.Delete(&models.Document{}, "id = ?", older.ID).Error, "Failed to delete document")
+
+		rec := serve(handler.PurgeFolder, http.MethodDelete, map[string]string{"id": old.ID.String()}, user.ID)
+		require.Equal(t, http.StatusNoContent, rec.Code, "Expected status code 204")
+
+		var count int64
+		db.Unscoped().Model(&models.Folder{}).Where("id = ?", old.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected folder to be permanently deleted")
+
+		var dbDoc models.Document
+		require.NoError(t, db.Unscoped().First(&dbDoc, "id = ?", older.ID).Error, "Expected document to stay in the trash")
+		assert.Nil(t, dbDoc.FolderID, "Expected document to be detached from the purged folder")
+
+		auditEntry(t, models.AuditPurge, old.ID)
+	})
+
+	// Test purging a folder with the subtree deleted together with it
+	t.Run("PurgeFolderSubtree", func(t *testing.T) {
+		projects := models.Folder{Name: "Projects", UserID: user.ID}
+		require.NoError(t, db.Create(&projects).Error, "Failed to create folder")
+		drafts := models.Folder{Name: "Drafts", UserID: user.ID, ParentID: &projects.ID}
+		require.NoError(t, db.Create(&drafts).Error, "Failed to create subfolder")
+		resp, err := documents.Create(models.Document{Title: "Plan", FolderID: &drafts.ID}, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create document")
+		plan := resp.Result().(models.Document)
+
+		deletedAt := gorm.DeletedAt{Time: time.Now().UTC(), Valid: true}
+		require.NoError(t, db.Model(&models.Document{}).Where("id = ?", plan.ID).Update("deleted_at", deletedAt).Error, "Failed to delete document")
+		require.NoError(t, db.Model(&models.Folder{}).Where("id IN ?", []uuid.UUID{projects.ID, drafts.ID}).Update("deleted_at", deletedAt).Error, "Failed to delete folders")
+
+		rec := serve(handler.PurgeFolder, http.MethodDelete, map[string]string{"id": projects.ID.String()}, user.ID)
+		require.Equal(t, http.StatusNoContent, rec.Code, "Expected status code 204")
+
+		var count int64
+		db.Unscoped().Model(&models.Folder{}).Where("id IN ?", []uuid.UUID{projects.ID, drafts.ID}).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected folder and subfolder to be permanently deleted")
+		db.Unscoped().Model(&models.Document{}).Where("id = ?", plan.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected document to be permanently deleted")
+		db.Model(&models.DocumentVersion{}).Where("document_id = ?", plan.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected document versions to be deleted")
+
+		auditEntry(t, models.AuditPurge, projects.ID)
+	})
+}
+
+func TestPurgeTrash(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create a test user with a long deleted and a recently deleted document
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	expired := models.Document{Title: "Expired", UserID: user.ID}
+	recent := models.Document{Title: "Recent", UserID: user.ID}
+	for _, doc := range []*models.Document{&expired, &recent} {
+		require.NoError(t, db.Create(doc).Error, "Failed to create test document")
+	}
+	require.NoError(t, db.Delete(&recent).Error, "Failed to delete document")
+	require.NoError(t, db.Model(&expired).Update("deleted_at", gorm.DeletedAt{Time: time.Now().AddDate(0, 0, -40), Valid: true}).Error, "Failed to delete document")
+
+	purge, err := database.PurgeTrash(db, time.Now().AddDate(0, 0, -30))
+	require.NoError(t, err, "Failed to purge trash")
+	assert.Equal(t, 1, purge.Documents, "Expected one document to be purged")
+	assert.Equal(t, 0, purge.Folders, "Expected no folders to be purged")
+
+	var count int64
+	db.Unscoped().Model(&models.Document{}).Where("id = ?", expired.ID).Count(&count)
+	assert.Equal(t, int64(0), count, "Expected expired document to be purged")
+	db.Unscoped().Model(&models.Document{}).Where("id = ?", recent.ID).Count(&count)
+	assert.Equal(t, int64(1), count, "Expected recent document to stay in the trash")
+
+	var entry models.AuditEntry
+	require.NoError(t, db.First(&entry, "action = ? AND target_id = ?", models.AuditPurge, expired.ID).Error, "Expected a purge audit entry")
+	assert.Equal(t, user.ID, entry.ActorID, "Expected the owner to be the actor")
+	assert.Equal(t, "Expired", entry.Changes["title"].Before, "Expected the purged document's attributes")
+
+	// Test purging more expired items than fit in one batch
+	t.Run("Batches", func(t *testing.T) {
+		deletedAt := gorm.DeletedAt{Time: time.Now().AddDate(0, 0, -40), Valid: true}
+		docs := make([]models.Document, 1201)
+		for i := range docs {
+			docs[i] = models.Document{ID: uuid.New(), Title: fmt.Sprintf("Expired %d", i), UserID: user.ID, DeletedAt: deletedAt}
+		}
+		require.NoError(t, db.CreateInBatches(docs, 100).Error, "Failed to create test documents")
+
+		purge, err := database.PurgeTrash(db, time.Now().AddDate(0, 0, -30))
+		require.NoError(t, err, "Failed to purge trash")
+		assert.Equal(t, len(docs), purge.Documents, "Expected all expired documents to be purged")
+
+		db.Unscoped().Model(&models.Document{}).Where("user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(1), count, "Expected only the recent document to stay in the trash")
+	})
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"net/http"
+	"srv/database"
+	"srv/models"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// TreeHandler serves the nested folder hierarchy of folders and users
+type TreeHandler struct {
+	DB *gorm.DB
+}
+
+// NewTreeHandler creates a new TreeHandler
+func NewTreeHandler(db *gorm.DB) *TreeHandler {
+	return &TreeHandler{
+		DB: db,
+	}
+}
+
+// folderTree is a folder with its nested subfolders and documents. The tree of
+// a user is rooted at a virtual folder carrying the user's ID and username.
+type folderTree struct {
+	ID        uuid.UUID      `json:"-"`
+	Name      string         `json:"name"`
+	ParentID  *uuid.UUID     `json:"parent_id"`
+	Folders   []*treeNode    `json:"folders"`
+	Documents []documentStub `json:"documents"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (t folderTree) GetID() string {
+	return t.ID.String()
+}
+
+// treeNode is a folder nested within a folderTree
+type treeNode struct {
+	ID        uuid.UUID      `json:"id"`
+	Name      string         `json:"name"`
+	Folders   []*treeNode    `json:"folders"`
+	Documents []documentStub `json:"documents"`
+}
+
+// documentStub is a document within a tree, without its content
+type documentStub struct {
+	ID        uuid.UUID  `json:"id"`
+	Title     string     `json:"title"`
+	FolderID  *uuid.UUID `json:"-"`
+	Revision  int        `json:"revision"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Register adds the tree routes to the router
+func (h TreeHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodGet, prefix+"/folders/:id/tree", h.FolderTree)
+	router.Handle(http.MethodGet, prefix+"/users/:id/tree", h.UserTree)
+}
+
+// FolderTree returns a folder with all of its subfolders and documents nested
+// within. Users the folder is shared with see the tree of its owner.
+func (h TreeHandler) FolderTree(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	maxDepth, ok := parseDepth(w, r)
+	if !ok {
+		return
+	}
+
+	folder, ok := findRequestFolder(h.DB, w, r, params["id"], models.RoleViewer)
+	if !ok {
+		return
+	}
+	userID, _ := requestUserID(r)
+
+	logrus.WithFields(logrus.Fields{
+		"id":    folder.ID,
+		"depth": maxDepth,
+	}).Info("Building folder tree")
+
+	tree := &folderTree{ID: folder.ID, Name: folder.Name, ParentID: folder.ParentID}
+	if err := h.buildTree(tree, userID, folder.UserID, &folder.ID, maxDepth); err != nil {
+		logrus.WithError(err).WithField("id", folder.ID).Error("Failed to build folder tree")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, *tree, nil)
+}
+
+// UserTree returns all folders and documents of a user nested by folder
+func (h TreeHandler) UserTree(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		logrus.WithError(err).WithField("id", params["id"]).Error("Invalid user ID")
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if id != userID {
+		logrus.WithField("id", id).Warn("Cannot access another user's tree")
+		writeError(w, http.StatusForbidden, "Cannot access another user")
+		return
+	}
+
+	maxDepth, ok := parseDepth(w, r)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", userID).Warn("User not found")
+			writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		logrus.WithError(err).WithField("id", userID).Error("Failed to find user")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":    userID,
+		"depth": maxDepth,
+	}).Info("Building user tree")
+
+	tree := &folderTree{ID: user.ID, Name: user.Username}
+	if err := h.buildTree(tree, userID, userID, nil, maxDepth); err != nil {
+		logrus.WithError(err).WithField("id", userID).Error("Failed to build user tree")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, *tree, nil)
+}
+
+// buildTree loads the folders and documents of ownerID below parentID, or
+// below the owner's root when it is nil, and nests in tree the ones userID may
+// access. A document counts one level deeper than its folder, so a depth of 1
+// lists the direct children only.
+func (h TreeHandler) buildTree(tree *folderTree, userID, ownerID uuid.UUID, parentID *uuid.UUID, maxDepth int) error {
+	folders, err := database.FolderTree(h.DB, ownerID, parentID, maxDepth)
+	if err != nil {
+		return err
+	}
+	if userID != ownerID {
+		if folders, err = h.accessibleFolders(userID, parentID, folders); err != nil {
+			return err
+		}
+	}
+
+	// Index the folders, collecting those whose documents are within the depth limit
+	nodes := make(map[uuid.UUID]*treeNode, len(folders))
+	var documentFolders []uuid.UUID
+	for _, folder := range folders {
+		nodes[folder.ID] = &treeNode{
+			ID:        folder.ID,
+			Name:      folder.Name,
+			Folders:   []*treeNode{},
+			Documents: []documentStub{},
+		}
+		if maxDepth <= 0 || folder.Depth < maxDepth {
+			documentFolders = append(documentFolders, folder.ID)
+		}
+	}
+
+	query := h.DB.Model(&models.Document{}).
+		Select("id", "title", "folder_id", "revision", "updated_at").
+		Where("user_id = ?", ownerID).
+		Scopes(database.AccessibleDocuments(userID))
+	if parentID != nil {
+		query = query.Where("folder_id IN ?", append(documentFolders, *parentID))
+	} else {
+		query = query.Where("(folder_id IS NULL OR folder_id IN ?)", documentFolders)
+	}
+
+	var documents []documentStub
+	if err := query.Order("title").Order("id").Find(&documents).Error; err != nil {
+		return err
+	}
+
+	// Folders are ordered by depth, so every parent is linked before its children
+	tree.Folders = []*treeNode{}
+	tree.Documents = []documentStub{}
+	for _, folder := range folders {
+		if folder.Depth > 1 {
+			parent := nodes[*folder.ParentID]
+			parent.Folders = append(parent.Folders, nodes[folder.ID])
+		} else {
+			tree.Folders = append(tree.Folders, nodes[folder.ID])
+		}
+	}
+	for _, document := range documents {
+		if document.FolderID == nil || (parentID != nil && *document.FolderID == *parentID) {
+			tree.Documents = append(tree.Documents, document)
+		} else {
+			node := nodes[*document.FolderID]
+			node.Documents = append(node.Documents, document)
+		}
+	}
+
+	return nil
+}
+
+// accessibleFolders keeps the folders below parentID that userID may access.
+// As shares extend to subfolders, these are whole branches of the tree.
+func (h TreeHandler) accessibleFolders(userID uuid.UUID, parentID *uuid.UUID, folders []database.TreeFolder) ([]database.TreeFolder, error) {
+	query := h.DB.Model(&models.Folder{}).Scopes(database.AccessibleFolders(userID))
+	if parentID != nil {
+		query = query.Where("folders.id IN (?)", database.FolderSubtreeIDs(h.DB, *parentID))
+	}
+	var ids []uuid.UUID
+	if err := query.Pluck("folders.id", &ids).Error; err != nil {
+		return nil, err
+	}
+	accessible := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		accessible[id] = true
+	}
+
+	// Folders come ordered by depth, so a parent is kept before its children
+	kept := folders[:0]
+	keptIDs := make(map[uuid.UUID]bool, len(folders))
+	for _, folder := range folders {
+		if accessible[folder.ID] && (folder.Depth == 1 || keptIDs[*folder.ParentID]) {
+			kept = append(kept, folder)
+			keptIDs[folder.ID] = true
+		}
+	}
+	return kept, nil
+}
+
+// parseDepth reads the optional depth query parameter, writing an error
+// response if it is invalid. Zero means the depth is unlimited.
+func parseDepth(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("depth")
+	if value == "" {
+		return 0, true
+	}
+
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 1 {
+		logrus.WithField("depth", value).Warn("Invalid depth")
+		writeError(w, http.StatusBadRequest, "depth must be a positive integer")
+		return 0, false
+	}
+
+	return depth, true
+}
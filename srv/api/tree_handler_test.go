@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeHandler(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create handler
+	handler := NewTreeHandler(db)
+
+	// Create a test user with a folder tree Projects/2026/Q1 and Archive
+	user := models.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	projects := models.Folder{Name: "Projects", UserID: user.ID}
+	archive := models.Folder{Name: "Archive", UserID: user.ID}
+	for _, folder := range []*models.Folder{&projects, &archive} {
+		require.NoError(t, db.Create(folder).Error, "Failed to create folder")
+	}
+	year := models.Folder{Name: "2026", UserID: user.ID, ParentID: &projects.ID}
+	require.NoError(t, db.Create(&year).Error, "Failed to create subfolder")
+	quarter := models.Folder{Name: "Q1", UserID: user.ID, ParentID: &year.ID}
+	require.NoError(t, db.Create(&quarter).Error, "Failed to create subfolder")
+	deleted := models.Folder{Name: "Deleted", UserID: user.ID, ParentID: &projects.ID}
+	require.NoError(t, db.Create(&deleted).Error, "Failed to create subfolder")
+	require.NoError(t, db.Delete(&deleted).Error, "Failed to delete subfolder")
+
+	docs := []models.Document{
+		{Title: "Readme", Content: "Root level", UserID: user.ID},
+		{Title: "Plan", UserID: user.ID, FolderID: &projects.ID},
+		{Title: "Budget", UserID: user.ID, FolderID: &year.ID},
+		{Title: "Report", UserID: user.ID, FolderID: &quarter.ID},
+	}
+	for i := range docs {
+		require.NoError(t, db.Create(&docs[i]).Error, "Failed to create document")
+	}
+
+	type node struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Folders   []node `json:"folders"`
+		Documents []struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		} `json:"documents"`
+	}
+	serve := func(h func(http.ResponseWriter, *http.Request, map[string]string, map[string]interface{}), target string, id uuid.UUID, userID uuid.UUID) (*httptest.ResponseRecorder, node) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		h(rec, req, map[string]string{"id": id.String()}, nil)
+
+		var body struct {
+			Data struct {
+				ID         string `json:"id"`
+				Type       string `json:"type"`
+				Attributes node   `json:"attributes"`
+			} `json:"data"`
+		}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), "Failed to decode response")
+			assert.Equal(t, "folderTrees", body.Data.Type, "Expected folderTrees resource")
+			body.Data.Attributes.ID = body.Data.ID
+		}
+		return rec, body.Data.Attributes
+	}
+	titles := func(n node) []string {
+		var result []string
+		for _, doc := range n.Documents {
+			result = append(result, doc.Title)
+		}
+		return result
+	}
+
+	// Test the full tree of a user
+	t.Run("UserTree", func(t *testing.T) {
+		rec, tree := serve(handler.UserTree, "/", user.ID, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		assert.Equal(t, user.ID.String(), tree.ID, "Expected user ID as tree ID")
+		assert.Equal(t, []string{"Readme"}, titles(tree), "Expected root documents")
+		require.Equal(t, 2, len(tree.Folders), "Expected two root folders")
+		assert.Equal(t, "Archive", tree.Folders[0].Name, "Expected folders sorted by name")
+		assert.Empty(t, tree.Folders[0].Folders, "Expected empty folder")
+
+		p := tree.Folders[1]
+		assert.Equal(t, []string{"Plan"}, titles(p), "Expected documents of Projects")
+		require.Equal(t, 1, len(p.Folders), "Expected deleted subfolder to be excluded")
+		require.Equal(t, 1, len(p.Folders[0].Folders), "Expected Q1 below 2026")
+		assert.Equal(t, []string{"Report"}, titles(p.Folders[0].Folders[0]), "Expected documents of Q1")
+		assert.Empty(t, p.Folders[0].Folders[0].Documents[0].Content, "Expected document stubs without content")
+	})
+
+	// Test the tree of a folder with a depth limit
+	t.Run("FolderTreeDepth", func(t *testing.T) {
+		rec, tree := serve(handler.FolderTree, "/?depth=2", projects.ID, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+
+		assert.Equal(t, "Projects", tree.Name, "Expected folder as tree root")
+		assert.Equal(t, []string{"Plan"}, titles(tree), "Expected documents of the folder")
+		require.Equal(t, 1, len(tree.Folders), "Expected one subfolder")
+		assert.Equal(t, []string{"Budget"}, titles(tree.Folders[0]), "Expected documents at depth 2")
+		require.Equal(t, 1, len(tree.Folders[0].Folders), "Expected folders at depth 2")
+		assert.Empty(t, tree.Folders[0].Folders[0].Folders, "Expected no folders beyond depth 2")
+		assert.Empty(t, tree.Folders[0].Folders[0].Documents, "Expected no documents beyond depth 2")
+
+		rec, tree = serve(handler.FolderTree, "/?depth=1", projects.ID, user.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, []string{"Plan"}, titles(tree), "Expected direct documents")
+		require.Equal(t, 1, len(tree.Folders), "Expected direct subfolders")
+		assert.Empty(t, tree.Folders[0].Documents, "Expected no documents beyond depth 1")
+	})
+
+	// Test invalid requests
+	t.Run("Invalid", func(t *testing.T) {
+		rec, _ := serve(handler.FolderTree, "/?depth=0", projects.ID, user.ID)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Expected status code 400")
+
+		rec, _ = serve(handler.FolderTree, "/", deleted.ID, user.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+	})
+
+	// Test the tree of a folder shared with another user
+	t.Run("Sharee", func(t *testing.T) {
+		sharee := models.User{Username: "sharee", Email: "sharee@example.com"}
+		require.NoError(t, db.Create(&sharee).Error, "Failed to create sharee")
+		share := models.Share{UserID: sharee.ID, FolderID: &year.ID, Role: models.RoleViewer, OwnerID: user.ID, CreatedByID: user.ID}
+		require.NoError(t, db.Create(&share).Error, "Failed to create share")
+
+		rec, tree := serve(handler.FolderTree, "/", year.ID, sharee.ID)
+		require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, "2026", tree.Name, "Expected shared folder as tree root")
+		assert.Equal(t, []string{"Budget"}, titles(tree), "Expected documents of the shared folder")
+		require.Equal(t, 1, len(tree.Folders), "Expected subfolders of the shared folder")
+		assert.Equal(t, []string{"Report"}, titles(tree.Folders[0]), "Expected documents of Q1")
+
+		rec, _ = serve(handler.FolderTree, "/", projects.ID, sharee.ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected the unshared parent to stay hidden")
+	})
+
+	// Test ownership enforcement
+	t.Run("OtherUser", func(t *testing.T) {
+		otherUser := uuid.New()
+		rec, _ := serve(handler.FolderTree, "/", projects.ID, otherUser)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "Expected status code 404")
+
+		rec, _ = serve(handler.UserTree, "/", user.ID, otherUser)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "Expected status code 403")
+	})
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"srv/auth"
 	"srv/models"
 
 	"github.com/google/uuid"
@@ -15,6 +16,14 @@ type UserResource struct {
 	DB *gorm.DB
 }
 
+// userSortFields are the attributes users can be sorted by
+var userSortFields = map[string]sortField{
+	"username":   {Column: "username"},
+	"email":      {Column: "email"},
+	"created_at": {Column: "created_at", Time: true},
+	"updated_at": {Column: "updated_at", Time: true},
+}
+
 // NewUserResource creates a new UserResource
 func NewUserResource(db *gorm.DB) *UserResource {
 	return &UserResource{
@@ -22,19 +31,105 @@ func NewUserResource(db *gorm.DB) *UserResource {
 	}
 }
 
-// FindAll returns all users
+// FindAll returns the authenticated user
 func (r UserResource) FindAll(req api2go.Request) (api2go.Responder, error) {
 	logrus.Info("Finding all users")
 
-	var users []models.User
-	query := r.DB.Unscoped()
+	result, err := r.findUsers(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of users along with the total count
+func (r UserResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of users")
+
+	result, err := r.findUsers(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findUsers loads the users matching the request's filters, sort and page
+func (r UserResource) findUsers(req api2go.Request) (page[models.User], error) {
+	userID, err := currentUserID(req)
+	if err != nil {
+		return page[models.User]{}, err
+	}
+
+	includes, err := parseIncludes(req, userIncludes)
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid include parameter")
+		return page[models.User]{}, err
+	}
+
+	// Users see themselves, and the owners of the folders and documents
+	// shared with them for routes such as GET /v1/folders/{id}/user
+	listedID, err := r.linkedOwner(req, userID)
+	if err != nil {
+		return page[models.User]{}, err
+	}
+
+	query := r.DB.Model(&models.User{}).Where("id = ?", listedID).
+		Scopes(includeScopes(includes, userIncludes, userID)...)
+
+	opts, err := parseListOptions(req, userSortFields, []sortTerm{{sortField: userSortFields["created_at"]}})
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.User]{}, err
+	}
 
-	if err := query.Find(&users).Error; err != nil {
+	result, err := findPage[models.User](query, opts)
+	if err != nil {
 		logrus.WithError(err).Error("Failed to find users")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return page[models.User]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
-	return &api2go.Response{Res: users, Code: http.StatusOK}, nil
+	for i := range result.Items {
+		if result.Items[i].ID != userID {
+			result.Items[i] = result.Items[i].Profile()
+			continue
+		}
+		result.Items[i].Include(includes...)
+	}
+	return result, nil
+}
+
+// linkedOwner returns the user to list for the user relationship of a folder
+// or document, its owner, or the current user for other requests
+func (r UserResource) linkedOwner(req api2go.Request, currentUser uuid.UUID) (uuid.UUID, error) {
+	for _, owned := range []struct {
+		resourceType string
+		find         func(id uuid.UUID) (uuid.UUID, error)
+	}{
+		{"folders", func(id uuid.UUID) (uuid.UUID, error) {
+			folder, err := findFolder(r.DB, currentUser, id, models.RoleViewer)
+			return folder.UserID, err
+		}},
+		{"documents", func(id uuid.UUID) (uuid.UUID, error) {
+			document, err := findDocument(r.DB, currentUser, id, models.RoleViewer)
+			return document.UserID, err
+		}},
+	} {
+		id, _, ok, err := linkedResource(req, owned.resourceType)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if !ok {
+			continue
+		}
+		ownerID, err := owned.find(id)
+		if err != nil {
+			return uuid.Nil, accessHTTPError(err)
+		}
+		return ownerID, nil
+	}
+	return currentUser, nil
 }
 
 // FindOne returns a single user
@@ -44,18 +139,33 @@ func (r UserResource) FindOne(id string, req api2go.Request) (api2go.Responder,
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Invalid user ID")
-		return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+		return &api2go.Response{}, newHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+	}
+
+	if err := r.authorize(uuid, req); err != nil {
+		return &api2go.Response{}, err
 	}
 
+	includes, err := parseIncludes(req, userIncludes)
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid include parameter")
+		return &api2go.Response{}, err
+	}
+
+	// The IDs of folders and documents are loaded for the relationships, and
+	// replaced by the complete items when they are included
 	var user models.User
-	if err := r.DB.First(&user, "id = ?", uuid).Error; err != nil {
+	if err := r.DB.Scopes(preloadChildIDs(uuid, "user_id", "user_id")).
+		Scopes(includeScopes(includes, userIncludes, uuid)...).
+		First(&user, "id = ?", uuid).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			logrus.WithField("id", id).Warn("User not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "User not found", http.StatusNotFound)
+			return &api2go.Response{}, newHTTPError(err, "User not found", http.StatusNotFound)
 		}
 		logrus.WithError(err).WithField("id", id).Error("Failed to find user")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
+	user.Include(includes...)
 
 	return &api2go.Response{Res: user, Code: http.StatusOK}, nil
 }
@@ -64,7 +174,7 @@ func (r UserResource) FindOne(id string, req api2go.Request) (api2go.Responder,
 func (r UserResource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
 	user, ok := obj.(models.User)
 	if !ok {
-		err := api2go.NewHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
 		logrus.WithError(err).Error("Invalid instance given to create user")
 		return &api2go.Response{}, err
 	}
@@ -74,9 +184,27 @@ func (r UserResource) Create(obj interface{}, req api2go.Request) (api2go.Respon
 		"email":    user.Email,
 	}).Info("Creating user")
 
-	if err := r.DB.Create(&user).Error; err != nil {
+	passwordHash, err := auth.HashPassword(user.Password)
+	if err != nil {
+		logrus.WithError(err).WithField("username", user.Username).Warn("Invalid password")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusBadRequest)
+	}
+	user.PasswordHash = passwordHash
+	user.Password = ""
+
+	// Users create themselves, so they are the actor of their creation
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditCreate, user.ID, nil, user); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventCreated, user, user.ID, nil)
+	})
+	if err != nil {
 		logrus.WithError(err).Error("Failed to create user")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, constraintHTTPError(err)
 	}
 
 	return &api2go.Response{Res: user, Code: http.StatusCreated}, nil
@@ -89,7 +217,11 @@ func (r UserResource) Delete(id string, req api2go.Request) (api2go.Responder, e
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Invalid user ID")
-		return &api2go.Response{}, api2go.NewHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+		return &api2go.Response{}, newHTTPError(err, "Invalid user ID", http.StatusBadRequest)
+	}
+
+	if err := r.authorize(uuid, req); err != nil {
+		return &api2go.Response{}, err
 	}
 
 	// Check if user exists
@@ -97,16 +229,28 @@ func (r UserResource) Delete(id string, req api2go.Request) (api2go.Responder, e
 	if err := r.DB.First(&user, "id = ?", uuid).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			logrus.WithField("id", id).Warn("User not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "User not found", http.StatusNotFound)
+			return &api2go.Response{}, newHTTPError(err, "User not found", http.StatusNotFound)
 		}
 		logrus.WithError(err).WithField("id", id).Error("Failed to find user")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
-	// Delete user
-	if err := r.DB.Delete(&user).Error; err != nil {
+	// Delete user and revoke all of their sessions
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditDelete, user.ID, user, nil); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventDeleted, user, user.ID, nil)
+	})
+	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to delete user")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
 	}
 
 	return &api2go.Response{Code: http.StatusNoContent}, nil
@@ -116,7 +260,7 @@ func (r UserResource) Delete(id string, req api2go.Request) (api2go.Responder, e
 func (r UserResource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
 	user, ok := obj.(models.User)
 	if !ok {
-		err := api2go.NewHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
 		logrus.WithError(err).Error("Invalid instance given to update user")
 		return &api2go.Response{}, err
 	}
@@ -127,22 +271,73 @@ func (r UserResource) Update(obj interface{}, req api2go.Request) (api2go.Respon
 		"email":    user.Email,
 	}).Info("Updating user")
 
+	if err := r.authorize(user.ID, req); err != nil {
+		return &api2go.Response{}, err
+	}
+
 	// Check if user exists
 	var existingUser models.User
 	if err := r.DB.First(&existingUser, "id = ?", user.ID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			logrus.WithField("id", user.ID).Warn("User not found")
-			return &api2go.Response{}, api2go.NewHTTPError(err, "User not found", http.StatusNotFound)
+			return &api2go.Response{}, newHTTPError(err, "User not found", http.StatusNotFound)
 		}
 		logrus.WithError(err).WithField("id", user.ID).Error("Failed to find user")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	// Apply only the attributes present in the payload to the stored user
+	changes := user
+	user = existingUser
+	if changes.HasAttribute("username") {
+		user.Username = changes.Username
+	}
+	if changes.HasAttribute("email") {
+		user.Email = changes.Email
+	}
+
+	// Change the password if a new one was given, otherwise keep the existing one
+	if changes.HasAttribute("password") && changes.Password != "" {
+		passwordHash, err := auth.HashPassword(changes.Password)
+		if err != nil {
+			logrus.WithError(err).WithField("id", user.ID).Warn("Invalid password")
+			return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusBadRequest)
+		}
+		user.PasswordHash = passwordHash
 	}
 
 	// Update user
-	if err := r.DB.Save(&user).Error; err != nil {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("username", "email", "password_hash", "updated_at").Updates(&user).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, models.AuditUpdate, user.ID, existingUser, user); err != nil {
+			return err
+		}
+		return recordEvent(tx, models.EventUpdated, user, user.ID, nil)
+	})
+	if err != nil {
 		logrus.WithError(err).WithField("id", user.ID).Error("Failed to update user")
-		return &api2go.Response{}, api2go.NewHTTPError(err, err.Error(), http.StatusInternalServerError)
+		return &api2go.Response{}, constraintHTTPError(err)
 	}
 
 	return &api2go.Response{Res: user, Code: http.StatusOK}, nil
 }
+
+// authorize ensures the authenticated user is the user with the given ID
+func (r UserResource) authorize(id uuid.UUID, req api2go.Request) error {
+	userID, err := currentUserID(req)
+	if err != nil {
+		return err
+	}
+
+	if userID != id {
+		logrus.WithFields(logrus.Fields{
+			"id":      id,
+			"user_id": userID,
+		}).Warn("Cannot access another user")
+		return newHTTPError(nil, "Cannot access another user", http.StatusForbidden)
+	}
+
+	return nil
+}
@@ -25,6 +25,7 @@ func TestUserResource_CRUD(t *testing.T) {
 		user := models.User{
 			Username: "testuser",
 			Email:    "test@example.com",
+			Password: "password123",
 		}
 
 		resp, err := resource.Create(user, api2go.Request{})
@@ -36,6 +37,21 @@ func TestUserResource_CRUD(t *testing.T) {
 		assert.NotEqual(t, uuid.Nil, createdUser.ID, "Expected user ID to be set")
 		assert.Equal(t, "testuser", createdUser.Username, "Expected username to match")
 		assert.Equal(t, "test@example.com", createdUser.Email, "Expected email to match")
+		assert.Empty(t, createdUser.Password, "Expected password not to be returned")
+		assert.NotEmpty(t, createdUser.PasswordHash, "Expected password to be hashed")
+		assert.NotEqual(t, "password123", createdUser.PasswordHash, "Expected password not to be stored in plain text")
+	})
+
+	// Test Create without a valid password
+	t.Run("CreateShortPassword", func(t *testing.T) {
+		user := models.User{
+			Username: "shortpassword",
+			Email:    "short@example.com",
+			Password: "short",
+		}
+
+		_, err := resource.Create(user, api2go.Request{})
+		assertHTTPStatus(t, err, http.StatusBadRequest)
 	})
 
 	// Create a user for subsequent tests
@@ -47,7 +63,7 @@ func TestUserResource_CRUD(t *testing.T) {
 
 	// Test FindOne
 	t.Run("FindOne", func(t *testing.T) {
-		resp, err := resource.FindOne(user.ID.String(), api2go.Request{})
+		resp, err := resource.FindOne(user.ID.String(), newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to find user")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -60,7 +76,7 @@ func TestUserResource_CRUD(t *testing.T) {
 
 	// Test FindAll
 	t.Run("FindAll", func(t *testing.T) {
-		resp, err := resource.FindAll(api2go.Request{})
+		resp, err := resource.FindAll(newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to find all users")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -89,7 +105,7 @@ func TestUserResource_CRUD(t *testing.T) {
 			Email:    "updated@example.com",
 		}
 
-		resp, err := resource.Update(updatedUser, api2go.Request{})
+		resp, err := resource.Update(updatedUser, newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to update user")
 		require.Equal(t, http.StatusOK, resp.StatusCode(), "Expected status code 200")
 
@@ -104,11 +120,56 @@ func TestUserResource_CRUD(t *testing.T) {
 		require.NoError(t, db.First(&dbUser, "id = ?", user.ID).Error, "Failed to find user in database")
 		assert.Equal(t, "updateduser", dbUser.Username, "Expected username to be updated in database")
 		assert.Equal(t, "updated@example.com", dbUser.Email, "Expected email to be updated in database")
+		assert.Equal(t, user.CreatedAt.Unix(), dbUser.CreatedAt.Unix(), "Expected created_at to be kept")
+	})
+
+	// Test partial updates
+	t.Run("PartialUpdate", func(t *testing.T) {
+		var stored models.User
+		require.NoError(t, db.First(&stored, "id = ?", user.ID).Error, "Failed to find user")
+
+		applyPatch(t, &stored, "users", user.ID.String(), `{"email": "partial@example.com", "created_at": "2000-01-01T00:00:00Z"}`)
+		resp, err := resource.Update(stored, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update user")
+		assert.Equal(t, "updateduser", resp.Result().(models.User).Username, "Expected absent username to be kept")
+
+		var dbUser models.User
+		require.NoError(t, db.First(&dbUser, "id = ?", user.ID).Error, "Failed to find user in database")
+		assert.Equal(t, "partial@example.com", dbUser.Email, "Expected email to be updated in database")
+		assert.Equal(t, "updateduser", dbUser.Username, "Expected absent username to be kept in database")
+		assert.Equal(t, user.PasswordHash, dbUser.PasswordHash, "Expected absent password to be kept")
+		assert.Equal(t, user.CreatedAt.Unix(), dbUser.CreatedAt.Unix(), "Expected created_at to be kept")
+	})
+
+	// Test ownership enforcement
+	t.Run("OtherUser", func(t *testing.T) {
+		otherUser := models.User{
+			Username: "otheruser",
+			Email:    "other@example.com",
+		}
+		require.NoError(t, db.Create(&otherUser).Error, "Failed to create other user")
+
+		// Only the authenticated user is listed
+		resp, err := resource.FindAll(newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find all users")
+		users := resp.Result().([]models.User)
+		require.Equal(t, 1, len(users), "Expected exactly one user")
+		assert.Equal(t, user.ID, users[0].ID, "Expected only the authenticated user")
+
+		// Other users cannot be read, updated or deleted
+		_, err = resource.FindOne(otherUser.ID.String(), newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		_, err = resource.Update(models.User{ID: otherUser.ID, Username: "hijacked"}, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
+
+		_, err = resource.Delete(otherUser.ID.String(), newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusForbidden)
 	})
 
 	// Test Delete
 	t.Run("Delete", func(t *testing.T) {
-		resp, err := resource.Delete(user.ID.String(), api2go.Request{})
+		resp, err := resource.Delete(user.ID.String(), newRequest(user.ID, nil))
 		require.NoError(t, err, "Failed to delete user")
 		require.Equal(t, http.StatusNoContent, resp.StatusCode(), "Expected status code 204")
 
@@ -124,6 +185,7 @@ func TestUserResource_CRUD(t *testing.T) {
 		user1 := models.User{
 			Username: "uniqueuser",
 			Email:    "unique@example.com",
+			Password: "password123",
 		}
 		resp, err := resource.Create(user1, api2go.Request{})
 		require.NoError(t, err, "Failed to create first user")
@@ -133,20 +195,24 @@ func TestUserResource_CRUD(t *testing.T) {
 		user2 := models.User{
 			Username: "uniqueuser",
 			Email:    "different@example.com",
+			Password: "password123",
 		}
 		_, err = resource.Create(user2, api2go.Request{})
 		require.Error(t, err, "Expected error when creating user with duplicate username")
 		_, ok := err.(api2go.HTTPError)
 		require.True(t, ok, "Expected error to be an HTTPError")
+		assertHTTPStatus(t, err, http.StatusConflict)
 
 		// Try to create another user with the same email
 		user3 := models.User{
 			Username: "differentuser",
 			Email:    "unique@example.com",
+			Password: "password123",
 		}
 		_, err = resource.Create(user3, api2go.Request{})
 		require.Error(t, err, "Expected error when creating user with duplicate email")
 		_, ok = err.(api2go.HTTPError)
 		require.True(t, ok, "Expected error to be an HTTPError")
+		assertHTTPStatus(t, err, http.StatusConflict)
 	})
 }
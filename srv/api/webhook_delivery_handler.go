@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"srv/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/routing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// WebhookDeliveryHandler serves the actions on webhook deliveries that don't
+// fit the read-only delivery resource
+type WebhookDeliveryHandler struct {
+	DB *gorm.DB
+}
+
+// NewWebhookDeliveryHandler creates a new WebhookDeliveryHandler
+func NewWebhookDeliveryHandler(db *gorm.DB) *WebhookDeliveryHandler {
+	return &WebhookDeliveryHandler{
+		DB: db,
+	}
+}
+
+// Register adds the webhook delivery routes to the router
+func (h WebhookDeliveryHandler) Register(router routing.Routeable, prefix string) {
+	router.Handle(http.MethodPost, prefix+"/webhookDeliveries/:id/retry", h.Retry)
+}
+
+// Retry requeues a dead delivery with a fresh set of attempts, the first of
+// which is due right away. Deliveries of inactive webhooks wait until the
+// webhook is activated again.
+func (h WebhookDeliveryHandler) Retry(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		logrus.WithError(err).WithField("id", params["id"]).Error("Invalid webhook delivery ID")
+		writeError(w, http.StatusBadRequest, "Invalid webhook delivery ID")
+		return
+	}
+
+	delivery, err := findDelivery(h.DB, userID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", id).Warn("Webhook delivery not found")
+			writeError(w, http.StatusNotFound, "Webhook delivery not found")
+			return
+		}
+		logrus.WithError(err).WithField("id", id).Error("Failed to find webhook delivery")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	logrus.WithField("id", id).Info("Retrying webhook delivery")
+
+	// The status condition keeps a concurrent retry from resetting the
+	// attempts of a delivery that is pending again
+	now := time.Now()
+	retry := h.DB.Model(&delivery).Where("status = ?", models.DeliveryDead).Updates(map[string]interface{}{
+		"status":          models.DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+	})
+	if retry.Error != nil {
+		logrus.WithError(retry.Error).WithField("id", id).Error("Failed to retry webhook delivery")
+		writeError(w, http.StatusInternalServerError, retry.Error.Error())
+		return
+	}
+	if retry.RowsAffected == 0 {
+		logrus.WithFields(logrus.Fields{
+			"id":     id,
+			"status": delivery.Status,
+		}).Warn("Only dead webhook deliveries can be retried")
+		writeError(w, http.StatusConflict, "Only dead deliveries can be retried")
+		return
+	}
+
+	if err := h.DB.First(&delivery, "id = ?", id).Error; err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to reload webhook delivery")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeResponse(w, http.StatusOK, delivery, nil)
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"srv/models"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// WebhookDeliveryResource serves the delivery log of the authenticated user's
+// webhooks. Deliveries are created by the dispatcher, so the resource is
+// read-only; dead deliveries are retried with the WebhookDeliveryHandler.
+type WebhookDeliveryResource struct {
+	DB *gorm.DB
+}
+
+// webhookDeliverySortFields are the attributes deliveries can be sorted by
+var webhookDeliverySortFields = map[string]sortField{
+	"attempts":        {Column: "attempts"},
+	"next_attempt_at": {Column: "next_attempt_at", Time: true},
+	"created_at":      {Column: "created_at", Time: true},
+	"updated_at":      {Column: "updated_at", Time: true},
+}
+
+// NewWebhookDeliveryResource creates a new WebhookDeliveryResource
+func NewWebhookDeliveryResource(db *gorm.DB) *WebhookDeliveryResource {
+	return &WebhookDeliveryResource{
+		DB: db,
+	}
+}
+
+// FindAll returns the deliveries of the authenticated user's webhooks
+func (r WebhookDeliveryResource) FindAll(req api2go.Request) (api2go.Responder, error) {
+	logrus.Info("Finding all webhook deliveries")
+
+	result, err := r.findDeliveries(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of deliveries along with the total count
+func (r WebhookDeliveryResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of webhook deliveries")
+
+	result, err := r.findDeliveries(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findDeliveries loads the deliveries matching the request's filters, sort and
+// page, newest first by default. GET /v1/webhooks/{id}/deliveries and the
+// filter[webhook_id] parameter list the deliveries of one webhook.
+func (r WebhookDeliveryResource) findDeliveries(req api2go.Request) (page[models.WebhookDelivery], error) {
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return page[models.WebhookDelivery]{}, err
+	}
+
+	webhooks := r.DB.Model(&models.Webhook{}).Select("id").Where("user_id = ?", currentUser)
+	query := r.DB.Model(&models.WebhookDelivery{}).Where("webhook_id IN (?)", webhooks)
+
+	webhookID, _, linked, err := linkedResource(req, "webhooks")
+	if err != nil {
+		return page[models.WebhookDelivery]{}, err
+	}
+	if !linked {
+		if values, ok := req.QueryParams["filter[webhook_id]"]; ok && len(values) > 0 {
+			if webhookID, err = uuid.Parse(values[0]); err != nil {
+				logrus.WithError(err).WithField("webhook_id", values[0]).Error("Invalid webhook ID")
+				return page[models.WebhookDelivery]{}, newHTTPError(err, "Invalid webhook ID", http.StatusBadRequest)
+			}
+			linked = true
+		}
+	}
+	if linked {
+		var count int64
+		if err := webhooks.Session(&gorm.Session{}).Where("id = ?", webhookID).Count(&count).Error; err != nil {
+			logrus.WithError(err).WithField("webhook_id", webhookID).Error("Failed to find webhook")
+			return page[models.WebhookDelivery]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+		}
+		if count == 0 {
+			logrus.WithField("webhook_id", webhookID).Warn("Webhook not found")
+			return page[models.WebhookDelivery]{}, newHTTPError(nil, "Webhook not found", http.StatusNotFound)
+		}
+		query = query.Where("webhook_id = ?", webhookID)
+	}
+
+	// Filter by status if provided
+	if statuses, ok := req.QueryParams["filter[status]"]; ok && len(statuses) > 0 {
+		for _, status := range statuses {
+			if status != models.DeliveryPending && status != models.DeliverySucceeded && status != models.DeliveryDead {
+				return page[models.WebhookDelivery]{}, newHTTPError(nil, "Status must be pending, succeeded or dead", http.StatusBadRequest)
+			}
+		}
+		query = query.Where("status IN ?", statuses)
+	}
+
+	opts, err := parseListOptions(req, webhookDeliverySortFields, []sortTerm{{sortField: webhookDeliverySortFields["created_at"], Desc: true}})
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.WebhookDelivery]{}, err
+	}
+
+	result, err := findPage[models.WebhookDelivery](query, opts)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find webhook deliveries")
+		return page[models.WebhookDelivery]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return result, nil
+}
+
+// FindOne returns a single delivery
+func (r WebhookDeliveryResource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Finding webhook delivery")
+
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid webhook delivery ID")
+		return &api2go.Response{}, newHTTPError(err, "Invalid webhook delivery ID", http.StatusBadRequest)
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	delivery, err := findDelivery(r.DB, currentUser, uuid)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", id).Warn("Webhook delivery not found")
+			return &api2go.Response{}, newHTTPError(err, "Webhook delivery not found", http.StatusNotFound)
+		}
+		logrus.WithError(err).WithField("id", id).Error("Failed to find webhook delivery")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return &api2go.Response{Res: delivery, Code: http.StatusOK}, nil
+}
+
+// findDelivery loads a delivery of one of the user's webhooks
+func findDelivery(db *gorm.DB, userID, id uuid.UUID) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := db.Where("webhook_id IN (?)", db.Model(&models.Webhook{}).Select("id").Where("user_id = ?", userID)).
+		First(&delivery, "id = ?", id).Error
+	return delivery, err
+}
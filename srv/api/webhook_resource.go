@@ -0,0 +1,299 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"srv/models"
+	"srv/webhook"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// minWebhookSecretLength is the length of the shortest signing secret accepted
+// from clients
+const minWebhookSecretLength = 16
+
+// WebhookResource implements api2go.CRUD interface for Webhook
+type WebhookResource struct {
+	DB *gorm.DB
+	// Resolver looks up the hosts of webhook URLs, which must have public
+	// addresses
+	Resolver webhook.Resolver
+}
+
+// webhookSortFields are the attributes webhooks can be sorted by
+var webhookSortFields = map[string]sortField{
+	"url":        {Column: "url"},
+	"created_at": {Column: "created_at", Time: true},
+	"updated_at": {Column: "updated_at", Time: true},
+}
+
+// NewWebhookResource creates a new WebhookResource
+func NewWebhookResource(db *gorm.DB) *WebhookResource {
+	return &WebhookResource{
+		DB:       db,
+		Resolver: net.DefaultResolver,
+	}
+}
+
+// FindAll returns the webhooks of the authenticated user
+func (r WebhookResource) FindAll(req api2go.Request) (api2go.Responder, error) {
+	logrus.Info("Finding all webhooks")
+
+	result, err := r.findWebhooks(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return newListResponse(result), nil
+}
+
+// PaginatedFindAll returns a page of webhooks along with the total count
+func (r WebhookResource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	logrus.Info("Finding page of webhooks")
+
+	result, err := r.findWebhooks(req)
+	if err != nil {
+		return 0, &api2go.Response{}, err
+	}
+
+	return uint(result.Total), newListResponse(result), nil
+}
+
+// findWebhooks loads the webhooks of the authenticated user matching the
+// request's sort and page
+func (r WebhookResource) findWebhooks(req api2go.Request) (page[models.Webhook], error) {
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return page[models.Webhook]{}, err
+	}
+
+	query := r.DB.Model(&models.Webhook{}).Where("user_id = ?", currentUser)
+
+	opts, err := parseListOptions(req, webhookSortFields, []sortTerm{{sortField: webhookSortFields["created_at"]}})
+	if err != nil {
+		logrus.WithError(err).Warn("Invalid sort or page parameters")
+		return page[models.Webhook]{}, err
+	}
+
+	result, err := findPage[models.Webhook](query, opts)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to find webhooks")
+		return page[models.Webhook]{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return result, nil
+}
+
+// FindOne returns a single webhook
+func (r WebhookResource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Finding webhook")
+
+	hook, err := r.findWebhook(id, req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	return &api2go.Response{Res: hook, Code: http.StatusOK}, nil
+}
+
+// Create registers a webhook for the events of the authenticated user. Unless
+// the payload contains a secret, one is generated; either way the response
+// carries it, and it can't be retrieved again.
+func (r WebhookResource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	hook, ok := obj.(models.Webhook)
+	if !ok {
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		logrus.WithError(err).Error("Invalid instance given to create webhook")
+		return &api2go.Response{}, err
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"url":    hook.URL,
+		"events": hook.Events,
+	}).Info("Creating webhook")
+
+	if err := r.validateWebhook(req, hook); err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Webhooks are active unless created otherwise
+	if !hook.HasAttribute("active") {
+		hook.Active = true
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	if hook.SigningSecret, err = webhookSecret(hook.Secret); err != nil {
+		return &api2go.Response{}, err
+	}
+
+	hook.ID = uuid.Nil
+	hook.UserID = currentUser
+	if err := r.DB.Create(&hook).Error; err != nil {
+		logrus.WithError(err).Error("Failed to create webhook")
+		return &api2go.Response{}, constraintHTTPError(err)
+	}
+
+	hook.Secret = hook.SigningSecret
+	return &api2go.Response{Res: hook, Code: http.StatusCreated}, nil
+}
+
+// Delete removes a webhook along with its deliveries
+func (r WebhookResource) Delete(id string, req api2go.Request) (api2go.Responder, error) {
+	logrus.WithField("id", id).Info("Deleting webhook")
+
+	hook, err := r.findWebhook(id, req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	if err := r.DB.Delete(&hook).Error; err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to delete webhook")
+		return &api2go.Response{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return &api2go.Response{Code: http.StatusNoContent}, nil
+}
+
+// Update changes the URL, subscribed events or state of a webhook. A secret
+// attribute rotates the signing secret, to the given value or to a generated
+// one if it's empty, and the response carries the new secret.
+func (r WebhookResource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	hook, ok := obj.(models.Webhook)
+	if !ok {
+		err := newHTTPError(nil, "Invalid instance given", http.StatusBadRequest)
+		logrus.WithError(err).Error("Invalid instance given to update webhook")
+		return &api2go.Response{}, err
+	}
+
+	logrus.WithField("id", hook.ID).Info("Updating webhook")
+
+	existingHook, err := r.findWebhook(hook.ID.String(), req)
+	if err != nil {
+		return &api2go.Response{}, err
+	}
+
+	// Apply only the attributes present in the payload to the stored webhook
+	changes := hook
+	hook = existingHook
+	if changes.HasAttribute("url") {
+		hook.URL = changes.URL
+	}
+	if changes.HasAttribute("events") {
+		hook.Events = changes.Events
+		if hook.Events == nil {
+			hook.Events = []string{}
+		}
+	}
+	if changes.HasAttribute("active") {
+		hook.Active = changes.Active
+	}
+	if err := r.validateWebhook(req, hook); err != nil {
+		return &api2go.Response{}, err
+	}
+
+	rotated := changes.HasAttribute("secret")
+	if rotated {
+		if hook.SigningSecret, err = webhookSecret(changes.Secret); err != nil {
+			return &api2go.Response{}, err
+		}
+	}
+
+	if err := r.DB.Model(&hook).Select("url", "events", "active", "signing_secret", "updated_at").Updates(&hook).Error; err != nil {
+		logrus.WithError(err).WithField("id", hook.ID).Error("Failed to update webhook")
+		return &api2go.Response{}, constraintHTTPError(err)
+	}
+
+	if rotated {
+		hook.Secret = hook.SigningSecret
+	}
+	return &api2go.Response{Res: hook, Code: http.StatusOK}, nil
+}
+
+// findWebhook loads a webhook of the authenticated user. Webhooks of other
+// users are reported as missing.
+func (r WebhookResource) findWebhook(id string, req api2go.Request) (models.Webhook, error) {
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Invalid webhook ID")
+		return models.Webhook{}, newHTTPError(err, "Invalid webhook ID", http.StatusBadRequest)
+	}
+
+	currentUser, err := currentUserID(req)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	var hook models.Webhook
+	if err := r.DB.First(&hook, "id = ? AND user_id = ?", uuid, currentUser).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logrus.WithField("id", id).Warn("Webhook not found")
+			return models.Webhook{}, newHTTPError(err, "Webhook not found", http.StatusNotFound)
+		}
+		logrus.WithError(err).WithField("id", id).Error("Failed to find webhook")
+		return models.Webhook{}, newHTTPError(err, err.Error(), http.StatusInternalServerError)
+	}
+
+	return hook, nil
+}
+
+// validateWebhook checks that a webhook has an absolute HTTP(S) URL whose
+// host resolves to public addresses only, and subscribes to known event types,
+// such as document.moved, or patterns matching some of them, such as folder.*
+func (r WebhookResource) validateWebhook(req api2go.Request, hook models.Webhook) error {
+	target, err := url.Parse(hook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return newHTTPError(err, "URL must be an absolute http or https URL", http.StatusBadRequest)
+	}
+	if err := webhook.CheckHost(req.PlainRequest.Context(), r.Resolver, target.Hostname()); err != nil {
+		logrus.WithError(err).WithField("url", hook.URL).Warn("Refused webhook host")
+		if errors.Is(err, webhook.ErrPrivateAddress) {
+			return newHTTPError(err, "URL must not point to a loopback, private or link-local address", http.StatusBadRequest)
+		}
+		return newHTTPError(err, "URL host could not be resolved", http.StatusBadRequest)
+	}
+
+	for _, pattern := range hook.Events {
+		matched := false
+		for _, eventType := range models.EventTypes {
+			if ok, _ := path.Match(pattern, eventType); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return newHTTPError(nil, fmt.Sprintf("Unknown event type %q", pattern), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// webhookSecret returns the signing secret given by a client, or a generated
+// one if none was given
+func webhookSecret(secret string) (string, error) {
+	if secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to generate webhook secret")
+			return "", newHTTPError(err, err.Error(), http.StatusInternalServerError)
+		}
+		return secret, nil
+	}
+	if len(secret) < minWebhookSecretLength {
+		return "", newHTTPError(nil, fmt.Sprintf("Secret must be at least %d characters", minWebhookSecretLength), http.StatusBadRequest)
+	}
+	return secret, nil
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"srv/auth"
+	"srv/database"
+	"srv/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookResource_CRUD(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Create resource, resolving hosts without DNS
+	resource := NewWebhookResource(db)
+	resource.Resolver = staticResolver{
+		"example.com":          {{IP: net.ParseIP("93.184.216.34")}},
+		"hooks.example.org":    {{IP: net.ParseIP("93.184.216.35")}},
+		"internal.example.com": {{IP: net.ParseIP("10.0.0.5")}},
+	}
+
+	// Create test users
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "otheruser", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	var hook models.Webhook
+
+	t.Run("Create", func(t *testing.T) {
+		payload := models.Webhook{}
+		applyPatch(t, &payload, "webhooks", "", `{"url": "https://example.com/hooks", "events": ["document.*", "folder.moved"]}`)
+		resp, err := resource.Create(payload, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create webhook")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode(), "Expected status code 201")
+
+		hook = resp.Result().(models.Webhook)
+		assert.True(t, hook.Active, "Webhooks should be active by default")
+		assert.Equal(t, user.ID, hook.UserID, "Webhook should belong to the user")
+		assert.Len(t, hook.Secret, 43, "A secret should be generated and returned")
+		assert.Equal(t, []string{"document.*", "folder.moved"}, hook.Events, "Events should be stored")
+
+		var stored models.Webhook
+		require.NoError(t, db.First(&stored, "id = ?", hook.ID).Error, "Failed to find webhook")
+		assert.Equal(t, hook.Secret, stored.SigningSecret, "The secret should be stored for signing")
+		assert.Equal(t, []string{"document.*", "folder.moved"}, stored.Events, "Events should be stored")
+	})
+
+	t.Run("CreateWithSecret", func(t *testing.T) {
+		payload := models.Webhook{}
+		applyPatch(t, &payload, "webhooks", "", `{"url": "http://hooks.example.org:9000/", "secret": "a-long-enough-secret", "active": false}`)
+		resp, err := resource.Create(payload, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to create webhook")
+
+		created := resp.Result().(models.Webhook)
+		assert.Equal(t, "a-long-enough-secret", created.Secret, "The given secret should be used")
+		assert.False(t, created.Active, "Webhook should be created inactive")
+		assert.Equal(t, []string{}, created.Events, "No events should subscribe to all of them")
+	})
+
+	t.Run("CreateInvalid", func(t *testing.T) {
+		req := newRequest(user.ID, nil)
+		for _, payload := range []models.Webhook{
+			{URL: ""},
+			{URL: "example.com/hooks"},
+			{URL: "ftp://example.com/hooks"},
+			{URL: "https:///hooks"},
+			{URL: "http://localhost:9000/"},
+			{URL: "http://127.0.0.1:8080/"},
+			{URL: "http://10.0.0.1/"},
+			{URL: "http://169.254.169.254/latest/meta-data/"},
+			{URL: "http://[::1]/"},
+			{URL: "https://internal.example.com/hooks"},
+			{URL: "https://missing.example.com/hooks"},
+			{URL: "https://example.com", Events: []string{"document.archived"}},
+			{URL: "https://example.com", Events: []string{"[.created"}},
+			{URL: "https://example.com", Secret: "short"},
+		} {
+			_, err := resource.Create(payload, req)
+			assertHTTPStatus(t, err, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("FindOne", func(t *testing.T) {
+		resp, err := resource.FindOne(hook.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find webhook")
+		found := resp.Result().(models.Webhook)
+		assert.Equal(t, hook.URL, found.URL, "Expected the webhook")
+		assert.Empty(t, found.Secret, "The secret should not be returned again")
+
+		_, err = resource.FindOne(hook.ID.String(), newRequest(other.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		_, err = resource.FindOne("invalid", newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("FindAll", func(t *testing.T) {
+		resp, err := resource.FindAll(newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to find webhooks")
+		hooks := resp.Result().([]models.Webhook)
+		assert.Len(t, hooks, 2, "Expected the user's webhooks")
+		for _, found := range hooks {
+			assert.Empty(t, found.Secret, "Secrets should not be listed")
+		}
+
+		resp, err = resource.FindAll(newRequest(other.ID, nil))
+		require.NoError(t, err, "Failed to find webhooks")
+		assert.Empty(t, resp.Result().([]models.Webhook), "Expected no webhooks of other users")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		payload := models.Webhook{}
+		applyPatch(t, &payload, "webhooks", hook.ID.String(), `{"active": false, "events": null}`)
+		resp, err := resource.Update(payload, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to update webhook")
+		updated := resp.Result().(models.Webhook)
+		assert.False(t, updated.Active, "Webhook should be deactivated")
+		assert.Equal(t, []string{}, updated.Events, "Webhook should subscribe to every event")
+		assert.Equal(t, hook.URL, updated.URL, "URL should be kept")
+		assert.Empty(t, updated.Secret, "The secret should not be returned unless rotated")
+
+		_, err = resource.Update(payload, newRequest(other.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		payload = models.Webhook{}
+		applyPatch(t, &payload, "webhooks", hook.ID.String(), `{"url": "mailto:someone@example.com"}`)
+		_, err = resource.Update(payload, newRequest(user.ID, nil))
+		assertHTTPStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("RotateSecret", func(t *testing.T) {
+		payload := models.Webhook{}
+		applyPatch(t, &payload, "webhooks", hook.ID.String(), `{"secret": ""}`)
+		resp, err := resource.Update(payload, newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to rotate secret")
+		rotated := resp.Result().(models.Webhook)
+		assert.Len(t, rotated.Secret, 43, "A new secret should be generated and returned")
+		assert.NotEqual(t, hook.Secret, rotated.Secret, "The secret should change")
+
+		var stored models.Webhook
+		require.NoError(t, db.First(&stored, "id = ?", hook.ID).Error, "Failed to find webhook")
+		assert.Equal(t, rotated.Secret, stored.SigningSecret, "The new secret should be stored")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		event, err := models.NewEvent(models.EventCreated, user, user.ID, nil)
+		require.NoError(t, err, "Failed to create event")
+		require.NoError(t, db.Create(&event).Error, "Failed to record event")
+		delivery := models.WebhookDelivery{WebhookID: hook.ID, EventID: event.ID, EventType: event.Type, Status: models.DeliveryPending}
+		require.NoError(t, db.Create(&delivery).Error, "Failed to create delivery")
+
+		_, err = resource.Delete(hook.ID.String(), newRequest(other.ID, nil))
+		assertHTTPStatus(t, err, http.StatusNotFound)
+
+		resp, err := resource.Delete(hook.ID.String(), newRequest(user.ID, nil))
+		require.NoError(t, err, "Failed to delete webhook")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode(), "Expected status code 204")
+
+		var count int64
+		db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", hook.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Deliveries should be deleted along with the webhook")
+	})
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	// Serve the resources through api2go, which adds the deliveries route of
+	// webhooks, along with the retry route
+	api := api2go.NewAPI("v1")
+	api.AddResource(models.Webhook{}, NewWebhookResource(db))
+	api.AddResource(models.WebhookDelivery{}, NewWebhookDeliveryResource(db))
+	NewWebhookDeliveryHandler(db).Register(api.Router(), "/v1")
+
+	// Create test users with a webhook each and an event
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	other := models.User{Username: "otheruser", Email: "other@example.com"}
+	require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+
+	hook := models.Webhook{UserID: user.ID, URL: "https://example.com/a", Active: true, SigningSecret: "secret"}
+	require.NoError(t, db.Create(&hook).Error, "Failed to create webhook")
+	second := models.Webhook{UserID: user.ID, URL: "https://example.com/b", Active: true, SigningSecret: "secret"}
+	require.NoError(t, db.Create(&second).Error, "Failed to create webhook")
+	otherHook := models.Webhook{UserID: other.ID, URL: "https://example.com/c", Active: true, SigningSecret: "secret"}
+	require.NoError(t, db.Create(&otherHook).Error, "Failed to create webhook")
+
+	event, err := models.NewEvent(models.EventCreated, user, user.ID, nil)
+	require.NoError(t, err, "Failed to create event")
+	require.NoError(t, db.Create(&event).Error, "Failed to record event")
+
+	// Record a dead and a succeeded delivery for the first webhook, a pending
+	// one for the second, and one for the other user's webhook
+	now := time.Now()
+	status := http.StatusInternalServerError
+	dead := models.WebhookDelivery{WebhookID: hook.ID, EventID: event.ID, EventType: event.Type, Status: models.DeliveryDead, Attempts: 8, ResponseStatus: &status, LastError: "unexpected status 500"}
+	require.NoError(t, db.Create(&dead).Error, "Failed to create delivery")
+	succeeded := models.WebhookDelivery{WebhookID: hook.ID, EventID: event.ID, EventType: event.Type, Status: models.DeliverySucceeded, Attempts: 1, DeliveredAt: &now}
+	require.NoError(t, db.Create(&succeeded).Error, "Failed to create delivery")
+	pending := models.WebhookDelivery{WebhookID: second.ID, EventID: event.ID, EventType: event.Type, Status: models.DeliveryPending, NextAttemptAt: &now}
+	require.NoError(t, db.Create(&pending).Error, "Failed to create delivery")
+	foreign := models.WebhookDelivery{WebhookID: otherHook.ID, EventID: event.ID, EventType: event.Type, Status: models.DeliveryDead}
+	require.NoError(t, db.Create(&foreign).Error, "Failed to create delivery")
+
+	type resourceObject struct {
+		Type       string                 `json:"type"`
+		ID         string                 `json:"id"`
+		Attributes map[string]interface{} `json:"attributes"`
+	}
+
+	serve := func(method, path string, userID uuid.UUID) (int, []resourceObject) {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		api.Handler().ServeHTTP(rec, req)
+
+		var response struct {
+			Data json.RawMessage `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response), "Failed to decode response")
+		var objects []resourceObject
+		if len(response.Data) > 0 && response.Data[0] == '[' {
+			require.NoError(t, json.Unmarshal(response.Data, &objects), "Failed to decode data")
+		} else if len(response.Data) > 0 && response.Data[0] == '{' {
+			var object resourceObject
+			require.NoError(t, json.Unmarshal(response.Data, &object), "Failed to decode data")
+			objects = append(objects, object)
+		}
+		return rec.Code, objects
+	}
+
+	ids := func(objects []resourceObject) []string {
+		result := make([]string, 0, len(objects))
+		for _, object := range objects {
+			result = append(result, object.ID)
+		}
+		return result
+	}
+
+	t.Run("List", func(t *testing.T) {
+		code, objects := serve(http.MethodGet, "/v1/webhookDeliveries", user.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{pending.ID.String(), succeeded.ID.String(), dead.ID.String()}, ids(objects), "Expected the user's deliveries, newest first")
+		assert.Equal(t, "webhookDeliveries", objects[0].Type, "Expected the deliveries' type")
+		assert.Equal(t, "unexpected status 500", objects[2].Attributes["last_error"], "Expected the cause of the failure")
+		assert.Equal(t, float64(500), objects[2].Attributes["response_status"], "Expected the response status")
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		code, objects := serve(http.MethodGet, "/v1/webhookDeliveries?filter[status]=dead", user.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{dead.ID.String()}, ids(objects), "Expected the dead delivery")
+
+		code, objects = serve(http.MethodGet, "/v1/webhookDeliveries?filter[webhook_id]="+second.ID.String(), user.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{pending.ID.String()}, ids(objects), "Expected the second webhook's delivery")
+
+		code, _ = serve(http.MethodGet, "/v1/webhookDeliveries?filter[status]=lost", user.ID)
+		assert.Equal(t, http.StatusBadRequest, code, "Expected an unknown status to be rejected")
+
+		code, _ = serve(http.MethodGet, "/v1/webhookDeliveries?filter[webhook_id]="+otherHook.ID.String(), user.ID)
+		assert.Equal(t, http.StatusNotFound, code, "Expected the other user's webhook to be hidden")
+	})
+
+	t.Run("WebhookDeliveries", func(t *testing.T) {
+		code, objects := serve(http.MethodGet, "/v1/webhooks/"+hook.ID.String()+"/deliveries", user.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		assert.Equal(t, []string{succeeded.ID.String(), dead.ID.String()}, ids(objects), "Expected the webhook's deliveries")
+
+		code, _ = serve(http.MethodGet, "/v1/webhooks/"+otherHook.ID.String()+"/deliveries", user.ID)
+		assert.Equal(t, http.StatusNotFound, code, "Expected the other user's webhook to be hidden")
+	})
+
+	t.Run("FindOne", func(t *testing.T) {
+		code, objects := serve(http.MethodGet, "/v1/webhookDeliveries/"+dead.ID.String(), user.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		require.Len(t, objects, 1, "Expected the delivery")
+		assert.Equal(t, "dead", objects[0].Attributes["status"], "Expected the delivery's status")
+
+		code, _ = serve(http.MethodGet, "/v1/webhookDeliveries/"+foreign.ID.String(), user.ID)
+		assert.Equal(t, http.StatusNotFound, code, "Expected the other user's delivery to be hidden")
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		code, _ := serve(http.MethodDelete, "/v1/webhookDeliveries/"+dead.ID.String(), user.ID)
+		assert.Equal(t, http.StatusMethodNotAllowed, code, "Expected deliveries not to be deletable")
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		code, objects := serve(http.MethodPost, "/v1/webhookDeliveries/"+dead.ID.String()+"/retry", user.ID)
+		require.Equal(t, http.StatusOK, code, "Expected status code 200")
+		require.Len(t, objects, 1, "Expected the delivery")
+		assert.Equal(t, "pending", objects[0].Attributes["status"], "Expected the delivery to be pending again")
+		assert.Equal(t, float64(0), objects[0].Attributes["attempts"], "Expected a fresh set of attempts")
+
+		var stored models.WebhookDelivery
+		require.NoError(t, db.First(&stored, "id = ?", dead.ID).Error, "Failed to find delivery")
+		require.NotNil(t, stored.NextAttemptAt, "Expected the next attempt to be scheduled")
+		assert.False(t, stored.NextAttemptAt.After(time.Now()), "Expected the next attempt to be due")
+
+		code, _ = serve(http.MethodPost, "/v1/webhookDeliveries/"+dead.ID.String()+"/retry", user.ID)
+		assert.Equal(t, http.StatusConflict, code, "Expected a pending delivery not to be retried")
+
+		code, _ = serve(http.MethodPost, "/v1/webhookDeliveries/"+succeeded.ID.String()+"/retry", user.ID)
+		assert.Equal(t, http.StatusConflict, code, "Expected a succeeded delivery not to be retried")
+
+		code, _ = serve(http.MethodPost, "/v1/webhookDeliveries/"+foreign.ID.String()+"/retry", user.ID)
+		assert.Equal(t, http.StatusNotFound, code, "Expected the other user's delivery to be hidden")
+	})
+}
+
+// staticResolver resolves hosts from a map
+type staticResolver map[string][]net.IPAddr
+
+func (r staticResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if addrs, ok := r[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
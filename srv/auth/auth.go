@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"srv/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// MinPasswordLength is the minimum accepted length of a user password
+const MinPasswordLength = 8
+
+var (
+	// ErrInvalidCredentials is returned when a username/password pair does not match
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidToken is returned when a bearer token is unknown or expired
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrPasswordTooShort is returned when a password is shorter than MinPasswordLength
+	ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+)
+
+// Service issues and validates bearer tokens for users
+type Service struct {
+	DB  *gorm.DB
+	TTL time.Duration
+}
+
+// NewService creates a new Service issuing tokens valid for ttl
+func NewService(db *gorm.DB, ttl time.Duration) *Service {
+	return &Service{
+		DB:  db,
+		TTL: ttl,
+	}
+}
+
+// HashPassword validates and hashes a plain text password
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Login verifies the given credentials and issues a new session
+func (s Service) Login(username, password string) (models.Session, error) {
+	var user models.User
+	if err := s.DB.First(&user, "username = ?", username).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.Session{}, ErrInvalidCredentials
+		}
+		return models.Session{}, err
+	}
+
+	if user.PasswordHash == "" {
+		return models.Session{}, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return models.Session{}, ErrInvalidCredentials
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	session := models.Session{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.TTL),
+	}
+	if err := s.DB.Create(&session).Error; err != nil {
+		return models.Session{}, err
+	}
+
+	logrus.WithField("user_id", user.ID).Info("Issued session")
+
+	session.Token = token
+	return session, nil
+}
+
+// Authenticate resolves a bearer token to the ID of the user it was issued to
+func (s Service) Authenticate(token string) (uuid.UUID, error) {
+	var session models.Session
+	if err := s.DB.First(&session, "token_hash = ?", hashToken(token)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return uuid.Nil, ErrInvalidToken
+		}
+		return uuid.Nil, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return uuid.Nil, ErrInvalidToken
+	}
+
+	// Tokens of deleted users are no longer valid
+	var user models.User
+	if err := s.DB.First(&user, "id = ?", session.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return uuid.Nil, ErrInvalidToken
+		}
+		return uuid.Nil, err
+	}
+
+	return session.UserID, nil
+}
+
+// Logout revokes the given bearer token
+func (s Service) Logout(token string) error {
+	return s.DB.Where("token_hash = ?", hashToken(token)).Delete(&models.Session{}).Error
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header value
+func BearerToken(header string) (string, bool) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(header[len(prefix):])
+	return token, token != ""
+}
+
+// generateToken creates a random URL-safe token
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex encoded SHA-256 of a token, which is what gets stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
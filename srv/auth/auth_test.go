@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"srv/database"
+	"srv/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	service := NewService(db, time.Hour)
+
+	// Create a test user with a password
+	passwordHash, err := HashPassword("password123")
+	require.NoError(t, err, "Failed to hash password")
+	user := models.User{
+		Username:     "testuser",
+		Email:        "test@example.com",
+		PasswordHash: passwordHash,
+	}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	session, err := service.Login("testuser", "password123")
+	require.NoError(t, err, "Failed to log in")
+
+	// The wrapped handler echoes the authenticated user
+	var seen uuid.UUID
+	handler := Middleware(service, func(r *http.Request) bool {
+		return r.URL.Path == "/public"
+	}, func(r *http.Request) bool {
+		return r.URL.Path == "/stream"
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = UserIDFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(path, authorization string) int {
+		seen = uuid.Nil
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("MissingToken", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("/private", ""), "Expected status code 401")
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("/private", "Bearer invalid"), "Expected status code 401")
+	})
+
+	t.Run("ValidToken", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("/private", "Bearer "+session.Token), "Expected status code 200")
+		assert.Equal(t, user.ID, seen, "Expected user ID in request context")
+	})
+
+	t.Run("TokenParameter", func(t *testing.T) {
+		// Only the allowed routes may pass the token as a parameter, whatever
+		// the request's headers
+		req := httptest.NewRequest(http.MethodGet, "/private?access_token="+session.Token, nil)
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Accept", "text/event-stream")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Expected status code 401")
+
+		seen = uuid.Nil
+		req = httptest.NewRequest(http.MethodGet, "/stream?access_token="+session.Token, nil)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected status code 200")
+		assert.Equal(t, user.ID, seen, "Expected user ID in request context")
+	})
+
+	t.Run("PublicRoute", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("/public", ""), "Expected status code 200")
+		assert.Equal(t, uuid.Nil, seen, "Expected no user ID in request context")
+	})
+
+	t.Run("ExpiredToken", func(t *testing.T) {
+		require.NoError(t, db.Model(&models.Session{}).Where("id = ?", session.ID).
+			Update("expires_at", time.Now().Add(-time.Minute)).Error, "Failed to expire session")
+		assert.Equal(t, http.StatusUnauthorized, serve("/private", "Bearer "+session.Token), "Expected status code 401")
+	})
+}
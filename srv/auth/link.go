@@ -0,0 +1,23 @@
+package auth
+
+import "golang.org/x/crypto/bcrypt"
+
+// NewLinkToken creates a random token for a public share link along with the
+// hash that gets stored in its place
+func NewLinkToken() (token, hash string, err error) {
+	token, err = generateToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, hashToken(token), nil
+}
+
+// HashLinkToken returns the stored hash of a public share link token
+func HashLinkToken(token string) string {
+	return hashToken(token)
+}
+
+// CheckPassword reports whether password matches a hash created by HashPassword
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type contextKey string
+
+const userIDKey contextKey = "user_id"
+
+// WithUserID returns a copy of ctx carrying the authenticated user ID
+func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the authenticated user ID stored in ctx
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userIDKey).(uuid.UUID)
+	return userID, ok && userID != uuid.Nil
+}
+
+// Middleware authenticates every request with a bearer token, except those
+// for which public returns true, and stores the user ID in the request context.
+// Browsers can't set headers on WebSocket connections or EventSource streams,
+// so the requests for which tokenParameter returns true may pass the token in
+// the access_token parameter instead. Tokens in URLs end up in logs, so only
+// the routes that browsers can't reach otherwise should allow it.
+func Middleware(service *Service, public, tokenParameter func(r *http.Request) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if public != nil && public(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := BearerToken(r.Header.Get("Authorization"))
+		if !ok && tokenParameter != nil && tokenParameter(r) {
+			token = r.URL.Query().Get("access_token")
+			ok = token != ""
+		}
+		if !ok {
+			logrus.WithField("path", r.URL.Path).Warn("Missing bearer token")
+			writeUnauthorized(w, "Authentication required")
+			return
+		}
+
+		userID, err := service.Authenticate(token)
+		if err != nil {
+			if err != ErrInvalidToken {
+				logrus.WithError(err).Error("Failed to authenticate token")
+			}
+			writeUnauthorized(w, "Invalid or expired token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithUserID(r.Context(), userID)))
+	})
+}
+
+// writeUnauthorized writes a JSON:API error document with status 401
+func writeUnauthorized(w http.ResponseWriter, title string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"errors": []map[string]string{
+			{"status": strconv.Itoa(http.StatusUnauthorized), "title": title},
+		},
+	})
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write(body)
+}
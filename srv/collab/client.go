@@ -0,0 +1,130 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"srv/ot"
+
+	"github.com/google/uuid"
+)
+
+// Types of the messages exchanged with clients. Clients send operation and
+// cursor messages; the server sends all of them.
+const (
+	MessageInit      = "init"
+	MessageOperation = "operation"
+	MessageAck       = "ack"
+	MessageCursor    = "cursor"
+	MessageJoin      = "join"
+	MessageLeave     = "leave"
+	MessageError     = "error"
+	MessagePing      = "ping"
+)
+
+// clientBuffer is the number of messages waiting for a client before the
+// client is considered too slow and removed from its session
+const clientBuffer = 256
+
+var (
+	// ErrInvalidMessage is returned for a message that can't be decoded or
+	// lacks the fields of its type
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrReadOnly is returned for operations of clients that may only view
+	// the document
+	ErrReadOnly = errors.New("only editors can change the document")
+	// ErrUnknownRevision is returned for operations based on a revision the
+	// session doesn't know, after which the client must join again
+	ErrUnknownRevision = errors.New("unknown revision, join the session again")
+	// ErrInvalidOperation is returned for operations that don't fit the
+	// content at their revision
+	ErrInvalidOperation = errors.New("operation doesn't fit the content")
+)
+
+// Cursor is the selection of a participant, from anchor to head. Both are
+// positions in code points, and equal for a plain cursor.
+type Cursor struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// Participant is a client taking part in a session, as shown to the others
+type Participant struct {
+	ClientID string    `json:"client_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	CanEdit  bool      `json:"can_edit"`
+	Cursor   *Cursor   `json:"cursor,omitempty"`
+}
+
+// Message is a message exchanged with a client. Revisions count the
+// operations applied since the session started.
+//
+//   - init: sent when joining, with the client's ID, the revision, the
+//     content and the participants
+//   - operation: sent by an editor, with the revision it is based on and the
+//     operation; sent to the others with the revision it created and the
+//     author's client ID, which is missing for changes saved outside the
+//     session
+//   - ack: sent to the author of an operation, with the revision it created
+//   - cursor: sent by a participant, and to the others with its client ID;
+//     a missing cursor clears it
+//   - join and leave: sent when a participant joins, or leaves by client ID
+//   - error: sent for a message that was rejected
+//   - ping: sent by transports to keep idle connections open
+type Message struct {
+	Type         string        `json:"type"`
+	ClientID     string        `json:"client_id,omitempty"`
+	Revision     *int          `json:"revision,omitempty"`
+	Operation    *ot.Operation `json:"operation,omitempty"`
+	Content      *string       `json:"content,omitempty"`
+	Cursor       *Cursor       `json:"cursor,omitempty"`
+	Participant  *Participant  `json:"participant,omitempty"`
+	Participants []Participant `json:"participants,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Client is a participant's connection to a session. Messages delivers what
+// is sent to the client, and is closed when the client leaves, is removed for
+// falling behind, or the session ends.
+type Client struct {
+	Participant
+	Messages <-chan Message
+
+	session  *session
+	messages chan Message
+	removed  bool
+}
+
+// Handle handles a message sent by the client. A rejected message is answered
+// with an error message, and its error is returned.
+func (c *Client) Handle(data []byte) error {
+	s := c.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.removed {
+		return nil
+	}
+
+	var message Message
+	var err error
+	switch {
+	case json.Unmarshal(data, &message) != nil:
+		err = ErrInvalidMessage
+	case message.Type == MessageOperation && message.Revision != nil && message.Operation != nil:
+		err = s.edit(c, *message.Revision, *message.Operation)
+	case message.Type == MessageCursor:
+		s.moveCursor(c, message.Cursor)
+	default:
+		err = ErrInvalidMessage
+	}
+
+	if err != nil {
+		s.send(c, Message{Type: MessageError, Error: err.Error()})
+	}
+	return err
+}
+
+// Leave removes the client from its session
+func (c *Client) Leave() {
+	c.session.hub.leave(c)
+}
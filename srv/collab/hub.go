@@ -0,0 +1,128 @@
+// Package collab runs collaborative editing sessions, in which several
+// clients edit the content of a document at once. Edits are operations of the
+// ot package: a session puts them in order, transforms those based on an
+// outdated revision against the ones applied since, and sends them to the
+// other clients. The content is saved back to the document periodically and
+// when the last client leaves.
+package collab
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrNotFound is returned by a Store for a document that doesn't exist
+	ErrNotFound = errors.New("document not found")
+	// ErrConflict is returned by a Store when a document no longer has the
+	// version its content was saved over
+	ErrConflict = errors.New("document was modified concurrently")
+)
+
+// Snapshot is the content of a document at one of its versions
+type Snapshot struct {
+	Content string
+	Version int
+}
+
+// Store loads and saves the documents edited in sessions
+type Store interface {
+	// Load returns the current content and version of a document
+	Load(documentID uuid.UUID) (Snapshot, error)
+	// Save replaces the content of a document on behalf of an actor, provided
+	// the document still has the snapshot's version, and returns its new
+	// version
+	Save(documentID uuid.UUID, snapshot Snapshot, actorID uuid.UUID) (int, error)
+}
+
+// Hub runs a session for every document being edited. Sessions live in
+// memory, so all clients editing a document must connect to the same hub.
+type Hub struct {
+	Store            Store
+	SnapshotInterval time.Duration
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*session
+}
+
+// NewHub creates a hub saving the content of its sessions to store every
+// snapshotInterval
+func NewHub(store Store, snapshotInterval time.Duration) *Hub {
+	return &Hub{
+		Store:            store,
+		SnapshotInterval: snapshotInterval,
+		sessions:         map[uuid.UUID]*session{},
+	}
+}
+
+// Join adds a participant to the session of a document, starting the session
+// if there is none. The client's first message describes the session.
+func (h *Hub) Join(documentID uuid.UUID, participant Participant) (*Client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.sessions[documentID]
+	if !ok {
+		snapshot, err := h.Store.Load(documentID)
+		if err != nil {
+			return nil, err
+		}
+		s = newSession(h, documentID, snapshot)
+		h.sessions[documentID] = s
+		go s.run(h.SnapshotInterval)
+		logrus.WithField("document_id", documentID).Info("Started collaborative editing session")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.join(participant), nil
+}
+
+// leave removes a client from its session. The last client leaving ends the
+// session, saving its content first.
+func (h *Hub) leave(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := c.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(c)
+	if s.closed || len(s.clients) > 0 {
+		return
+	}
+	if err := s.snapshot(); err != nil {
+		logrus.WithError(err).WithField("document_id", s.documentID).Error("Failed to save collaborative edits")
+	}
+	h.close(s)
+}
+
+// end ends a session right away, disconnecting its clients
+func (h *Hub) end(s *session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	for len(s.clients) > 0 {
+		s.remove(s.clients[0])
+	}
+	h.close(s)
+}
+
+// close stops a session and forgets it. The caller holds the locks of both.
+func (h *Hub) close(s *session) {
+	s.closed = true
+	close(s.done)
+	if h.sessions[s.documentID] == s {
+		delete(h.sessions, s.documentID)
+	}
+	logrus.WithField("document_id", s.documentID).Info("Ended collaborative editing session")
+}
@@ -0,0 +1,319 @@
+package collab
+
+import (
+	"errors"
+	"srv/ot"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxHistory is the number of operations kept to transform operations
+	// based on older revisions. Half of them are dropped when it is exceeded.
+	maxHistory = 1000
+	// maxSaveAttempts is the number of times a snapshot is saved, merging the
+	// document's changes in between, before giving up until the next one
+	maxSaveAttempts = 3
+)
+
+// session is the editing session of a document. Besides the current content,
+// it keeps the content last saved to or loaded from the store, the shadow,
+// and the operation turning the shadow into the current content, the bridge.
+// Changes saved outside the session are merged by transforming the change
+// from the shadow to the stored content against the bridge.
+type session struct {
+	hub        *Hub
+	documentID uuid.UUID
+	done       chan struct{}
+
+	// The fields below are guarded by mu
+	mu           sync.Mutex
+	content      string
+	revision     int
+	history      []ot.Operation
+	historyStart int
+	clients      []*Client
+	shadow       string
+	version      int
+	bridge       ot.Operation
+	lastEditor   uuid.UUID
+	closed       bool
+}
+
+// newSession creates the session of a document with the given content
+func newSession(hub *Hub, documentID uuid.UUID, snapshot Snapshot) *session {
+	return &session{
+		hub:        hub,
+		documentID: documentID,
+		done:       make(chan struct{}),
+		content:    snapshot.Content,
+		shadow:     snapshot.Content,
+		version:    snapshot.Version,
+		bridge:     identity(snapshot.Content),
+	}
+}
+
+// run saves the session's content, or merges the changes saved outside the
+// session, every interval until the session ends. The session is ended when
+// its document is deleted.
+func (s *session) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		err := s.sync()
+		s.mu.Unlock()
+		if errors.Is(err, ErrNotFound) {
+			logrus.WithField("document_id", s.documentID).Warn("Document of collaborative editing session was deleted")
+			s.hub.end(s)
+			return
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("document_id", s.documentID).Error("Failed to sync collaborative editing session")
+		}
+	}
+}
+
+// sync saves the content if it changed, and otherwise merges the changes
+// saved outside the session since it was last synced
+func (s *session) sync() error {
+	if s.closed {
+		return nil
+	}
+	if s.content != s.shadow {
+		return s.snapshot()
+	}
+
+	current, err := s.hub.Store.Load(s.documentID)
+	if err != nil {
+		return err
+	}
+	if current.Version == s.version {
+		return nil
+	}
+	return s.merge(current)
+}
+
+// snapshot saves the content if it changed. If the document was modified in
+// the meantime, its changes are merged and saving is retried.
+func (s *session) snapshot() error {
+	for attempt := 1; s.content != s.shadow; attempt++ {
+		version, err := s.hub.Store.Save(s.documentID, Snapshot{Content: s.content, Version: s.version}, s.lastEditor)
+		if err == nil {
+			s.shadow = s.content
+			s.version = version
+			s.bridge = identity(s.content)
+			return nil
+		}
+		if !errors.Is(err, ErrConflict) || attempt == maxSaveAttempts {
+			return err
+		}
+
+		current, err := s.hub.Store.Load(s.documentID)
+		if err != nil {
+			return err
+		}
+		if err := s.merge(current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge applies the changes made to the document outside the session, which
+// turned the shadow into the current snapshot
+func (s *session) merge(current Snapshot) error {
+	external := ot.Diff(s.shadow, current.Content)
+	external, bridge, err := ot.Transform(external, s.bridge)
+	if err != nil {
+		return err
+	}
+
+	s.shadow = current.Content
+	s.version = current.Version
+	s.bridge = bridge
+	if external.IsNoop() {
+		return nil
+	}
+	logrus.WithFields(logrus.Fields{
+		"document_id": s.documentID,
+		"version":     current.Version,
+	}).Info("Merging changes into collaborative editing session")
+	return s.apply(nil, external)
+}
+
+// join adds a client for a participant and sends it the session's state
+func (s *session) join(participant Participant) *Client {
+	participant.ClientID = uuid.NewString()
+	participant.Cursor = nil
+	messages := make(chan Message, clientBuffer)
+	c := &Client{
+		Participant: participant,
+		Messages:    messages,
+		session:     s,
+		messages:    messages,
+	}
+
+	s.broadcast(Message{Type: MessageJoin, Participant: &participant}, nil)
+	s.clients = append(s.clients, c)
+
+	participants := make([]Participant, len(s.clients))
+	for i, client := range s.clients {
+		participants[i] = client.Participant
+	}
+	revision, content := s.revision, s.content
+	s.send(c, Message{
+		Type:         MessageInit,
+		ClientID:     c.ClientID,
+		Revision:     &revision,
+		Content:      &content,
+		Participants: participants,
+	})
+
+	logrus.WithFields(logrus.Fields{
+		"document_id": s.documentID,
+		"client_id":   c.ClientID,
+		"user_id":     c.UserID,
+	}).Info("Joined collaborative editing session")
+	return c
+}
+
+// remove removes a client from the session and tells the others
+func (s *session) remove(c *Client) {
+	if c.removed {
+		return
+	}
+	c.removed = true
+	close(c.messages)
+	for i, client := range s.clients {
+		if client == c {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			break
+		}
+	}
+	s.broadcast(Message{Type: MessageLeave, ClientID: c.ClientID}, nil)
+}
+
+// edit applies an operation of a client based on the given revision, after
+// transforming it against the operations applied since
+func (s *session) edit(c *Client, revision int, operation ot.Operation) error {
+	if !c.CanEdit {
+		return ErrReadOnly
+	}
+	if revision < s.historyStart || revision > s.revision {
+		return ErrUnknownRevision
+	}
+
+	for _, concurrent := range s.history[revision-s.historyStart:] {
+		var err error
+		if operation, _, err = ot.Transform(operation, concurrent); err != nil {
+			return ErrInvalidOperation
+		}
+	}
+	bridge, err := ot.Compose(s.bridge, operation)
+	if err != nil {
+		return ErrInvalidOperation
+	}
+	if err := s.apply(c, operation); err != nil {
+		return ErrInvalidOperation
+	}
+	s.bridge = bridge
+	s.lastEditor = c.UserID
+
+	revision = s.revision
+	s.send(c, Message{Type: MessageAck, Revision: &revision})
+	return nil
+}
+
+// apply applies an operation to the content, moves the cursors accordingly
+// and sends the operation to every client but its author, which is nil for
+// merged changes
+func (s *session) apply(author *Client, operation ot.Operation) error {
+	content, err := operation.Apply(s.content)
+	if err != nil {
+		return err
+	}
+	s.content = content
+	s.revision++
+	s.history = append(s.history, operation)
+	if len(s.history) > maxHistory {
+		dropped := len(s.history) / 2
+		s.history = append([]ot.Operation(nil), s.history[dropped:]...)
+		s.historyStart += dropped
+	}
+
+	// Cursors are replaced rather than changed, as messages may share them
+	for _, c := range s.clients {
+		if c.Cursor != nil {
+			c.Cursor = &Cursor{
+				Anchor: ot.TransformIndex(c.Cursor.Anchor, operation),
+				Head:   ot.TransformIndex(c.Cursor.Head, operation),
+			}
+		}
+	}
+
+	revision := s.revision
+	message := Message{Type: MessageOperation, Revision: &revision, Operation: &operation}
+	if author != nil {
+		message.ClientID = author.ClientID
+	}
+	s.broadcast(message, author)
+	return nil
+}
+
+// moveCursor sets the cursor of a client and tells the others. Cursors may be
+// based on an older revision, so they are clamped to the content.
+func (s *session) moveCursor(c *Client, cursor *Cursor) {
+	if cursor != nil {
+		length := utf8.RuneCountInString(s.content)
+		cursor = &Cursor{
+			Anchor: min(max(cursor.Anchor, 0), length),
+			Head:   min(max(cursor.Head, 0), length),
+		}
+	}
+	c.Cursor = cursor
+	s.broadcast(Message{Type: MessageCursor, ClientID: c.ClientID, Cursor: cursor}, c)
+}
+
+// broadcast sends a message to every client except one
+func (s *session) broadcast(message Message, except *Client) {
+	for _, c := range append([]*Client(nil), s.clients...) {
+		if c != except {
+			s.send(c, message)
+		}
+	}
+}
+
+// send sends a message to a client without blocking, removing the client if
+// it has fallen too far behind
+func (s *session) send(c *Client, message Message) {
+	if c.removed {
+		return
+	}
+	select {
+	case c.messages <- message:
+	default:
+		logrus.WithFields(logrus.Fields{
+			"document_id": s.documentID,
+			"client_id":   c.ClientID,
+		}).Warn("Collaborative editing client fell behind")
+		s.remove(c)
+	}
+}
+
+// identity returns the operation leaving text unchanged
+func identity(text string) ot.Operation {
+	var operation ot.Operation
+	operation.Retain(utf8.RuneCountInString(text))
+	return operation
+}
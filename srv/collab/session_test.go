@@ -0,0 +1,340 @@
+package collab
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps documents in memory and records who saved them
+type memoryStore struct {
+	mu        sync.Mutex
+	documents map[uuid.UUID]Snapshot
+	actors    []uuid.UUID
+}
+
+func (m *memoryStore) Load(documentID uuid.UUID) (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot, ok := m.documents[documentID]
+	if !ok {
+		return Snapshot{}, ErrNotFound
+	}
+	return snapshot, nil
+}
+
+func (m *memoryStore) Save(documentID uuid.UUID, snapshot Snapshot, actorID uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.documents[documentID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if current.Version != snapshot.Version {
+		return 0, ErrConflict
+	}
+	m.documents[documentID] = Snapshot{Content: snapshot.Content, Version: current.Version + 1}
+	m.actors = append(m.actors, actorID)
+	return current.Version + 1, nil
+}
+
+// set changes a document as if it was saved outside the session
+func (m *memoryStore) set(documentID uuid.UUID, content string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.documents[documentID] = Snapshot{Content: content, Version: m.documents[documentID].Version + 1}
+}
+
+func (m *memoryStore) get(documentID uuid.UUID) Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.documents[documentID]
+}
+
+func TestSession(t *testing.T) {
+	alice := Participant{UserID: uuid.New(), Username: "alice", CanEdit: true}
+	bob := Participant{UserID: uuid.New(), Username: "bob", CanEdit: true}
+	carol := Participant{UserID: uuid.New(), Username: "carol"}
+
+	// setup creates a hub whose sessions aren't synced in the background
+	// unless an interval is given, with a document containing content
+	setup := func(t *testing.T, content string, interval time.Duration) (*Hub, *memoryStore, uuid.UUID) {
+		documentID := uuid.New()
+		store := &memoryStore{documents: map[uuid.UUID]Snapshot{documentID: {Content: content, Version: 1}}}
+		if interval == 0 {
+			interval = time.Hour
+		}
+		return NewHub(store, interval), store, documentID
+	}
+	join := func(t *testing.T, hub *Hub, documentID uuid.UUID, participant Participant) *Client {
+		client, err := hub.Join(documentID, participant)
+		require.NoError(t, err, "Failed to join session")
+		return client
+	}
+	// next returns the next message sent to a client
+	next := func(t *testing.T, client *Client) Message {
+		select {
+		case message, ok := <-client.Messages:
+			require.True(t, ok, "Expected the client to be connected")
+			return message
+		case <-time.After(time.Second):
+			require.FailNow(t, "Expected a message")
+			return Message{}
+		}
+	}
+	// edit sends an operation given in the ot.js format
+	edit := func(client *Client, revision int, operation string) error {
+		return client.Handle([]byte(fmt.Sprintf(`{"type": "operation", "revision": %d, "operation": %s}`, revision, operation)))
+	}
+	content := func(hub *Hub, documentID uuid.UUID) string {
+		hub.mu.Lock()
+		s := hub.sessions[documentID]
+		hub.mu.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.content
+	}
+	// closed reports whether a client was disconnected after the messages
+	// waiting for it
+	closed := func(client *Client) bool {
+		for {
+			select {
+			case _, ok := <-client.Messages:
+				if !ok {
+					return true
+				}
+			case <-time.After(time.Second):
+				return false
+			}
+		}
+	}
+
+	t.Run("Join", func(t *testing.T) {
+		hub, _, documentID := setup(t, "Hello", 0)
+		first := join(t, hub, documentID, alice)
+		init := next(t, first)
+		assert.Equal(t, MessageInit, init.Type, "Expected the session's state first")
+		assert.Equal(t, first.ClientID, init.ClientID, "Expected the client's ID")
+		assert.Equal(t, "Hello", *init.Content, "Expected the document's content")
+		assert.Equal(t, 0, *init.Revision, "Expected the first revision")
+		assert.Len(t, init.Participants, 1, "Expected the client as the only participant")
+
+		second := join(t, hub, documentID, bob)
+		init = next(t, second)
+		require.Len(t, init.Participants, 2, "Expected both participants")
+		assert.Equal(t, "alice", init.Participants[0].Username, "Expected the first participant")
+		assert.Equal(t, "bob", init.Participants[1].Username, "Expected the joining participant")
+		joined := next(t, first)
+		assert.Equal(t, MessageJoin, joined.Type, "Expected the others to learn about the participant")
+		assert.Equal(t, second.ClientID, joined.Participant.ClientID, "Expected the joining participant")
+
+		second.Leave()
+		left := next(t, first)
+		assert.Equal(t, MessageLeave, left.Type, "Expected the others to learn about the leave")
+		assert.Equal(t, second.ClientID, left.ClientID, "Expected the leaving client's ID")
+		assert.True(t, closed(second), "Expected the client to be disconnected")
+		first.Leave()
+	})
+
+	t.Run("ConcurrentEdits", func(t *testing.T) {
+		hub, _, documentID := setup(t, "world", 0)
+		first := join(t, hub, documentID, alice)
+		second := join(t, hub, documentID, bob)
+		next(t, first)
+		next(t, first)
+		next(t, second)
+
+		// Both edit revision 0, and the second operation is transformed
+		require.NoError(t, edit(first, 0, `["Hello ", 5]`), "Failed to edit")
+		require.NoError(t, edit(second, 0, `[5, "!"]`), "Failed to edit")
+		assert.Equal(t, "Hello world!", content(hub, documentID), "Expected both edits")
+
+		ack := next(t, first)
+		assert.Equal(t, MessageAck, ack.Type, "Expected the first edit to be acknowledged")
+		assert.Equal(t, 1, *ack.Revision, "Expected the revision of the first edit")
+		operation := next(t, first)
+		assert.Equal(t, MessageOperation, operation.Type, "Expected the second edit")
+		assert.Equal(t, second.ClientID, operation.ClientID, "Expected the second edit's author")
+		assert.Equal(t, 2, *operation.Revision, "Expected the revision of the second edit")
+		data, _ := json.Marshal(operation.Operation)
+		assert.JSONEq(t, `[11, "!"]`, string(data), "Expected the transformed operation")
+
+		operation = next(t, second)
+		data, _ = json.Marshal(operation.Operation)
+		assert.JSONEq(t, `["Hello ", 5]`, string(data), "Expected the first edit as it was")
+		assert.Equal(t, 2, *next(t, second).Revision, "Expected the second edit to be acknowledged")
+
+		first.Leave()
+		second.Leave()
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		hub, _, documentID := setup(t, "Hello", 0)
+		viewer := join(t, hub, documentID, carol)
+		editor := join(t, hub, documentID, alice)
+		next(t, viewer)
+		next(t, viewer)
+		next(t, editor)
+
+		assert.ErrorIs(t, edit(viewer, 0, `[5, "!"]`), ErrReadOnly, "Expected viewers not to edit")
+		rejection := next(t, viewer)
+		assert.Equal(t, MessageError, rejection.Type, "Expected an error message")
+		assert.Equal(t, ErrReadOnly.Error(), rejection.Error, "Expected the reason")
+
+		assert.ErrorIs(t, edit(editor, 1, `[5, "!"]`), ErrUnknownRevision, "Expected a future revision to be rejected")
+		assert.ErrorIs(t, edit(editor, 0, `[4, "!"]`), ErrInvalidOperation, "Expected an operation of the wrong length to be rejected")
+		assert.ErrorIs(t, editor.Handle([]byte(`{"type": "operation"}`)), ErrInvalidMessage, "Expected an incomplete message to be rejected")
+		assert.ErrorIs(t, editor.Handle([]byte(`{"type": "save"}`)), ErrInvalidMessage, "Expected an unknown message to be rejected")
+		assert.ErrorIs(t, editor.Handle([]byte(`not json`)), ErrInvalidMessage, "Expected invalid JSON to be rejected")
+		assert.Equal(t, "Hello", content(hub, documentID), "Expected the content to be unchanged")
+
+		viewer.Leave()
+		editor.Leave()
+	})
+
+	t.Run("Cursors", func(t *testing.T) {
+		hub, _, documentID := setup(t, "Hello world", 0)
+		viewer := join(t, hub, documentID, carol)
+		editor := join(t, hub, documentID, alice)
+		next(t, viewer)
+		next(t, viewer)
+		next(t, editor)
+
+		// Viewers share their cursors too, clamped to the content
+		require.NoError(t, viewer.Handle([]byte(`{"type": "cursor", "cursor": {"anchor": 6, "head": 20}}`)), "Failed to move cursor")
+		moved := next(t, editor)
+		assert.Equal(t, MessageCursor, moved.Type, "Expected the cursor")
+		assert.Equal(t, viewer.ClientID, moved.ClientID, "Expected the cursor's client")
+		assert.Equal(t, Cursor{Anchor: 6, Head: 11}, *moved.Cursor, "Expected the clamped cursor")
+
+		// Cursors follow the edits, and joining clients see them
+		require.NoError(t, edit(editor, 0, `["Oh, ", 11]`), "Failed to edit")
+		init := next(t, join(t, hub, documentID, bob))
+		require.Len(t, init.Participants, 3, "Expected every participant")
+		assert.Equal(t, Cursor{Anchor: 10, Head: 15}, *init.Participants[0].Cursor, "Expected the moved cursor")
+		assert.Nil(t, init.Participants[1].Cursor, "Expected no cursor for the editor")
+
+		require.NoError(t, viewer.Handle([]byte(`{"type": "cursor"}`)), "Failed to clear cursor")
+		assert.Equal(t, MessageAck, next(t, editor).Type, "Expected the edit to be acknowledged")
+		assert.Equal(t, MessageJoin, next(t, editor).Type, "Expected the joining participant")
+		cleared := next(t, editor)
+		assert.Equal(t, MessageCursor, cleared.Type, "Expected the cursor")
+		assert.Nil(t, cleared.Cursor, "Expected the cursor to be cleared")
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		hub, store, documentID := setup(t, "Hello", 0)
+		first := join(t, hub, documentID, alice)
+		second := join(t, hub, documentID, bob)
+		require.NoError(t, edit(second, 0, `[5, " world"]`), "Failed to edit")
+
+		// The content is saved when the last client leaves, on behalf of the
+		// last editor
+		first.Leave()
+		assert.Equal(t, 1, store.get(documentID).Version, "Expected nothing to be saved while a client remains")
+		second.Leave()
+		assert.Equal(t, Snapshot{Content: "Hello world", Version: 2}, store.get(documentID), "Expected the content to be saved")
+		assert.Equal(t, []uuid.UUID{bob.UserID}, store.actors, "Expected the last editor to save the content")
+		assert.Empty(t, hub.sessions, "Expected the session to end")
+
+		// The next session starts from the saved content
+		third := join(t, hub, documentID, alice)
+		assert.Equal(t, "Hello world", *next(t, third).Content, "Expected the saved content")
+		third.Leave()
+		assert.Len(t, store.actors, 1, "Expected nothing to be saved without changes")
+	})
+
+	t.Run("Periodic", func(t *testing.T) {
+		hub, store, documentID := setup(t, "Hello", 10*time.Millisecond)
+		client := join(t, hub, documentID, alice)
+		require.NoError(t, edit(client, 0, `[5, "!"]`), "Failed to edit")
+		assert.Eventually(t, func() bool {
+			return store.get(documentID).Content == "Hello!"
+		}, time.Second, 10*time.Millisecond, "Expected the content to be saved while editing")
+
+		// Changes saved outside the session are merged while nobody edits
+		next(t, client)
+		next(t, client)
+		store.set(documentID, "Oh, Hello!")
+		operation := next(t, client)
+		assert.Equal(t, MessageOperation, operation.Type, "Expected the change to be sent")
+		assert.Empty(t, operation.ClientID, "Expected the change not to have an author")
+		assert.Equal(t, "Oh, Hello!", content(hub, documentID), "Expected the change to be merged")
+		client.Leave()
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		hub, store, documentID := setup(t, "The quick fox", 0)
+		client := join(t, hub, documentID, alice)
+		next(t, client)
+		require.NoError(t, edit(client, 0, `[4, "very ", 9]`), "Failed to edit")
+		next(t, client)
+
+		// The document is changed outside the session before it is saved
+		store.set(documentID, "The quick brown fox")
+		hub.mu.Lock()
+		s := hub.sessions[documentID]
+		hub.mu.Unlock()
+		s.mu.Lock()
+		err := s.snapshot()
+		s.mu.Unlock()
+		require.NoError(t, err, "Failed to save content")
+
+		assert.Equal(t, Snapshot{Content: "The very quick brown fox", Version: 3}, store.get(documentID), "Expected both changes to be saved")
+		operation := next(t, client)
+		data, _ := json.Marshal(operation.Operation)
+		assert.JSONEq(t, `[15, "brown ", 3]`, string(data), "Expected the external change to be sent")
+
+		// Later edits build on the merged content
+		require.NoError(t, edit(client, 2, `[24, "!"]`), "Failed to edit")
+		store.set(documentID, "The very quick brown fox jumps")
+		s.mu.Lock()
+		err = s.snapshot()
+		s.mu.Unlock()
+		require.NoError(t, err, "Failed to save content")
+		assert.Equal(t, "The very quick brown fox jumps!", store.get(documentID).Content, "Expected the change's text before the edit's at the same position")
+		client.Leave()
+	})
+
+	t.Run("DeletedDocument", func(t *testing.T) {
+		hub, store, documentID := setup(t, "Hello", 10*time.Millisecond)
+		client := join(t, hub, documentID, alice)
+		store.mu.Lock()
+		delete(store.documents, documentID)
+		store.mu.Unlock()
+
+		assert.True(t, closed(client), "Expected the client to be disconnected")
+		client.Leave()
+
+		_, err := hub.Join(documentID, alice)
+		assert.ErrorIs(t, err, ErrNotFound, "Expected the deleted document not to be found")
+	})
+
+	t.Run("SlowClient", func(t *testing.T) {
+		hub, _, documentID := setup(t, "a", 0)
+		slow := join(t, hub, documentID, bob)
+		editor := join(t, hub, documentID, alice)
+		next(t, editor)
+		var left bool
+		for revision := 0; revision < clientBuffer; revision++ {
+			require.NoError(t, edit(editor, revision, fmt.Sprintf(`[%d, "a"]`, revision+1)), "Failed to edit")
+			for len(editor.Messages) > 0 {
+				if next(t, editor).Type == MessageLeave {
+					left = true
+				}
+			}
+		}
+
+		// The slow client is removed once its buffer is full
+		assert.True(t, closed(slow), "Expected the slow client to be disconnected")
+		assert.True(t, left, "Expected the others to learn about the leave")
+		slow.Leave()
+		editor.Leave()
+	})
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"srv/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SharedFolderIDs returns a subquery selecting the IDs of the non-deleted
+// folders shared with a user, either directly or through one of their
+// ancestors
+func SharedFolderIDs(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE shared(id, depth) AS (
+		SELECT folders.id, 0 FROM folders JOIN shares ON shares.folder_id = folders.id
+		WHERE shares.user_id = ? AND folders.deleted_at IS NULL
+		UNION ALL
+		SELECT folders.id, shared.depth + 1 FROM folders JOIN shared ON folders.parent_id = shared.id
+		WHERE folders.deleted_at IS NULL AND shared.depth < ?
+	) SELECT id FROM shared`, userID, maxFolderDepth)
+}
+
+// sharedFolderIDsWithDeleted returns a subquery selecting the IDs of the
+// folders shared with a user like SharedFolderIDs, deleted ones included
+func sharedFolderIDsWithDeleted(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE shared(id, depth) AS (
+		SELECT folders.id, 0 FROM folders JOIN shares ON shares.folder_id = folders.id
+		WHERE shares.user_id = ?
+		UNION ALL
+		SELECT folders.id, shared.depth + 1 FROM folders JOIN shared ON folders.parent_id = shared.id
+		WHERE shared.depth < ?
+	) SELECT id FROM shared`, userID, maxFolderDepth)
+}
+
+// sharedDocumentIDs returns a subquery selecting the IDs of the documents
+// shared with a user on their own
+func sharedDocumentIDs(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Model(&models.Share{}).Select("document_id").Where("user_id = ? AND document_id IS NOT NULL", userID)
+}
+
+// AccessibleDocuments returns a scope restricting a query to the documents a
+// user owns or has been granted any role on
+func AccessibleDocuments(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		sub := db.Session(&gorm.Session{NewDB: true})
+		return db.Where("(documents.user_id = ? OR documents.id IN (?) OR documents.folder_id IN (?))",
+			userID, sharedDocumentIDs(sub, userID), SharedFolderIDs(sub, userID))
+	}
+}
+
+// AccessibleFolders returns a scope restricting a query to the folders a user
+// owns or has been granted any role on
+func AccessibleFolders(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		sub := db.Session(&gorm.Session{NewDB: true})
+		return db.Where("(folders.user_id = ? OR folders.id IN (?))", userID, SharedFolderIDs(sub, userID))
+	}
+}
+
+// VisibleEvents returns a scope restricting a query to the events of the
+// folders and documents a user owns or has been granted any role on. Deleted
+// items count too, so that collaborators learn about deletions.
+func VisibleEvents(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		sub := db.Session(&gorm.Session{NewDB: true})
+		documents := sub.Unscoped().Model(&models.Document{}).Select("id").
+			Where("id IN (?) OR folder_id IN (?)", sharedDocumentIDs(sub, userID), sharedFolderIDsWithDeleted(sub, userID))
+		return db.Where("events.resource_type IN ?", []string{"folder", "document"}).
+			Where(`(events.user_id = ? OR (events.resource_type = 'folder' AND events.resource_id IN (?))
+				OR (events.resource_type = 'document' AND events.resource_id IN (?)))`,
+				userID, sharedFolderIDsWithDeleted(sub, userID), documents)
+	}
+}
+
+// DocumentRole returns the role a user holds on a document: owner for the
+// document's owner, otherwise the highest role shared with the user on the
+// document or on any folder containing it. It returns "" without access.
+func DocumentRole(db *gorm.DB, userID uuid.UUID, document models.Document) (string, error) {
+	if document.UserID == userID {
+		return models.RoleOwner, nil
+	}
+
+	query := db.Model(&models.Share{}).Where("user_id = ?", userID)
+	if document.FolderID != nil {
+		query = query.Where("(document_id = ? OR folder_id IN (?))", document.ID, FolderAncestorIDs(db, *document.FolderID))
+	} else {
+		query = query.Where("document_id = ?", document.ID)
+	}
+	return highestRole(query)
+}
+
+// FolderRole returns the role a user holds on a folder: owner for the folder's
+// owner, otherwise the highest role shared with the user on the folder or on
+// any of its ancestors. It returns "" without access.
+func FolderRole(db *gorm.DB, userID uuid.UUID, folder models.Folder) (string, error) {
+	if folder.UserID == userID {
+		return models.RoleOwner, nil
+	}
+
+	query := db.Model(&models.Share{}).Where("user_id = ? AND folder_id IN (?)", userID, FolderAncestorIDs(db, folder.ID))
+	return highestRole(query)
+}
+
+// highestRole returns the most privileged role among the shares of a query
+func highestRole(query *gorm.DB) (string, error) {
+	var roles []string
+	if err := query.Pluck("role", &roles).Error; err != nil {
+		return "", err
+	}
+
+	highest := ""
+	for _, role := range roles {
+		if !models.RoleAtLeast(highest, role) {
+			highest = role
+		}
+	}
+	return highest, nil
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ConstraintKind is the kind of a violated database constraint
+type ConstraintKind string
+
+const (
+	// ConstraintUnique is a unique constraint, index or primary key
+	ConstraintUnique ConstraintKind = "unique"
+	// ConstraintForeignKey is a foreign key
+	ConstraintForeignKey ConstraintKind = "foreign_key"
+	// ConstraintNotNull is a NOT NULL column
+	ConstraintNotNull ConstraintKind = "not_null"
+	// ConstraintCheck is a CHECK constraint
+	ConstraintCheck ConstraintKind = "check"
+)
+
+// ConstraintError is a constraint violation reported by Postgres or SQLite
+type ConstraintError struct {
+	Kind ConstraintKind
+	// Table is the table of the violating row, if the database reports it.
+	// SQLite doesn't for foreign keys.
+	Table string
+	Err   error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// postgresConstraintKinds maps Postgres error codes of integrity constraint
+// violations to their kind
+var postgresConstraintKinds = map[string]ConstraintKind{
+	"23505": ConstraintUnique,
+	"23503": ConstraintForeignKey,
+	"23502": ConstraintNotNull,
+	"23514": ConstraintCheck,
+}
+
+// sqliteConstraintKinds maps SQLite extended error codes of constraint
+// violations to their kind
+var sqliteConstraintKinds = map[sqlite3.ErrNoExtended]ConstraintKind{
+	sqlite3.ErrConstraintUnique:     ConstraintUnique,
+	sqlite3.ErrConstraintPrimaryKey: ConstraintUnique,
+	sqlite3.ErrConstraintForeignKey: ConstraintForeignKey,
+	sqlite3.ErrConstraintNotNull:    ConstraintNotNull,
+	sqlite3.ErrConstraintCheck:      ConstraintCheck,
+}
+
+// AsConstraintError returns the constraint violation err reports, if any
+func AsConstraintError(err error) (*ConstraintError, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		kind, ok := postgresConstraintKinds[pgErr.Code]
+		if !ok {
+			return nil, false
+		}
+		return &ConstraintError{Kind: kind, Table: pgErr.TableName, Err: err}, true
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		kind, ok := sqliteConstraintKinds[sqliteErr.ExtendedCode]
+		if !ok {
+			return nil, false
+		}
+		return &ConstraintError{Kind: kind, Table: sqliteConstraintTable(sqliteErr.Error()), Err: err}, true
+	}
+
+	return nil, false
+}
+
+// sqliteIndexTables maps the unique indexes on expressions to their table, as
+// SQLite names the index rather than the columns when one is violated
+var sqliteIndexTables = map[string]string{
+	"idx_folders_parent_name": "folders",
+	"idx_folders_root_name":   "folders",
+}
+
+// sqliteConstraintTable extracts the table from SQLite messages such as
+// "UNIQUE constraint failed: folders.parent_id, folders.name" or, for indexes
+// on expressions, "UNIQUE constraint failed: index 'idx_folders_root_name'"
+func sqliteConstraintTable(message string) string {
+	_, columns, ok := strings.Cut(message, "failed: ")
+	if !ok {
+		return ""
+	}
+	if index, ok := strings.CutPrefix(columns, "index "); ok {
+		return sqliteIndexTables[strings.Trim(index, "'")]
+	}
+	table, _, ok := strings.Cut(columns, ".")
+	if !ok {
+		return ""
+	}
+	return table
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"errors"
+	"srv/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraints(t *testing.T) {
+	db := NewTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+	parent := models.Folder{Name: "Parent", UserID: user.ID}
+	require.NoError(t, db.Create(&parent).Error, "Failed to create folder")
+
+	t.Run("Unique", func(t *testing.T) {
+		err := db.Create(&models.User{Username: "testuser", Email: "other@example.com"}).Error
+		violation, ok := AsConstraintError(err)
+		require.True(t, ok, "Expected a constraint violation")
+		assert.Equal(t, ConstraintUnique, violation.Kind, "Expected a unique violation")
+		assert.Equal(t, "users", violation.Table, "Expected the table to be reported")
+	})
+
+	t.Run("ForeignKey", func(t *testing.T) {
+		err := db.Create(&models.Folder{Name: "Orphan", UserID: uuid.New()}).Error
+		violation, ok := AsConstraintError(err)
+		require.True(t, ok, "Expected a constraint violation")
+		assert.Equal(t, ConstraintForeignKey, violation.Kind, "Expected a foreign key violation")
+
+		missing := uuid.New()
+		err = db.Create(&models.Folder{Name: "Orphan", UserID: user.ID, ParentID: &missing}).Error
+		violation, ok = AsConstraintError(err)
+		require.True(t, ok, "Expected a constraint violation")
+		assert.Equal(t, ConstraintForeignKey, violation.Kind, "Expected a foreign key violation for the parent")
+	})
+
+	t.Run("NotNull", func(t *testing.T) {
+		err := db.Exec("INSERT INTO documents (id, user_id) VALUES (?, ?)", uuid.New(), user.ID).Error
+		violation, ok := AsConstraintError(err)
+		require.True(t, ok, "Expected a constraint violation")
+		assert.Equal(t, ConstraintNotNull, violation.Kind, "Expected a not null violation")
+		assert.Equal(t, "documents", violation.Table, "Expected the table to be reported")
+	})
+
+	t.Run("OtherErrors", func(t *testing.T) {
+		_, ok := AsConstraintError(errors.New("connection refused"))
+		assert.False(t, ok, "Expected other errors not to be constraint violations")
+		_, ok = AsConstraintError(db.Exec("SELECT * FROM missing").Error)
+		assert.False(t, ok, "Expected other database errors not to be constraint violations")
+	})
+
+	t.Run("SiblingFolderNames", func(t *testing.T) {
+		child := models.Folder{Name: "Child", UserID: user.ID, ParentID: &parent.ID}
+		require.NoError(t, db.Create(&child).Error, "Failed to create folder")
+
+		err := db.Create(&models.Folder{Name: "Child", UserID: user.ID, ParentID: &parent.ID}).Error
+		violation, ok := AsConstraintError(err)
+		require.True(t, ok, "Expected a sibling with the same name to be rejected")
+		assert.Equal(t, "folders", violation.Table, "Expected the table to be reported")
+
+		err = db.Create(&models.Folder{Name: "Parent", UserID: user.ID}).Error
+		_, ok = AsConstraintError(err)
+		assert.True(t, ok, "Expected a root folder with the same name to be rejected")
+
+		// Names are compared ignoring case, like the handlers do
+		err = db.Create(&models.Folder{Name: "CHILD", UserID: user.ID, ParentID: &parent.ID}).Error
+		violation, ok = AsConstraintError(err)
+		require.True(t, ok, "Expected a sibling with the name in another case to be rejected")
+		assert.Equal(t, "folders", violation.Table, "Expected the table to be reported")
+		err = db.Create(&models.Folder{Name: "parent", UserID: user.ID}).Error
+		_, ok = AsConstraintError(err)
+		assert.True(t, ok, "Expected a root folder with the name in another case to be rejected")
+
+		other := models.User{Username: "otheruser", Email: "other@example.com"}
+		require.NoError(t, db.Create(&other).Error, "Failed to create user")
+		assert.NoError(t, db.Create(&models.Folder{Name: "Parent", UserID: other.ID}).Error,
+			"Expected root folders of other users not to conflict")
+		assert.NoError(t, db.Create(&models.Folder{Name: "Child", UserID: user.ID}).Error,
+			"Expected folders with other parents not to conflict")
+
+		// Deleted folders don't take up their name
+		require.NoError(t, db.Delete(&child).Error, "Failed to delete folder")
+		assert.NoError(t, db.Create(&models.Folder{Name: "Child", UserID: user.ID, ParentID: &parent.ID}).Error,
+			"Expected the name of a deleted folder to be free")
+	})
+
+	t.Run("Cascades", func(t *testing.T) {
+		folder := models.Folder{Name: "Cascade", UserID: user.ID}
+		require.NoError(t, db.Create(&folder).Error, "Failed to create folder")
+		subfolder := models.Folder{Name: "Sub", UserID: user.ID, ParentID: &folder.ID}
+		require.NoError(t, db.Create(&subfolder).Error, "Failed to create subfolder")
+		document := models.Document{Title: "Doc", UserID: user.ID, FolderID: &folder.ID}
+		require.NoError(t, db.Create(&document).Error, "Failed to create document")
+		version := document.NewVersion(user.ID)
+		require.NoError(t, db.Create(&version).Error, "Failed to create document version")
+		share := models.Share{UserID: user.ID, OwnerID: user.ID, CreatedByID: user.ID, FolderID: &folder.ID, Role: models.RoleViewer}
+		require.NoError(t, db.Create(&share).Error, "Failed to create share")
+
+		require.NoError(t, db.Unscoped().Delete(&folder).Error, "Failed to delete folder")
+
+		var count int64
+		db.Model(&models.Share{}).Where("id = ?", share.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected shares of the folder to be deleted")
+		var dbFolder models.Folder
+		require.NoError(t, db.First(&dbFolder, "id = ?", subfolder.ID).Error, "Expected subfolder to be kept")
+		assert.Nil(t, dbFolder.ParentID, "Expected subfolder to be moved to the root")
+		var dbDocument models.Document
+		require.NoError(t, db.First(&dbDocument, "id = ?", document.ID).Error, "Expected document to be kept")
+		assert.Nil(t, dbDocument.FolderID, "Expected document to be moved to the root")
+
+		require.NoError(t, db.Unscoped().Delete(&document).Error, "Failed to delete document")
+		db.Model(&models.DocumentVersion{}).Where("document_id = ?", document.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "Expected versions of the document to be deleted")
+	})
+}
@@ -2,9 +2,8 @@ package database
 
 import (
 	"fmt"
-	"srv/models"
+	"strings"
 
-	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -20,14 +19,17 @@ type Config struct {
 	SSLMode  string
 }
 
-// NewConnection creates a new database connection
-func NewConnection(config *Config) (*gorm.DB, error) {
-	dsn := fmt.Sprintf(
+// DSN returns the connection string of the configured Postgres database
+func (c *Config) DSN() string {
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode,
+		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode,
 	)
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// NewConnection creates a new database connection
+func NewConnection(config *Config) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(config.DSN()), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
@@ -35,32 +37,18 @@ func NewConnection(config *Config) (*gorm.DB, error) {
 	return db, nil
 }
 
-// NewSQLiteConnection creates a new SQLite database connection for testing
+// NewSQLiteConnection creates a new SQLite database connection for testing.
+// Foreign keys are enforced, which SQLite doesn't do by default.
 func NewSQLiteConnection(dbPath string) (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
-	if err != nil {
-		return nil, err
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
 	}
 
-	return db, nil
-}
-
-// MigrateDB performs database migration
-func MigrateDB(db *gorm.DB) error {
-	logrus.Info("Running database migrations")
-
-	// Auto migrate the models
-	err := db.AutoMigrate(
-		&models.User{},
-		&models.Folder{},
-		&models.Document{},
-	)
-
+	db, err := gorm.Open(sqlite.Open(dbPath+separator+"_foreign_keys=1"), &gorm.Config{})
 	if err != nil {
-		logrus.WithError(err).Error("Failed to migrate database")
-		return err
+		return nil, err
 	}
 
-	logrus.Info("Database migration completed successfully")
-	return nil
+	return db, nil
 }
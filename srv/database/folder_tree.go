@@ -0,0 +1,94 @@
+package database
+
+import (
+	"srv/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxFolderDepth bounds the recursive walks of the folder hierarchy, so that a
+// cycle in the stored parent IDs can't keep a query running
+const maxFolderDepth = 1000
+
+// FolderSubtreeIDs returns a subquery selecting the ID of a folder and of all of
+// its non-deleted descendants. The recursive CTE works on Postgres and SQLite.
+func FolderSubtreeIDs(db *gorm.DB, folderID interface{}) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE subtree(id, depth) AS (
+		SELECT id, 0 FROM folders WHERE id = ? AND deleted_at IS NULL
+		UNION ALL
+		SELECT folders.id, subtree.depth + 1 FROM folders JOIN subtree ON folders.parent_id = subtree.id
+		WHERE folders.deleted_at IS NULL AND subtree.depth < ?
+	) SELECT id FROM subtree`, folderID, maxFolderDepth)
+}
+
+// DeletedFolderSubtreeIDs returns a subquery selecting the ID of a deleted folder
+// and of all of its descendants that were deleted together with it.
+func DeletedFolderSubtreeIDs(db *gorm.DB, folderID interface{}, deletedAt time.Time) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE subtree(id, depth) AS (
+		SELECT id, 0 FROM folders WHERE id = ?
+		UNION ALL
+		SELECT folders.id, subtree.depth + 1 FROM folders JOIN subtree ON folders.parent_id = subtree.id
+		WHERE folders.deleted_at = ? AND subtree.depth < ?
+	) SELECT id FROM subtree`, folderID, deletedAt, maxFolderDepth)
+}
+
+// FolderAncestorIDs returns a subquery selecting the ID of a folder and of all of
+// its ancestors up to the root
+func FolderAncestorIDs(db *gorm.DB, folderID interface{}) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+		SELECT id, parent_id, 0 FROM folders WHERE id = ?
+		UNION ALL
+		SELECT folders.id, folders.parent_id, ancestors.depth + 1 FROM folders JOIN ancestors ON folders.id = ancestors.parent_id
+		WHERE ancestors.depth < ?
+	) SELECT id FROM ancestors`, folderID, maxFolderDepth)
+}
+
+// TreeFolder is a folder within a subtree along with its depth below the
+// subtree's root, where the root's direct children have depth 1
+type TreeFolder struct {
+	models.Folder
+	Depth int
+}
+
+// FolderTree loads the non-deleted folders below a folder of the given user, or
+// below the user's root when parentID is nil, ordered by depth and name. A
+// positive maxDepth limits how many levels are loaded.
+func FolderTree(db *gorm.DB, userID uuid.UUID, parentID *uuid.UUID, maxDepth int) ([]TreeFolder, error) {
+	start := "parent_id IS NULL"
+	args := []interface{}{userID}
+	if parentID != nil {
+		start = "parent_id = ?"
+		args = append(args, *parentID)
+	}
+
+	if maxDepth <= 0 || maxDepth > maxFolderDepth {
+		maxDepth = maxFolderDepth
+	}
+	args = append(args, maxDepth)
+
+	var folders []TreeFolder
+	err := db.Raw(`WITH RECURSIVE tree(id, depth) AS (
+		SELECT id, 1 FROM folders WHERE user_id = ? AND `+start+` AND deleted_at IS NULL
+		UNION ALL
+		SELECT folders.id, tree.depth + 1 FROM folders JOIN tree ON folders.parent_id = tree.id
+		WHERE folders.deleted_at IS NULL AND tree.depth < ?
+	) SELECT folders.*, tree.depth FROM folders JOIN tree ON folders.id = tree.id
+	ORDER BY tree.depth, folders.name, folders.id`, args...).Scan(&folders).Error
+	return folders, err
+}
+
+// FolderAncestors loads a non-deleted folder and all of its ancestors, ordered
+// from the root down to the folder itself
+func FolderAncestors(db *gorm.DB, folderID uuid.UUID) ([]models.Folder, error) {
+	var folders []models.Folder
+	err := db.Raw(`WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+		SELECT id, parent_id, 0 FROM folders WHERE id = ? AND deleted_at IS NULL
+		UNION ALL
+		SELECT folders.id, folders.parent_id, ancestors.depth + 1 FROM folders JOIN ancestors ON folders.id = ancestors.parent_id
+		WHERE folders.deleted_at IS NULL AND ancestors.depth < ?
+	) SELECT folders.* FROM folders JOIN ancestors ON folders.id = ancestors.id
+	ORDER BY ancestors.depth DESC`, folderID, maxFolderDepth).Scan(&folders).Error
+	return folders, err
+}
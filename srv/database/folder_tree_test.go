@@ -0,0 +1,53 @@
+package database
+
+import (
+	"srv/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolderTree(t *testing.T) {
+	db := NewTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	owner := models.User{Username: "owner", Email: "owner@example.com"}
+	require.NoError(t, db.Create(&owner).Error, "Failed to create owner")
+	viewer := models.User{Username: "viewer", Email: "viewer@example.com"}
+	require.NoError(t, db.Create(&viewer).Error, "Failed to create viewer")
+
+	// Corrupt the hierarchy into a cycle: a -> b -> c -> a
+	a := models.Folder{Name: "A", UserID: owner.ID}
+	require.NoError(t, db.Create(&a).Error, "Failed to create folder")
+	b := models.Folder{Name: "B", UserID: owner.ID, ParentID: &a.ID}
+	require.NoError(t, db.Create(&b).Error, "Failed to create folder")
+	c := models.Folder{Name: "C", UserID: owner.ID, ParentID: &b.ID}
+	require.NoError(t, db.Create(&c).Error, "Failed to create folder")
+	require.NoError(t, db.Model(&models.Folder{}).Where("id = ?", a.ID).Update("parent_id", c.ID).Error, "Failed to create cycle")
+	share := models.Share{UserID: viewer.ID, FolderID: &a.ID, Role: models.RoleViewer, OwnerID: owner.ID, CreatedByID: owner.ID}
+	require.NoError(t, db.Create(&share).Error, "Failed to create share")
+
+	// count runs a subquery selecting folder IDs and returns how many folders
+	// it selected. A walk that doesn't stop at the cycle never returns.
+	count := func(t *testing.T, sub interface{}) int64 {
+		var count int64
+		require.NoError(t, db.Unscoped().Model(&models.Folder{}).Where("id IN (?)", sub).Count(&count).Error, "Failed to walk folders")
+		return count
+	}
+
+	t.Run("Cycle", func(t *testing.T) {
+		assert.Equal(t, int64(3), count(t, FolderSubtreeIDs(db, a.ID)), "Expected the subtree to stop at the depth bound")
+		assert.Equal(t, int64(3), count(t, FolderAncestorIDs(db, a.ID)), "Expected the ancestors to stop at the depth bound")
+		assert.Equal(t, int64(3), count(t, SharedFolderIDs(db, viewer.ID)), "Expected the shared folders to stop at the depth bound")
+
+		folders, err := FolderTree(db, owner.ID, &a.ID, 0)
+		require.NoError(t, err, "Failed to load tree")
+		assert.Len(t, folders, maxFolderDepth, "Expected the tree to stop at the depth bound")
+
+		deletedAt := time.Now()
+		require.NoError(t, db.Model(&models.Folder{}).Where("id IN ?", []interface{}{a.ID, b.ID, c.ID}).Update("deleted_at", deletedAt).Error, "Failed to delete folders")
+		assert.Equal(t, int64(3), count(t, DeletedFolderSubtreeIDs(db, a.ID, deletedAt)), "Expected the deleted subtree to stop at the depth bound")
+	})
+}
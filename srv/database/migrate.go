@@ -0,0 +1,389 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds the SQL migrations of every supported dialect, in a
+// directory per dialect named after the GORM dialector
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFilePattern matches migration file names such as
+// 0001_initial_schema.up.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLockID is the key of the Postgres advisory lock taken by migrations
+const migrationLockID = 4127336461
+
+// schemaMigrationsTable creates the table recording applied migrations
+var schemaMigrationsTable = map[string]string{
+	"postgres": `CREATE TABLE IF NOT EXISTS "schema_migrations" (
+		"version" bigint PRIMARY KEY,
+		"name" varchar(255) NOT NULL,
+		"checksum" varchar(64) NOT NULL,
+		"applied_at" timestamptz NOT NULL
+	)`,
+	"sqlite": "CREATE TABLE IF NOT EXISTS `schema_migrations` (" +
+		"`version` integer PRIMARY KEY," +
+		"`name` text NOT NULL," +
+		"`checksum` text NOT NULL," +
+		"`applied_at` datetime NOT NULL)",
+}
+
+// ErrMigrationModified is returned when the script of an applied migration no
+// longer matches the checksum recorded when it was applied
+var ErrMigrationModified = errors.New("applied migration has been modified")
+
+// Migration is a versioned schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the hex encoded SHA-256 of the up script
+	Checksum string
+}
+
+// String returns the file name prefix of the migration
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// MigrationStatus describes whether a migration has been applied to a database
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Modified is set if the up script changed after the migration was applied
+	Modified bool
+	// Unknown is set if an applied migration has no script in this build,
+	// typically because the database was migrated by a newer release
+	Unknown bool
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// TableName overrides the pluralized table name GORM would use
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// LoadMigrations returns the migrations of a dialect ordered by version
+func LoadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q: %w", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by %q and %q", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+			sum := sha256.Sum256(data)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down script", migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateDB applies all pending migrations. It is run on every start of the
+// service, so deployments don't need a separate migration step.
+func MigrateDB(db *gorm.DB) error {
+	logrus.Info("Running database migrations")
+
+	applied, err := MigrateUp(db)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to migrate database")
+		return err
+	}
+
+	logrus.WithField("applied", len(applied)).Info("Database migration completed successfully")
+	return nil
+}
+
+// MigrateUp applies all pending migrations in order, each in its own
+// transaction, and returns the applied migrations. It refuses to run if an
+// applied migration has been modified since.
+func MigrateUp(db *gorm.DB) ([]Migration, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		if row, ok := applied[migration.Version]; ok && row.Checksum != migration.Checksum {
+			return nil, fmt.Errorf("%w: %s", ErrMigrationModified, migration)
+		}
+	}
+	for version, row := range applied {
+		if !known[version] {
+			logrus.WithFields(logrus.Fields{"version": version, "name": row.Name}).
+				Warn("Database has a migration applied that is unknown to this build")
+		}
+	}
+
+	var done []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		ran := false
+		err := migrationTransaction(db, func(tx *gorm.DB) error {
+			// Another instance may have applied it while we waited for the lock
+			var count int64
+			if err := tx.Model(&schemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Checksum:  migration.Checksum,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s: %w", migration, err)
+		}
+		if ran {
+			logrus.WithField("migration", migration.String()).Info("Applied migration")
+			done = append(done, migration)
+		}
+	}
+
+	return done, nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations,
+// newest first, and returns the reverted migrations
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	var done []Migration
+	for _, version := range versions {
+		migration, ok := byVersion[version]
+		if !ok {
+			return done, fmt.Errorf("migration %04d_%s is unknown to this build and can't be reverted", version, applied[version].Name)
+		}
+		if applied[version].Checksum != migration.Checksum {
+			return done, fmt.Errorf("%w: %s", ErrMigrationModified, migration)
+		}
+
+		ran := false
+		err := migrationTransaction(db, func(tx *gorm.DB) error {
+			result := tx.Where("version = ?", version).Delete(&schemaMigration{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				// Already reverted by another instance
+				return nil
+			}
+
+			ran = true
+			return tx.Exec(migration.Down).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s: %w", migration, err)
+		}
+		if ran {
+			logrus.WithField("migration", migration.String()).Info("Reverted migration")
+			done = append(done, migration)
+		}
+	}
+
+	return done, nil
+}
+
+// MigrationStatuses returns the status of every migration known to this build
+// or applied to the database, ordered by version
+func MigrationStatuses(db *gorm.DB) ([]MigrationStatus, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+			status.Modified = row.Checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:   row.Version,
+			Name:      row.Name,
+			AppliedAt: &appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// loadMigrationState returns the migrations of the database's dialect and the
+// applied ones by version, creating the schema_migrations table if needed
+func loadMigrationState(db *gorm.DB) ([]Migration, map[int]schemaMigration, error) {
+	dialect := db.Dialector.Name()
+	migrations, err := LoadMigrations(dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := db.Exec(schemaMigrationsTable[dialect]).Error; err != nil {
+		return nil, nil, err
+	}
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	return migrations, applied, nil
+}
+
+// migrationTransaction runs fn in a transaction. On Postgres the transaction
+// holds an advisory lock, so instances starting at the same time don't run
+// migrations concurrently. SQLite serializes writing transactions already, but
+// can only change constraints by rebuilding tables, which foreign keys
+// referencing them prevent; enforcement is suspended for the transaction and
+// all foreign keys are checked before it commits instead.
+func migrationTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() != "sqlite" {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+				return err
+			}
+			return fn(tx)
+		})
+	}
+
+	// The pragma is a no-op within transactions and applies to a single
+	// connection, so pin one
+	return db.Connection(func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{NewDB: true})
+		var enforced bool
+		if err := conn.Raw("PRAGMA foreign_keys").Row().Scan(&enforced); err != nil {
+			return err
+		}
+		if enforced {
+			if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+				return err
+			}
+			defer conn.Exec("PRAGMA foreign_keys = ON")
+		}
+
+		return conn.Transaction(func(tx *gorm.DB) error {
+			if err := fn(tx); err != nil {
+				return err
+			}
+			rows, err := tx.Raw("PRAGMA foreign_key_check").Rows()
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			if rows.Next() {
+				var table, parent string
+				var rowID sql.NullInt64
+				var index int
+				if err := rows.Scan(&table, &rowID, &parent, &index); err != nil {
+					return err
+				}
+				return fmt.Errorf("foreign key of %s referencing %s violated", table, parent)
+			}
+			return rows.Err()
+		})
+	})
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"path/filepath"
+	"srv/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newMigrationTestDB creates an empty SQLite database in a temporary file, so
+// every connection of the pool sees the same schema
+func newMigrationTestDB(t *testing.T) *gorm.DB {
+	db, err := NewSQLiteConnection(filepath.Join(t.TempDir(), "migrations.db"))
+	require.NoError(t, err, "Failed to connect to test database")
+	t.Cleanup(func() { CleanupTestDB(t, db) })
+	return db
+}
+
+// assertSchemaMatchesModels checks that every table and column GORM expects
+// for the models exists in db
+func assertSchemaMatchesModels(t *testing.T, db *gorm.DB) {
+	allModels := []interface{}{
+		&models.User{},
+		&models.Tag{},
+		&models.Folder{},
+		&models.Document{},
+		&models.Session{},
+		&models.DocumentVersion{},
+		&models.Attachment{},
+		&models.Share{},
+		&models.ShareLink{},
+		&models.Event{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.AuditEntry{},
+	}
+	for _, model := range allModels {
+		stmt := &gorm.Statement{DB: db}
+		require.NoError(t, stmt.Parse(model), "Failed to parse model")
+		assert.True(t, db.Migrator().HasTable(stmt.Schema.Table), "Table %s should exist", stmt.Schema.Table)
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			assert.True(t, db.Migrator().HasColumn(stmt.Schema.Table, field.DBName),
+				"Column %s.%s should exist", stmt.Schema.Table, field.DBName)
+		}
+	}
+	for _, table := range []string{"document_tags", "folder_tags"} {
+		assert.True(t, db.Migrator().HasTable(table), "Join table %s should exist", table)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	postgres, err := LoadMigrations("postgres")
+	require.NoError(t, err, "Failed to load Postgres migrations")
+	sqlite, err := LoadMigrations("sqlite")
+	require.NoError(t, err, "Failed to load SQLite migrations")
+
+	t.Run("Ordered", func(t *testing.T) {
+		require.NotEmpty(t, sqlite, "There should be migrations")
+		for i, migration := range sqlite {
+			assert.NotEmpty(t, migration.Up, "Migration %s should have an up script", migration)
+			assert.NotEmpty(t, migration.Down, "Migration %s should have a down script", migration)
+			assert.Len(t, migration.Checksum, 64, "Migration %s should have a SHA-256 checksum", migration)
+			if i > 0 {
+				assert.Greater(t, migration.Version, sqlite[i-1].Version, "Migrations should be ordered by version")
+			}
+		}
+	})
+
+	t.Run("DialectsInStep", func(t *testing.T) {
+		require.Len(t, postgres, len(sqlite), "Both dialects should have the same number of migrations")
+		for i := range sqlite {
+			assert.Equal(t, sqlite[i].String(), postgres[i].String(), "Both dialects should have the same migrations")
+		}
+	})
+
+	t.Run("UnknownDialect", func(t *testing.T) {
+		_, err := LoadMigrations("mysql")
+		assert.Error(t, err, "Loading migrations of an unsupported dialect should fail")
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := LoadMigrations("sqlite")
+	require.NoError(t, err, "Failed to load migrations")
+
+	t.Run("UpAndDown", func(t *testing.T) {
+		db := newMigrationTestDB(t)
+
+		applied, err := MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations")
+		assert.Len(t, applied, len(migrations), "Every migration should be applied")
+		assertSchemaMatchesModels(t, db)
+
+		applied, err = MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations again")
+		assert.Empty(t, applied, "No migration should be applied twice")
+
+		// Revert one migration at a time, newest first
+		for i := len(migrations) - 1; i >= 0; i-- {
+			reverted, err := MigrateDown(db, 1)
+			require.NoError(t, err, "Failed to revert migration %s", migrations[i])
+			require.Len(t, reverted, 1, "One migration should be reverted")
+			assert.Equal(t, migrations[i].Version, reverted[0].Version, "The newest migration should be reverted")
+		}
+
+		reverted, err := MigrateDown(db, 1)
+		require.NoError(t, err, "Reverting without applied migrations should succeed")
+		assert.Empty(t, reverted, "Nothing should be reverted")
+
+		tables, err := db.Migrator().GetTables()
+		require.NoError(t, err, "Failed to list tables")
+		assert.Equal(t, []string{"schema_migrations"}, tables, "Only the migrations table should be left")
+
+		// Every migration must be re-applicable after being reverted
+		applied, err = MigrateUp(db)
+		require.NoError(t, err, "Failed to re-apply migrations")
+		assert.Len(t, applied, len(migrations), "Every migration should be re-applied")
+		assertSchemaMatchesModels(t, db)
+	})
+
+	t.Run("DownSteps", func(t *testing.T) {
+		db := newMigrationTestDB(t)
+		_, err := MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations")
+
+		reverted, err := MigrateDown(db, len(migrations)+1)
+		require.NoError(t, err, "Failed to revert migrations")
+		require.Len(t, reverted, len(migrations), "Every applied migration should be reverted")
+		assert.Equal(t, migrations[len(migrations)-1].Version, reverted[0].Version, "The newest migration should be reverted first")
+	})
+
+	t.Run("RenamesDuplicateSiblingFolders", func(t *testing.T) {
+		db := newMigrationTestDB(t)
+		_, err := MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations")
+
+		// Revert to just before the unique sibling names, with rows inserted
+		// by plain SQL as later migrations may have changed the models
+		steps := 1
+		for migrations[len(migrations)-steps].Name != "foreign_keys_and_sibling_names" {
+			steps++
+		}
+		_, err = MigrateDown(db, steps)
+		require.NoError(t, err, "Failed to revert migrations")
+
+		userID, firstID, secondID := uuid.New(), uuid.New(), uuid.New()
+		now := time.Now()
+		require.NoError(t, db.Exec("INSERT INTO users (id, username, email) VALUES (?, 'testuser', 'test@example.com')", userID).Error,
+			"Failed to create user")
+		for _, id := range []uuid.UUID{firstID, secondID} {
+			now = now.Add(time.Second)
+			require.NoError(t, db.Exec("INSERT INTO folders (id, name, user_id, created_at) VALUES (?, 'Archive', ?, ?)", id, userID, now).Error,
+				"Failed to create folder")
+		}
+
+		_, err = MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations with duplicate folder names")
+
+		var first, second models.Folder
+		require.NoError(t, db.First(&first, "id = ?", firstID).Error, "Failed to find folder")
+		assert.Equal(t, "Archive", first.Name, "Expected the oldest folder to keep its name")
+		require.NoError(t, db.First(&second, "id = ?", secondID).Error, "Failed to find folder")
+		assert.Equal(t, "Archive ("+secondID.String()[:8]+")", second.Name, "Expected the duplicate to be renamed")
+	})
+
+	t.Run("RenamesSiblingFoldersDifferingInCase", func(t *testing.T) {
+		db := newMigrationTestDB(t)
+		_, err := MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations")
+
+		steps := 1
+		for migrations[len(migrations)-steps].Name != "case_insensitive_sibling_names" {
+			steps++
+		}
+		_, err = MigrateDown(db, steps)
+		require.NoError(t, err, "Failed to revert migrations")
+
+		userID, firstID, secondID := uuid.New(), uuid.New(), uuid.New()
+		now := time.Now()
+		require.NoError(t, db.Exec("INSERT INTO users (id, username, email) VALUES (?, 'testuser', 'test@example.com')", userID).Error,
+			"Failed to create user")
+		for i, id := range []uuid.UUID{firstID, secondID} {
+			now = now.Add(time.Second)
+			require.NoError(t, db.Exec("INSERT INTO folders (id, name, user_id, created_at) VALUES (?, ?, ?, ?)", id, []string{"Archive", "ARCHIVE"}[i], userID, now).Error,
+				"Failed to create folder")
+		}
+
+		_, err = MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations with folder names differing in case")
+
+		var first, second models.Folder
+		require.NoError(t, db.First(&first, "id = ?", firstID).Error, "Failed to find folder")
+		assert.Equal(t, "Archive", first.Name, "Expected the oldest folder to keep its name")
+		require.NoError(t, db.First(&second, "id = ?", secondID).Error, "Failed to find folder")
+		assert.Equal(t, "ARCHIVE ("+secondID.String()[:8]+")", second.Name, "Expected the other folder to be renamed")
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		db := newMigrationTestDB(t)
+
+		statuses, err := MigrationStatuses(db)
+		require.NoError(t, err, "Failed to get migration status")
+		require.Len(t, statuses, len(migrations), "Every migration should have a status")
+		for _, status := range statuses {
+			assert.Nil(t, status.AppliedAt, "Migration %d should be pending", status.Version)
+		}
+
+		_, err = MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations")
+
+		statuses, err = MigrationStatuses(db)
+		require.NoError(t, err, "Failed to get migration status")
+		for _, status := range statuses {
+			assert.NotNil(t, status.AppliedAt, "Migration %d should be applied", status.Version)
+			assert.False(t, status.Modified, "Migration %d should not be modified", status.Version)
+			assert.False(t, status.Unknown, "Migration %d should be known", status.Version)
+		}
+	})
+
+	t.Run("Modified", func(t *testing.T) {
+		db := newMigrationTestDB(t)
+		_, err := MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations")
+
+		err = db.Model(&schemaMigration{}).Where("version = ?", migrations[0].Version).Update("checksum", "changed").Error
+		require.NoError(t, err, "Failed to change checksum")
+
+		_, err = MigrateUp(db)
+		assert.ErrorIs(t, err, ErrMigrationModified, "Migrating should fail when an applied migration changed")
+
+		_, err = MigrateDown(db, len(migrations))
+		assert.ErrorIs(t, err, ErrMigrationModified, "Reverting a changed migration should fail")
+
+		statuses, err := MigrationStatuses(db)
+		require.NoError(t, err, "Failed to get migration status")
+		assert.True(t, statuses[0].Modified, "Changed migration should be reported as modified")
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		db := newMigrationTestDB(t)
+		_, err := MigrateUp(db)
+		require.NoError(t, err, "Failed to apply migrations")
+
+		err = db.Create(&schemaMigration{Version: 9999, Name: "from_the_future", Checksum: "unknown"}).Error
+		require.NoError(t, err, "Failed to record unknown migration")
+
+		applied, err := MigrateUp(db)
+		require.NoError(t, err, "Unknown applied migrations should not prevent migrating")
+		assert.Empty(t, applied, "Nothing should be applied")
+
+		statuses, err := MigrationStatuses(db)
+		require.NoError(t, err, "Failed to get migration status")
+		last := statuses[len(statuses)-1]
+		assert.Equal(t, 9999, last.Version, "Unknown migration should be listed last")
+		assert.True(t, last.Unknown, "Unknown migration should be reported")
+
+		_, err = MigrateDown(db, 1)
+		assert.Error(t, err, "Reverting an unknown migration should fail")
+	})
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS "share_links";
+DROP TABLE IF EXISTS "shares";
+DROP TABLE IF EXISTS "attachments";
+DROP TABLE IF EXISTS "document_versions";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "document_tags";
+DROP TABLE IF EXISTS "documents";
+DROP TABLE IF EXISTS "folder_tags";
+DROP TABLE IF EXISTS "folders";
+DROP TABLE IF EXISTS "tags";
+DROP TABLE IF EXISTS "users";
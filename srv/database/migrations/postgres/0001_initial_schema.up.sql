@@ -0,0 +1,158 @@
+-- Tables as previously created by GORM's AutoMigrate, so databases set up before
+-- versioned migrations adopt this migration without changes.
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" uuid,
+    "username" varchar(255) NOT NULL UNIQUE,
+    "email" varchar(255) NOT NULL UNIQUE,
+    "password_hash" varchar(255),
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users"("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "tags" (
+    "id" uuid,
+    "name" varchar(64) NOT NULL,
+    "user_id" uuid NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_tags_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_tags_user_id" ON "tags"("user_id");
+
+CREATE TABLE IF NOT EXISTS "folders" (
+    "id" uuid,
+    "name" varchar(255) NOT NULL,
+    "user_id" uuid NOT NULL,
+    "parent_id" uuid,
+    "version" bigint NOT NULL DEFAULT 1,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_folders_folders" FOREIGN KEY ("parent_id") REFERENCES "folders"("id"),
+    CONSTRAINT "fk_users_folders" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_folders_deleted_at" ON "folders"("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "folder_tags" (
+    "folder_id" uuid,
+    "tag_id" uuid,
+    PRIMARY KEY ("folder_id", "tag_id"),
+    CONSTRAINT "fk_folder_tags_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id"),
+    CONSTRAINT "fk_folder_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "documents" (
+    "id" uuid,
+    "title" varchar(255) NOT NULL,
+    "content" text,
+    "revision" bigint NOT NULL DEFAULT 1,
+    "version" bigint NOT NULL DEFAULT 1,
+    "user_id" uuid NOT NULL,
+    "folder_id" uuid,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_folders_documents" FOREIGN KEY ("folder_id") REFERENCES "folders"("id"),
+    CONSTRAINT "fk_users_documents" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_documents_deleted_at" ON "documents"("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "document_tags" (
+    "document_id" uuid,
+    "tag_id" uuid,
+    PRIMARY KEY ("document_id", "tag_id"),
+    CONSTRAINT "fk_document_tags_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id"),
+    CONSTRAINT "fk_document_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "sessions" (
+    "id" uuid,
+    "user_id" uuid NOT NULL,
+    "token_hash" varchar(64) NOT NULL UNIQUE,
+    "expires_at" timestamptz NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sessions_user_id" ON "sessions"("user_id");
+
+CREATE TABLE IF NOT EXISTS "document_versions" (
+    "id" uuid,
+    "document_id" uuid NOT NULL,
+    "revision" bigint NOT NULL,
+    "title" varchar(255) NOT NULL,
+    "content" text,
+    "user_id" uuid NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_document_versions_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id"),
+    CONSTRAINT "fk_document_versions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_document_versions_revision" ON "document_versions"("document_id", "revision");
+
+CREATE TABLE IF NOT EXISTS "attachments" (
+    "id" uuid,
+    "document_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "filename" varchar(255) NOT NULL,
+    "content_type" varchar(255) NOT NULL,
+    "size" bigint NOT NULL,
+    "sha256" varchar(64) NOT NULL,
+    "storage_key" varchar(255) NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_attachments_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_attachments_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_attachments_document_id" ON "attachments"("document_id");
+
+CREATE TABLE IF NOT EXISTS "shares" (
+    "id" uuid,
+    "user_id" uuid NOT NULL,
+    "folder_id" uuid,
+    "document_id" uuid,
+    "role" varchar(16) NOT NULL,
+    "owner_id" uuid NOT NULL,
+    "created_by_id" uuid NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_shares_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_shares_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id"),
+    CONSTRAINT "fk_shares_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_shares_owner_id" ON "shares"("owner_id");
+CREATE INDEX IF NOT EXISTS "idx_shares_document_id" ON "shares"("document_id");
+CREATE INDEX IF NOT EXISTS "idx_shares_folder_id" ON "shares"("folder_id");
+CREATE INDEX IF NOT EXISTS "idx_shares_user_id" ON "shares"("user_id");
+
+CREATE TABLE IF NOT EXISTS "share_links" (
+    "id" uuid,
+    "token_hash" varchar(64) NOT NULL UNIQUE,
+    "user_id" uuid NOT NULL,
+    "owner_id" uuid NOT NULL,
+    "folder_id" uuid,
+    "document_id" uuid,
+    "password_hash" varchar(255),
+    "expires_at" timestamptz,
+    "max_downloads" bigint,
+    "download_count" bigint NOT NULL DEFAULT 0,
+    "revoked_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_share_links_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_share_links_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id"),
+    CONSTRAINT "fk_share_links_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_share_links_document_id" ON "share_links"("document_id");
+CREATE INDEX IF NOT EXISTS "idx_share_links_folder_id" ON "share_links"("folder_id");
+CREATE INDEX IF NOT EXISTS "idx_share_links_owner_id" ON "share_links"("owner_id");
+CREATE INDEX IF NOT EXISTS "idx_share_links_user_id" ON "share_links"("user_id");
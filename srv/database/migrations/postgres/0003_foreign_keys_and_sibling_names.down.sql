@@ -0,0 +1,52 @@
+-- Folder names renamed by the up migration keep their new names
+
+DROP INDEX IF EXISTS "idx_folders_root_name";
+DROP INDEX IF EXISTS "idx_folders_parent_name";
+
+ALTER TABLE "folders"
+    DROP CONSTRAINT IF EXISTS "fk_folders_folders",
+    ADD CONSTRAINT "fk_folders_folders" FOREIGN KEY ("parent_id") REFERENCES "folders"("id");
+
+ALTER TABLE "folder_tags"
+    DROP CONSTRAINT IF EXISTS "fk_folder_tags_folder",
+    ADD CONSTRAINT "fk_folder_tags_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id");
+
+ALTER TABLE "folder_tags"
+    DROP CONSTRAINT IF EXISTS "fk_folder_tags_tag",
+    ADD CONSTRAINT "fk_folder_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id");
+
+ALTER TABLE "documents"
+    DROP CONSTRAINT IF EXISTS "fk_folders_documents",
+    ADD CONSTRAINT "fk_folders_documents" FOREIGN KEY ("folder_id") REFERENCES "folders"("id");
+
+ALTER TABLE "document_tags"
+    DROP CONSTRAINT IF EXISTS "fk_document_tags_document",
+    ADD CONSTRAINT "fk_document_tags_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id");
+
+ALTER TABLE "document_tags"
+    DROP CONSTRAINT IF EXISTS "fk_document_tags_tag",
+    ADD CONSTRAINT "fk_document_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id");
+
+ALTER TABLE "sessions"
+    DROP CONSTRAINT IF EXISTS "fk_sessions_user",
+    ADD CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id");
+
+ALTER TABLE "document_versions"
+    DROP CONSTRAINT IF EXISTS "fk_document_versions_document",
+    ADD CONSTRAINT "fk_document_versions_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id");
+
+ALTER TABLE "shares"
+    DROP CONSTRAINT IF EXISTS "fk_shares_folder",
+    ADD CONSTRAINT "fk_shares_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id");
+
+ALTER TABLE "shares"
+    DROP CONSTRAINT IF EXISTS "fk_shares_document",
+    ADD CONSTRAINT "fk_shares_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id");
+
+ALTER TABLE "share_links"
+    DROP CONSTRAINT IF EXISTS "fk_share_links_folder",
+    ADD CONSTRAINT "fk_share_links_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id");
+
+ALTER TABLE "share_links"
+    DROP CONSTRAINT IF EXISTS "fk_share_links_document",
+    ADD CONSTRAINT "fk_share_links_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id");
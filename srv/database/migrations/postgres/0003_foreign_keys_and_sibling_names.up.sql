@@ -0,0 +1,71 @@
+-- Delete dependent rows along with folders and documents, and move the contents
+-- of a deleted folder to the root, matching what purging from the trash does.
+
+ALTER TABLE "folders"
+    DROP CONSTRAINT IF EXISTS "fk_folders_folders",
+    ADD CONSTRAINT "fk_folders_folders" FOREIGN KEY ("parent_id") REFERENCES "folders"("id") ON DELETE SET NULL;
+
+ALTER TABLE "folder_tags"
+    DROP CONSTRAINT IF EXISTS "fk_folder_tags_folder",
+    ADD CONSTRAINT "fk_folder_tags_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id") ON DELETE CASCADE;
+
+ALTER TABLE "folder_tags"
+    DROP CONSTRAINT IF EXISTS "fk_folder_tags_tag",
+    ADD CONSTRAINT "fk_folder_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id") ON DELETE CASCADE;
+
+ALTER TABLE "documents"
+    DROP CONSTRAINT IF EXISTS "fk_folders_documents",
+    ADD CONSTRAINT "fk_folders_documents" FOREIGN KEY ("folder_id") REFERENCES "folders"("id") ON DELETE SET NULL;
+
+ALTER TABLE "document_tags"
+    DROP CONSTRAINT IF EXISTS "fk_document_tags_document",
+    ADD CONSTRAINT "fk_document_tags_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id") ON DELETE CASCADE;
+
+ALTER TABLE "document_tags"
+    DROP CONSTRAINT IF EXISTS "fk_document_tags_tag",
+    ADD CONSTRAINT "fk_document_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id") ON DELETE CASCADE;
+
+ALTER TABLE "sessions"
+    DROP CONSTRAINT IF EXISTS "fk_sessions_user",
+    ADD CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE;
+
+ALTER TABLE "document_versions"
+    DROP CONSTRAINT IF EXISTS "fk_document_versions_document",
+    ADD CONSTRAINT "fk_document_versions_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id") ON DELETE CASCADE;
+
+ALTER TABLE "shares"
+    DROP CONSTRAINT IF EXISTS "fk_shares_folder",
+    ADD CONSTRAINT "fk_shares_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id") ON DELETE CASCADE;
+
+ALTER TABLE "shares"
+    DROP CONSTRAINT IF EXISTS "fk_shares_document",
+    ADD CONSTRAINT "fk_shares_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id") ON DELETE CASCADE;
+
+ALTER TABLE "share_links"
+    DROP CONSTRAINT IF EXISTS "fk_share_links_folder",
+    ADD CONSTRAINT "fk_share_links_folder" FOREIGN KEY ("folder_id") REFERENCES "folders"("id") ON DELETE CASCADE;
+
+ALTER TABLE "share_links"
+    DROP CONSTRAINT IF EXISTS "fk_share_links_document",
+    ADD CONSTRAINT "fk_share_links_document" FOREIGN KEY ("document_id") REFERENCES "documents"("id") ON DELETE CASCADE;
+
+-- Rename duplicate names of live sibling folders, keeping the oldest, so that
+-- the unique indexes below can be created
+UPDATE "folders" SET "name" = left("name", 244) || ' (' || left("id"::text, 8) || ')'
+WHERE "id" IN (
+    SELECT "id" FROM (
+        SELECT "id", row_number() OVER (
+            PARTITION BY "parent_id", CASE WHEN "parent_id" IS NULL THEN "user_id" END, "name"
+            ORDER BY "created_at", "id"
+        ) AS "position"
+        FROM "folders"
+        WHERE "deleted_at" IS NULL
+    ) AS "siblings"
+    WHERE "position" > 1
+);
+
+-- Sibling folders have unique names; deleted folders don't count
+CREATE UNIQUE INDEX "idx_folders_parent_name" ON "folders" ("parent_id", "name")
+    WHERE "deleted_at" IS NULL AND "parent_id" IS NOT NULL;
+CREATE UNIQUE INDEX "idx_folders_root_name" ON "folders" ("user_id", "name")
+    WHERE "deleted_at" IS NULL AND "parent_id" IS NULL;
@@ -0,0 +1,54 @@
+-- Events are the outbox of changes to users, folders and documents. They keep
+-- no foreign keys so that they outlive the resources they describe.
+
+CREATE TABLE IF NOT EXISTS "events" (
+    "id" uuid,
+    "type" varchar(64) NOT NULL,
+    "resource_type" varchar(32) NOT NULL,
+    "resource_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "actor_id" uuid NOT NULL,
+    "payload" text NOT NULL,
+    "dispatched_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_events_user_id" ON "events"("user_id");
+CREATE INDEX IF NOT EXISTS "idx_events_dispatched_at" ON "events"("dispatched_at");
+
+CREATE TABLE IF NOT EXISTS "webhooks" (
+    "id" uuid,
+    "user_id" uuid NOT NULL,
+    "url" varchar(2048) NOT NULL,
+    "events" text NOT NULL,
+    "active" boolean NOT NULL,
+    "signing_secret" varchar(255) NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_webhooks_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_webhooks_user_id" ON "webhooks"("user_id");
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+    "id" uuid,
+    "webhook_id" uuid NOT NULL,
+    "event_id" uuid NOT NULL,
+    "event_type" varchar(64) NOT NULL,
+    "status" varchar(16) NOT NULL,
+    "attempts" bigint NOT NULL DEFAULT 0,
+    "next_attempt_at" timestamptz,
+    "last_attempt_at" timestamptz,
+    "response_status" bigint,
+    "last_error" text,
+    "delivered_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_webhook_deliveries_webhook" FOREIGN KEY ("webhook_id") REFERENCES "webhooks"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_webhook_deliveries_event" FOREIGN KEY ("event_id") REFERENCES "events"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_webhook_id" ON "webhook_deliveries"("webhook_id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_event_id" ON "webhook_deliveries"("event_id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_status" ON "webhook_deliveries"("status");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_next_attempt_at" ON "webhook_deliveries"("next_attempt_at");
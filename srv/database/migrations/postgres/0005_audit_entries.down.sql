@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "audit_entries";
+DROP FUNCTION IF EXISTS "reject_audit_entry_update"();
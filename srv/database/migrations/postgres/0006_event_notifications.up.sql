@@ -0,0 +1,11 @@
+-- Notify listeners of the ID of every event once its transaction commits, so
+-- that replicas can stream the changes made through each other
+CREATE OR REPLACE FUNCTION "notify_event"() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('events', NEW."id"::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "events_notify" AFTER INSERT ON "events"
+    FOR EACH ROW EXECUTE FUNCTION "notify_event"();
@@ -0,0 +1,4 @@
+-- Documents record whether their content is plain text, Markdown or HTML.
+-- Existing documents were written in a plain text area.
+
+ALTER TABLE "documents" ADD COLUMN "content_type" varchar(32) NOT NULL DEFAULT 'text/plain';
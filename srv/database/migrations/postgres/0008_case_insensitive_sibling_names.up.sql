@@ -0,0 +1,24 @@
+-- Sibling folder names are compared ignoring case, as the handlers check them,
+-- so that the indexes also catch concurrent requests racing each other.
+
+-- Rename the live sibling folders whose names only differ in case, keeping the
+-- oldest, so that the unique indexes below can be created
+UPDATE "folders" SET "name" = left("name", 244) || ' (' || left("id"::text, 8) || ')'
+WHERE "id" IN (
+    SELECT "id" FROM (
+        SELECT "id", row_number() OVER (
+            PARTITION BY "parent_id", CASE WHEN "parent_id" IS NULL THEN "user_id" END, lower("name")
+            ORDER BY "created_at", "id"
+        ) AS "position"
+        FROM "folders"
+        WHERE "deleted_at" IS NULL
+    ) AS "siblings"
+    WHERE "position" > 1
+);
+
+DROP INDEX IF EXISTS "idx_folders_parent_name";
+DROP INDEX IF EXISTS "idx_folders_root_name";
+CREATE UNIQUE INDEX "idx_folders_parent_name" ON "folders" ("parent_id", lower("name"))
+    WHERE "deleted_at" IS NULL AND "parent_id" IS NOT NULL;
+CREATE UNIQUE INDEX "idx_folders_root_name" ON "folders" ("user_id", lower("name"))
+    WHERE "deleted_at" IS NULL AND "parent_id" IS NULL;
@@ -0,0 +1 @@
+-- Nothing to revert, see 0002_document_search.up.sql
@@ -0,0 +1,3 @@
+-- SQLite has no search vector; SearchDocuments falls back to substring
+-- matching there. This migration only keeps the versions of both dialects in
+-- step.
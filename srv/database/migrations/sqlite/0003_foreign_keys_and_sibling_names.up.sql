@@ -0,0 +1,174 @@
+-- Delete dependent rows along with folders and documents, and move the contents
+-- of a deleted folder to the root, matching what purging from the trash does.
+-- SQLite can't alter constraints, so the affected tables are rebuilt; the
+-- migration runner disables foreign key enforcement while doing so.
+
+CREATE TABLE `folders_new` (
+    `id` uuid,
+    `name` text NOT NULL,
+    `user_id` uuid NOT NULL,
+    `parent_id` uuid,
+    `version` integer NOT NULL DEFAULT 1,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_folders_folders` FOREIGN KEY (`parent_id`) REFERENCES `folders`(`id`) ON DELETE SET NULL,
+    CONSTRAINT `fk_users_folders` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)
+);
+INSERT INTO `folders_new` (`id`, `name`, `user_id`, `parent_id`, `version`, `created_at`, `updated_at`, `deleted_at`)
+    SELECT `id`, `name`, `user_id`, `parent_id`, `version`, `created_at`, `updated_at`, `deleted_at` FROM `folders`;
+DROP TABLE `folders`;
+ALTER TABLE `folders_new` RENAME TO `folders`;
+CREATE INDEX `idx_folders_deleted_at` ON `folders`(`deleted_at`);
+
+CREATE TABLE `folder_tags_new` (
+    `folder_id` uuid,
+    `tag_id` uuid,
+    PRIMARY KEY (`folder_id`, `tag_id`),
+    CONSTRAINT `fk_folder_tags_folder` FOREIGN KEY (`folder_id`) REFERENCES `folders`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_folder_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`) ON DELETE CASCADE
+);
+INSERT INTO `folder_tags_new` (`folder_id`, `tag_id`)
+    SELECT `folder_id`, `tag_id` FROM `folder_tags`;
+DROP TABLE `folder_tags`;
+ALTER TABLE `folder_tags_new` RENAME TO `folder_tags`;
+
+CREATE TABLE `documents_new` (
+    `id` uuid,
+    `title` text NOT NULL,
+    `content` text,
+    `revision` integer NOT NULL DEFAULT 1,
+    `version` integer NOT NULL DEFAULT 1,
+    `user_id` uuid NOT NULL,
+    `folder_id` uuid,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_folders_documents` FOREIGN KEY (`folder_id`) REFERENCES `folders`(`id`) ON DELETE SET NULL,
+    CONSTRAINT `fk_users_documents` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)
+);
+INSERT INTO `documents_new` (`id`, `title`, `content`, `revision`, `version`, `user_id`, `folder_id`, `created_at`, `updated_at`, `deleted_at`)
+    SELECT `id`, `title`, `content`, `revision`, `version`, `user_id`, `folder_id`, `created_at`, `updated_at`, `deleted_at` FROM `documents`;
+DROP TABLE `documents`;
+ALTER TABLE `documents_new` RENAME TO `documents`;
+CREATE INDEX `idx_documents_deleted_at` ON `documents`(`deleted_at`);
+
+CREATE TABLE `document_tags_new` (
+    `document_id` uuid,
+    `tag_id` uuid,
+    PRIMARY KEY (`document_id`, `tag_id`),
+    CONSTRAINT `fk_document_tags_document` FOREIGN KEY (`document_id`) REFERENCES `documents`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_document_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`) ON DELETE CASCADE
+);
+INSERT INTO `document_tags_new` (`document_id`, `tag_id`)
+    SELECT `document_id`, `tag_id` FROM `document_tags`;
+DROP TABLE `document_tags`;
+ALTER TABLE `document_tags_new` RENAME TO `document_tags`;
+
+CREATE TABLE `sessions_new` (
+    `id` uuid,
+    `user_id` uuid NOT NULL,
+    `token_hash` text NOT NULL UNIQUE,
+    `expires_at` datetime NOT NULL,
+    `created_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+INSERT INTO `sessions_new` (`id`, `user_id`, `token_hash`, `expires_at`, `created_at`)
+    SELECT `id`, `user_id`, `token_hash`, `expires_at`, `created_at` FROM `sessions`;
+DROP TABLE `sessions`;
+ALTER TABLE `sessions_new` RENAME TO `sessions`;
+CREATE INDEX `idx_sessions_user_id` ON `sessions`(`user_id`);
+
+CREATE TABLE `document_versions_new` (
+    `id` uuid,
+    `document_id` uuid NOT NULL,
+    `revision` integer NOT NULL,
+    `title` text NOT NULL,
+    `content` text,
+    `user_id` uuid NOT NULL,
+    `created_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_document_versions_document` FOREIGN KEY (`document_id`) REFERENCES `documents`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_document_versions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)
+);
+INSERT INTO `document_versions_new` (`id`, `document_id`, `revision`, `title`, `content`, `user_id`, `created_at`)
+    SELECT `id`, `document_id`, `revision`, `title`, `content`, `user_id`, `created_at` FROM `document_versions`;
+DROP TABLE `document_versions`;
+ALTER TABLE `document_versions_new` RENAME TO `document_versions`;
+CREATE UNIQUE INDEX `idx_document_versions_revision` ON `document_versions`(`document_id`, `revision`);
+
+CREATE TABLE `shares_new` (
+    `id` uuid,
+    `user_id` uuid NOT NULL,
+    `folder_id` uuid,
+    `document_id` uuid,
+    `role` text NOT NULL,
+    `owner_id` uuid NOT NULL,
+    `created_by_id` uuid NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_shares_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),
+    CONSTRAINT `fk_shares_folder` FOREIGN KEY (`folder_id`) REFERENCES `folders`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_shares_document` FOREIGN KEY (`document_id`) REFERENCES `documents`(`id`) ON DELETE CASCADE
+);
+INSERT INTO `shares_new` (`id`, `user_id`, `folder_id`, `document_id`, `role`, `owner_id`, `created_by_id`, `created_at`, `updated_at`)
+    SELECT `id`, `user_id`, `folder_id`, `document_id`, `role`, `owner_id`, `created_by_id`, `created_at`, `updated_at` FROM `shares`;
+DROP TABLE `shares`;
+ALTER TABLE `shares_new` RENAME TO `shares`;
+CREATE INDEX `idx_shares_owner_id` ON `shares`(`owner_id`);
+CREATE INDEX `idx_shares_document_id` ON `shares`(`document_id`);
+CREATE INDEX `idx_shares_folder_id` ON `shares`(`folder_id`);
+CREATE INDEX `idx_shares_user_id` ON `shares`(`user_id`);
+
+CREATE TABLE `share_links_new` (
+    `id` uuid,
+    `token_hash` text NOT NULL UNIQUE,
+    `user_id` uuid NOT NULL,
+    `owner_id` uuid NOT NULL,
+    `folder_id` uuid,
+    `document_id` uuid,
+    `password_hash` text,
+    `expires_at` datetime,
+    `max_downloads` integer,
+    `download_count` integer NOT NULL DEFAULT 0,
+    `revoked_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_share_links_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),
+    CONSTRAINT `fk_share_links_folder` FOREIGN KEY (`folder_id`) REFERENCES `folders`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_share_links_document` FOREIGN KEY (`document_id`) REFERENCES `documents`(`id`) ON DELETE CASCADE
+);
+INSERT INTO `share_links_new` (`id`, `token_hash`, `user_id`, `owner_id`, `folder_id`, `document_id`, `password_hash`, `expires_at`, `max_downloads`, `download_count`, `revoked_at`, `created_at`, `updated_at`)
+    SELECT `id`, `token_hash`, `user_id`, `owner_id`, `folder_id`, `document_id`, `password_hash`, `expires_at`, `max_downloads`, `download_count`, `revoked_at`, `created_at`, `updated_at` FROM `share_links`;
+DROP TABLE `share_links`;
+ALTER TABLE `share_links_new` RENAME TO `share_links`;
+CREATE INDEX `idx_share_links_document_id` ON `share_links`(`document_id`);
+CREATE INDEX `idx_share_links_folder_id` ON `share_links`(`folder_id`);
+CREATE INDEX `idx_share_links_owner_id` ON `share_links`(`owner_id`);
+CREATE INDEX `idx_share_links_user_id` ON `share_links`(`user_id`);
+
+-- Rename duplicate names of live sibling folders, keeping the oldest, so that
+-- the unique indexes below can be created
+UPDATE `folders` SET `name` = `name` || ' (' || substr(`id`, 1, 8) || ')'
+WHERE `id` IN (
+    SELECT `id` FROM (
+        SELECT `id`, row_number() OVER (
+            PARTITION BY `parent_id`, CASE WHEN `parent_id` IS NULL THEN `user_id` END, `name`
+            ORDER BY `created_at`, `id`
+        ) AS `position`
+        FROM `folders`
+        WHERE `deleted_at` IS NULL
+    )
+    WHERE `position` > 1
+);
+
+-- Sibling folders have unique names; deleted folders don't count
+CREATE UNIQUE INDEX `idx_folders_parent_name` ON `folders`(`parent_id`, `name`)
+    WHERE `deleted_at` IS NULL AND `parent_id` IS NOT NULL;
+CREATE UNIQUE INDEX `idx_folders_root_name` ON `folders`(`user_id`, `name`)
+    WHERE `deleted_at` IS NULL AND `parent_id` IS NULL;
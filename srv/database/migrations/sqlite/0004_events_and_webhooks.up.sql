@@ -0,0 +1,54 @@
+-- Events are the outbox of changes to users, folders and documents. They keep
+-- no foreign keys so that they outlive the resources they describe.
+
+CREATE TABLE IF NOT EXISTS `events` (
+    `id` uuid,
+    `type` text NOT NULL,
+    `resource_type` text NOT NULL,
+    `resource_id` uuid NOT NULL,
+    `user_id` uuid NOT NULL,
+    `actor_id` uuid NOT NULL,
+    `payload` text NOT NULL,
+    `dispatched_at` datetime,
+    `created_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_events_user_id` ON `events`(`user_id`);
+CREATE INDEX IF NOT EXISTS `idx_events_dispatched_at` ON `events`(`dispatched_at`);
+
+CREATE TABLE IF NOT EXISTS `webhooks` (
+    `id` uuid,
+    `user_id` uuid NOT NULL,
+    `url` text NOT NULL,
+    `events` text NOT NULL,
+    `active` numeric NOT NULL,
+    `signing_secret` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_webhooks_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS `idx_webhooks_user_id` ON `webhooks`(`user_id`);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+    `id` uuid,
+    `webhook_id` uuid NOT NULL,
+    `event_id` uuid NOT NULL,
+    `event_type` text NOT NULL,
+    `status` text NOT NULL,
+    `attempts` integer NOT NULL DEFAULT 0,
+    `next_attempt_at` datetime,
+    `last_attempt_at` datetime,
+    `response_status` integer,
+    `last_error` text,
+    `delivered_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_webhook_deliveries_webhook` FOREIGN KEY (`webhook_id`) REFERENCES `webhooks`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_webhook_deliveries_event` FOREIGN KEY (`event_id`) REFERENCES `events`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_webhook_id` ON `webhook_deliveries`(`webhook_id`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_event_id` ON `webhook_deliveries`(`event_id`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_status` ON `webhook_deliveries`(`status`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_next_attempt_at` ON `webhook_deliveries`(`next_attempt_at`);
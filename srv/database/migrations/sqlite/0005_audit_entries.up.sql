@@ -0,0 +1,25 @@
+-- The audit trail of changes to users, folders and documents. Like events,
+-- entries keep no foreign keys so that they outlive the resources they
+-- describe. A trigger rejects updates, so that recorded entries can't be
+-- rewritten; deleting them is left to retention jobs.
+
+CREATE TABLE IF NOT EXISTS `audit_entries` (
+    `id` uuid,
+    `actor_id` uuid NOT NULL,
+    `action` text NOT NULL,
+    `target_type` text NOT NULL,
+    `target_id` uuid NOT NULL,
+    `owner_id` uuid NOT NULL,
+    `changes` text NOT NULL,
+    `created_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_audit_entries_actor_id` ON `audit_entries`(`actor_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_entries_target_id` ON `audit_entries`(`target_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_entries_owner_id` ON `audit_entries`(`owner_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_entries_created_at` ON `audit_entries`(`created_at`);
+
+CREATE TRIGGER IF NOT EXISTS `audit_entries_immutable` BEFORE UPDATE ON `audit_entries`
+BEGIN
+    SELECT RAISE(ABORT, 'audit entries are immutable');
+END;
@@ -0,0 +1 @@
+-- Nothing to revert, see 0006_event_notifications.up.sql
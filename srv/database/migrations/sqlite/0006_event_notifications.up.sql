@@ -0,0 +1,2 @@
+-- SQLite has no notifications; the local stream broker polls the events table
+-- there. This migration only keeps the versions of both dialects in step.
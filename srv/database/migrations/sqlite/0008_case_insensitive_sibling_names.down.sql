@@ -0,0 +1,8 @@
+-- Folder names renamed by the up migration keep their new names
+
+DROP INDEX IF EXISTS `idx_folders_parent_name`;
+DROP INDEX IF EXISTS `idx_folders_root_name`;
+CREATE UNIQUE INDEX `idx_folders_parent_name` ON `folders`(`parent_id`, `name`)
+    WHERE `deleted_at` IS NULL AND `parent_id` IS NOT NULL;
+CREATE UNIQUE INDEX `idx_folders_root_name` ON `folders`(`user_id`, `name`)
+    WHERE `deleted_at` IS NULL AND `parent_id` IS NULL;
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"srv/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SiblingFolderNames returns the names of the live folders in a parent folder,
+// or of the user's root folders if parentID is nil, except the folder excludeID
+func SiblingFolderNames(db *gorm.DB, userID uuid.UUID, parentID *uuid.UUID, excludeID uuid.UUID) ([]string, error) {
+	query := db.Model(&models.Folder{}).Where("id <> ?", excludeID)
+	if parentID != nil {
+		query = query.Where("parent_id = ?", *parentID)
+	} else {
+		query = query.Where("parent_id IS NULL AND user_id = ?", userID)
+	}
+
+	var names []string
+	err := query.Pluck("name", &names).Error
+	return names, err
+}
+
+// SiblingDocumentTitles returns the titles of the live documents in a folder,
+// or of the user's documents in the root if folderID is nil, except the
+// document excludeID
+func SiblingDocumentTitles(db *gorm.DB, userID uuid.UUID, folderID *uuid.UUID, excludeID uuid.UUID) ([]string, error) {
+	query := db.Model(&models.Document{}).Where("id <> ?", excludeID)
+	if folderID != nil {
+		query = query.Where("folder_id = ?", *folderID)
+	} else {
+		query = query.Where("folder_id IS NULL AND user_id = ?", userID)
+	}
+
+	var titles []string
+	err := query.Pluck("title", &titles).Error
+	return titles, err
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// maxSearchTerms limits how many terms of a query are matched on the fallback search
+const maxSearchTerms = 10
+
+// SearchDocuments returns a scope matching documents against a full-text query.
+// It selects a relevance score into the `rank` column for ordering. Postgres
+// uses the `search_vector` column, other databases fall back to
+// case-insensitive substring matching where every term must match.
+func SearchDocuments(query string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if db.Dialector.Name() == "postgres" {
+			return db.
+				Select("documents.*, ts_rank(documents.search_vector, websearch_to_tsquery('english', ?)) AS rank", query).
+				Where("documents.search_vector @@ websearch_to_tsquery('english', ?)", query)
+		}
+
+		terms := strings.Fields(strings.ToLower(query))
+		if len(terms) > maxSearchTerms {
+			terms = terms[:maxSearchTerms]
+		}
+
+		// Title matches weigh twice as much as content matches
+		var rank []string
+		var rankArgs []interface{}
+		for _, term := range terms {
+			pattern := "%" + escapeLike(term) + "%"
+			rank = append(rank, `CASE WHEN lower(documents.title) LIKE ? ESCAPE '\' THEN 2 ELSE 0 END + `+
+				`CASE WHEN lower(documents.content) LIKE ? ESCAPE '\' THEN 1 ELSE 0 END`)
+			rankArgs = append(rankArgs, pattern, pattern)
+			db = db.Where(`(lower(documents.title) LIKE ? ESCAPE '\' OR lower(documents.content) LIKE ? ESCAPE '\')`, pattern, pattern)
+		}
+		if len(rank) == 0 {
+			return db.Where("1 = 0")
+		}
+
+		return db.Select("documents.*, ("+strings.Join(rank, " + ")+") AS rank", rankArgs...)
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in s using a backslash
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"errors"
+	"srv/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Join tables linking tags to documents and folders
+const (
+	DocumentTagsTable = "document_tags"
+	FolderTagsTable   = "folder_tags"
+)
+
+// TagsWithUsage returns a query over the tags of a user that selects how many
+// documents and folders outside the trash carry each tag into the
+// `document_count` and `folder_count` columns
+func TagsWithUsage(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	documentCount := db.Table(DocumentTagsTable).
+		Select("COUNT(*)").
+		Joins("JOIN documents ON documents.id = document_tags.document_id").
+		Where("document_tags.tag_id = tags.id AND documents.deleted_at IS NULL")
+	folderCount := db.Table(FolderTagsTable).
+		Select("COUNT(*)").
+		Joins("JOIN folders ON folders.id = folder_tags.folder_id").
+		Where("folder_tags.tag_id = tags.id AND folders.deleted_at IS NULL")
+
+	return db.Model(&models.Tag{}).
+		Select("tags.*, (?) AS document_count, (?) AS folder_count", documentCount, folderCount).
+		Where("tags.user_id = ?", userID)
+}
+
+// TaggedIDs returns a subquery selecting the IDs of the documents or folders
+// that carry any of the named tags. joinTable is DocumentTagsTable or
+// FolderTagsTable and column is its document_id or folder_id column. Tag names
+// are matched case-insensitively. Items only carry tags of their owner, so the
+// caller restricts the result to the items the user may access.
+func TaggedIDs(db *gorm.DB, joinTable, column string, names []string) *gorm.DB {
+	// Lower both sides in SQL so that the database decides what case-insensitive means
+	placeholders := make([]string, len(names))
+	args := []interface{}{}
+	for i, name := range names {
+		placeholders[i] = "LOWER(?)"
+		args = append(args, name)
+	}
+
+	return db.Table(joinTable).
+		Select(joinTable+"."+column).
+		Joins("JOIN tags ON tags.id = "+joinTable+".tag_id").
+		Where("LOWER(tags.name) IN ("+strings.Join(placeholders, ", ")+")", args...)
+}
+
+// DeleteTagLinks removes the rows of a tag join table whose column, such as
+// document_id or tag_id, holds one of ids
+func DeleteTagLinks(tx *gorm.DB, joinTable, column string, ids []uuid.UUID) error {
+	return tx.Exec("DELETE FROM "+joinTable+" WHERE "+column+" IN ?", ids).Error
+}
+
+// MatchTags returns the tags of a user named like tags, ignoring case, and
+// creates the ones the user doesn't have yet. It carries tags over to items
+// copied for another owner, since items only carry tags of their owner.
+func MatchTags(tx *gorm.DB, userID uuid.UUID, tags []models.Tag) ([]models.Tag, error) {
+	matched := make([]models.Tag, 0, len(tags))
+	for _, tag := range tags {
+		if tag.UserID == userID {
+			matched = append(matched, tag)
+			continue
+		}
+
+		var own models.Tag
+		err := tx.Where("user_id = ? AND LOWER(name) = LOWER(?)", userID, tag.Name).Order("created_at").First(&own).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			own = models.Tag{Name: tag.Name, UserID: userID}
+			err = tx.Create(&own).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+		matched = append(matched, own)
+	}
+	return matched, nil
+}
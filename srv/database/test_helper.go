@@ -1,7 +1,6 @@
 package database
 
 import (
-	"srv/models"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -14,11 +13,7 @@ func NewTestDB(t *testing.T) *gorm.DB {
 	require.NoError(t, err, "Failed to connect to test database")
 
 	// Migrate the schema
-	err = db.AutoMigrate(
-		&models.User{},
-		&models.Folder{},
-		&models.Document{},
-	)
+	_, err = MigrateUp(db)
 	require.NoError(t, err, "Failed to migrate test database")
 
 	return db
@@ -37,7 +32,19 @@ func CleanupTestDB(t *testing.T, db *gorm.DB) {
 
 // TruncateTables truncates all tables in the test database
 func TruncateTables(t *testing.T, db *gorm.DB) {
+	require.NoError(t, db.Exec("DELETE FROM audit_entries").Error, "Failed to truncate audit entries table")
+	require.NoError(t, db.Exec("DELETE FROM webhook_deliveries").Error, "Failed to truncate webhook deliveries table")
+	require.NoError(t, db.Exec("DELETE FROM webhooks").Error, "Failed to truncate webhooks table")
+	require.NoError(t, db.Exec("DELETE FROM events").Error, "Failed to truncate events table")
+	require.NoError(t, db.Exec("DELETE FROM share_links").Error, "Failed to truncate share links table")
+	require.NoError(t, db.Exec("DELETE FROM shares").Error, "Failed to truncate shares table")
+	require.NoError(t, db.Exec("DELETE FROM sessions").Error, "Failed to truncate sessions table")
+	require.NoError(t, db.Exec("DELETE FROM document_versions").Error, "Failed to truncate document versions table")
+	require.NoError(t, db.Exec("DELETE FROM attachments").Error, "Failed to truncate attachments table")
+	require.NoError(t, db.Exec("DELETE FROM document_tags").Error, "Failed to truncate document tags table")
+	require.NoError(t, db.Exec("DELETE FROM folder_tags").Error, "Failed to truncate folder tags table")
 	require.NoError(t, db.Exec("DELETE FROM documents").Error, "Failed to truncate documents table")
 	require.NoError(t, db.Exec("DELETE FROM folders").Error, "Failed to truncate folders table")
+	require.NoError(t, db.Exec("DELETE FROM tags").Error, "Failed to truncate tags table")
 	require.NoError(t, db.Exec("DELETE FROM users").Error, "Failed to truncate users table")
 }
\ No newline at end of file
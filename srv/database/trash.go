@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"srv/models"
+	"srv/storage"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize is the number of items purged per statement, keeping the
+// lists of IDs well below the bind parameter limits of SQLite and Postgres
+const purgeBatchSize = 500
+
+// inBatches calls fn for consecutive slices of at most purgeBatchSize IDs
+func inBatches(ids []uuid.UUID, fn func(batch []uuid.UUID) error) error {
+	for len(ids) > 0 {
+		n := min(len(ids), purgeBatchSize)
+		if err := fn(ids[:n]); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// PurgeDocuments permanently deletes documents along with their version
+// history, attachments, tag links, shares and share links. It returns the
+// storage keys of the deleted attachments, whose blobs should be deleted once
+// the transaction commits.
+func PurgeDocuments(tx *gorm.DB, ids []uuid.UUID) ([]string, error) {
+	var blobKeys []string
+	err := inBatches(ids, func(batch []uuid.UUID) error {
+		keys, err := purgeDocuments(tx, batch)
+		blobKeys = append(blobKeys, keys...)
+		return err
+	})
+	return blobKeys, err
+}
+
+// purgeDocuments purges a batch of documents for PurgeDocuments
+func purgeDocuments(tx *gorm.DB, ids []uuid.UUID) ([]string, error) {
+	var blobKeys []string
+	if err := tx.Model(&models.Attachment{}).Where("document_id IN ?", ids).Pluck("storage_key", &blobKeys).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("document_id IN ?", ids).Delete(&models.Attachment{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("document_id IN ?", ids).Delete(&models.DocumentVersion{}).Error; err != nil {
+		return nil, err
+	}
+	if err := DeleteTagLinks(tx, DocumentTagsTable, "document_id", ids); err != nil {
+		return nil, err
+	}
+	if err := tx.Where("document_id IN ?", ids).Delete(&models.Share{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("document_id IN ?", ids).Delete(&models.ShareLink{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Document{}).Error; err != nil {
+		return nil, err
+	}
+	return blobKeys, nil
+}
+
+// PurgeFolders permanently deletes folders along with their tag links, shares
+// and share links. Deleted documents and subfolders that are still in the
+// trash are detached, so restoring them later moves them to the root.
+func PurgeFolders(tx *gorm.DB, ids []uuid.UUID) error {
+	return inBatches(ids, func(batch []uuid.UUID) error {
+		return purgeFolders(tx, batch)
+	})
+}
+
+// purgeFolders purges a batch of folders for PurgeFolders
+func purgeFolders(tx *gorm.DB, ids []uuid.UUID) error {
+	if err := tx.Unscoped().Model(&models.Document{}).Where("folder_id IN ?", ids).Update("folder_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(&models.Folder{}).Where("parent_id IN ? AND id NOT IN ?", ids, ids).Update("parent_id", nil).Error; err != nil {
+		return err
+	}
+	if err := DeleteTagLinks(tx, FolderTagsTable, "folder_id", ids); err != nil {
+		return err
+	}
+	if err := tx.Where("folder_id IN ?", ids).Delete(&models.Share{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("folder_id IN ?", ids).Delete(&models.ShareLink{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Folder{}).Error
+}
+
+// TrashPurge summarizes the items removed by PurgeTrash
+type TrashPurge struct {
+	Documents int
+	Folders   int
+	// BlobKeys are the storage keys of the purged attachments
+	BlobKeys []string
+}
+
+// PurgeTrash permanently deletes all documents and folders deleted before
+// cutoff, recording a purge audit entry for each of them. Items are purged in
+// batches of their own transaction, so a failure leaves the batches purged
+// before it, which the returned TrashPurge counts.
+func PurgeTrash(db *gorm.DB, cutoff time.Time) (TrashPurge, error) {
+	var purge TrashPurge
+	for {
+		var ids []uuid.UUID
+		var blobKeys []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var documents []models.Document
+			if err := tx.Unscoped().Where("deleted_at < ?", cutoff).Limit(purgeBatchSize).Find(&documents).Error; err != nil {
+				return err
+			}
+			for _, document := range documents {
+				if err := recordPurge(tx, document.UserID, document); err != nil {
+					return err
+				}
+				ids = append(ids, document.ID)
+			}
+			var err error
+			blobKeys, err = PurgeDocuments(tx, ids)
+			return err
+		})
+		if err != nil {
+			return purge, err
+		}
+		purge.Documents += len(ids)
+		purge.BlobKeys = append(purge.BlobKeys, blobKeys...)
+		if len(ids) < purgeBatchSize {
+			break
+		}
+	}
+
+	for {
+		var ids []uuid.UUID
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var folders []models.Folder
+			if err := tx.Unscoped().Where("deleted_at < ?", cutoff).Limit(purgeBatchSize).Find(&folders).Error; err != nil {
+				return err
+			}
+			for _, folder := range folders {
+				if err := recordPurge(tx, folder.UserID, folder); err != nil {
+					return err
+				}
+				ids = append(ids, folder.ID)
+			}
+			return PurgeFolders(tx, ids)
+		})
+		if err != nil {
+			return purge, err
+		}
+		purge.Folders += len(ids)
+		if len(ids) < purgeBatchSize {
+			break
+		}
+	}
+	return purge, nil
+}
+
+// recordPurge records the audit entry for an item purged from the trash once
+// its retention ran out. No user purges it, so its owner stands as the actor.
+func recordPurge(tx *gorm.DB, ownerID uuid.UUID, item jsonapi.MarshalIdentifier) error {
+	entry, err := models.NewAuditEntry(models.AuditPurge, ownerID, item, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&entry).Error
+}
+
+// PurgeTrashPeriodically purges items that have been in the trash for longer
+// than retention along with their attachment blobs, checking once per
+// interval. It never returns.
+func PurgeTrashPeriodically(db *gorm.DB, blobs storage.Storage, retention, interval time.Duration) {
+	for {
+		purge, err := PurgeTrash(db, time.Now().Add(-retention))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to purge trash")
+		} else if purge.Documents > 0 || purge.Folders > 0 {
+			logrus.WithFields(logrus.Fields{
+				"documents": purge.Documents,
+				"folders":   purge.Folders,
+			}).Info("Purged expired items from trash")
+		}
+		if err := storage.DeleteAll(context.Background(), blobs, purge.BlobKeys); err != nil {
+			logrus.WithError(err).Error("Failed to delete purged attachment blobs")
+		}
+		time.Sleep(interval)
+	}
+}
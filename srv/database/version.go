@@ -0,0 +1,29 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrVersionConflict is returned when a row no longer has the version an
+// update was based on
+var ErrVersionConflict = errors.New("row was modified concurrently")
+
+// ClaimVersion increments the version column of the row of model with the
+// given ID, provided it still has the expected version. Within a transaction
+// this locks the row until it commits, so concurrent updates based on the same
+// version can't both succeed; the loser gets ErrVersionConflict.
+func ClaimVersion(tx *gorm.DB, model interface{}, id uuid.UUID, version int) error {
+	result := tx.Model(model).
+		Where("id = ? AND version = ?", id, version).
+		UpdateColumn("version", gorm.Expr("version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxLines and MaxBytes bound the size of the texts compared together, as the
+// time a diff takes grows with the product of their length and the number of
+// differences
+const (
+	MaxLines = 10000
+	MaxBytes = 1 << 20
+)
+
+// ErrTooLarge is returned for texts that together exceed MaxLines or MaxBytes
+var ErrTooLarge = errors.New("texts are too large to compare")
+
+// Operation describes how a line changed between two texts
+type Operation string
+
+const (
+	// Equal marks a line present in both texts
+	Equal Operation = "equal"
+	// Insert marks a line only present in the new text
+	Insert Operation = "insert"
+	// Delete marks a line only present in the old text
+	Delete Operation = "delete"
+)
+
+// Line is a single line of a line-by-line diff. OldLine and NewLine are the
+// 1-based line numbers in the old and new text, or 0 if the line is absent.
+type Line struct {
+	Op      Operation `json:"op"`
+	Text    string    `json:"text"`
+	OldLine int       `json:"old_line,omitempty"`
+	NewLine int       `json:"new_line,omitempty"`
+}
+
+// Lines computes a minimal line-by-line diff turning oldText into newText
+// using the linear space variant of Myers' O(ND) algorithm, which splits the
+// texts at the middle of an optimal edit script and diffs the halves. It
+// returns ErrTooLarge for texts exceeding MaxLines or MaxBytes together.
+func Lines(oldText, newText string) ([]Line, error) {
+	if len(oldText)+len(newText) > MaxBytes {
+		return nil, ErrTooLarge
+	}
+	a := splitLines(oldText)
+	b := splitLines(newText)
+	if len(a)+len(b) > MaxLines {
+		return nil, ErrTooLarge
+	}
+
+	// Lines are compared by number, the same number for the same text
+	numbers := map[string]int{}
+	number := func(lines []string) []int {
+		result := make([]int, len(lines))
+		for i, line := range lines {
+			n, ok := numbers[line]
+			if !ok {
+				n = len(numbers)
+				numbers[line] = n
+			}
+			result[i] = n
+		}
+		return result
+	}
+
+	d := &differ{oldLines: a, newLines: b, a: number(a), b: number(b), lines: []Line{}}
+	d.diff(0, len(a), 0, len(b))
+	return d.lines, nil
+}
+
+// differ accumulates the diff of two texts, given as their lines and as the
+// numbers standing for the lines
+type differ struct {
+	oldLines, newLines []string
+	a, b               []int
+	lines              []Line
+}
+
+// diff appends the lines turning a[aLo:aHi] into b[bLo:bHi]
+func (d *differ) diff(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.equal(aLo, bLo)
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aHi > aLo && bHi > bLo && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+		suffix++
+	}
+
+	x, y, ok := d.middle(aLo, aHi, bLo, bHi)
+	if ok {
+		d.diff(aLo, x, bLo, y)
+		d.diff(x, aHi, y, bHi)
+	} else {
+		for x := aLo; x < aHi; x++ {
+			d.lines = append(d.lines, Line{Op: Delete, Text: d.oldLines[x], OldLine: x + 1})
+		}
+		for y := bLo; y < bHi; y++ {
+			d.lines = append(d.lines, Line{Op: Insert, Text: d.newLines[y], NewLine: y + 1})
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.equal(aHi+i, bHi+i)
+	}
+}
+
+// equal appends the line at x in the old text and y in the new one
+func (d *differ) equal(x, y int) {
+	d.lines = append(d.lines, Line{Op: Equal, Text: d.oldLines[x], OldLine: x + 1, NewLine: y + 1})
+}
+
+// middle finds where an optimal edit script turning a[aLo:aHi] into
+// b[bLo:bHi] crosses its middle, by following the furthest reaching paths
+// from both ends until they overlap. It reports false if either range is
+// empty or the ranges have no line in common, as their diff then only deletes
+// and inserts. The ranges must not start or end with a common line.
+func (d *differ) middle(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	// The paths overlap in the forward pass when the difference in length is
+	// odd, and in the backward pass otherwise
+	delta := n - m
+	odd := delta%2 != 0
+	// Diagonals running off the edges are skipped from then on
+	forwardStart, forwardEnd, backwardStart, backwardEnd := 0, 0, 0, 0
+	for step := 0; step < maxD; step++ {
+		for k := -step + forwardStart; k <= step-forwardEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -step || (k != step && forward[i-1] < forward[i+1]) {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[i] = x
+			switch {
+			case x > n:
+				forwardEnd += 2
+			case y > m:
+				forwardStart += 2
+			case odd:
+				j := offset + delta - k
+				if j >= 0 && j < len(backward) && backward[j] != -1 && x >= n-backward[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k := -step + backwardStart; k <= step-backwardEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -step || (k != step && backward[i-1] < backward[i+1]) {
+				x = backward[i+1]
+			} else {
+				x = backward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			backward[i] = x
+			switch {
+			case x > n:
+				backwardEnd += 2
+			case y > m:
+				backwardStart += 2
+			case !odd:
+				j := offset + delta - k
+				if j >= 0 && j < len(forward) && forward[j] != -1 {
+					forwardX := forward[j]
+					if forwardX >= n-x {
+						return aLo + forwardX, bLo + forwardX - (j - offset), true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// splitLines splits text into lines, ignoring a single trailing newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
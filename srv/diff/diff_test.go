@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mustLines diffs two texts that are within the limits
+func mustLines(t *testing.T, oldText, newText string) []Line {
+	t.Helper()
+	lines, err := Lines(oldText, newText)
+	require.NoError(t, err, "Failed to diff texts")
+	return lines
+}
+
+func TestLines(t *testing.T) {
+	t.Run("Identical", func(t *testing.T) {
+		lines := mustLines(t, "a\nb", "a\nb")
+		assert.Equal(t, []Line{
+			{Op: Equal, Text: "a", OldLine: 1, NewLine: 1},
+			{Op: Equal, Text: "b", OldLine: 2, NewLine: 2},
+		}, lines, "Expected only equal lines")
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, mustLines(t, "", ""), "Expected no lines")
+		assert.Equal(t, []Line{{Op: Insert, Text: "a", NewLine: 1}}, mustLines(t, "", "a"), "Expected one insertion")
+		assert.Equal(t, []Line{{Op: Delete, Text: "a", OldLine: 1}}, mustLines(t, "a", ""), "Expected one deletion")
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		lines := mustLines(t, "one\ntwo\nthree\nfour", "one\n2\nthree\nfour\nfive")
+		assert.Equal(t, []Line{
+			{Op: Equal, Text: "one", OldLine: 1, NewLine: 1},
+			{Op: Delete, Text: "two", OldLine: 2},
+			{Op: Insert, Text: "2", NewLine: 2},
+			{Op: Equal, Text: "three", OldLine: 3, NewLine: 3},
+			{Op: Equal, Text: "four", OldLine: 4, NewLine: 4},
+			{Op: Insert, Text: "five", NewLine: 5},
+		}, lines, "Expected a minimal diff")
+	})
+
+	t.Run("Minimal", func(t *testing.T) {
+		// Random texts over a small alphabet share many lines in many ways
+		random := rand.New(rand.NewSource(1))
+		text := func() []string {
+			lines := make([]string, random.Intn(30))
+			for i := range lines {
+				lines[i] = string(rune('a' + random.Intn(4)))
+			}
+			return lines
+		}
+		for i := 0; i < 500; i++ {
+			a, b := text(), text()
+			lines := mustLines(t, strings.Join(a, "\n"), strings.Join(b, "\n"))
+
+			var oldLines, newLines []string
+			edits := 0
+			for _, line := range lines {
+				if line.Op != Insert {
+					require.Equal(t, len(oldLines)+1, line.OldLine, "Expected the old line numbers in order")
+					oldLines = append(oldLines, line.Text)
+				}
+				if line.Op != Delete {
+					require.Equal(t, len(newLines)+1, line.NewLine, "Expected the new line numbers in order")
+					newLines = append(newLines, line.Text)
+				}
+				if line.Op != Equal {
+					edits++
+				}
+			}
+			require.Equal(t, strings.Join(a, "\n"), strings.Join(oldLines, "\n"), "Expected the old text to be kept")
+			require.Equal(t, strings.Join(b, "\n"), strings.Join(newLines, "\n"), "Expected the new text to be kept")
+			require.Equal(t, len(a)+len(b)-2*commonLength(a, b), edits, "Expected a minimal diff of %q and %q", a, b)
+		}
+	})
+
+	t.Run("LargeUnrelated", func(t *testing.T) {
+		// Memory stays linear in the size of the texts
+		var a, b strings.Builder
+		for i := 0; i < 3000; i++ {
+			fmt.Fprintf(&a, "old line %d\n", i)
+			fmt.Fprintf(&b, "new line %d\n", i)
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		lines := mustLines(t, a.String(), b.String())
+		runtime.ReadMemStats(&after)
+		assert.Len(t, lines, 6000, "Expected every line to be deleted or inserted")
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16<<20), "Expected the diff to allocate little memory")
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		_, err := Lines(strings.Repeat("line\n", MaxLines/2), strings.Repeat("other\n", MaxLines/2+1))
+		assert.ErrorIs(t, err, ErrTooLarge, "Expected too many lines to be rejected")
+		_, err = Lines(strings.Repeat("x", MaxBytes), "y")
+		assert.ErrorIs(t, err, ErrTooLarge, "Expected too many bytes to be rejected")
+	})
+}
+
+// commonLength returns the length of the longest common subsequence of the
+// lines of two texts
+func commonLength(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	return lengths[0][0]
+}
@@ -1,11 +1,21 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"regexp"
 	"srv/api"
+	"srv/auth"
+	"srv/collab"
 	"srv/database"
 	"srv/models"
+	"srv/storage"
+	"srv/stream"
+	"srv/webhook"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/manyminds/api2go"
 	"github.com/sirupsen/logrus"
@@ -43,28 +53,194 @@ func main() {
 		logrus.WithError(err).Fatal("Failed to connect to database")
 	}
 
-	// Migrate database
+	// Run a command instead of the server, e.g. `srv migrate status`
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			logrus.Fatalf("Unknown command %q, the only command is migrate", os.Args[1])
+		}
+		if err := runMigrate(db, os.Args[2:], os.Stdout); err != nil {
+			logrus.WithError(err).Fatal("Migration command failed")
+		}
+		return
+	}
+
+	// Apply pending migrations
 	if err := database.MigrateDB(db); err != nil {
 		logrus.WithError(err).Fatal("Failed to migrate database")
 	}
 
+	// Create authentication service
+	tokenTTL, err := time.ParseDuration(getEnv("AUTH_TOKEN_TTL", "24h"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid AUTH_TOKEN_TTL")
+	}
+	authService := auth.NewService(db, tokenTTL)
+
+	// Create blob storage for attachments
+	blobs, err := storage.New(storage.Config{
+		Backend:         getEnv("STORAGE_BACKEND", "local"),
+		Path:            getEnv("STORAGE_PATH", "./data/attachments"),
+		Endpoint:        getEnv("S3_ENDPOINT", ""),
+		Bucket:          getEnv("S3_BUCKET", ""),
+		Region:          getEnv("S3_REGION", "us-east-1"),
+		AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to create blob storage")
+	}
+	maxAttachmentSize, err := strconv.ParseInt(getEnv("ATTACHMENT_MAX_SIZE", "26214400"), 10, 64)
+	if err != nil || maxAttachmentSize <= 0 {
+		logrus.WithError(err).Fatal("Invalid ATTACHMENT_MAX_SIZE")
+	}
+
+	// Purge items that have been in the trash for longer than the retention period
+	retentionDays, err := strconv.Atoi(getEnv("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || retentionDays < 0 {
+		logrus.WithError(err).Fatal("Invalid TRASH_RETENTION_DAYS")
+	}
+	if retentionDays > 0 {
+		go database.PurgeTrashPeriodically(db, blobs, time.Duration(retentionDays)*24*time.Hour, time.Hour)
+	}
+
+	// Deliver the events in the outbox to webhooks, retrying failed deliveries
+	webhookTimeout, err := time.ParseDuration(getEnv("WEBHOOK_TIMEOUT", "10s"))
+	if err != nil || webhookTimeout <= 0 {
+		logrus.WithError(err).Fatal("Invalid WEBHOOK_TIMEOUT")
+	}
+	webhookMaxAttempts, err := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if err != nil || webhookMaxAttempts < 1 {
+		logrus.WithError(err).Fatal("Invalid WEBHOOK_MAX_ATTEMPTS")
+	}
+	webhookBackoff, err := time.ParseDuration(getEnv("WEBHOOK_RETRY_BACKOFF", "30s"))
+	if err != nil || webhookBackoff <= 0 {
+		logrus.WithError(err).Fatal("Invalid WEBHOOK_RETRY_BACKOFF")
+	}
+	webhookInterval, err := time.ParseDuration(getEnv("WEBHOOK_POLL_INTERVAL", "5s"))
+	if err != nil || webhookInterval <= 0 {
+		logrus.WithError(err).Fatal("Invalid WEBHOOK_POLL_INTERVAL")
+	}
+	dispatcher := webhook.NewDispatcher(db, webhookTimeout, webhookMaxAttempts, webhookBackoff)
+	go dispatcher.RunPeriodically(webhookInterval)
+
+	// Stream committed events to clients, polling the outbox or, with several
+	// replicas, listening for the notifications Postgres sends for them
+	var broker stream.Broker
+	switch streamBroker := getEnv("STREAM_BROKER", "local"); streamBroker {
+	case "local":
+		streamInterval, err := time.ParseDuration(getEnv("STREAM_POLL_INTERVAL", "1s"))
+		if err != nil || streamInterval <= 0 {
+			logrus.WithError(err).Fatal("Invalid STREAM_POLL_INTERVAL")
+		}
+		broker = stream.NewLocalBroker(db, streamInterval)
+	case "postgres":
+		broker = stream.NewPostgresBroker(db, dbConfig.DSN())
+	default:
+		logrus.Fatalf("Invalid STREAM_BROKER %q, must be local or postgres", streamBroker)
+	}
+	go broker.Run(context.Background())
+
+	// Run collaborative editing sessions, saving their content periodically
+	collabInterval, err := time.ParseDuration(getEnv("COLLAB_SNAPSHOT_INTERVAL", "10s"))
+	if err != nil || collabInterval <= 0 {
+		logrus.WithError(err).Fatal("Invalid COLLAB_SNAPSHOT_INTERVAL")
+	}
+	collabHub := collab.NewHub(api.NewCollabStore(db), collabInterval)
+
 	// Create API resources
 	userResource := api.NewUserResource(db)
 	folderResource := api.NewFolderResource(db)
 	documentResource := api.NewDocumentResource(db)
+	tagResource := api.NewTagResource(db)
+	shareResource := api.NewShareResource(db)
+	shareLinkResource := api.NewShareLinkResource(db)
+	webhookResource := api.NewWebhookResource(db)
+	webhookDeliveryResource := api.NewWebhookDeliveryResource(db)
+	auditEntryResource := api.NewAuditEntryResource(db)
+	authHandler := api.NewAuthHandler(authService)
+	documentVersionHandler := api.NewDocumentVersionHandler(db)
+	trashHandler := api.NewTrashHandler(db, blobs)
+	treeHandler := api.NewTreeHandler(db)
+	pathHandler := api.NewPathHandler(db)
+	attachmentHandler := api.NewAttachmentHandler(db, blobs, maxAttachmentSize)
+	sharedHandler := api.NewSharedHandler(db)
+	publicLinkHandler := api.NewPublicLinkHandler(db, blobs)
+	copyHandler := api.NewCopyHandler(db, blobs)
+	bulkHandler := api.NewBulkHandler(db)
+	webhookDeliveryHandler := api.NewWebhookDeliveryHandler(db)
+	streamHandler := api.NewStreamHandler(db, broker)
+	collabHandler := api.NewCollabHandler(db, collabHub)
+	renderHandler := api.NewRenderHandler(db)
 
 	// Create API
-	api := api2go.NewAPI("v1")
+	v1 := api2go.NewAPI("v1")
+
+	// Let resources set response headers such as ETag
+	v1.UseMiddleware(api.ResponseWriterMiddleware)
 
 	// Register resources
-	api.AddResource(models.User{}, userResource)
-	api.AddResource(models.Folder{}, folderResource)
-	api.AddResource(models.Document{}, documentResource)
+	v1.AddResource(models.User{}, userResource)
+	v1.AddResource(models.Folder{}, folderResource)
+	v1.AddResource(models.Document{}, documentResource)
+	v1.AddResource(models.Tag{}, tagResource)
+	v1.AddResource(models.Share{}, shareResource)
+	v1.AddResource(models.ShareLink{}, shareLinkResource)
+	v1.AddResource(models.Webhook{}, webhookResource)
+	v1.AddResource(models.WebhookDelivery{}, webhookDeliveryResource)
+	v1.AddResource(models.AuditEntry{}, auditEntryResource)
+
+	// Register additional routes
+	authHandler.Register(v1.Router(), "/v1")
+	documentVersionHandler.Register(v1.Router(), "/v1")
+	trashHandler.Register(v1.Router(), "/v1")
+	treeHandler.Register(v1.Router(), "/v1")
+	pathHandler.Register(v1.Router(), "/v1")
+	attachmentHandler.Register(v1.Router(), "/v1")
+	sharedHandler.Register(v1.Router(), "/v1")
+	publicLinkHandler.Register(v1.Router(), "/v1")
+	copyHandler.Register(v1.Router(), "/v1")
+	bulkHandler.Register(v1.Router(), "/v1")
+	webhookDeliveryHandler.Register(v1.Router(), "/v1")
+	streamHandler.Register(v1.Router(), "/v1")
+	collabHandler.Register(v1.Router(), "/v1")
+	renderHandler.Register(v1.Router(), "/v1")
+
+	// Require a bearer token for everything except registration, login and public links
+	handler := auth.Middleware(authService, isPublicRoute, acceptsTokenParameter, v1.Handler())
 
 	// Start server
 	port := getEnv("PORT", "8080")
 	logrus.WithField("port", port).Info("Starting server")
-	http.ListenAndServe(":"+port, api.Handler())
+	http.ListenAndServe(":"+port, handler)
+}
+
+// isPublicRoute reports whether a request may be served without authentication
+func isPublicRoute(r *http.Request) bool {
+	switch {
+	case r.Method == http.MethodOptions:
+		return true
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/users":
+		return true
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/login":
+		return true
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/public/"):
+		return true
+	}
+	return false
+}
+
+// sessionPath matches the paths of the collaborative editing sessions
+var sessionPath = regexp.MustCompile(`^/v1/documents/[^/]+/session$`)
+
+// acceptsTokenParameter reports whether a request may pass its token in the
+// access_token parameter: the change stream, for EventSource, and the
+// WebSocket handshakes of editing sessions, as browsers can't set headers on
+// either
+func acceptsTokenParameter(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	return r.URL.Path == "/v1/stream" || sessionPath.MatchString(r.URL.Path)
 }
 
 // getEnv gets an environment variable or returns a default value
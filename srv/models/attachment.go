@@ -0,0 +1,80 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Attachment represents a binary file attached to a document. The file itself
+// lives in blob storage under StorageKey.
+type Attachment struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	DocumentID  uuid.UUID `gorm:"type:uuid;not null;index" json:"document_id"`
+	Document    Document  `gorm:"foreignKey:DocumentID" json:"-"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	User        User      `gorm:"foreignKey:UserID" json:"-"`
+	Filename    string    `gorm:"size:255;not null" json:"filename"`
+	ContentType string    `gorm:"size:255;not null" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	SHA256      string    `gorm:"column:sha256;size:64;not null" json:"sha256"`
+	StorageKey  string    `gorm:"size:255;not null" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (a Attachment) GetID() string {
+	return a.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (a *Attachment) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	a.ID = uuid
+	return nil
+}
+
+// GetReferences to satisfy the jsonapi.MarshalReferences interface
+func (a Attachment) GetReferences() []jsonapi.Reference {
+	return []jsonapi.Reference{
+		{
+			Type: "documents",
+			Name: "document",
+		},
+		{
+			Type: "users",
+			Name: "user",
+		},
+	}
+}
+
+// GetReferencedIDs to satisfy the jsonapi.MarshalLinkedRelations interface
+func (a Attachment) GetReferencedIDs() []jsonapi.ReferenceID {
+	return []jsonapi.ReferenceID{
+		{
+			ID:   a.DocumentID.String(),
+			Type: "documents",
+			Name: "document",
+		},
+		{
+			ID:   a.UserID.String(),
+			Type: "users",
+			Name: "user",
+		},
+	}
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (a *Attachment) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package models
+
+import "encoding/json"
+
+// attributeNames returns the keys of the JSON object in data. Models record
+// them when decoding a payload, so that an update can tell attributes that
+// were left out from attributes explicitly set to null.
+func attributeNames(data []byte) (map[string]bool, error) {
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(attributes))
+	for name := range attributes {
+		names[name] = true
+	}
+	return names, nil
+}
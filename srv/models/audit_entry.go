@@ -0,0 +1,208 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit trail. Restore takes an item out of the
+// trash, while purge deletes it from the trash for good.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// AuditActions are the actions recorded in the audit trail
+var AuditActions = []string{AuditCreate, AuditUpdate, AuditDelete, AuditRestore, AuditPurge}
+
+// AuditTargetTypes are the types of the resources the audit trail covers
+var AuditTargetTypes = []string{"user", "folder", "document"}
+
+// ErrAuditEntryImmutable is returned when an audit entry is updated or deleted
+var ErrAuditEntryImmutable = errors.New("audit entries are immutable")
+
+// redactedValue stands in for the values of secret attributes in changes
+const redactedValue = "[redacted]"
+
+// auditIgnoredAttributes change along with every write or are derived from
+// other attributes, so recording them would only add noise to the changes
+var auditIgnoredAttributes = map[string]bool{
+	"version":    true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+	"excerpt":    true,
+}
+
+// AuditChange is the value of an attribute before and after a change. Before
+// is null for a creation and after is null for a deletion.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEntry records who created, updated or deleted a user, folder or
+// document, and when. Entries are written in the same transaction as the
+// change and never modified afterwards. OwnerID is the user owning the target,
+// who can read the entries along with the actor. Like events, entries keep no
+// foreign keys so that they outlive the resources they describe.
+type AuditEntry struct {
+	ID         uuid.UUID              `gorm:"type:uuid;primary_key" json:"id"`
+	ActorID    uuid.UUID              `gorm:"type:uuid;not null;index" json:"actor_id"`
+	Action     string                 `gorm:"size:16;not null" json:"action"`
+	TargetType string                 `gorm:"size:32;not null" json:"target_type"`
+	TargetID   uuid.UUID              `gorm:"type:uuid;not null;index" json:"target_id"`
+	OwnerID    uuid.UUID              `gorm:"type:uuid;not null;index" json:"owner_id"`
+	Changes    map[string]AuditChange `gorm:"serializer:json;type:text;not null" json:"changes"`
+	CreatedAt  time.Time              `gorm:"index" json:"created_at"`
+}
+
+// NewAuditEntry creates the audit entry for an action of actorID on a user,
+// folder or document. Before is the resource as it was, nil for a creation,
+// and after is the resource as it is now, nil for a deletion or purge.
+// Changes holds every attribute whose value differs between the two, with the
+// tags of folders and documents as a sorted list of IDs and changes to
+// passwords recorded without their values.
+func NewAuditEntry(action string, actorID uuid.UUID, before, after jsonapi.MarshalIdentifier) (AuditEntry, error) {
+	target := after
+	if target == nil {
+		target = before
+	}
+	entry := AuditEntry{ID: uuid.New(), ActorID: actorID, Action: action, CreatedAt: time.Now().UTC()}
+	switch r := target.(type) {
+	case User:
+		entry.TargetType, entry.TargetID, entry.OwnerID = "user", r.ID, r.ID
+	case Folder:
+		entry.TargetType, entry.TargetID, entry.OwnerID = "folder", r.ID, r.UserID
+	case Document:
+		entry.TargetType, entry.TargetID, entry.OwnerID = "document", r.ID, r.UserID
+	default:
+		return AuditEntry{}, fmt.Errorf("no audit entries for resources of type %T", target)
+	}
+
+	beforeAttributes, err := auditAttributes(before)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	afterAttributes, err := auditAttributes(after)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	entry.Changes = map[string]AuditChange{}
+	for name, value := range beforeAttributes {
+		if afterValue, ok := afterAttributes[name]; !ok || !reflect.DeepEqual(value, afterValue) {
+			entry.Changes[name] = AuditChange{Before: value, After: afterAttributes[name]}
+		}
+	}
+	for name, value := range afterAttributes {
+		if _, ok := beforeAttributes[name]; !ok {
+			entry.Changes[name] = AuditChange{After: value}
+		}
+	}
+
+	if change, ok := entry.Changes["password"]; ok {
+		entry.Changes["password"] = AuditChange{Before: redact(change.Before), After: redact(change.After)}
+	}
+	return entry, nil
+}
+
+// auditAttributes returns the attributes of a resource as they are served,
+// decoded into generic values so that they can be compared, plus those the
+// API doesn't serve as attributes but that the audit trail tracks
+func auditAttributes(resource jsonapi.MarshalIdentifier) (map[string]interface{}, error) {
+	attributes := map[string]interface{}{}
+	if resource == nil {
+		return attributes, nil
+	}
+
+	document, err := jsonapi.MarshalToStruct(resource, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(document.Data.DataObject.Attributes, &attributes); err != nil {
+		return nil, err
+	}
+	for name := range auditIgnoredAttributes {
+		delete(attributes, name)
+	}
+
+	switch r := resource.(type) {
+	case User:
+		attributes["password"] = r.PasswordHash
+	case Folder:
+		attributes["tags"] = tagIDs(r.Tags)
+	case Document:
+		attributes["tags"] = tagIDs(r.Tags)
+	}
+	return attributes, nil
+}
+
+// tagIDs returns the sorted IDs of tags in the form they take once decoded
+func tagIDs(tags []Tag) []interface{} {
+	ids := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		ids = append(ids, tag.ID.String())
+	}
+	sort.Strings(ids)
+	result := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, id)
+	}
+	return result
+}
+
+// redact hides a secret value, keeping only whether there was one
+func redact(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return nil
+	}
+	return redactedValue
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (e AuditEntry) GetID() string {
+	return e.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (e *AuditEntry) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	e.ID = uuid
+	return nil
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (e *AuditEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeUpdate keeps audit entries from being modified
+func (e *AuditEntry) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditEntryImmutable
+}
+
+// BeforeDelete keeps audit entries from being deleted
+func (e *AuditEntry) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditEntryImmutable
+}
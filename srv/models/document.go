@@ -1,24 +1,57 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/manyminds/api2go/jsonapi"
 	"gorm.io/gorm"
+	"strconv"
 	"time"
 )
 
+// Content types of documents. Plain text is the default; Markdown and HTML
+// are rendered to sanitized HTML for display.
+const (
+	ContentTypePlain    = "text/plain"
+	ContentTypeMarkdown = "text/markdown"
+	ContentTypeHTML     = "text/html"
+)
+
+// ValidContentType reports whether contentType is one of the content types a
+// document can have
+func ValidContentType(contentType string) bool {
+	switch contentType {
+	case ContentTypePlain, ContentTypeMarkdown, ContentTypeHTML:
+		return true
+	}
+	return false
+}
+
 // Document represents a document in the system
 type Document struct {
-	ID        uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
-	Title     string         `gorm:"size:255;not null" json:"title"`
-	Content   string         `gorm:"type:text" json:"content"`
-	UserID    uuid.UUID      `gorm:"type:uuid;not null" json:"user_id"`
-	User      User           `gorm:"foreignKey:UserID" json:"-"`
-	FolderID  *uuid.UUID     `gorm:"type:uuid;null" json:"folder_id"`
-	Folder    *Folder        `gorm:"foreignKey:FolderID" json:"-"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	ID          uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	Title       string         `gorm:"size:255;not null" json:"title"`
+	Content     string         `gorm:"type:text" json:"content"`
+	ContentType string         `gorm:"size:32;not null;default:'text/plain'" json:"content_type"`
+	Revision    int            `gorm:"not null;default:1" json:"revision"`
+	Version     int            `gorm:"not null;default:1" json:"version"`
+	UserID      uuid.UUID      `gorm:"type:uuid;not null" json:"user_id"`
+	User        User           `gorm:"foreignKey:UserID" json:"-"`
+	FolderID    *uuid.UUID     `gorm:"type:uuid;null" json:"folder_id"`
+	Folder      *Folder        `gorm:"foreignKey:FolderID" json:"-"`
+	Tags        []Tag          `gorm:"many2many:document_tags" json:"-"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	Rank        float64        `gorm:"->;-:migration" json:"rank,omitempty"`
+	Excerpt     string         `gorm:"-" json:"excerpt,omitempty"`
+	// attributes holds the names of the attributes decoded from a payload
+	attributes map[string]bool
+	// relationships holds the names of the relationships set from a payload
+	relationships map[string]bool
+	// included holds the names of the relationships to include in a response
+	included map[string]bool
 }
 
 // GetID to satisfy jsonapi.MarshalIdentifier interface
@@ -28,6 +61,9 @@ func (d Document) GetID() string {
 
 // SetID to satisfy jsonapi.UnmarshalIdentifier interface
 func (d *Document) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		return err
@@ -47,6 +83,10 @@ func (d Document) GetReferences() []jsonapi.Reference {
 			Type: "folders",
 			Name: "folder",
 		},
+		{
+			Type: "tags",
+			Name: "tags",
+		},
 	}
 }
 
@@ -69,9 +109,92 @@ func (d Document) GetReferencedIDs() []jsonapi.ReferenceID {
 		})
 	}
 
+	return append(result, tagReferenceIDs(d.Tags)...)
+}
+
+// GetReferencedStructs to satisfy the jsonapi.MarshalIncludedRelations
+// interface. It returns the loaded resources of the relationships passed to
+// Include.
+func (d Document) GetReferencedStructs() []jsonapi.MarshalIdentifier {
+	result := []jsonapi.MarshalIdentifier{}
+	if d.included["user"] && d.User.ID != uuid.Nil {
+		result = append(result, d.User)
+	}
+	if d.included["folder"] && d.Folder != nil {
+		result = append(result, *d.Folder)
+	}
+	if d.included["tags"] {
+		for _, tag := range d.Tags {
+			result = append(result, tag)
+		}
+	}
 	return result
 }
 
+// Include selects relationships, such as user or folder, whose resources end
+// up in the included member of the document's response
+func (d *Document) Include(names ...string) {
+	d.included = includeNames(d.included, names)
+}
+
+// SetToManyReferenceIDs to satisfy the jsonapi.UnmarshalToManyRelations interface
+func (d *Document) SetToManyReferenceIDs(name string, IDs []string) error {
+	if name != "tags" {
+		return errors.New("relationship " + name + " cannot be set")
+	}
+	tags, err := tagsFromIDs(IDs)
+	if err != nil {
+		return err
+	}
+	d.Tags = tags
+	d.relationships = includeNames(d.relationships, []string{name})
+	return nil
+}
+
+// NewVersion returns a snapshot of the document's current revision authored by userID
+func (d Document) NewVersion(userID uuid.UUID) DocumentVersion {
+	return DocumentVersion{
+		DocumentID: d.ID,
+		Revision:   d.Revision,
+		Title:      d.Title,
+		Content:    d.Content,
+		UserID:     userID,
+	}
+}
+
+// ETag returns the entity tag of the document's current version
+func (d Document) ETag() string {
+	return `"` + strconv.Itoa(d.Version) + `"`
+}
+
+// UnmarshalJSON decodes the attributes of a document, recording which of them
+// the payload contained
+func (d *Document) UnmarshalJSON(data []byte) error {
+	type attributes Document
+	if err := json.Unmarshal(data, (*attributes)(d)); err != nil {
+		return err
+	}
+	names, err := attributeNames(data)
+	if err != nil {
+		return err
+	}
+	d.attributes = names
+	return nil
+}
+
+// HasAttribute reports whether the payload the document was decoded from
+// contained the named attribute. A document that wasn't decoded from a payload
+// has all of its attributes.
+func (d Document) HasAttribute(name string) bool {
+	return d.attributes == nil || d.attributes[name]
+}
+
+// HasRelationship reports whether the named relationship was set from a
+// payload. Unlike attributes, relationships such as tags are never assumed.
+func (d Document) HasRelationship(name string) bool {
+	return d.relationships[name]
+}
+
 // BeforeCreate will set a UUID rather than numeric ID
 func (d *Document) BeforeCreate(tx *gorm.DB) error {
 	if d.ID == uuid.Nil {
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"time"
+)
+
+// DocumentVersion represents a recorded revision of a document's title and content
+type DocumentVersion struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	DocumentID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_document_versions_revision" json:"document_id"`
+	Document   Document  `gorm:"foreignKey:DocumentID" json:"-"`
+	Revision   int       `gorm:"not null;uniqueIndex:idx_document_versions_revision" json:"revision"`
+	Title      string    `gorm:"size:255;not null" json:"title"`
+	Content    string    `gorm:"type:text" json:"content"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	User       User      `gorm:"foreignKey:UserID" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (v DocumentVersion) GetID() string {
+	return v.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (v *DocumentVersion) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	v.ID = uuid
+	return nil
+}
+
+// GetReferences to satisfy the jsonapi.MarshalReferences interface
+func (v DocumentVersion) GetReferences() []jsonapi.Reference {
+	return []jsonapi.Reference{
+		{
+			Type: "documents",
+			Name: "document",
+		},
+		{
+			Type: "users",
+			Name: "user",
+		},
+	}
+}
+
+// GetReferencedIDs to satisfy the jsonapi.MarshalLinkedRelations interface
+func (v DocumentVersion) GetReferencedIDs() []jsonapi.ReferenceID {
+	return []jsonapi.ReferenceID{
+		{
+			ID:   v.DocumentID.String(),
+			Type: "documents",
+			Name: "document",
+		},
+		{
+			ID:   v.UserID.String(),
+			Type: "users",
+			Name: "user",
+		},
+	}
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (v *DocumentVersion) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Actions of events, which are named <resource>.<action>, e.g. document.moved
+const (
+	EventCreated  = "created"
+	EventUpdated  = "updated"
+	EventMoved    = "moved"
+	EventDeleted  = "deleted"
+	EventRestored = "restored"
+)
+
+// EventTypes are the types of the events recorded for changes. Users are
+// neither moved nor restored from the trash.
+var EventTypes = []string{
+	"user.created", "user.updated", "user.deleted",
+	"folder.created", "folder.updated", "folder.moved", "folder.deleted", "folder.restored",
+	"document.created", "document.updated", "document.moved", "document.deleted", "document.restored",
+}
+
+// Event is a change to a user, folder or document. Events are written to the
+// events table, the outbox, in the same transaction as the change itself, and
+// the webhook dispatcher later fans them out to the webhooks of the user
+// owning the changed resource.
+type Event struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	Type         string     `gorm:"size:64;not null" json:"type"`
+	ResourceType string     `gorm:"size:32;not null" json:"resource_type"`
+	ResourceID   uuid.UUID  `gorm:"type:uuid;not null" json:"resource_id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	ActorID      uuid.UUID  `gorm:"type:uuid;not null" json:"actor_id"`
+	Payload      string     `gorm:"type:text;not null" json:"-"`
+	DispatchedAt *time.Time `gorm:"index" json:"dispatched_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// eventPayload is the body of the requests delivering an event to webhooks
+type eventPayload struct {
+	ID        uuid.UUID              `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	ActorID   uuid.UUID              `json:"actor_id"`
+	Data      *jsonapi.Data          `json:"data"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+}
+
+// NewEvent creates the event for an action of actorID on a user, folder or
+// document. Its payload carries the type, ID and attributes of the resource as
+// of the action, without relationships that may not have been loaded, along
+// with details such as the previous folder of a move in meta.
+func NewEvent(action string, resource jsonapi.MarshalIdentifier, actorID uuid.UUID, meta map[string]interface{}) (Event, error) {
+	event := Event{ID: uuid.New(), ActorID: actorID, CreatedAt: time.Now().UTC()}
+	switch r := resource.(type) {
+	case User:
+		event.ResourceType, event.ResourceID, event.UserID = "user", r.ID, r.ID
+	case Folder:
+		event.ResourceType, event.ResourceID, event.UserID = "folder", r.ID, r.UserID
+	case Document:
+		event.ResourceType, event.ResourceID, event.UserID = "document", r.ID, r.UserID
+	default:
+		return Event{}, fmt.Errorf("no events for resources of type %T", resource)
+	}
+	event.Type = event.ResourceType + "." + action
+
+	document, err := jsonapi.MarshalToStruct(resource, nil)
+	if err != nil {
+		return Event{}, err
+	}
+	document.Data.DataObject.Relationships = nil
+	payload, err := json.Marshal(eventPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		ActorID:   actorID,
+		Data:      document.Data.DataObject,
+		Meta:      meta,
+	})
+	if err != nil {
+		return Event{}, err
+	}
+	event.Payload = string(payload)
+	return event, nil
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (e *Event) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/manyminds/api2go/jsonapi"
 	"gorm.io/gorm"
+	"strconv"
 	"time"
 )
 
@@ -17,9 +20,17 @@ type Folder struct {
 	Parent    *Folder        `gorm:"foreignKey:ParentID" json:"-"`
 	Folders   []Folder       `gorm:"foreignKey:ParentID" json:"-"`
 	Documents []Document     `gorm:"foreignKey:FolderID" json:"-"`
+	Tags      []Tag          `gorm:"many2many:folder_tags" json:"-"`
+	Version   int            `gorm:"not null;default:1" json:"version"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	// attributes holds the names of the attributes decoded from a payload
+	attributes map[string]bool
+	// relationships holds the names of the relationships set from a payload
+	relationships map[string]bool
+	// included holds the names of the relationships to include in a response
+	included map[string]bool
 }
 
 // GetID to satisfy jsonapi.MarshalIdentifier interface
@@ -29,6 +40,9 @@ func (f Folder) GetID() string {
 
 // SetID to satisfy jsonapi.UnmarshalIdentifier interface
 func (f *Folder) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		return err
@@ -49,12 +63,18 @@ func (f Folder) GetReferences() []jsonapi.Reference {
 			Name: "parent",
 		},
 		{
-			Type: "folders",
-			Name: "folders",
+			Type:        "folders",
+			Name:        "folders",
+			IsNotLoaded: f.Folders == nil,
 		},
 		{
-			Type: "documents",
-			Name: "documents",
+			Type:        "documents",
+			Name:        "documents",
+			IsNotLoaded: f.Documents == nil,
+		},
+		{
+			Type: "tags",
+			Name: "tags",
 		},
 	}
 }
@@ -96,9 +116,92 @@ func (f Folder) GetReferencedIDs() []jsonapi.ReferenceID {
 		})
 	}
 
+	return append(result, tagReferenceIDs(f.Tags)...)
+}
+
+// GetReferencedStructs to satisfy the jsonapi.MarshalIncludedRelations
+// interface. It returns the loaded resources of the relationships passed to
+// Include.
+func (f Folder) GetReferencedStructs() []jsonapi.MarshalIdentifier {
+	result := []jsonapi.MarshalIdentifier{}
+	if f.included["user"] && f.User.ID != uuid.Nil {
+		result = append(result, f.User)
+	}
+	if f.included["parent"] && f.Parent != nil {
+		result = append(result, *f.Parent)
+	}
+	if f.included["folders"] {
+		for _, folder := range f.Folders {
+			result = append(result, folder)
+		}
+	}
+	if f.included["documents"] {
+		for _, document := range f.Documents {
+			result = append(result, document)
+		}
+	}
+	if f.included["tags"] {
+		for _, tag := range f.Tags {
+			result = append(result, tag)
+		}
+	}
 	return result
 }
 
+// Include selects relationships, such as documents or parent, whose resources
+// end up in the included member of the folder's response
+func (f *Folder) Include(names ...string) {
+	f.included = includeNames(f.included, names)
+}
+
+// SetToManyReferenceIDs to satisfy the jsonapi.UnmarshalToManyRelations interface.
+// Only tags can be set; subfolders and documents are moved by updating them.
+func (f *Folder) SetToManyReferenceIDs(name string, IDs []string) error {
+	if name != "tags" {
+		return errors.New("relationship " + name + " cannot be set")
+	}
+	tags, err := tagsFromIDs(IDs)
+	if err != nil {
+		return err
+	}
+	f.Tags = tags
+	f.relationships = includeNames(f.relationships, []string{name})
+	return nil
+}
+
+// ETag returns the entity tag of the folder's current version
+func (f Folder) ETag() string {
+	return `"` + strconv.Itoa(f.Version) + `"`
+}
+
+// UnmarshalJSON decodes the attributes of a folder, recording which of them
+// the payload contained
+func (f *Folder) UnmarshalJSON(data []byte) error {
+	type attributes Folder
+	if err := json.Unmarshal(data, (*attributes)(f)); err != nil {
+		return err
+	}
+	names, err := attributeNames(data)
+	if err != nil {
+		return err
+	}
+	f.attributes = names
+	return nil
+}
+
+// HasAttribute reports whether the payload the folder was decoded from
+// contained the named attribute. A folder that wasn't decoded from a payload
+// has all of its attributes.
+func (f Folder) HasAttribute(name string) bool {
+	return f.attributes == nil || f.attributes[name]
+}
+
+// HasRelationship reports whether the named relationship was set from a
+// payload. Unlike attributes, relationships such as tags are never assumed.
+func (f Folder) HasRelationship(name string) bool {
+	return f.relationships[name]
+}
+
 // BeforeCreate will set a UUID rather than numeric ID
 func (f *Folder) BeforeCreate(tx *gorm.DB) error {
 	if f.ID == uuid.Nil {
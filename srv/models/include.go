@@ -0,0 +1,13 @@
+package models
+
+// includeNames adds names to a set of relationships whose resources are
+// included in a compound document, creating the set if needed
+func includeNames(included map[string]bool, names []string) map[string]bool {
+	if included == nil {
+		included = make(map[string]bool, len(names))
+	}
+	for _, name := range names {
+		included[name] = true
+	}
+	return included
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Session represents a bearer token issued to a user on login
+type Session struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+	TokenHash string    `gorm:"size:64;not null;unique" json:"-"`
+	Token     string    `gorm:"-" json:"token,omitempty"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (s Session) GetID() string {
+	return s.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (s *Session) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	s.ID = uuid
+	return nil
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Roles a share can grant, from least to most privileged. Viewers can read,
+// editors can also change and add items, and owners can also delete items and
+// manage their shares.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// roleRanks orders the roles by privilege
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// ValidRole reports whether role is one of the roles a share can grant
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants at least the rights of required
+func RoleAtLeast(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required] && roleRanks[role] > 0
+}
+
+// Share grants a user a role on a folder, including everything inside it, or on
+// a single document. Exactly one of FolderID and DocumentID is set. When
+// creating a share, the user can be given by Email instead of UserID.
+type Share struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User        User       `gorm:"foreignKey:UserID" json:"-"`
+	Email       string     `gorm:"-" json:"email,omitempty"`
+	FolderID    *uuid.UUID `gorm:"type:uuid;null;index" json:"folder_id"`
+	Folder      *Folder    `gorm:"foreignKey:FolderID" json:"-"`
+	DocumentID  *uuid.UUID `gorm:"type:uuid;null;index" json:"document_id"`
+	Document    *Document  `gorm:"foreignKey:DocumentID" json:"-"`
+	Role        string     `gorm:"size:16;not null" json:"role"`
+	OwnerID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"owner_id"`
+	CreatedByID uuid.UUID  `gorm:"type:uuid;not null" json:"created_by_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (s Share) GetID() string {
+	return s.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (s *Share) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	s.ID = uuid
+	return nil
+}
+
+// GetReferences to satisfy the jsonapi.MarshalReferences interface
+func (s Share) GetReferences() []jsonapi.Reference {
+	return []jsonapi.Reference{
+		{
+			Type: "users",
+			Name: "user",
+		},
+		{
+			Type: "folders",
+			Name: "folder",
+		},
+		{
+			Type: "documents",
+			Name: "document",
+		},
+	}
+}
+
+// GetReferencedIDs to satisfy the jsonapi.MarshalLinkedRelations interface
+func (s Share) GetReferencedIDs() []jsonapi.ReferenceID {
+	result := []jsonapi.ReferenceID{
+		{
+			ID:   s.UserID.String(),
+			Type: "users",
+			Name: "user",
+		},
+	}
+
+	// Add the shared folder or document
+	if s.FolderID != nil {
+		result = append(result, jsonapi.ReferenceID{
+			ID:   s.FolderID.String(),
+			Type: "folders",
+			Name: "folder",
+		})
+	}
+	if s.DocumentID != nil {
+		result = append(result, jsonapi.ReferenceID{
+			ID:   s.DocumentID.String(),
+			Type: "documents",
+			Name: "document",
+		})
+	}
+
+	return result
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (s *Share) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ShareLink is a tokenized public link giving anyone who knows it read-only
+// access to a folder, including everything inside it, or to a single document.
+// Exactly one of FolderID and DocumentID is set. Only the hash of the token is
+// stored; the token itself is returned once when the link is created.
+type ShareLink struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	TokenHash         string     `gorm:"size:64;not null;unique" json:"-"`
+	Token             string     `gorm:"-" json:"token,omitempty"`
+	UserID            uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User              User       `gorm:"foreignKey:UserID" json:"-"`
+	OwnerID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"owner_id"`
+	FolderID          *uuid.UUID `gorm:"type:uuid;null;index" json:"folder_id"`
+	Folder            *Folder    `gorm:"foreignKey:FolderID" json:"-"`
+	DocumentID        *uuid.UUID `gorm:"type:uuid;null;index" json:"document_id"`
+	Document          *Document  `gorm:"foreignKey:DocumentID" json:"-"`
+	Password          string     `gorm:"-" json:"password,omitempty"`
+	PasswordHash      string     `gorm:"size:255" json:"-"`
+	PasswordProtected bool       `gorm:"-" json:"password_protected"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	MaxDownloads      *int       `json:"max_downloads"`
+	DownloadCount     int        `gorm:"not null;default:0" json:"download_count"`
+	RevokedAt         *time.Time `json:"revoked_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (l ShareLink) GetID() string {
+	return l.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (l *ShareLink) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	l.ID = uuid
+	return nil
+}
+
+// GetReferences to satisfy the jsonapi.MarshalReferences interface
+func (l ShareLink) GetReferences() []jsonapi.Reference {
+	return []jsonapi.Reference{
+		{
+			Type: "users",
+			Name: "user",
+		},
+		{
+			Type: "folders",
+			Name: "folder",
+		},
+		{
+			Type: "documents",
+			Name: "document",
+		},
+	}
+}
+
+// GetReferencedIDs to satisfy the jsonapi.MarshalLinkedRelations interface
+func (l ShareLink) GetReferencedIDs() []jsonapi.ReferenceID {
+	result := []jsonapi.ReferenceID{
+		{
+			ID:   l.UserID.String(),
+			Type: "users",
+			Name: "user",
+		},
+	}
+
+	// Add the linked folder or document
+	if l.FolderID != nil {
+		result = append(result, jsonapi.ReferenceID{
+			ID:   l.FolderID.String(),
+			Type: "folders",
+			Name: "folder",
+		})
+	}
+	if l.DocumentID != nil {
+		result = append(result, jsonapi.ReferenceID{
+			ID:   l.DocumentID.String(),
+			Type: "documents",
+			Name: "document",
+		})
+	}
+
+	return result
+}
+
+// Expired reports whether the link's expiry has passed at the given time
+func (l ShareLink) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// Exhausted reports whether the link has reached its download limit
+func (l ShareLink) Exhausted() bool {
+	return l.MaxDownloads != nil && l.DownloadCount >= *l.MaxDownloads
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (l *ShareLink) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+// AfterFind reports whether the loaded link is protected by a password
+func (l *ShareLink) AfterFind(tx *gorm.DB) error {
+	l.PasswordProtected = l.PasswordHash != ""
+	return nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Tag represents a user-defined label that can be attached to documents and folders
+type Tag struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	Name          string    `gorm:"size:64;not null" json:"name"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	User          User      `gorm:"foreignKey:UserID" json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	DocumentCount int64     `gorm:"->;-:migration" json:"document_count"`
+	FolderCount   int64     `gorm:"->;-:migration" json:"folder_count"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (t Tag) GetID() string {
+	return t.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (t *Tag) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	t.ID = uuid
+	return nil
+}
+
+// GetReferences to satisfy the jsonapi.MarshalReferences interface
+func (t Tag) GetReferences() []jsonapi.Reference {
+	return []jsonapi.Reference{
+		{
+			Type: "users",
+			Name: "user",
+		},
+	}
+}
+
+// GetReferencedIDs to satisfy the jsonapi.MarshalLinkedRelations interface
+func (t Tag) GetReferencedIDs() []jsonapi.ReferenceID {
+	return []jsonapi.ReferenceID{
+		{
+			ID:   t.UserID.String(),
+			Type: "users",
+			Name: "user",
+		},
+	}
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *Tag) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// tagReferenceIDs returns the relationship entries of tags
+func tagReferenceIDs(tags []Tag) []jsonapi.ReferenceID {
+	result := make([]jsonapi.ReferenceID, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, jsonapi.ReferenceID{
+			ID:   tag.ID.String(),
+			Type: "tags",
+			Name: "tags",
+		})
+	}
+	return result
+}
+
+// tagsFromIDs converts the IDs of a tags relationship into tags carrying only
+// their ID. The result is never nil, so an empty relationship clears the tags.
+func tagsFromIDs(ids []string) ([]Tag, error) {
+	tags := make([]Tag, 0, len(ids))
+	for _, id := range ids {
+		var tag Tag
+		if err := tag.SetID(id); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/manyminds/api2go/jsonapi"
 	"gorm.io/gorm"
@@ -9,14 +10,20 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID        uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
-	Username  string         `gorm:"size:255;not null;unique" json:"username"`
-	Email     string         `gorm:"size:255;not null;unique" json:"email"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
-	Folders   []Folder       `gorm:"foreignKey:UserID" json:"-"`
-	Documents []Document     `gorm:"foreignKey:UserID" json:"-"`
+	ID           uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	Username     string         `gorm:"size:255;not null;unique" json:"username"`
+	Email        string         `gorm:"size:255;not null;unique" json:"email"`
+	Password     string         `gorm:"-" json:"password,omitempty"`
+	PasswordHash string         `gorm:"size:255" json:"-"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	Folders      []Folder       `gorm:"foreignKey:UserID" json:"-"`
+	Documents    []Document     `gorm:"foreignKey:UserID" json:"-"`
+	// attributes holds the names of the attributes decoded from a payload
+	attributes map[string]bool
+	// included holds the names of the relationships to include in a response
+	included map[string]bool
 }
 
 // GetID to satisfy jsonapi.MarshalIdentifier interface
@@ -26,6 +33,9 @@ func (u User) GetID() string {
 
 // SetID to satisfy jsonapi.UnmarshalIdentifier interface
 func (u *User) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
 	uuid, err := uuid.Parse(id)
 	if err != nil {
 		return err
@@ -38,12 +48,14 @@ func (u *User) SetID(id string) error {
 func (u User) GetReferences() []jsonapi.Reference {
 	return []jsonapi.Reference{
 		{
-			Type: "folders",
-			Name: "folders",
+			Type:        "folders",
+			Name:        "folders",
+			IsNotLoaded: u.Folders == nil,
 		},
 		{
-			Type: "documents",
-			Name: "documents",
+			Type:        "documents",
+			Name:        "documents",
+			IsNotLoaded: u.Documents == nil,
 		},
 	}
 }
@@ -68,6 +80,62 @@ func (u User) GetReferencedIDs() []jsonapi.ReferenceID {
 	return result
 }
 
+// GetReferencedStructs to satisfy the jsonapi.MarshalIncludedRelations
+// interface. It returns the loaded resources of the relationships passed to
+// Include.
+func (u User) GetReferencedStructs() []jsonapi.MarshalIdentifier {
+	result := []jsonapi.MarshalIdentifier{}
+	if u.included["folders"] {
+		for _, folder := range u.Folders {
+			result = append(result, folder)
+		}
+	}
+	if u.included["documents"] {
+		for _, document := range u.Documents {
+			result = append(result, document)
+		}
+	}
+	return result
+}
+
+// Include selects the relationships, folders or documents, whose resources
+// end up in the included member of the user's response
+func (u *User) Include(names ...string) {
+	u.included = includeNames(u.included, names)
+}
+
+// Profile returns the public part of the user, without their email address
+// or relationships, as shown to other users as the owner of shared items
+func (u User) Profile() User {
+	u.Email = ""
+	u.Folders = nil
+	u.Documents = nil
+	u.included = nil
+	return u
+}
+
+// UnmarshalJSON decodes the attributes of a user, recording which of them
+// the payload contained
+func (u *User) UnmarshalJSON(data []byte) error {
+	type attributes User
+	if err := json.Unmarshal(data, (*attributes)(u)); err != nil {
+		return err
+	}
+	names, err := attributeNames(data)
+	if err != nil {
+		return err
+	}
+	u.attributes = names
+	return nil
+}
+
+// HasAttribute reports whether the payload the user was decoded from
+// contained the named attribute. A user that wasn't decoded from a payload
+// has all of its attributes.
+func (u User) HasAttribute(name string) bool {
+	return u.attributes == nil || u.attributes[name]
+}
+
 // BeforeCreate will set a UUID rather than numeric ID
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"path"
+	"time"
+)
+
+// Webhook is an endpoint receiving the events of its user's folders, documents
+// and account as signed POST requests. Events lists the event types it
+// subscribes to, such as document.moved or folder.*, and is empty for all of
+// them. The signing secret is returned only when it is set.
+type Webhook struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	User          User      `gorm:"foreignKey:UserID" json:"-"`
+	URL           string    `gorm:"size:2048;not null" json:"url"`
+	Events        []string  `gorm:"serializer:json;type:text;not null" json:"events"`
+	Active        bool      `gorm:"not null" json:"active"`
+	Secret        string    `gorm:"-" json:"secret,omitempty"`
+	SigningSecret string    `gorm:"size:255;not null" json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	// attributes holds the names of the attributes decoded from a payload
+	attributes map[string]bool
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (w Webhook) GetID() string {
+	return w.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (w *Webhook) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	w.ID = uuid
+	return nil
+}
+
+// GetReferences to satisfy the jsonapi.MarshalReferences interface. The
+// deliveries are never loaded along with the webhook and are listed with
+// GET /v1/webhooks/{id}/deliveries instead.
+func (w Webhook) GetReferences() []jsonapi.Reference {
+	return []jsonapi.Reference{
+		{
+			Type: "users",
+			Name: "user",
+		},
+		{
+			Type:        "webhookDeliveries",
+			Name:        "deliveries",
+			IsNotLoaded: true,
+		},
+	}
+}
+
+// GetReferencedIDs to satisfy the jsonapi.MarshalLinkedRelations interface
+func (w Webhook) GetReferencedIDs() []jsonapi.ReferenceID {
+	return []jsonapi.ReferenceID{
+		{
+			ID:   w.UserID.String(),
+			Type: "users",
+			Name: "user",
+		},
+	}
+}
+
+// Subscribes reports whether the webhook receives events of the given type
+func (w Webhook) Subscribes(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, pattern := range w.Events {
+		if ok, _ := path.Match(pattern, eventType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalJSON decodes the attributes of a webhook, recording which of them
+// the payload contained
+func (w *Webhook) UnmarshalJSON(data []byte) error {
+	type attributes Webhook
+	if err := json.Unmarshal(data, (*attributes)(w)); err != nil {
+		return err
+	}
+	names, err := attributeNames(data)
+	if err != nil {
+		return err
+	}
+	w.attributes = names
+	return nil
+}
+
+// HasAttribute reports whether the payload the webhook was decoded from
+// contained the named attribute. A webhook that wasn't decoded from a payload
+// has all of its attributes.
+func (w Webhook) HasAttribute(name string) bool {
+	return w.attributes == nil || w.attributes[name]
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (w *Webhook) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
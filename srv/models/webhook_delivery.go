@@ -0,0 +1,85 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/manyminds/api2go/jsonapi"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Statuses of webhook deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is the delivery of an event to a webhook. A pending delivery
+// is attempted at NextAttemptAt and retried with backoff until the endpoint
+// responds with a 2xx status, when it succeeds, or until it runs out of
+// attempts and is dead-lettered. LastError holds the cause of the last failed
+// attempt, such as the start of the response body.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	WebhookID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"webhook_id"`
+	Webhook        Webhook    `gorm:"foreignKey:WebhookID" json:"-"`
+	EventID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"event_id"`
+	Event          Event      `gorm:"foreignKey:EventID" json:"-"`
+	EventType      string     `gorm:"size:64;not null" json:"event_type"`
+	Status         string     `gorm:"size:16;not null;index" json:"status"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  *time.Time `gorm:"index" json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	ResponseStatus *int       `json:"response_status"`
+	LastError      string     `gorm:"type:text" json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (d WebhookDelivery) GetID() string {
+	return d.ID.String()
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (d *WebhookDelivery) SetID(id string) error {
+	if id == "" {
+		return nil
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	d.ID = uuid
+	return nil
+}
+
+// GetReferences to satisfy the jsonapi.MarshalReferences interface
+func (d WebhookDelivery) GetReferences() []jsonapi.Reference {
+	return []jsonapi.Reference{
+		{
+			Type: "webhooks",
+			Name: "webhook",
+		},
+	}
+}
+
+// GetReferencedIDs to satisfy the jsonapi.MarshalLinkedRelations interface
+func (d WebhookDelivery) GetReferencedIDs() []jsonapi.ReferenceID {
+	return []jsonapi.ReferenceID{
+		{
+			ID:   d.WebhookID.String(),
+			Type: "webhooks",
+			Name: "webhook",
+		},
+	}
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
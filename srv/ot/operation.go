@@ -0,0 +1,339 @@
+// Package ot implements operational transformation of plain text, the
+// algorithm behind collaborative editing sessions. Operations follow the
+// model and JSON format of ot.js, except that lengths and positions count
+// Unicode code points rather than UTF-16 code units.
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrLengthMismatch is returned when an operation doesn't fit the text or the
+// other operation it is applied to, transformed against or composed with
+var ErrLengthMismatch = errors.New("operation lengths don't match")
+
+// Component is a single step of an operation: it keeps the next Retain code
+// points, inserts Insert, or removes the next Delete code points
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Operation is a sequence of components turning a text of BaseLen code points
+// into one of TargetLen code points. Operations are built with Retain, Insert
+// and Delete, which merge adjacent components of the same kind and put
+// insertions before deletions, so that equal operations have equal components.
+type Operation struct {
+	Components []Component
+	BaseLen    int
+	TargetLen  int
+}
+
+// Retain keeps the next n code points
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	o.TargetLen += n
+	if last := len(o.Components) - 1; last >= 0 && o.Components[last].Retain > 0 {
+		o.Components[last].Retain += n
+		return o
+	}
+	o.Components = append(o.Components, Component{Retain: n})
+	return o
+}
+
+// Insert inserts text at the current position
+func (o *Operation) Insert(text string) *Operation {
+	if text == "" {
+		return o
+	}
+	o.TargetLen += utf8.RuneCountInString(text)
+	last := len(o.Components) - 1
+	switch {
+	case last >= 0 && o.Components[last].Insert != "":
+		o.Components[last].Insert += text
+	case last >= 0 && o.Components[last].Delete > 0:
+		// Insert before the deletion, merging with an insertion before it
+		if last > 0 && o.Components[last-1].Insert != "" {
+			o.Components[last-1].Insert += text
+		} else {
+			o.Components = append(o.Components, o.Components[last])
+			o.Components[last] = Component{Insert: text}
+		}
+	default:
+		o.Components = append(o.Components, Component{Insert: text})
+	}
+	return o
+}
+
+// Delete removes the next n code points
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	if last := len(o.Components) - 1; last >= 0 && o.Components[last].Delete > 0 {
+		o.Components[last].Delete += n
+		return o
+	}
+	o.Components = append(o.Components, Component{Delete: n})
+	return o
+}
+
+// IsNoop reports whether the operation leaves every text unchanged
+func (o Operation) IsNoop() bool {
+	return len(o.Components) == 0 || (len(o.Components) == 1 && o.Components[0].Retain > 0)
+}
+
+// Apply applies the operation to text, which must be BaseLen code points long
+func (o Operation) Apply(text string) (string, error) {
+	runes := []rune(text)
+	if len(runes) != o.BaseLen {
+		return "", ErrLengthMismatch
+	}
+
+	result := make([]rune, 0, o.TargetLen)
+	position := 0
+	for _, component := range o.Components {
+		switch {
+		case component.Retain > 0:
+			result = append(result, runes[position:position+component.Retain]...)
+			position += component.Retain
+		case component.Insert != "":
+			result = append(result, []rune(component.Insert)...)
+		default:
+			position += component.Delete
+		}
+	}
+	return string(result), nil
+}
+
+// Transform transforms two concurrent operations on the same text so that
+// applying a and then bPrime has the same result as applying b and then
+// aPrime. Text inserted by a at the same position as text inserted by b comes
+// first.
+func Transform(a, b Operation) (aPrime, bPrime Operation, err error) {
+	if a.BaseLen != b.BaseLen {
+		return Operation{}, Operation{}, ErrLengthMismatch
+	}
+
+	as, bs := newCursor(a), newCursor(b)
+	for !as.done() || !bs.done() {
+		switch {
+		case as.current().Insert != "":
+			aPrime.Insert(as.current().Insert)
+			bPrime.Retain(utf8.RuneCountInString(as.current().Insert))
+			as.next()
+		case bs.current().Insert != "":
+			aPrime.Retain(utf8.RuneCountInString(bs.current().Insert))
+			bPrime.Insert(bs.current().Insert)
+			bs.next()
+		case as.done() || bs.done():
+			return Operation{}, Operation{}, ErrLengthMismatch
+		default:
+			n := min(as.length(), bs.length())
+			switch {
+			case as.current().Retain > 0 && bs.current().Retain > 0:
+				aPrime.Retain(n)
+				bPrime.Retain(n)
+			case as.current().Delete > 0 && bs.current().Retain > 0:
+				aPrime.Delete(n)
+			case as.current().Retain > 0 && bs.current().Delete > 0:
+				bPrime.Delete(n)
+			}
+			// Text deleted by both operations is already gone on either side
+			as.consume(n)
+			bs.consume(n)
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// Compose combines a and then b into a single operation with the same effect
+func Compose(a, b Operation) (Operation, error) {
+	if a.TargetLen != b.BaseLen {
+		return Operation{}, ErrLengthMismatch
+	}
+
+	var result Operation
+	as, bs := newCursor(a), newCursor(b)
+	for !as.done() || !bs.done() {
+		switch {
+		case as.current().Delete > 0:
+			result.Delete(as.current().Delete)
+			as.next()
+		case bs.current().Insert != "":
+			result.Insert(bs.current().Insert)
+			bs.next()
+		case as.done() || bs.done():
+			return Operation{}, ErrLengthMismatch
+		default:
+			n := min(as.length(), bs.length())
+			switch {
+			case as.current().Retain > 0 && bs.current().Retain > 0:
+				result.Retain(n)
+			case as.current().Insert != "" && bs.current().Retain > 0:
+				result.Insert(string([]rune(as.current().Insert)[:n]))
+			case as.current().Retain > 0 && bs.current().Delete > 0:
+				result.Delete(n)
+			}
+			// Text inserted by a and deleted by b cancels out
+			as.consume(n)
+			bs.consume(n)
+		}
+	}
+	return result, nil
+}
+
+// TransformIndex moves a position in a text, such as a cursor, to where it
+// is after the operation is applied to the text
+func TransformIndex(index int, o Operation) int {
+	result := index
+	for _, component := range o.Components {
+		switch {
+		case component.Retain > 0:
+			index -= component.Retain
+		case component.Insert != "":
+			result += utf8.RuneCountInString(component.Insert)
+		default:
+			result -= min(index, component.Delete)
+			index -= component.Delete
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return result
+}
+
+// Diff returns an operation turning oldText into newText, which replaces the
+// part between their common prefix and suffix
+func Diff(oldText, newText string) Operation {
+	a, b := []rune(oldText), []rune(newText)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var o Operation
+	o.Retain(prefix)
+	o.Insert(string(b[prefix : len(b)-suffix]))
+	o.Delete(len(a) - prefix - suffix)
+	o.Retain(suffix)
+	return o
+}
+
+// MarshalJSON encodes the operation in the format of ot.js: an array of
+// positive numbers retaining, strings inserting and negative numbers deleting
+func (o Operation) MarshalJSON() ([]byte, error) {
+	components := make([]interface{}, 0, len(o.Components))
+	for _, component := range o.Components {
+		switch {
+		case component.Retain > 0:
+			components = append(components, component.Retain)
+		case component.Insert != "":
+			components = append(components, component.Insert)
+		default:
+			components = append(components, -component.Delete)
+		}
+	}
+	return json.Marshal(components)
+}
+
+// UnmarshalJSON decodes an operation in the format of ot.js
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var components []json.RawMessage
+	if err := json.Unmarshal(data, &components); err != nil {
+		return err
+	}
+
+	*o = Operation{}
+	for _, raw := range components {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil && text != "" {
+			o.Insert(text)
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil || n == 0 {
+			return fmt.Errorf("invalid operation component %s", raw)
+		}
+		if n > 0 {
+			o.Retain(n)
+		} else {
+			o.Delete(-n)
+		}
+	}
+	return nil
+}
+
+// cursor walks the components of an operation, splitting them where the
+// other operation's components end
+type cursor struct {
+	components []Component
+	index      int
+	// offset is the part of the current component consumed already
+	offset int
+}
+
+// newCursor creates a cursor at the first component of an operation
+func newCursor(o Operation) *cursor {
+	return &cursor{components: o.Components}
+}
+
+// done reports whether every component has been consumed
+func (c *cursor) done() bool {
+	return c.index >= len(c.components)
+}
+
+// current returns the rest of the current component, or a zero component
+// once every component has been consumed
+func (c *cursor) current() Component {
+	if c.done() {
+		return Component{}
+	}
+	component := c.components[c.index]
+	switch {
+	case component.Retain > 0:
+		component.Retain -= c.offset
+	case component.Insert != "":
+		component.Insert = string([]rune(component.Insert)[c.offset:])
+	default:
+		component.Delete -= c.offset
+	}
+	return component
+}
+
+// length returns the number of code points left in the current component
+func (c *cursor) length() int {
+	component := c.current()
+	if component.Insert != "" {
+		return utf8.RuneCountInString(component.Insert)
+	}
+	return component.Retain + component.Delete
+}
+
+// consume moves the cursor n code points into the current component
+func (c *cursor) consume(n int) {
+	if n >= c.length() {
+		c.next()
+		return
+	}
+	c.offset += n
+}
+
+// next moves the cursor to the next component
+func (c *cursor) next() {
+	c.index++
+	c.offset = 0
+}
@@ -0,0 +1,170 @@
+package ot
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// randomOperation returns a random operation on text
+func randomOperation(r *rand.Rand, text string) Operation {
+	alphabet := []rune("abcäö€ \n")
+	randomText := func() string {
+		runes := make([]rune, 1+r.Intn(4))
+		for i := range runes {
+			runes[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		return string(runes)
+	}
+
+	var o Operation
+	left := len([]rune(text))
+	for left > 0 {
+		n := 1 + r.Intn(left)
+		switch r.Intn(3) {
+		case 0:
+			o.Retain(n)
+		case 1:
+			o.Insert(randomText())
+			continue
+		default:
+			o.Delete(n)
+		}
+		left -= n
+	}
+	if r.Intn(2) == 0 {
+		o.Insert(randomText())
+	}
+	return o
+}
+
+func TestOperation(t *testing.T) {
+	t.Run("Apply", func(t *testing.T) {
+		var o Operation
+		o.Retain(6).Delete(5).Insert("Welt").Retain(1)
+		assert.Equal(t, 12, o.BaseLen, "Expected the base length")
+		assert.Equal(t, 11, o.TargetLen, "Expected the target length")
+
+		result, err := o.Apply("Hello world!")
+		require.NoError(t, err, "Failed to apply operation")
+		assert.Equal(t, "Hello Welt!", result, "Expected the edited text")
+
+		// Lengths count code points
+		o = Operation{}
+		o.Retain(2).Insert("ß").Retain(1)
+		result, err = o.Apply("€ä!")
+		require.NoError(t, err, "Failed to apply operation")
+		assert.Equal(t, "€äß!", result, "Expected the insertion after the second code point")
+
+		_, err = o.Apply("Hello")
+		assert.ErrorIs(t, err, ErrLengthMismatch, "Expected a length mismatch")
+	})
+
+	t.Run("Builder", func(t *testing.T) {
+		// Adjacent components are merged and insertions precede deletions
+		var o Operation
+		o.Retain(1).Retain(2).Delete(1).Insert("a").Delete(2).Insert("b").Retain(0).Insert("")
+		assert.Equal(t, []Component{{Retain: 3}, {Insert: "ab"}, {Delete: 3}}, o.Components, "Expected canonical components")
+
+		assert.True(t, (&Operation{}).Retain(4).IsNoop(), "Expected a retain to be a no-op")
+		assert.False(t, o.IsNoop(), "Expected changes not to be a no-op")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var o Operation
+		o.Retain(2).Insert("ab").Delete(3)
+		data, err := json.Marshal(o)
+		require.NoError(t, err, "Failed to encode operation")
+		assert.JSONEq(t, `[2, "ab", -3]`, string(data), "Expected the ot.js format")
+
+		var decoded Operation
+		require.NoError(t, json.Unmarshal(data, &decoded), "Failed to decode operation")
+		assert.Equal(t, o, decoded, "Expected the same operation")
+
+		for _, invalid := range []string{`[0]`, `[1.5]`, `[true]`, `{"retain": 1}`} {
+			assert.Error(t, json.Unmarshal([]byte(invalid), &decoded), "Expected %s to be rejected", invalid)
+		}
+	})
+
+	t.Run("Transform", func(t *testing.T) {
+		var a, b Operation
+		a.Retain(5).Insert(" there").Retain(6)
+		b.Retain(5).Insert(",").Retain(6)
+		aPrime, bPrime, err := Transform(a, b)
+		require.NoError(t, err, "Failed to transform operations")
+
+		left, _ := a.Apply("Hello world")
+		left, err = bPrime.Apply(left)
+		require.NoError(t, err, "Failed to apply transformed operation")
+		right, _ := b.Apply("Hello world")
+		right, err = aPrime.Apply(right)
+		require.NoError(t, err, "Failed to apply transformed operation")
+		assert.Equal(t, "Hello there, world", left, "Expected the first operation's insertion first")
+		assert.Equal(t, left, right, "Expected both orders to converge")
+
+		var short Operation
+		short.Retain(3)
+		_, _, err = Transform(a, short)
+		assert.ErrorIs(t, err, ErrLengthMismatch, "Expected a length mismatch")
+	})
+
+	t.Run("Compose", func(t *testing.T) {
+		var a, b Operation
+		a.Retain(5).Insert(" there").Retain(6)
+		b.Retain(3).Delete(8).Insert("!").Retain(6)
+		composed, err := Compose(a, b)
+		require.NoError(t, err, "Failed to compose operations")
+
+		result, err := composed.Apply("Hello world")
+		require.NoError(t, err, "Failed to apply composed operation")
+		assert.Equal(t, "Hel! world", result, "Expected the effect of both operations")
+
+		_, err = Compose(b, a)
+		assert.ErrorIs(t, err, ErrLengthMismatch, "Expected a length mismatch")
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 500; i++ {
+			suffix, _ := randomOperation(r, "").Apply("")
+			text := "Hällo €\nworld" + suffix
+			a, b := randomOperation(r, text), randomOperation(r, text)
+
+			aPrime, bPrime, err := Transform(a, b)
+			require.NoError(t, err, "Failed to transform operations")
+			left, _ := a.Apply(text)
+			left, err = bPrime.Apply(left)
+			require.NoError(t, err, "Failed to apply transformed operation")
+			right, _ := b.Apply(text)
+			right, err = aPrime.Apply(right)
+			require.NoError(t, err, "Failed to apply transformed operation")
+			require.Equal(t, left, right, "Expected %v and %v to converge on %q", a, b, text)
+
+			afterA, _ := a.Apply(text)
+			c := randomOperation(r, afterA)
+			composed, err := Compose(a, c)
+			require.NoError(t, err, "Failed to compose operations")
+			expected, _ := c.Apply(afterA)
+			actual, err := composed.Apply(text)
+			require.NoError(t, err, "Failed to apply composed operation")
+			require.Equal(t, expected, actual, "Expected %v composed with %v to have the same effect", a, c)
+
+			diff := Diff(text, left)
+			actual, err = diff.Apply(text)
+			require.NoError(t, err, "Failed to apply diff")
+			require.Equal(t, left, actual, "Expected the diff to produce the new text")
+		}
+	})
+
+	t.Run("TransformIndex", func(t *testing.T) {
+		var o Operation
+		o.Retain(2).Insert("abc").Delete(2).Retain(4)
+		assert.Equal(t, 1, TransformIndex(1, o), "Expected a cursor before the change to stay")
+		assert.Equal(t, 5, TransformIndex(2, o), "Expected a cursor at the insertion to follow it")
+		assert.Equal(t, 5, TransformIndex(3, o), "Expected a cursor in deleted text to move to the deletion")
+		assert.Equal(t, 7, TransformIndex(6, o), "Expected a cursor after the change to shift")
+	})
+}
@@ -0,0 +1,269 @@
+// Package render turns the content of documents into sanitized HTML for
+// display, along with a plain-text excerpt and an outline of the headings
+// for listings and navigation.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"srv/models"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ExcerptLength is the maximum length of an excerpt in characters, not
+// counting the ellipsis marking a cut
+const ExcerptLength = 200
+
+// ErrUnsupportedContentType is returned for content types that can't be
+// rendered
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// Heading is an entry of a document's outline. ID is the id attribute of the
+// heading in the rendered HTML, to link to it.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+// Result is the rendering of a document's content
+type Result struct {
+	HTML    string    `json:"html"`
+	Excerpt string    `json:"excerpt"`
+	Outline []Heading `json:"outline"`
+}
+
+// markdown converts GitHub Flavored Markdown, with tables, strikethrough,
+// autolinks and task lists. Raw HTML is passed on to the sanitizer, which
+// treats it like the content of HTML documents.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.TaskList,
+	),
+	goldmark.WithRendererOptions(gmhtml.WithUnsafe()),
+)
+
+// policy allows the markup of user generated content, plus the language
+// classes of code blocks and the checkboxes of task lists
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).OnElements("code")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}()
+
+// paragraphBreak separates the paragraphs of plain text
+var paragraphBreak = regexp.MustCompile(`\n[ \t]*\n`)
+
+// Render renders content of the given content type
+func Render(content, contentType string) (Result, error) {
+	var source string
+	switch contentType {
+	case models.ContentTypePlain:
+		source = plainHTML(content)
+	case models.ContentTypeMarkdown:
+		var buf bytes.Buffer
+		if err := markdown.Convert([]byte(content), &buf); err != nil {
+			return Result{}, err
+		}
+		source = buf.String()
+	case models.ContentTypeHTML:
+		source = content
+	default:
+		return Result{}, ErrUnsupportedContentType
+	}
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(policy.Sanitize(source)), body)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Outline: []Heading{}}
+	ids := map[string]bool{}
+	var text strings.Builder
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		collectIDs(node, ids)
+	}
+	for _, node := range nodes {
+		outline(node, ids, &result.Outline)
+		plainText(node, &text)
+		if err := html.Render(&buf, node); err != nil {
+			return Result{}, err
+		}
+	}
+	result.HTML = buf.String()
+	result.Excerpt = excerpt(text.String(), ExcerptLength)
+	return result, nil
+}
+
+// plainHTML wraps the paragraphs of plain text in p elements, keeping their
+// line breaks
+func plainHTML(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var b strings.Builder
+	for _, paragraph := range paragraphBreak.Split(content, -1) {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+// collectIDs records the id attributes in the tree of node, so that the ids
+// given to headings don't collide with them
+func collectIDs(node *html.Node, ids map[string]bool) {
+	if node.Type == html.ElementNode {
+		if id := attr(node, "id"); id != "" {
+			ids[id] = true
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		collectIDs(child, ids)
+	}
+}
+
+// outline appends the headings in the tree of node, giving those without an
+// id one derived from their text
+func outline(node *html.Node, ids map[string]bool, headings *[]Heading) {
+	if level := headingLevel(node); level > 0 {
+		var text strings.Builder
+		plainText(node, &text)
+		heading := Heading{Level: level, Text: strings.Join(strings.Fields(text.String()), " "), ID: attr(node, "id")}
+		if heading.ID == "" {
+			heading.ID = uniqueID(slug(heading.Text), ids)
+			node.Attr = append(node.Attr, html.Attribute{Key: "id", Val: heading.ID})
+		}
+		*headings = append(*headings, heading)
+		return
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		outline(child, ids, headings)
+	}
+}
+
+// plainText writes the text in the tree of node, separating the text of
+// blocks with whitespace. Code blocks are left out, as they rarely read well
+// out of context.
+func plainText(node *html.Node, text *strings.Builder) {
+	switch node.Type {
+	case html.TextNode:
+		text.WriteString(node.Data)
+		return
+	case html.ElementNode:
+		if !inline[node.DataAtom] {
+			defer text.WriteString(" ")
+		}
+		if node.DataAtom == atom.Pre {
+			return
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		plainText(child, text)
+	}
+}
+
+// inline holds the elements whose text runs on with the surrounding text
+var inline = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.B: true, atom.Bdi: true, atom.Bdo: true,
+	atom.Cite: true, atom.Code: true, atom.Del: true, atom.Dfn: true, atom.Em: true,
+	atom.I: true, atom.Ins: true, atom.Kbd: true, atom.Mark: true, atom.Q: true,
+	atom.S: true, atom.Samp: true, atom.Small: true, atom.Span: true, atom.Strike: true,
+	atom.Strong: true, atom.Sub: true, atom.Sup: true, atom.Time: true, atom.U: true,
+	atom.Var: true,
+}
+
+// excerpt collapses the whitespace of text and cuts it to at most length
+// characters, at a word boundary where possible
+func excerpt(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	cut := string(runes[:length])
+	// A word running past the cut is dropped, unless it is the only one
+	if runes[length] != ' ' {
+		if space := strings.LastIndex(cut, " "); space > 0 {
+			cut = cut[:space]
+		}
+	}
+	return strings.TrimRightFunc(cut, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// headingLevel returns the level of a heading element, or 0 for other nodes
+func headingLevel(node *html.Node) int {
+	if node.Type != html.ElementNode {
+		return 0
+	}
+	switch node.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return int(node.Data[1] - '0')
+	}
+	return 0
+}
+
+// slug derives an id from the text of a heading: lower case letters and
+// digits, with dashes between words
+func slug(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// uniqueID returns id, or id with the first free numeric suffix if it is
+// taken, and marks the result as taken
+func uniqueID(id string, ids map[string]bool) string {
+	unique := id
+	for n := 1; ids[unique]; n++ {
+		unique = id + "-" + strconv.Itoa(n)
+	}
+	ids[unique] = true
+	return unique
+}
+
+// attr returns the value of a node's attribute, or "" if it has none
+func attr(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
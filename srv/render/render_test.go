@@ -0,0 +1,95 @@
+package render
+
+import (
+	"srv/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	t.Run("Markdown", func(t *testing.T) {
+		content := "# Plan\n\n| Step | Done |\n|:-----|-----:|\n| One | yes |\n\n" +
+			"```go\nfmt.Println(\"hi\")\n```\n\n- [x] Write\n- [ ] Review\n\n~~Old~~ see https://example.com\n"
+		result, err := Render(content, models.ContentTypeMarkdown)
+		require.NoError(t, err, "Failed to render Markdown")
+
+		assert.Contains(t, result.HTML, `<h1 id="plan">Plan</h1>`, "Expected the heading with an id")
+		assert.Contains(t, result.HTML, `<th align="left">Step</th>`, "Expected the table with its alignment")
+		assert.Contains(t, result.HTML, `<code class="language-go">`, "Expected the code block's language")
+		assert.Contains(t, result.HTML, `<input checked="" disabled="" type="checkbox"/> Write`, "Expected a checked task")
+		assert.Contains(t, result.HTML, `<input disabled="" type="checkbox"/> Review`, "Expected an open task")
+		assert.Contains(t, result.HTML, `<del>Old</del>`, "Expected strikethrough")
+		assert.Contains(t, result.HTML, `<a href="https://example.com" rel="nofollow">`, "Expected the URL to be linked")
+
+		assert.Equal(t, "Plan Step Done One yes Write Review Old see https://example.com", result.Excerpt,
+			"Expected the text without the code block")
+		assert.Equal(t, []Heading{{Level: 1, Text: "Plan", ID: "plan"}}, result.Outline, "Expected the heading")
+	})
+
+	t.Run("Sanitized", func(t *testing.T) {
+		content := "Hi <script>alert(1)</script>\n\n<a href=\"javascript:alert(1)\">link</a> <img src=\"a.png\" onerror=\"alert(1)\">\n\n" +
+			"<iframe src=\"https://example.com\"></iframe><input type=\"text\" value=\"x\">"
+		for _, contentType := range []string{models.ContentTypeMarkdown, models.ContentTypeHTML} {
+			result, err := Render(content, contentType)
+			require.NoError(t, err, "Failed to render %s", contentType)
+			for _, unsafe := range []string{"<script", "alert", "javascript:", "onerror", "<iframe", `type="text"`} {
+				assert.NotContains(t, result.HTML, unsafe, "Expected %s not to keep %s", contentType, unsafe)
+			}
+			assert.Contains(t, result.HTML, `<img src="a.png"/>`, "Expected %s to keep the image", contentType)
+		}
+
+		result, err := Render("[link](javascript:alert(1))", models.ContentTypeMarkdown)
+		require.NoError(t, err, "Failed to render Markdown")
+		assert.Equal(t, "<p>link</p>\n", result.HTML, "Expected the unsafe link to be removed")
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		content := `<h2 id="intro">Intro</h2><p>First <em>point</em></p><h3>Intro</h3><h3 id="">Intro!</h3>`
+		result, err := Render(content, models.ContentTypeHTML)
+		require.NoError(t, err, "Failed to render HTML")
+
+		assert.Equal(t, `<h2 id="intro">Intro</h2><p>First <em>point</em></p><h3 id="intro-1">Intro</h3><h3 id="intro-2">Intro!</h3>`,
+			result.HTML, "Expected ids for the headings without one")
+		assert.Equal(t, []Heading{
+			{Level: 2, Text: "Intro", ID: "intro"},
+			{Level: 3, Text: "Intro", ID: "intro-1"},
+			{Level: 3, Text: "Intro!", ID: "intro-2"},
+		}, result.Outline, "Expected unique ids")
+		assert.Equal(t, "Intro First point Intro Intro!", result.Excerpt, "Expected inline text to run on")
+	})
+
+	t.Run("Plain", func(t *testing.T) {
+		result, err := Render("a < b\r\nand <b>c</b>\n\n\nNext", models.ContentTypePlain)
+		require.NoError(t, err, "Failed to render plain text")
+
+		assert.Equal(t, "<p>a &lt; b<br/>\nand &lt;b&gt;c&lt;/b&gt;</p>\n<p>Next</p>\n", result.HTML, "Expected escaped paragraphs")
+		assert.Equal(t, "a < b and <b>c</b> Next", result.Excerpt, "Expected the text")
+		assert.Empty(t, result.Outline, "Expected no headings")
+	})
+
+	t.Run("Excerpt", func(t *testing.T) {
+		words := strings.Repeat("word ", 50)
+		result, err := Render(words, models.ContentTypePlain)
+		require.NoError(t, err, "Failed to render plain text")
+		assert.Equal(t, strings.TrimSpace(strings.Repeat("word ", 40))+"…", result.Excerpt, "Expected whole words")
+
+		assert.Equal(t, "one two…", excerpt("one two, three", 10), "Expected the cut word and punctuation dropped")
+		assert.Equal(t, "one two…", excerpt("one two three", 7), "Expected a cut at a space")
+		assert.Equal(t, "abcd…", excerpt("abcdefgh", 4), "Expected a single long word to be cut")
+		assert.Equal(t, "äöü", excerpt(" äöü\n", 3), "Expected characters rather than bytes to count")
+	})
+
+	t.Run("Slug", func(t *testing.T) {
+		assert.Equal(t, "getting-started-2024", slug("  Getting Started: 2024!"), "Expected dashes between words")
+		assert.Equal(t, "über-uns", slug("Über uns"), "Expected letters of any script")
+		assert.Equal(t, "section", slug("!!!"), "Expected a fallback")
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := Render("x", "application/pdf")
+		assert.ErrorIs(t, err, ErrUnsupportedContentType, "Expected an error")
+	})
+}
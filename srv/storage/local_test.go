@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocal(t.TempDir())
+	require.NoError(t, err, "Failed to create local storage")
+
+	t.Run("PutGetDelete", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, "a/b/blob", strings.NewReader("hello"), 5, "text/plain"), "Failed to put blob")
+
+		r, err := store.Get(ctx, "a/b/blob")
+		require.NoError(t, err, "Failed to get blob")
+		content, err := io.ReadAll(r)
+		require.NoError(t, err, "Failed to read blob")
+		require.NoError(t, r.Close(), "Failed to close blob")
+		assert.Equal(t, "hello", string(content), "Expected stored content")
+
+		require.NoError(t, store.Delete(ctx, "a/b/blob"), "Failed to delete blob")
+		_, err = store.Get(ctx, "a/b/blob")
+		assert.Equal(t, ErrNotFound, err, "Expected deleted blob to be missing")
+		assert.NoError(t, store.Delete(ctx, "a/b/blob"), "Expected deleting a missing blob to succeed")
+	})
+
+	t.Run("ShortWrite", func(t *testing.T) {
+		err := store.Put(ctx, "short", strings.NewReader("abc"), 5, "")
+		assert.Error(t, err, "Expected size mismatch to fail")
+		_, err = store.Get(ctx, "short")
+		assert.Equal(t, ErrNotFound, err, "Expected incomplete blob not to be stored")
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		for _, key := range []string{"", "../escape", "/etc/passwd", "a/../../escape"} {
+			err := store.Put(ctx, key, strings.NewReader("x"), 1, "")
+			assert.Error(t, err, "Expected key %q to be rejected", key)
+		}
+	})
+}
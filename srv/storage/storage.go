@@ -0,0 +1,61 @@
+// Package storage stores binary blobs such as document attachments.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// Storage stores binary blobs under slash-separated keys
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key for reading
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Config holds the blob storage configuration
+type Config struct {
+	// Backend is either "local" or "s3"
+	Backend string
+
+	// Path is the root directory of the local backend
+	Path string
+
+	// Endpoint, Bucket, Region and credentials configure the S3 backend
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// New creates the storage backend selected by the configuration
+func New(config Config) (Storage, error) {
+	switch config.Backend {
+	case "local":
+		return NewLocal(config.Path)
+	case "s3":
+		return NewS3(config.Endpoint, config.Bucket, config.Region, config.AccessKeyID, config.SecretAccessKey)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+}
+
+// DeleteAll removes the blobs stored under keys, continuing past failures and
+// returning the first error
+func DeleteAll(ctx context.Context, s Storage, keys []string) error {
+	var first error
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
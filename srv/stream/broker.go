@@ -0,0 +1,97 @@
+// Package stream pushes the events recorded in the outbox to the clients
+// subscribed to them as soon as they are committed.
+package stream
+
+import (
+	"context"
+	"srv/models"
+	"sync"
+)
+
+// subscriptionBuffer is the number of events a subscription holds before it
+// is considered too slow and closed
+const subscriptionBuffer = 64
+
+// Broker fans out committed events to the subscriptions of this process. How
+// it learns about the events is up to the implementation, so that a single
+// replica can poll the outbox while several replicas are notified by Postgres.
+type Broker interface {
+	// Subscribe returns a subscription to every event committed from now on
+	Subscribe() *Subscription
+
+	// Run feeds the broker with committed events until ctx is done
+	Run(ctx context.Context)
+}
+
+// Subscription receives the events published by a broker in the order they
+// were committed. Events is closed when the subscription is closed, and when
+// the subscriber falls behind or the broker may have missed events, in which
+// case the subscriber should catch up from the outbox.
+type Subscription struct {
+	Events <-chan models.Event
+	events chan models.Event
+	hub    *hub
+}
+
+// Close stops the subscription and releases its resources
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// hub is the in-process fan-out of the brokers
+type hub struct {
+	mu            sync.Mutex
+	subscriptions map[*Subscription]bool
+}
+
+// newHub creates a hub without subscriptions
+func newHub() *hub {
+	return &hub{subscriptions: make(map[*Subscription]bool)}
+}
+
+// Subscribe returns a subscription to the events published from now on
+func (h *hub) Subscribe() *Subscription {
+	events := make(chan models.Event, subscriptionBuffer)
+	subscription := &Subscription{Events: events, events: events, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscriptions[subscription] = true
+	return subscription
+}
+
+// publish hands an event to every subscription without waiting for them.
+// Subscriptions whose buffer is full are closed rather than slowing down the
+// others.
+func (h *hub) publish(event models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscription := range h.subscriptions {
+		select {
+		case subscription.events <- event:
+		default:
+			delete(h.subscriptions, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+// remove closes a subscription unless it has been closed already
+func (h *hub) remove(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscriptions[subscription] {
+		delete(h.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+// closeAll closes every subscription, telling subscribers to catch up
+func (h *hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscription := range h.subscriptions {
+		delete(h.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
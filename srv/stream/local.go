@@ -0,0 +1,98 @@
+package stream
+
+import (
+	"context"
+	"srv/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// LocalBroker is the in-process broker, which polls the outbox for the events
+// committed since its last poll. It works with any number of replicas, each
+// polling on its own, at the cost of the polling interval's latency.
+//
+// Events are read by creation time, which is taken before their transaction
+// commits. Every poll therefore looks back by Lookback for events committed
+// late, and remembers the events of that window to publish each only once.
+type LocalBroker struct {
+	*hub
+	DB        *gorm.DB
+	Interval  time.Duration
+	Lookback  time.Duration
+	BatchSize int
+	cursor    time.Time
+	published map[uuid.UUID]time.Time
+}
+
+// NewLocalBroker creates a broker publishing the events committed from now on
+func NewLocalBroker(db *gorm.DB, interval time.Duration) *LocalBroker {
+	return &LocalBroker{
+		hub:       newHub(),
+		DB:        db,
+		Interval:  interval,
+		Lookback:  5 * time.Second,
+		BatchSize: 500,
+		cursor:    time.Now().UTC(),
+		published: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Run polls the outbox every interval until ctx is done
+func (b *LocalBroker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.closeAll()
+			return
+		case <-ticker.C:
+			if _, err := b.Poll(); err != nil {
+				logrus.WithError(err).Error("Failed to poll events")
+			}
+		}
+	}
+}
+
+// Poll publishes the events committed since the last poll and returns how
+// many there were. It isn't safe to call concurrently.
+func (b *LocalBroker) Poll() (int, error) {
+	published := 0
+	query := b.DB.Where("created_at > ?", b.cursor.Add(-b.Lookback))
+	for {
+		var events []models.Event
+		if err := query.Order("created_at, id").Limit(b.BatchSize).Find(&events).Error; err != nil {
+			return published, err
+		}
+
+		for _, event := range events {
+			if _, ok := b.published[event.ID]; ok {
+				continue
+			}
+			b.publish(event)
+			b.published[event.ID] = event.CreatedAt
+			published++
+		}
+		if len(events) < b.BatchSize {
+			break
+		}
+		last := events[len(events)-1]
+		query = b.DB.Where("created_at > ? OR (created_at = ? AND id > ?)", last.CreatedAt, last.CreatedAt, last.ID)
+	}
+
+	// Move the window to the newest event and forget the events that left it
+	for _, createdAt := range b.published {
+		if createdAt.After(b.cursor) {
+			b.cursor = createdAt
+		}
+	}
+	for id, createdAt := range b.published {
+		if !createdAt.After(b.cursor.Add(-b.Lookback)) {
+			delete(b.published, id)
+		}
+	}
+	return published, nil
+}
@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"srv/database"
+	"srv/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBroker(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	user := models.User{Username: "testuser", Email: "test@example.com"}
+	require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+
+	// record stores an event created at the given time
+	record := func(t *testing.T, createdAt time.Time) models.Event {
+		event, err := models.NewEvent(models.EventCreated, models.Folder{ID: uuid.New(), UserID: user.ID}, user.ID, nil)
+		require.NoError(t, err, "Failed to create event")
+		event.CreatedAt = createdAt
+		require.NoError(t, db.Create(&event).Error, "Failed to record event")
+		return event
+	}
+	// received returns the events waiting in a subscription
+	received := func(subscription *Subscription) []uuid.UUID {
+		var ids []uuid.UUID
+		for {
+			select {
+			case event, ok := <-subscription.Events:
+				if !ok {
+					return ids
+				}
+				ids = append(ids, event.ID)
+			default:
+				return ids
+			}
+		}
+	}
+
+	t.Run("Publish", func(t *testing.T) {
+		// Events recorded before the broker started aren't published
+		record(t, time.Now().UTC().Add(-time.Hour))
+		broker := NewLocalBroker(db, time.Second)
+		first := broker.Subscribe()
+		second := broker.Subscribe()
+
+		created := record(t, time.Now().UTC())
+		published, err := broker.Poll()
+		require.NoError(t, err, "Failed to poll events")
+		assert.Equal(t, 1, published, "Expected only the event committed after the broker started")
+		assert.Equal(t, []uuid.UUID{created.ID}, received(first), "Expected the event in every subscription")
+		assert.Equal(t, []uuid.UUID{created.ID}, received(second), "Expected the event in every subscription")
+
+		// Closed subscriptions receive nothing more
+		second.Close()
+		second.Close()
+		next := record(t, time.Now().UTC())
+		_, err = broker.Poll()
+		require.NoError(t, err, "Failed to poll events")
+		assert.Equal(t, []uuid.UUID{next.ID}, received(first), "Expected the next event")
+		_, ok := <-second.Events
+		assert.False(t, ok, "Expected the closed subscription's channel to be closed")
+	})
+
+	t.Run("LateCommit", func(t *testing.T) {
+		database.TruncateTables(t, db)
+		require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+		broker := NewLocalBroker(db, time.Second)
+		subscription := broker.Subscribe()
+
+		now := time.Now().UTC()
+		first := record(t, now.Add(time.Second))
+		_, err := broker.Poll()
+		require.NoError(t, err, "Failed to poll events")
+		require.Equal(t, []uuid.UUID{first.ID}, received(subscription), "Expected the first event")
+
+		// An event created before the last one but committed after it is
+		// still published, and neither is published again
+		late := record(t, now.Add(500*time.Millisecond))
+		published, err := broker.Poll()
+		require.NoError(t, err, "Failed to poll events")
+		assert.Equal(t, 1, published, "Expected only the late event")
+		assert.Equal(t, []uuid.UUID{late.ID}, received(subscription), "Expected the late event")
+
+		published, err = broker.Poll()
+		require.NoError(t, err, "Failed to poll events")
+		assert.Zero(t, published, "Expected no event to be published twice")
+	})
+
+	t.Run("Batches", func(t *testing.T) {
+		database.TruncateTables(t, db)
+		require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+		broker := NewLocalBroker(db, time.Second)
+		broker.BatchSize = 2
+		subscription := broker.Subscribe()
+
+		var ids []uuid.UUID
+		at := time.Now().UTC().Add(time.Second)
+		for i := 0; i < 5; i++ {
+			ids = append(ids, record(t, at.Add(time.Duration(i)*time.Millisecond)).ID)
+		}
+		published, err := broker.Poll()
+		require.NoError(t, err, "Failed to poll events")
+		assert.Equal(t, 5, published, "Expected every event")
+		assert.Equal(t, ids, received(subscription), "Expected the events in order")
+	})
+
+	t.Run("SlowSubscriber", func(t *testing.T) {
+		database.TruncateTables(t, db)
+		require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+		broker := NewLocalBroker(db, time.Second)
+		slow := broker.Subscribe()
+
+		at := time.Now().UTC().Add(time.Second)
+		for i := 0; i <= subscriptionBuffer; i++ {
+			record(t, at.Add(time.Duration(i)*time.Millisecond))
+		}
+		_, err := broker.Poll()
+		require.NoError(t, err, "Failed to poll events")
+
+		// The subscription holds what fit in its buffer and is then closed
+		assert.Len(t, received(slow), subscriptionBuffer, "Expected a full buffer")
+		_, ok := <-slow.Events
+		assert.False(t, ok, "Expected the slow subscription to be closed")
+		slow.Close()
+	})
+}
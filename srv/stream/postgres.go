@@ -0,0 +1,89 @@
+package stream
+
+import (
+	"context"
+	"srv/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// NotifyChannel is the Postgres channel on which a trigger on the events table
+// sends the ID of every event when its transaction commits
+const NotifyChannel = "events"
+
+// PostgresBroker is fed by the notifications Postgres sends for committed
+// events, so that every replica learns about the changes made through the
+// others right away. Notifications sent while the broker is disconnected are
+// lost, so it closes its subscriptions whenever it reconnects.
+type PostgresBroker struct {
+	*hub
+	DB            *gorm.DB
+	DSN           string
+	RetryInterval time.Duration
+}
+
+// NewPostgresBroker creates a broker listening for notifications on the
+// database at dsn and loading the events they announce from db
+func NewPostgresBroker(db *gorm.DB, dsn string) *PostgresBroker {
+	return &PostgresBroker{
+		hub:           newHub(),
+		DB:            db,
+		DSN:           dsn,
+		RetryInterval: 5 * time.Second,
+	}
+}
+
+// Run listens for notifications until ctx is done, reconnecting after errors
+func (b *PostgresBroker) Run(ctx context.Context) {
+	for {
+		err := b.listen(ctx)
+		b.closeAll()
+		if ctx.Err() != nil {
+			return
+		}
+		logrus.WithError(err).Error("Lost event notifications, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.RetryInterval):
+		}
+	}
+}
+
+// listen publishes the events announced on NotifyChannel until the
+// connection fails or ctx is done
+func (b *PostgresBroker) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, b.DSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{NotifyChannel}.Sanitize()); err != nil {
+		return err
+	}
+	logrus.WithField("channel", NotifyChannel).Info("Listening for event notifications")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		id, err := uuid.Parse(notification.Payload)
+		if err != nil {
+			logrus.WithError(err).WithField("payload", notification.Payload).Warn("Invalid event notification")
+			continue
+		}
+		var event models.Event
+		if err := b.DB.First(&event, "id = ?", id).Error; err != nil {
+			return err
+		}
+		b.publish(event)
+	}
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrPrivateAddress is returned for webhook hosts with addresses that aren't
+// publicly routable, so that webhooks can't be used to reach the service's
+// own network
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// Resolver looks up the addresses of a host, as net.Resolver does
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// PublicAddress reports whether ip may be the target of a webhook. Loopback,
+// private, link-local, multicast and unspecified addresses are not.
+func PublicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// CheckHost resolves the host of a webhook URL and returns ErrPrivateAddress
+// if any of its addresses isn't public
+func CheckHost(ctx context.Context, resolver Resolver, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !PublicAddress(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !PublicAddress(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to addresses that aren't public. Checking
+// the address being dialed, rather than the host of the URL, also covers
+// hosts whose DNS records changed after the webhook was registered.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !PublicAddress(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckHost(t *testing.T) {
+	ctx := context.Background()
+	resolver := staticResolver{
+		"hooks.example.com":    {{IP: net.ParseIP("93.184.216.34")}},
+		"internal.example.com": {{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("10.0.0.5")}},
+	}
+
+	assert.NoError(t, CheckHost(ctx, resolver, "hooks.example.com"), "Expected a public host to be accepted")
+	assert.NoError(t, CheckHost(ctx, resolver, "93.184.216.34"), "Expected a public address to be accepted")
+	assert.NoError(t, CheckHost(ctx, resolver, "2606:2800:220:1::1"), "Expected a public IPv6 address to be accepted")
+	for _, host := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1", "internal.example.com"} {
+		assert.ErrorIs(t, CheckHost(ctx, resolver, host), ErrPrivateAddress, "Expected %s to be refused", host)
+	}
+	assert.Error(t, CheckHost(ctx, resolver, "missing.example.com"), "Expected unknown hosts to be refused")
+}
+
+// staticResolver resolves hosts from a map
+type staticResolver map[string][]net.IPAddr
+
+func (r staticResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if addrs, ok := r[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
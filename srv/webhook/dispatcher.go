@@ -0,0 +1,237 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"srv/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Dispatcher fans the events in the outbox out to deliveries for the matching
+// webhooks and attempts the due deliveries. Both steps claim rows with
+// conditional updates, so several instances of the service can dispatch
+// concurrently without sending an event twice.
+type Dispatcher struct {
+	DB     *gorm.DB
+	Client *http.Client
+	// MaxAttempts is the number of attempts after which a delivery is dead
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles with each
+	// failed attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// BatchSize is the number of events or deliveries handled per run
+	BatchSize int
+}
+
+// NewDispatcher creates a dispatcher whose requests time out after timeout
+// and which gives up on a delivery after maxAttempts
+func NewDispatcher(db *gorm.DB, timeout time.Duration, maxAttempts int, backoff time.Duration) *Dispatcher {
+	return &Dispatcher{
+		DB: db,
+		Client: &http.Client{
+			Timeout: timeout,
+			// Requests only go to public addresses, checked when dialing, and
+			// not through a proxy, which would be dialed instead
+			Transport: &http.Transport{
+				DialContext:         (&net.Dialer{Timeout: timeout, Control: dialControl}).DialContext,
+				TLSHandshakeTimeout: timeout,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// Redirects are failures rather than followed to another URL
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+		MaxBackoff:  time.Hour,
+		BatchSize:   100,
+	}
+}
+
+// RunPeriodically queues and delivers events every interval, forever
+func (d *Dispatcher) RunPeriodically(interval time.Duration) {
+	for {
+		if queued, err := d.QueueEvents(); err != nil {
+			logrus.WithError(err).Error("Failed to queue webhook deliveries")
+		} else if queued > 0 {
+			logrus.WithField("deliveries", queued).Info("Queued webhook deliveries")
+		}
+		if _, err := d.DeliverDue(context.Background()); err != nil {
+			logrus.WithError(err).Error("Failed to deliver webhooks")
+		}
+		time.Sleep(interval)
+	}
+}
+
+// QueueEvents marks undispatched events as dispatched and creates a pending
+// delivery for each active webhook of their user subscribed to them. It
+// returns the number of deliveries created.
+func (d *Dispatcher) QueueEvents() (int, error) {
+	var events []models.Event
+	if err := d.DB.Where("dispatched_at IS NULL").Order("created_at, id").Limit(d.BatchSize).Find(&events).Error; err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, event := range events {
+		err := d.DB.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			claim := tx.Model(&models.Event{}).Where("id = ? AND dispatched_at IS NULL", event.ID).Update("dispatched_at", now)
+			if claim.Error != nil || claim.RowsAffected == 0 {
+				return claim.Error
+			}
+
+			var webhooks []models.Webhook
+			if err := tx.Where("user_id = ? AND active = ?", event.UserID, true).Find(&webhooks).Error; err != nil {
+				return err
+			}
+			for _, webhook := range webhooks {
+				if !webhook.Subscribes(event.Type) {
+					continue
+				}
+				delivery := models.WebhookDelivery{
+					WebhookID:     webhook.ID,
+					EventID:       event.ID,
+					EventType:     event.Type,
+					Status:        models.DeliveryPending,
+					NextAttemptAt: &now,
+				}
+				if err := tx.Create(&delivery).Error; err != nil {
+					return err
+				}
+				queued++
+			}
+			return nil
+		})
+		if err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// DeliverDue attempts the pending deliveries of active webhooks whose next
+// attempt is due and returns the number of attempts made. Failed deliveries
+// are retried with backoff until they run out of attempts.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	active := d.DB.Model(&models.Webhook{}).Select("id").Where("active = ?", true)
+
+	var deliveries []models.WebhookDelivery
+	if err := d.DB.Preload("Webhook").Preload("Event").
+		Where("status = ? AND next_attempt_at <= ? AND webhook_id IN (?)", models.DeliveryPending, time.Now(), active).
+		Order("next_attempt_at, id").Limit(d.BatchSize).
+		Find(&deliveries).Error; err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for _, delivery := range deliveries {
+		// Claim the attempt, pushing the next one past the request's timeout
+		// in case this instance stops before recording the outcome
+		lease := time.Now().Add(d.Client.Timeout + time.Minute)
+		claim := d.DB.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND attempts = ?", delivery.ID, models.DeliveryPending, delivery.Attempts).
+			Updates(map[string]interface{}{"attempts": delivery.Attempts + 1, "next_attempt_at": lease})
+		if claim.Error != nil {
+			return attempted, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		delivery.Attempts++
+		attempted++
+
+		if err := d.DB.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).
+			Updates(d.attempt(ctx, delivery)).Error; err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// attempt sends a delivery's event to its webhook and returns the changes
+// recording the outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery models.WebhookDelivery) map[string]interface{} {
+	now := time.Now()
+	log := logrus.WithFields(logrus.Fields{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"event_id":    delivery.EventID,
+		"attempt":     delivery.Attempts,
+	})
+
+	status, err := d.send(ctx, delivery, now)
+	changes := map[string]interface{}{
+		"last_attempt_at": now,
+		"response_status": nil,
+		"last_error":      "",
+	}
+	if status != 0 {
+		changes["response_status"] = status
+	}
+	if err == nil {
+		log.Info("Delivered webhook")
+		changes["status"] = models.DeliverySucceeded
+		changes["delivered_at"] = now
+		changes["next_attempt_at"] = nil
+		return changes
+	}
+
+	changes["last_error"] = err.Error()
+	if delivery.Attempts >= d.MaxAttempts {
+		log.WithError(err).Warn("Webhook delivery failed for the last time")
+		changes["status"] = models.DeliveryDead
+		changes["next_attempt_at"] = nil
+		return changes
+	}
+	log.WithError(err).Warn("Webhook delivery failed, retrying")
+	changes["next_attempt_at"] = now.Add(d.backoff(delivery.Attempts))
+	return changes
+}
+
+// send posts the signed payload of a delivery's event to its webhook. Any
+// response other than 2xx is an error. Its message only names the status, as
+// it is shown to the webhook's owner and the body could be anything.
+func (d *Dispatcher) send(ctx context.Context, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Event.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(SignatureHeader, Sign(delivery.Webhook.SigningSecret, now, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// backoff returns the delay after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.Backoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		return d.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,268 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"srv/database"
+	"srv/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher(t *testing.T) {
+	// Setup test database
+	db := database.NewTestDB(t)
+	defer database.CleanupTestDB(t, db)
+
+	ctx := context.Background()
+
+	// The endpoint records the requests it receives and responds with the
+	// next of the queued statuses, or 204 once they run out
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	var statuses []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		status := http.StatusNoContent
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("endpoint says no"))
+	}))
+	defer server.Close()
+
+	respond := func(codes ...int) {
+		mu.Lock()
+		defer mu.Unlock()
+		received, bodies, statuses = nil, nil, codes
+	}
+
+	// The test endpoint listens on loopback, which the dispatcher's own
+	// transport refuses to dial
+	dispatcher := NewDispatcher(db, 5*time.Second, 3, time.Minute)
+	dispatcher.Client.Transport = http.DefaultTransport
+
+	setup := func(t *testing.T, events ...string) (models.User, models.Webhook) {
+		database.TruncateTables(t, db)
+		user := models.User{Username: "testuser", Email: "test@example.com"}
+		require.NoError(t, db.Create(&user).Error, "Failed to create test user")
+		webhook := models.Webhook{UserID: user.ID, URL: server.URL, Events: events, Active: true, SigningSecret: "secret"}
+		require.NoError(t, db.Create(&webhook).Error, "Failed to create test webhook")
+		return user, webhook
+	}
+
+	record := func(t *testing.T, action string, resource models.Folder) models.Event {
+		event, err := models.NewEvent(action, resource, resource.UserID, nil)
+		require.NoError(t, err, "Failed to create event")
+		require.NoError(t, db.Create(&event).Error, "Failed to record event")
+		return event
+	}
+
+	// due makes the pending deliveries due, as if their backoff had passed
+	due := func(t *testing.T) {
+		require.NoError(t, db.Model(&models.WebhookDelivery{}).Where("status = ?", models.DeliveryPending).
+			Update("next_attempt_at", time.Now().Add(-time.Second)).Error, "Failed to make deliveries due")
+	}
+
+	delivery := func(t *testing.T) models.WebhookDelivery {
+		var delivery models.WebhookDelivery
+		require.NoError(t, db.First(&delivery).Error, "Failed to find delivery")
+		return delivery
+	}
+
+	t.Run("Deliver", func(t *testing.T) {
+		user, _ := setup(t)
+		respond()
+		event := record(t, models.EventCreated, models.Folder{ID: uuid.New(), Name: "Inbox", UserID: user.ID})
+
+		queued, err := dispatcher.QueueEvents()
+		require.NoError(t, err, "Failed to queue events")
+		assert.Equal(t, 1, queued, "Expected a delivery for the webhook")
+
+		queued, err = dispatcher.QueueEvents()
+		require.NoError(t, err, "Failed to queue events")
+		assert.Equal(t, 0, queued, "Expected the event to be queued once")
+
+		attempted, err := dispatcher.DeliverDue(ctx)
+		require.NoError(t, err, "Failed to deliver")
+		assert.Equal(t, 1, attempted, "Expected one attempt")
+
+		require.Len(t, received, 1, "Expected the endpoint to receive the event")
+		req := received[0]
+		assert.Equal(t, "folder.created", req.Header.Get(EventHeader), "Expected the event type header")
+		assert.Equal(t, delivery(t).ID.String(), req.Header.Get(DeliveryHeader), "Expected the delivery ID header")
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"), "Expected a JSON body")
+		assert.NoError(t, Verify("secret", req.Header.Get(SignatureHeader), bodies[0], time.Minute), "Expected a valid signature")
+
+		var payload struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Data struct {
+				Type       string                 `json:"type"`
+				ID         string                 `json:"id"`
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(bodies[0], &payload), "Failed to decode payload")
+		assert.Equal(t, event.ID.String(), payload.ID, "Expected the event ID")
+		assert.Equal(t, "folder.created", payload.Type, "Expected the event type")
+		assert.Equal(t, "folders", payload.Data.Type, "Expected the folder as data")
+		assert.Equal(t, "Inbox", payload.Data.Attributes["name"], "Expected the folder's attributes")
+
+		d := delivery(t)
+		assert.Equal(t, models.DeliverySucceeded, d.Status, "Expected the delivery to succeed")
+		assert.Equal(t, 1, d.Attempts, "Expected one attempt")
+		require.NotNil(t, d.ResponseStatus, "Expected the response status")
+		assert.Equal(t, http.StatusNoContent, *d.ResponseStatus, "Expected the response status")
+		assert.NotNil(t, d.DeliveredAt, "Expected the delivery time")
+		assert.Nil(t, d.NextAttemptAt, "Expected no further attempt")
+
+		attempted, err = dispatcher.DeliverDue(ctx)
+		require.NoError(t, err, "Failed to deliver")
+		assert.Equal(t, 0, attempted, "Expected no attempt for a delivered event")
+	})
+
+	t.Run("RetryWithBackoff", func(t *testing.T) {
+		user, _ := setup(t)
+		respond(http.StatusInternalServerError)
+		record(t, models.EventUpdated, models.Folder{ID: uuid.New(), Name: "Inbox", UserID: user.ID})
+
+		_, err := dispatcher.QueueEvents()
+		require.NoError(t, err, "Failed to queue events")
+		before := time.Now()
+		_, err = dispatcher.DeliverDue(ctx)
+		require.NoError(t, err, "Failed to deliver")
+
+		d := delivery(t)
+		assert.Equal(t, models.DeliveryPending, d.Status, "Expected the delivery to stay pending")
+		assert.Equal(t, 1, d.Attempts, "Expected one attempt")
+		require.NotNil(t, d.ResponseStatus, "Expected the response status")
+		assert.Equal(t, http.StatusInternalServerError, *d.ResponseStatus, "Expected the response status")
+		assert.Equal(t, "unexpected status 500", d.LastError, "Expected the status without the response body")
+		require.NotNil(t, d.NextAttemptAt, "Expected another attempt")
+		assert.WithinDuration(t, before.Add(time.Minute), *d.NextAttemptAt, 5*time.Second, "Expected the first backoff")
+
+		attempted, err := dispatcher.DeliverDue(ctx)
+		require.NoError(t, err, "Failed to deliver")
+		assert.Equal(t, 0, attempted, "Expected no attempt before the backoff passed")
+
+		due(t)
+		attempted, err = dispatcher.DeliverDue(ctx)
+		require.NoError(t, err, "Failed to deliver")
+		assert.Equal(t, 1, attempted, "Expected a retry once due")
+
+		d = delivery(t)
+		assert.Equal(t, models.DeliverySucceeded, d.Status, "Expected the retry to succeed")
+		assert.Equal(t, 2, d.Attempts, "Expected two attempts")
+		assert.Empty(t, d.LastError, "Expected the error to be cleared")
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		user, _ := setup(t)
+		respond(http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+		record(t, models.EventDeleted, models.Folder{ID: uuid.New(), Name: "Inbox", UserID: user.ID})
+
+		_, err := dispatcher.QueueEvents()
+		require.NoError(t, err, "Failed to queue events")
+		for i := 0; i < 3; i++ {
+			due(t)
+			_, err = dispatcher.DeliverDue(ctx)
+			require.NoError(t, err, "Failed to deliver")
+		}
+
+		d := delivery(t)
+		assert.Equal(t, models.DeliveryDead, d.Status, "Expected the delivery to be dead after the last attempt")
+		assert.Equal(t, 3, d.Attempts, "Expected the maximum attempts")
+		assert.Nil(t, d.NextAttemptAt, "Expected no further attempt")
+
+		due(t)
+		attempted, err := dispatcher.DeliverDue(ctx)
+		require.NoError(t, err, "Failed to deliver")
+		assert.Equal(t, 0, attempted, "Expected dead deliveries not to be attempted")
+		assert.Len(t, received, 3, "Expected three requests")
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		user, webhook := setup(t)
+		redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+		defer redirect.Close()
+		require.NoError(t, db.Model(&webhook).Update("url", redirect.URL).Error, "Failed to update webhook")
+		respond()
+		record(t, models.EventCreated, models.Folder{ID: uuid.New(), Name: "Inbox", UserID: user.ID})
+
+		_, err := dispatcher.QueueEvents()
+		require.NoError(t, err, "Failed to queue events")
+		_, err = dispatcher.DeliverDue(ctx)
+		require.NoError(t, err, "Failed to deliver")
+
+		d := delivery(t)
+		assert.Equal(t, models.DeliveryPending, d.Status, "Expected a redirect to fail")
+		require.NotNil(t, d.ResponseStatus, "Expected the response status")
+		assert.Equal(t, http.StatusFound, *d.ResponseStatus, "Expected the redirect status")
+		assert.Empty(t, received, "Expected the redirect not to be followed")
+	})
+
+	t.Run("PrivateAddress", func(t *testing.T) {
+		user, _ := setup(t)
+		respond()
+		record(t, models.EventCreated, models.Folder{ID: uuid.New(), Name: "Inbox", UserID: user.ID})
+
+		guarded := NewDispatcher(db, 5*time.Second, 3, time.Minute)
+		_, err := guarded.QueueEvents()
+		require.NoError(t, err, "Failed to queue events")
+		_, err = guarded.DeliverDue(ctx)
+		require.NoError(t, err, "Failed to deliver")
+
+		d := delivery(t)
+		assert.Equal(t, models.DeliveryPending, d.Status, "Expected the delivery to fail")
+		assert.Nil(t, d.ResponseStatus, "Expected no response")
+		assert.Contains(t, d.LastError, ErrPrivateAddress.Error(), "Expected the address to be refused")
+		assert.Empty(t, received, "Expected the endpoint not to be reached")
+	})
+
+	t.Run("Subscriptions", func(t *testing.T) {
+		user, _ := setup(t, "document.*", "folder.moved")
+		respond()
+		other := models.User{Username: "otheruser", Email: "other@example.com"}
+		require.NoError(t, db.Create(&other).Error, "Failed to create other user")
+		inactive := models.Webhook{UserID: user.ID, URL: server.URL, Active: false, SigningSecret: "secret"}
+		require.NoError(t, db.Create(&inactive).Error, "Failed to create inactive webhook")
+
+		record(t, models.EventCreated, models.Folder{ID: uuid.New(), Name: "Ignored", UserID: user.ID})
+		record(t, models.EventMoved, models.Folder{ID: uuid.New(), Name: "Moved", UserID: user.ID})
+		record(t, models.EventMoved, models.Folder{ID: uuid.New(), Name: "Other", UserID: other.ID})
+
+		queued, err := dispatcher.QueueEvents()
+		require.NoError(t, err, "Failed to queue events")
+		assert.Equal(t, 1, queued, "Expected only the subscribed event of the user to be queued")
+
+		var undispatched int64
+		require.NoError(t, db.Model(&models.Event{}).Where("dispatched_at IS NULL").Count(&undispatched).Error, "Failed to count events")
+		assert.Equal(t, int64(0), undispatched, "Expected every event to be dispatched")
+
+		assert.Equal(t, "folder.moved", delivery(t).EventType, "Expected the moved event")
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		d := Dispatcher{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+		assert.Equal(t, time.Second, d.backoff(1), "Expected the base delay after the first attempt")
+		assert.Equal(t, 2*time.Second, d.backoff(2), "Expected the delay to double")
+		assert.Equal(t, 8*time.Second, d.backoff(4), "Expected the delay to keep doubling")
+		assert.Equal(t, 10*time.Second, d.backoff(5), "Expected the delay to be capped")
+		assert.Equal(t, 10*time.Second, d.backoff(60), "Expected the delay to stay capped")
+	})
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"type":"document.created"}`)
+	now := time.Now()
+
+	t.Run("Verify", func(t *testing.T) {
+		header := Sign("secret", now, body)
+		assert.True(t, strings.HasPrefix(header, "t="), "Expected the timestamp first")
+		assert.NoError(t, Verify("secret", header, body, time.Minute), "Expected the signature to verify")
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		timestamp := time.Unix(1700000000, 0)
+		assert.Equal(t, Sign("secret", timestamp, body), Sign("secret", timestamp, body), "Expected the same signature for the same input")
+		assert.NotEqual(t, Sign("secret", timestamp, body), Sign("other", timestamp, body), "Expected the signature to depend on the secret")
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		header := Sign("secret", now, body)
+		assert.Equal(t, ErrInvalidSignature, Verify("secret", header, []byte(`{}`), 0), "Expected a changed body to fail")
+		assert.Equal(t, ErrInvalidSignature, Verify("other", header, body, 0), "Expected another secret to fail")
+		assert.Equal(t, ErrInvalidSignature, Verify("secret", "v1=abc", body, 0), "Expected a missing timestamp to fail")
+		assert.Equal(t, ErrInvalidSignature, Verify("secret", "", body, 0), "Expected an empty header to fail")
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		header := Sign("secret", now.Add(-time.Hour), body)
+		assert.Equal(t, ErrInvalidSignature, Verify("secret", header, body, time.Minute), "Expected an old signature to fail")
+		assert.NoError(t, Verify("secret", header, body, 0), "Expected no tolerance to accept old signatures")
+	})
+
+	t.Run("NewSecret", func(t *testing.T) {
+		a, err := NewSecret()
+		require.NoError(t, err, "Failed to create secret")
+		b, err := NewSecret()
+		require.NoError(t, err, "Failed to create secret")
+		assert.Len(t, a, 43, "Expected 32 random bytes, base64 encoded")
+		assert.NotEqual(t, a, b, "Expected random secrets")
+	})
+}